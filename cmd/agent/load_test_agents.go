@@ -5,18 +5,26 @@ import (
 	"fmt"
 	"log"
 	"math/rand"
+	"os"
+	"runtime"
 	"sync"
 	"time"
 
 	pb "gowatch/gopherwatch/pkg/generated"
 
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
 )
 
+// agentVersion is declared on registration.
+const agentVersion = "1.0.0"
+
 func main() {
 	const agentCount = 150 // <-- Requirement satisfied
 	var wg sync.WaitGroup
 
+	hostname, _ := os.Hostname()
+
 	log.Printf("Starting load test with %d streaming agents...\n", agentCount)
 
 	for i := 0; i < agentCount; i++ {
@@ -37,31 +45,75 @@ func main() {
 
 			client := pb.NewMetricsServiceClient(conn)
 
-			stream, err := client.SendMetrics(context.Background())
+			agentID := fmt.Sprintf("load-agent-%d", id)
+
+			// Register, which also returns the configuration profile of
+			// the agent, then open the control stream so the server can
+			// push commands and changes
+			s := newSettings(300 * time.Millisecond)
+			reg, err := client.Register(context.Background(), &pb.RegisterRequest{
+				AgentId:      agentID,
+				Hostname:     hostname,
+				Os:           runtime.GOOS,
+				AgentVersion: agentVersion,
+				Labels:       map[string]string{"load_test": "true"},
+				Metrics:      []string{"cpu", "memory", "disk", "net_bytes"},
+			})
+			if err != nil {
+				log.Printf("Agent %d registration refused: %v", id, err)
+				return
+			}
+			s.applyConfig(reg.Settings.Config)
+
+			// Both streams speak for the agent with its session
+			ctx := metadata.AppendToOutgoingContext(context.Background(), "session-id", reg.SessionId)
+
+			stream, err := client.SendMetrics(ctx)
 			if err != nil {
 				log.Printf("Agent %d stream error: %v", id, err)
 				return
 			}
 
-			agentID := fmt.Sprintf("load-agent-%d", id)
+			ctrl, err := client.Control(ctx)
+			if err != nil {
+				log.Printf("Agent %d control stream error: %v", id, err)
+				return
+			}
+			hello := &pb.AgentMessage{Body: &pb.AgentMessage_Hello{Hello: &pb.Hello{AgentId: agentID}}}
+			if err := ctrl.Send(hello); err != nil {
+				log.Printf("Agent %d control stream error: %v", id, err)
+				return
+			}
+			go s.follow(ctrl)
 
-			// Continuously send metrics
+			// Continuously send metrics, numbered so the server can
+			// drop replays
+			var seq uint64
+			var netBytes float64
 			for {
+				seq++
+				netBytes += rand.Float64() * 1e6 // counter: only grows
 				metric := &pb.MetricReport{
 					AgentId:     agentID,
+					Sequence:    seq,
 					Timestamp:   time.Now().Unix(),
 					CpuUsage:    50 + rand.Float64()*50, // random 50–100%
 					MemoryUsage: 20 + rand.Float64()*60,
 					DiskUsage:   10 + rand.Float64()*40,
+					NetBytes:    netBytes,
 				}
+				s.mask(metric)
 
 				if err := stream.Send(metric); err != nil {
 					log.Printf("Agent %d send failed: %v", id, err)
 					return
 				}
 
-				// Slow down each agent a bit
-				time.Sleep(300 * time.Millisecond)
+				// Wait for the next interval or an immediate sample request
+				select {
+				case <-time.After(s.next()):
+				case <-s.sampleNow:
+				}
 			}
 
 		}(i)
@@ -70,6 +122,126 @@ func main() {
 	wg.Wait()
 }
 
+// settings are what the server can change through the control stream.
+type settings struct {
+	mu            sync.Mutex
+	defaults      time.Duration // interval without a configuration profile
+	interval      time.Duration
+	disabled      map[string]bool // collectors turned off
+	throttle      float64         // interval multiplier until throttleUntil
+	throttleUntil time.Time
+	sampleNow     chan struct{}
+}
+
+func newSettings(interval time.Duration) *settings {
+	return &settings{defaults: interval, interval: interval, disabled: map[string]bool{}, sampleNow: make(chan struct{}, 1)}
+}
+
+// next returns how long to wait before the next report.
+func (s *settings) next() time.Duration {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if time.Now().Before(s.throttleUntil) {
+		return time.Duration(float64(s.interval) * s.throttle)
+	}
+	return s.interval
+}
+
+// mask zeroes the metrics of disabled collectors and marks them absent, so
+// the server does not take the zeros for samples.
+func (s *settings) mask(metric *pb.MetricReport) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, m := range []struct {
+		name  string
+		value *float64
+	}{
+		{"cpu", &metric.CpuUsage},
+		{"memory", &metric.MemoryUsage},
+		{"disk", &metric.DiskUsage},
+		{"net_bytes", &metric.NetBytes},
+	} {
+		if s.disabled[m.name] {
+			*m.value = 0
+			metric.Absent = append(metric.Absent, m.name)
+		}
+	}
+}
+
+// follow applies the commands of the control stream and acknowledges them.
+func (s *settings) follow(ctrl pb.MetricsService_ControlClient) {
+	for {
+		cmd, err := ctrl.Recv()
+		if err != nil {
+			log.Printf("control stream closed: %v", err)
+			return
+		}
+
+		ack := &pb.CommandAck{CommandId: cmd.Id, Ok: true}
+		if err := s.apply(cmd); err != nil {
+			ack.Ok = false
+			ack.Error = err.Error()
+		}
+		if err := ctrl.Send(&pb.AgentMessage{Body: &pb.AgentMessage_Ack{Ack: ack}}); err != nil {
+			log.Printf("control stream closed: %v", err)
+			return
+		}
+	}
+}
+
+func (s *settings) apply(cmd *pb.Command) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	switch a := cmd.Action.(type) {
+	case *pb.Command_SetInterval:
+		s.interval = time.Duration(a.SetInterval.IntervalMs) * time.Millisecond
+	case *pb.Command_SetCollector:
+		s.disabled[a.SetCollector.Collector] = !a.SetCollector.Enabled
+	case *pb.Command_SampleNow:
+		select {
+		case s.sampleNow <- struct{}{}:
+		default:
+		}
+	case *pb.Command_Throttle:
+		s.throttle = a.Throttle.Factor
+		s.throttleUntil = time.Now().Add(time.Duration(a.Throttle.DurationMs) * time.Millisecond)
+	case *pb.Command_Config:
+		s.configure(a.Config)
+	default:
+		return fmt.Errorf("unsupported command %T", cmd.Action)
+	}
+	return nil
+}
+
+// applyConfig applies a configuration profile from the server.
+func (s *settings) applyConfig(cfg *pb.AgentConfig) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.configure(cfg)
+}
+
+// configure replaces the interval and collectors with those of cfg; an
+// empty profile restores the defaults. Called with s.mu held.
+func (s *settings) configure(cfg *pb.AgentConfig) {
+	s.interval = s.defaults
+	if cfg.IntervalMs > 0 {
+		s.interval = time.Duration(cfg.IntervalMs) * time.Millisecond
+	}
+
+	s.disabled = map[string]bool{}
+	if len(cfg.Collectors) > 0 {
+		for _, c := range []string{"cpu", "memory", "disk", "net_bytes"} {
+			s.disabled[c] = true
+		}
+		for _, c := range cfg.Collectors {
+			s.disabled[c] = false
+		}
+	}
+}
+
 //========================================== FOR A SINGLE AGENT =======================================================
 
 // package main
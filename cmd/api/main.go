@@ -5,10 +5,13 @@ import (
 	"log"
 	"os"
 	"os/signal"
+	"strconv"
 	"syscall"
+	"time"
 
 	"gowatch/internal/database"
 	"gowatch/internal/grpc"
+	"gowatch/internal/tsdb"
 
 	"github.com/joho/godotenv"
 )
@@ -28,10 +31,145 @@ func main() {
 	// Initialize MySQL connection using environment variables
 	// --------------------------------------------------------
 	// NewMySQLService() picks up DB_USER, DB_PASSWORD,
-	// DB_HOST, DB_PORT, DB_NAME from the environment.
-	db, err := database.NewMySQLService()
+	// DB_HOST, DB_PORT, DB_NAME from the environment. MySQL
+	// is required even with METRICS_STORAGE=tsdb: alerts,
+	// silences, maintenance windows, baselines and config
+	// profiles are only stored there.
+	mysql, err := database.NewMySQLService()
 	if err != nil {
-		log.Fatalf("failed to connect to mysql: %v", err)
+		log.Fatalf("failed to connect to mysql (required, also with METRICS_STORAGE=tsdb): %v", err)
+	}
+
+	// --------------------------------------------------------
+	// Choose where metric samples are stored
+	// --------------------------------------------------------
+	// METRICS_STORAGE=tsdb keeps samples in the embedded
+	// time-series engine under TSDB_DIR (default data/tsdb)
+	// instead of the MySQL sample and rollup tables, for
+	// TSDB_RETENTION (default 30 days).
+	var db database.Service = mysql
+
+	if os.Getenv("METRICS_STORAGE") == "tsdb" {
+		dir := os.Getenv("TSDB_DIR")
+		if dir == "" {
+			dir = "data/tsdb"
+		}
+
+		var opts tsdb.Options
+		if raw := os.Getenv("TSDB_RETENTION"); raw != "" {
+			if opts.Retention, err = time.ParseDuration(raw); err != nil {
+				log.Fatalf("invalid TSDB_RETENTION: %v", err)
+			}
+		}
+
+		store, err := database.NewTSDBStore(dir, opts)
+		if err != nil {
+			log.Fatalf("failed to open tsdb: %v", err)
+		}
+		db = database.WithSampleStore(mysql, store)
+	}
+
+	// --------------------------------------------------------
+	// Register notifiers
+	// --------------------------------------------------------
+	// Critical alerts go to ALERT_WEBHOOK_URL and pages also
+	// to PAGER_WEBHOOK_URL; everything is logged regardless.
+	if url := os.Getenv("ALERT_WEBHOOK_URL"); url != "" {
+		grpc.RegisterNotifier("webhook", grpc.NewWebhookNotifier(url))
+	}
+	if url := os.Getenv("PAGER_WEBHOOK_URL"); url != "" {
+		grpc.RegisterNotifier("pager", grpc.NewWebhookNotifier(url))
+	}
+
+	// --------------------------------------------------------
+	// Register the external evaluator
+	// --------------------------------------------------------
+	// Rules with External settings are sent to the
+	// EvaluatorService at EVALUATOR_ADDR; each call blocks the
+	// worker evaluating the report and times out after
+	// EVALUATOR_TIMEOUT (default 1s).
+	if addr := os.Getenv("EVALUATOR_ADDR"); addr != "" {
+		timeout := time.Second
+		if raw := os.Getenv("EVALUATOR_TIMEOUT"); raw != "" {
+			if timeout, err = time.ParseDuration(raw); err != nil {
+				log.Fatalf("invalid EVALUATOR_TIMEOUT: %v", err)
+			}
+		}
+
+		external, err := grpc.NewExternalEvaluator(addr, timeout)
+		if err != nil {
+			log.Fatalf("failed to set up the external evaluator: %v", err)
+		}
+		grpc.RegisterEvaluator(grpc.EvaluatorExternal, external)
+	}
+
+	// Inhibition rules are read from INHIBIT_RULES_FILE, a
+	// JSON list (see grpc.ParseInhibitRules); PUT
+	// /inhibit-rules replaces them until the next restart.
+	if path := os.Getenv("INHIBIT_RULES_FILE"); path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			log.Fatalf("failed to read INHIBIT_RULES_FILE: %v", err)
+		}
+		list, err := grpc.ParseInhibitRules(data)
+		if err != nil {
+			log.Fatalf("invalid INHIBIT_RULES_FILE: %v", err)
+		}
+		if err := grpc.SetInhibitRules(list); err != nil {
+			log.Fatalf("invalid INHIBIT_RULES_FILE: %v", err)
+		}
+	}
+
+	// Alert grouping (group_by and its timers) is read from
+	// GROUPING_FILE (see grpc.ParseGrouping).
+	if path := os.Getenv("GROUPING_FILE"); path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			log.Fatalf("failed to read GROUPING_FILE: %v", err)
+		}
+		cfg, err := grpc.ParseGrouping(data)
+		if err != nil {
+			log.Fatalf("invalid GROUPING_FILE: %v", err)
+		}
+		if err := grpc.SetGrouping(cfg); err != nil {
+			log.Fatalf("invalid GROUPING_FILE: %v", err)
+		}
+	}
+
+	// Escalation policies and the services they apply to are
+	// read from ESCALATION_POLICIES_FILE (see
+	// grpc.ParseEscalationPolicies); rules naming a policy
+	// need it loaded here.
+	if path := os.Getenv("ESCALATION_POLICIES_FILE"); path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			log.Fatalf("failed to read ESCALATION_POLICIES_FILE: %v", err)
+		}
+		cfg, err := grpc.ParseEscalationPolicies(data)
+		if err != nil {
+			log.Fatalf("invalid ESCALATION_POLICIES_FILE: %v", err)
+		}
+		if err := grpc.SetEscalationConfig(cfg); err != nil {
+			log.Fatalf("invalid ESCALATION_POLICIES_FILE: %v", err)
+		}
+	}
+
+	// Agents older than MIN_AGENT_VERSION are refused on
+	// registration (default 1.0.0).
+	if v := os.Getenv("MIN_AGENT_VERSION"); v != "" {
+		if err := grpc.SetMinAgentVersion(v); err != nil {
+			log.Fatalf("invalid MIN_AGENT_VERSION: %v", err)
+		}
+	}
+
+	// REQUIRE_REGISTRATION=true refuses the streams of agents
+	// that did not register.
+	if raw := os.Getenv("REQUIRE_REGISTRATION"); raw != "" {
+		required, err := strconv.ParseBool(raw)
+		if err != nil {
+			log.Fatalf("invalid REQUIRE_REGISTRATION: %v", err)
+		}
+		grpc.SetRequireRegistration(required)
 	}
 
 	// --------------------------------------------------------
@@ -48,6 +186,24 @@ func main() {
 	// we can gracefully shut it down later.
 	grpcServer := grpc.StartGRPCServer(db)
 
+	// --------------------------------------------------------
+	// Start background jobs
+	// --------------------------------------------------------
+	// The rollup job aggregates raw samples into 1m/1h/1d
+	// tables so long-range queries don't scan raw data. The
+	// escalation scheduler notifies the next tier of alerts
+	// left unacknowledged, grouped alert notifications are
+	// sent as their group timers expire, learned anomaly
+	// baselines are saved so restarts keep them, and the
+	// in-memory history of agents that stopped reporting is
+	// dropped.
+	jobsCtx, cancelJobs := context.WithCancel(context.Background())
+	database.StartRollupJob(jobsCtx, db, time.Minute)
+	grpc.StartEscalations(jobsCtx, db, 15*time.Second)
+	grpc.StartGrouping(jobsCtx, time.Second)
+	grpc.StartBaselineSync(jobsCtx, db, time.Minute)
+	grpc.StartHistoryEviction(jobsCtx, time.Minute)
+
 	// --------------------------------------------------------
 	// Graceful Shutdown Handling
 	// --------------------------------------------------------
@@ -55,8 +211,9 @@ func main() {
 	// shut down cleanly:
 	//
 	//   - Stop gRPC server gracefully
+	//   - Let the workers finish the queued reports
+	//   - Stop background jobs and save the baselines
 	//   - Close database connections
-	//   - Close channels
 	//
 	ctx, stop := signal.NotifyContext(
 		context.Background(),
@@ -79,14 +236,30 @@ func main() {
 	grpcServer.GRPC.GracefulStop()
 
 	// --------------------------------------------------------
-	// Close DB connection
+	// Drain the workers
 	// --------------------------------------------------------
-	db.Close()
+	// No stream sends any more: close the metric ingestion
+	// channel and wait for the workers to store and evaluate
+	// what is still queued, while the database is open.
+	grpcServer.StopWorkers()
 
 	// --------------------------------------------------------
-	// Close metric ingestion channel
+	// Stop background jobs
 	// --------------------------------------------------------
-	close(grpc.MetricChan)
+	cancelJobs()
+
+	// Save what the anomaly baselines learned since the last sync,
+	// including from the reports just drained
+	saveCtx, cancelSave := context.WithTimeout(context.Background(), 5*time.Second)
+	if err := grpc.SaveBaselines(saveCtx, db); err != nil {
+		log.Printf("failed to save anomaly baselines: %v", err)
+	}
+	cancelSave()
+
+	// --------------------------------------------------------
+	// Close DB connection
+	// --------------------------------------------------------
+	db.Close()
 
 	log.Println("Shutdown complete")
 }
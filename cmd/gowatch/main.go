@@ -0,0 +1,77 @@
+// Command gowatch holds the tools used around the server.
+//
+//	gowatch rules test <rules.json> <fixtures.json>
+//
+// runs the rules of a rule file against the tests of a fixture file (see
+// internal/ruletest) and exits with status 1 when any test fails.
+package main
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"gowatch/internal/grpc"
+	"gowatch/internal/ruletest"
+)
+
+const usage = "usage: gowatch rules test <rules.json> <fixtures.json>"
+
+func main() {
+	if len(os.Args) != 5 || os.Args[1] != "rules" || os.Args[2] != "test" {
+		fmt.Fprintln(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	if !testRules(os.Args[3], os.Args[4]) {
+		os.Exit(1)
+	}
+}
+
+// testRules runs the fixtures and prints one line per test, followed by
+// its mismatches. It reports whether every test passed.
+func testRules(rulesPath, fixturesPath string) bool {
+	data, err := os.ReadFile(rulesPath)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return false
+	}
+	rules, err := grpc.ParseRules(data)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", rulesPath, err)
+		return false
+	}
+
+	data, err = os.ReadFile(fixturesPath)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return false
+	}
+	fixtures, err := ruletest.Parse(data)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", fixturesPath, err)
+		return false
+	}
+
+	passed := true
+	for _, r := range ruletest.Run(rules, fixtures) {
+		if r.Passed() {
+			fmt.Printf("ok   %s\n", r.Name)
+			continue
+		}
+
+		passed = false
+		fmt.Printf("FAIL %s\n", r.Name)
+		if r.Err != nil {
+			fmt.Printf("  error: %v\n", r.Err)
+		}
+		for _, e := range r.Missing {
+			fmt.Printf("  missing:    %s\n", e)
+		}
+		for _, t := range r.Unexpected {
+			fmt.Printf("  unexpected: +%s %s %q %s (%s, value %.2f)\n",
+				time.Duration(t.At)*time.Second, t.AgentID, t.Rule, t.Kind, t.Severity, t.Value)
+		}
+	}
+	return passed
+}
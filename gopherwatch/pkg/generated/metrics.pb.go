@@ -23,13 +23,25 @@ const (
 )
 
 type MetricReport struct {
-	state         protoimpl.MessageState `protogen:"open.v1"`
-	AgentId       string                 `protobuf:"bytes,1,opt,name=agent_id,json=agentId,proto3" json:"agent_id,omitempty"`
-	Timestamp     int64                  `protobuf:"varint,2,opt,name=timestamp,proto3" json:"timestamp,omitempty"`
-	CpuUsage      float64                `protobuf:"fixed64,3,opt,name=cpu_usage,json=cpuUsage,proto3" json:"cpu_usage,omitempty"`
-	MemoryUsage   float64                `protobuf:"fixed64,4,opt,name=memory_usage,json=memoryUsage,proto3" json:"memory_usage,omitempty"`
-	DiskUsage     float64                `protobuf:"fixed64,5,opt,name=disk_usage,json=diskUsage,proto3" json:"disk_usage,omitempty"`
-	ServiceName   string                 `protobuf:"bytes,6,opt,name=service_name,json=serviceName,proto3" json:"service_name,omitempty"`
+	state       protoimpl.MessageState `protogen:"open.v1"`
+	AgentId     string                 `protobuf:"bytes,1,opt,name=agent_id,json=agentId,proto3" json:"agent_id,omitempty"`
+	Timestamp   int64                  `protobuf:"varint,2,opt,name=timestamp,proto3" json:"timestamp,omitempty"`
+	CpuUsage    float64                `protobuf:"fixed64,3,opt,name=cpu_usage,json=cpuUsage,proto3" json:"cpu_usage,omitempty"`
+	MemoryUsage float64                `protobuf:"fixed64,4,opt,name=memory_usage,json=memoryUsage,proto3" json:"memory_usage,omitempty"`
+	DiskUsage   float64                `protobuf:"fixed64,5,opt,name=disk_usage,json=diskUsage,proto3" json:"disk_usage,omitempty"`
+	ServiceName string                 `protobuf:"bytes,6,opt,name=service_name,json=serviceName,proto3" json:"service_name,omitempty"`
+	// Per-agent sequence number, starting at 1 and growing by one with every
+	// report, kept across reconnects so replayed reports can be recognised.
+	// Registering starts the numbering over at 1. 0 means the report is not
+	// sequenced.
+	Sequence uint64 `protobuf:"varint,7,opt,name=sequence,proto3" json:"sequence,omitempty"`
+	// Bytes sent and received since the agent started: a counter, reset to 0
+	// when the agent restarts.
+	NetBytes float64 `protobuf:"fixed64,8,opt,name=net_bytes,json=netBytes,proto3" json:"net_bytes,omitempty"`
+	// Metrics not collected for this report because their collector is
+	// disabled (cpu, memory, disk, net_bytes). Their fields are 0 and are
+	// neither stored nor evaluated.
+	Absent        []string `protobuf:"bytes,9,rep,name=absent,proto3" json:"absent,omitempty"`
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
 }
@@ -106,9 +118,41 @@ func (x *MetricReport) GetServiceName() string {
 	return ""
 }
 
+func (x *MetricReport) GetSequence() uint64 {
+	if x != nil {
+		return x.Sequence
+	}
+	return 0
+}
+
+func (x *MetricReport) GetNetBytes() float64 {
+	if x != nil {
+		return x.NetBytes
+	}
+	return 0
+}
+
+func (x *MetricReport) GetAbsent() []string {
+	if x != nil {
+		return x.Absent
+	}
+	return nil
+}
+
 type Summary struct {
-	state         protoimpl.MessageState `protogen:"open.v1"`
-	Message       string                 `protobuf:"bytes,1,opt,name=message,proto3" json:"message,omitempty"`
+	state   protoimpl.MessageState `protogen:"open.v1"`
+	Message string                 `protobuf:"bytes,1,opt,name=message,proto3" json:"message,omitempty"`
+	// Highest sequence number up to which every report of the stream's agent
+	// is stored and evaluated; the agent can drop everything up to it from
+	// its spool. The server waits briefly for its workers before answering,
+	// so it can be below the reports just sent. It is only sent when the
+	// agent closes the stream, so a long-lived stream trims its spool by
+	// closing and reopening it.
+	LastAckedSequence uint64 `protobuf:"varint,2,opt,name=last_acked_sequence,json=lastAckedSequence,proto3" json:"last_acked_sequence,omitempty"`
+	// Reports dropped because their sequence was already accepted.
+	Duplicates uint64 `protobuf:"varint,3,opt,name=duplicates,proto3" json:"duplicates,omitempty"`
+	// Sequence numbers skipped on this stream.
+	Missing       uint64 `protobuf:"varint,4,opt,name=missing,proto3" json:"missing,omitempty"`
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
 }
@@ -150,55 +194,1055 @@ func (x *Summary) GetMessage() string {
 	return ""
 }
 
-var File_proto_metrics_proto protoreflect.FileDescriptor
+func (x *Summary) GetLastAckedSequence() uint64 {
+	if x != nil {
+		return x.LastAckedSequence
+	}
+	return 0
+}
 
-const file_proto_metrics_proto_rawDesc = "" +
-	"\n" +
-	"\x13proto/metrics.proto\x12\ametrics\"\xc9\x01\n" +
-	"\fMetricReport\x12\x19\n" +
-	"\bagent_id\x18\x01 \x01(\tR\aagentId\x12\x1c\n" +
-	"\ttimestamp\x18\x02 \x01(\x03R\ttimestamp\x12\x1b\n" +
-	"\tcpu_usage\x18\x03 \x01(\x01R\bcpuUsage\x12!\n" +
-	"\fmemory_usage\x18\x04 \x01(\x01R\vmemoryUsage\x12\x1d\n" +
-	"\n" +
-	"disk_usage\x18\x05 \x01(\x01R\tdiskUsage\x12!\n" +
-	"\fservice_name\x18\x06 \x01(\tR\vserviceName\"#\n" +
-	"\aSummary\x12\x18\n" +
-	"\amessage\x18\x01 \x01(\tR\amessage2J\n" +
-	"\x0eMetricsService\x128\n" +
-	"\vSendMetrics\x12\x15.metrics.MetricReport\x1a\x10.metrics.Summary(\x01B-Z+gowatch/gopherwatch/pkg/generated;generatedb\x06proto3"
+func (x *Summary) GetDuplicates() uint64 {
+	if x != nil {
+		return x.Duplicates
+	}
+	return 0
+}
 
-var (
-	file_proto_metrics_proto_rawDescOnce sync.Once
-	file_proto_metrics_proto_rawDescData []byte
-)
+func (x *Summary) GetMissing() uint64 {
+	if x != nil {
+		return x.Missing
+	}
+	return 0
+}
 
-func file_proto_metrics_proto_rawDescGZIP() []byte {
-	file_proto_metrics_proto_rawDescOnce.Do(func() {
-		file_proto_metrics_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_proto_metrics_proto_rawDesc), len(file_proto_metrics_proto_rawDesc)))
-	})
-	return file_proto_metrics_proto_rawDescData
+type AgentMessage struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// Types that are valid to be assigned to Body:
+	//
+	//	*AgentMessage_Hello
+	//	*AgentMessage_Ack
+	Body          isAgentMessage_Body `protobuf_oneof:"body"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
 }
 
-var file_proto_metrics_proto_msgTypes = make([]protoimpl.MessageInfo, 2)
-var file_proto_metrics_proto_goTypes = []any{
-	(*MetricReport)(nil), // 0: metrics.MetricReport
-	(*Summary)(nil),      // 1: metrics.Summary
+func (x *AgentMessage) Reset() {
+	*x = AgentMessage{}
+	mi := &file_proto_metrics_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
 }
-var file_proto_metrics_proto_depIdxs = []int32{
-	0, // 0: metrics.MetricsService.SendMetrics:input_type -> metrics.MetricReport
-	1, // 1: metrics.MetricsService.SendMetrics:output_type -> metrics.Summary
-	1, // [1:2] is the sub-list for method output_type
-	0, // [0:1] is the sub-list for method input_type
-	0, // [0:0] is the sub-list for extension type_name
-	0, // [0:0] is the sub-list for extension extendee
-	0, // [0:0] is the sub-list for field type_name
+
+func (x *AgentMessage) String() string {
+	return protoimpl.X.MessageStringOf(x)
 }
 
-func init() { file_proto_metrics_proto_init() }
-func file_proto_metrics_proto_init() {
-	if File_proto_metrics_proto != nil {
-		return
+func (*AgentMessage) ProtoMessage() {}
+
+func (x *AgentMessage) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_metrics_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use AgentMessage.ProtoReflect.Descriptor instead.
+func (*AgentMessage) Descriptor() ([]byte, []int) {
+	return file_proto_metrics_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *AgentMessage) GetBody() isAgentMessage_Body {
+	if x != nil {
+		return x.Body
+	}
+	return nil
+}
+
+func (x *AgentMessage) GetHello() *Hello {
+	if x != nil {
+		if x, ok := x.Body.(*AgentMessage_Hello); ok {
+			return x.Hello
+		}
+	}
+	return nil
+}
+
+func (x *AgentMessage) GetAck() *CommandAck {
+	if x != nil {
+		if x, ok := x.Body.(*AgentMessage_Ack); ok {
+			return x.Ack
+		}
+	}
+	return nil
+}
+
+type isAgentMessage_Body interface {
+	isAgentMessage_Body()
+}
+
+type AgentMessage_Hello struct {
+	Hello *Hello `protobuf:"bytes,1,opt,name=hello,proto3,oneof"`
+}
+
+type AgentMessage_Ack struct {
+	Ack *CommandAck `protobuf:"bytes,2,opt,name=ack,proto3,oneof"`
+}
+
+func (*AgentMessage_Hello) isAgentMessage_Body() {}
+
+func (*AgentMessage_Ack) isAgentMessage_Body() {}
+
+type Hello struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	AgentId       string                 `protobuf:"bytes,1,opt,name=agent_id,json=agentId,proto3" json:"agent_id,omitempty"`
+	ServiceName   string                 `protobuf:"bytes,2,opt,name=service_name,json=serviceName,proto3" json:"service_name,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Hello) Reset() {
+	*x = Hello{}
+	mi := &file_proto_metrics_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Hello) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Hello) ProtoMessage() {}
+
+func (x *Hello) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_metrics_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Hello.ProtoReflect.Descriptor instead.
+func (*Hello) Descriptor() ([]byte, []int) {
+	return file_proto_metrics_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *Hello) GetAgentId() string {
+	if x != nil {
+		return x.AgentId
+	}
+	return ""
+}
+
+func (x *Hello) GetServiceName() string {
+	if x != nil {
+		return x.ServiceName
+	}
+	return ""
+}
+
+type CommandAck struct {
+	state     protoimpl.MessageState `protogen:"open.v1"`
+	CommandId string                 `protobuf:"bytes,1,opt,name=command_id,json=commandId,proto3" json:"command_id,omitempty"`
+	Ok        bool                   `protobuf:"varint,2,opt,name=ok,proto3" json:"ok,omitempty"`
+	// Why the agent could not apply the command.
+	Error         string `protobuf:"bytes,3,opt,name=error,proto3" json:"error,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *CommandAck) Reset() {
+	*x = CommandAck{}
+	mi := &file_proto_metrics_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *CommandAck) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*CommandAck) ProtoMessage() {}
+
+func (x *CommandAck) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_metrics_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use CommandAck.ProtoReflect.Descriptor instead.
+func (*CommandAck) Descriptor() ([]byte, []int) {
+	return file_proto_metrics_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *CommandAck) GetCommandId() string {
+	if x != nil {
+		return x.CommandId
+	}
+	return ""
+}
+
+func (x *CommandAck) GetOk() bool {
+	if x != nil {
+		return x.Ok
+	}
+	return false
+}
+
+func (x *CommandAck) GetError() string {
+	if x != nil {
+		return x.Error
+	}
+	return ""
+}
+
+type Command struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	Id    string                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	// Types that are valid to be assigned to Action:
+	//
+	//	*Command_SetInterval
+	//	*Command_SetCollector
+	//	*Command_SampleNow
+	//	*Command_Throttle
+	//	*Command_Config
+	Action        isCommand_Action `protobuf_oneof:"action"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Command) Reset() {
+	*x = Command{}
+	mi := &file_proto_metrics_proto_msgTypes[5]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Command) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Command) ProtoMessage() {}
+
+func (x *Command) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_metrics_proto_msgTypes[5]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Command.ProtoReflect.Descriptor instead.
+func (*Command) Descriptor() ([]byte, []int) {
+	return file_proto_metrics_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *Command) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+func (x *Command) GetAction() isCommand_Action {
+	if x != nil {
+		return x.Action
+	}
+	return nil
+}
+
+func (x *Command) GetSetInterval() *SetInterval {
+	if x != nil {
+		if x, ok := x.Action.(*Command_SetInterval); ok {
+			return x.SetInterval
+		}
+	}
+	return nil
+}
+
+func (x *Command) GetSetCollector() *SetCollector {
+	if x != nil {
+		if x, ok := x.Action.(*Command_SetCollector); ok {
+			return x.SetCollector
+		}
+	}
+	return nil
+}
+
+func (x *Command) GetSampleNow() *SampleNow {
+	if x != nil {
+		if x, ok := x.Action.(*Command_SampleNow); ok {
+			return x.SampleNow
+		}
+	}
+	return nil
+}
+
+func (x *Command) GetThrottle() *Throttle {
+	if x != nil {
+		if x, ok := x.Action.(*Command_Throttle); ok {
+			return x.Throttle
+		}
+	}
+	return nil
+}
+
+func (x *Command) GetConfig() *AgentConfig {
+	if x != nil {
+		if x, ok := x.Action.(*Command_Config); ok {
+			return x.Config
+		}
+	}
+	return nil
+}
+
+type isCommand_Action interface {
+	isCommand_Action()
+}
+
+type Command_SetInterval struct {
+	SetInterval *SetInterval `protobuf:"bytes,2,opt,name=set_interval,json=setInterval,proto3,oneof"`
+}
+
+type Command_SetCollector struct {
+	SetCollector *SetCollector `protobuf:"bytes,3,opt,name=set_collector,json=setCollector,proto3,oneof"`
+}
+
+type Command_SampleNow struct {
+	SampleNow *SampleNow `protobuf:"bytes,4,opt,name=sample_now,json=sampleNow,proto3,oneof"`
+}
+
+type Command_Throttle struct {
+	Throttle *Throttle `protobuf:"bytes,5,opt,name=throttle,proto3,oneof"`
+}
+
+type Command_Config struct {
+	Config *AgentConfig `protobuf:"bytes,6,opt,name=config,proto3,oneof"`
+}
+
+func (*Command_SetInterval) isCommand_Action() {}
+
+func (*Command_SetCollector) isCommand_Action() {}
+
+func (*Command_SampleNow) isCommand_Action() {}
+
+func (*Command_Throttle) isCommand_Action() {}
+
+func (*Command_Config) isCommand_Action() {}
+
+// SetInterval changes how often the agent reports.
+type SetInterval struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	IntervalMs    int64                  `protobuf:"varint,1,opt,name=interval_ms,json=intervalMs,proto3" json:"interval_ms,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *SetInterval) Reset() {
+	*x = SetInterval{}
+	mi := &file_proto_metrics_proto_msgTypes[6]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SetInterval) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SetInterval) ProtoMessage() {}
+
+func (x *SetInterval) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_metrics_proto_msgTypes[6]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SetInterval.ProtoReflect.Descriptor instead.
+func (*SetInterval) Descriptor() ([]byte, []int) {
+	return file_proto_metrics_proto_rawDescGZIP(), []int{6}
+}
+
+func (x *SetInterval) GetIntervalMs() int64 {
+	if x != nil {
+		return x.IntervalMs
+	}
+	return 0
+}
+
+// SetCollector enables or disables one metric (cpu, memory or disk).
+type SetCollector struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Collector     string                 `protobuf:"bytes,1,opt,name=collector,proto3" json:"collector,omitempty"`
+	Enabled       bool                   `protobuf:"varint,2,opt,name=enabled,proto3" json:"enabled,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *SetCollector) Reset() {
+	*x = SetCollector{}
+	mi := &file_proto_metrics_proto_msgTypes[7]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SetCollector) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SetCollector) ProtoMessage() {}
+
+func (x *SetCollector) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_metrics_proto_msgTypes[7]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SetCollector.ProtoReflect.Descriptor instead.
+func (*SetCollector) Descriptor() ([]byte, []int) {
+	return file_proto_metrics_proto_rawDescGZIP(), []int{7}
+}
+
+func (x *SetCollector) GetCollector() string {
+	if x != nil {
+		return x.Collector
+	}
+	return ""
+}
+
+func (x *SetCollector) GetEnabled() bool {
+	if x != nil {
+		return x.Enabled
+	}
+	return false
+}
+
+// SampleNow asks for an immediate report.
+type SampleNow struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *SampleNow) Reset() {
+	*x = SampleNow{}
+	mi := &file_proto_metrics_proto_msgTypes[8]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SampleNow) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SampleNow) ProtoMessage() {}
+
+func (x *SampleNow) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_metrics_proto_msgTypes[8]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SampleNow.ProtoReflect.Descriptor instead.
+func (*SampleNow) Descriptor() ([]byte, []int) {
+	return file_proto_metrics_proto_rawDescGZIP(), []int{8}
+}
+
+// Throttle stretches the reporting interval by factor for a while.
+type Throttle struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Factor        float64                `protobuf:"fixed64,1,opt,name=factor,proto3" json:"factor,omitempty"`
+	DurationMs    int64                  `protobuf:"varint,2,opt,name=duration_ms,json=durationMs,proto3" json:"duration_ms,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Throttle) Reset() {
+	*x = Throttle{}
+	mi := &file_proto_metrics_proto_msgTypes[9]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Throttle) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Throttle) ProtoMessage() {}
+
+func (x *Throttle) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_metrics_proto_msgTypes[9]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Throttle.ProtoReflect.Descriptor instead.
+func (*Throttle) Descriptor() ([]byte, []int) {
+	return file_proto_metrics_proto_rawDescGZIP(), []int{9}
+}
+
+func (x *Throttle) GetFactor() float64 {
+	if x != nil {
+		return x.Factor
+	}
+	return 0
+}
+
+func (x *Throttle) GetDurationMs() int64 {
+	if x != nil {
+		return x.DurationMs
+	}
+	return 0
+}
+
+type ConfigRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	AgentId       string                 `protobuf:"bytes,1,opt,name=agent_id,json=agentId,proto3" json:"agent_id,omitempty"`
+	ServiceName   string                 `protobuf:"bytes,2,opt,name=service_name,json=serviceName,proto3" json:"service_name,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ConfigRequest) Reset() {
+	*x = ConfigRequest{}
+	mi := &file_proto_metrics_proto_msgTypes[10]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ConfigRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ConfigRequest) ProtoMessage() {}
+
+func (x *ConfigRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_metrics_proto_msgTypes[10]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ConfigRequest.ProtoReflect.Descriptor instead.
+func (*ConfigRequest) Descriptor() ([]byte, []int) {
+	return file_proto_metrics_proto_rawDescGZIP(), []int{10}
+}
+
+func (x *ConfigRequest) GetAgentId() string {
+	if x != nil {
+		return x.AgentId
+	}
+	return ""
+}
+
+func (x *ConfigRequest) GetServiceName() string {
+	if x != nil {
+		return x.ServiceName
+	}
+	return ""
+}
+
+// AgentConfig is the configuration profile an agent should run. An empty
+// profile means none applies and the agent keeps its own settings.
+type AgentConfig struct {
+	state      protoimpl.MessageState `protogen:"open.v1"`
+	Profile    string                 `protobuf:"bytes,1,opt,name=profile,proto3" json:"profile,omitempty"`
+	Version    int64                  `protobuf:"varint,2,opt,name=version,proto3" json:"version,omitempty"`
+	IntervalMs int64                  `protobuf:"varint,3,opt,name=interval_ms,json=intervalMs,proto3" json:"interval_ms,omitempty"`
+	// Enabled collectors; empty means all.
+	Collectors    []string `protobuf:"bytes,4,rep,name=collectors,proto3" json:"collectors,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *AgentConfig) Reset() {
+	*x = AgentConfig{}
+	mi := &file_proto_metrics_proto_msgTypes[11]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *AgentConfig) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*AgentConfig) ProtoMessage() {}
+
+func (x *AgentConfig) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_metrics_proto_msgTypes[11]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use AgentConfig.ProtoReflect.Descriptor instead.
+func (*AgentConfig) Descriptor() ([]byte, []int) {
+	return file_proto_metrics_proto_rawDescGZIP(), []int{11}
+}
+
+func (x *AgentConfig) GetProfile() string {
+	if x != nil {
+		return x.Profile
+	}
+	return ""
+}
+
+func (x *AgentConfig) GetVersion() int64 {
+	if x != nil {
+		return x.Version
+	}
+	return 0
+}
+
+func (x *AgentConfig) GetIntervalMs() int64 {
+	if x != nil {
+		return x.IntervalMs
+	}
+	return 0
+}
+
+func (x *AgentConfig) GetCollectors() []string {
+	if x != nil {
+		return x.Collectors
+	}
+	return nil
+}
+
+type RegisterRequest struct {
+	state       protoimpl.MessageState `protogen:"open.v1"`
+	AgentId     string                 `protobuf:"bytes,1,opt,name=agent_id,json=agentId,proto3" json:"agent_id,omitempty"`
+	ServiceName string                 `protobuf:"bytes,2,opt,name=service_name,json=serviceName,proto3" json:"service_name,omitempty"`
+	Hostname    string                 `protobuf:"bytes,3,opt,name=hostname,proto3" json:"hostname,omitempty"`
+	Os          string                 `protobuf:"bytes,4,opt,name=os,proto3" json:"os,omitempty"`
+	// Semantic version of the agent, e.g. "1.4.2".
+	AgentVersion string            `protobuf:"bytes,5,opt,name=agent_version,json=agentVersion,proto3" json:"agent_version,omitempty"`
+	Labels       map[string]string `protobuf:"bytes,6,rep,name=labels,proto3" json:"labels,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"bytes,2,opt,name=value"`
+	// Metrics the agent can collect: cpu, memory, disk.
+	Metrics []string `protobuf:"bytes,7,rep,name=metrics,proto3" json:"metrics,omitempty"`
+	// Session of a previous registration, to take it over after a restart.
+	SessionId     string `protobuf:"bytes,8,opt,name=session_id,json=sessionId,proto3" json:"session_id,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *RegisterRequest) Reset() {
+	*x = RegisterRequest{}
+	mi := &file_proto_metrics_proto_msgTypes[12]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *RegisterRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*RegisterRequest) ProtoMessage() {}
+
+func (x *RegisterRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_metrics_proto_msgTypes[12]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use RegisterRequest.ProtoReflect.Descriptor instead.
+func (*RegisterRequest) Descriptor() ([]byte, []int) {
+	return file_proto_metrics_proto_rawDescGZIP(), []int{12}
+}
+
+func (x *RegisterRequest) GetAgentId() string {
+	if x != nil {
+		return x.AgentId
+	}
+	return ""
+}
+
+func (x *RegisterRequest) GetServiceName() string {
+	if x != nil {
+		return x.ServiceName
+	}
+	return ""
+}
+
+func (x *RegisterRequest) GetHostname() string {
+	if x != nil {
+		return x.Hostname
+	}
+	return ""
+}
+
+func (x *RegisterRequest) GetOs() string {
+	if x != nil {
+		return x.Os
+	}
+	return ""
+}
+
+func (x *RegisterRequest) GetAgentVersion() string {
+	if x != nil {
+		return x.AgentVersion
+	}
+	return ""
+}
+
+func (x *RegisterRequest) GetLabels() map[string]string {
+	if x != nil {
+		return x.Labels
+	}
+	return nil
+}
+
+func (x *RegisterRequest) GetMetrics() []string {
+	if x != nil {
+		return x.Metrics
+	}
+	return nil
+}
+
+func (x *RegisterRequest) GetSessionId() string {
+	if x != nil {
+		return x.SessionId
+	}
+	return ""
+}
+
+type RegisterResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	SessionId     string                 `protobuf:"bytes,1,opt,name=session_id,json=sessionId,proto3" json:"session_id,omitempty"`
+	Settings      *ServerSettings        `protobuf:"bytes,2,opt,name=settings,proto3" json:"settings,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *RegisterResponse) Reset() {
+	*x = RegisterResponse{}
+	mi := &file_proto_metrics_proto_msgTypes[13]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *RegisterResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*RegisterResponse) ProtoMessage() {}
+
+func (x *RegisterResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_metrics_proto_msgTypes[13]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use RegisterResponse.ProtoReflect.Descriptor instead.
+func (*RegisterResponse) Descriptor() ([]byte, []int) {
+	return file_proto_metrics_proto_rawDescGZIP(), []int{13}
+}
+
+func (x *RegisterResponse) GetSessionId() string {
+	if x != nil {
+		return x.SessionId
+	}
+	return ""
+}
+
+func (x *RegisterResponse) GetSettings() *ServerSettings {
+	if x != nil {
+		return x.Settings
+	}
+	return nil
+}
+
+// ServerSettings are what the server expects of a registered agent.
+type ServerSettings struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	ServerVersion string                 `protobuf:"bytes,1,opt,name=server_version,json=serverVersion,proto3" json:"server_version,omitempty"`
+	// The session expires unless the agent reports or keeps its control
+	// stream open within this long.
+	SessionTtlMs  int64        `protobuf:"varint,2,opt,name=session_ttl_ms,json=sessionTtlMs,proto3" json:"session_ttl_ms,omitempty"`
+	Config        *AgentConfig `protobuf:"bytes,3,opt,name=config,proto3" json:"config,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ServerSettings) Reset() {
+	*x = ServerSettings{}
+	mi := &file_proto_metrics_proto_msgTypes[14]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ServerSettings) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ServerSettings) ProtoMessage() {}
+
+func (x *ServerSettings) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_metrics_proto_msgTypes[14]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ServerSettings.ProtoReflect.Descriptor instead.
+func (*ServerSettings) Descriptor() ([]byte, []int) {
+	return file_proto_metrics_proto_rawDescGZIP(), []int{14}
+}
+
+func (x *ServerSettings) GetServerVersion() string {
+	if x != nil {
+		return x.ServerVersion
+	}
+	return ""
+}
+
+func (x *ServerSettings) GetSessionTtlMs() int64 {
+	if x != nil {
+		return x.SessionTtlMs
+	}
+	return 0
+}
+
+func (x *ServerSettings) GetConfig() *AgentConfig {
+	if x != nil {
+		return x.Config
+	}
+	return nil
+}
+
+var File_proto_metrics_proto protoreflect.FileDescriptor
+
+const file_proto_metrics_proto_rawDesc = "" +
+	"\n" +
+	"\x13proto/metrics.proto\x12\ametrics\"\x9a\x02\n" +
+	"\fMetricReport\x12\x19\n" +
+	"\bagent_id\x18\x01 \x01(\tR\aagentId\x12\x1c\n" +
+	"\ttimestamp\x18\x02 \x01(\x03R\ttimestamp\x12\x1b\n" +
+	"\tcpu_usage\x18\x03 \x01(\x01R\bcpuUsage\x12!\n" +
+	"\fmemory_usage\x18\x04 \x01(\x01R\vmemoryUsage\x12\x1d\n" +
+	"\n" +
+	"disk_usage\x18\x05 \x01(\x01R\tdiskUsage\x12!\n" +
+	"\fservice_name\x18\x06 \x01(\tR\vserviceName\x12\x1a\n" +
+	"\bsequence\x18\a \x01(\x04R\bsequence\x12\x1b\n" +
+	"\tnet_bytes\x18\b \x01(\x01R\bnetBytes\x12\x16\n" +
+	"\x06absent\x18\t \x03(\tR\x06absent\"\x8d\x01\n" +
+	"\aSummary\x12\x18\n" +
+	"\amessage\x18\x01 \x01(\tR\amessage\x12.\n" +
+	"\x13last_acked_sequence\x18\x02 \x01(\x04R\x11lastAckedSequence\x12\x1e\n" +
+	"\n" +
+	"duplicates\x18\x03 \x01(\x04R\n" +
+	"duplicates\x12\x18\n" +
+	"\amissing\x18\x04 \x01(\x04R\amissing\"g\n" +
+	"\fAgentMessage\x12&\n" +
+	"\x05hello\x18\x01 \x01(\v2\x0e.metrics.HelloH\x00R\x05hello\x12'\n" +
+	"\x03ack\x18\x02 \x01(\v2\x13.metrics.CommandAckH\x00R\x03ackB\x06\n" +
+	"\x04body\"E\n" +
+	"\x05Hello\x12\x19\n" +
+	"\bagent_id\x18\x01 \x01(\tR\aagentId\x12!\n" +
+	"\fservice_name\x18\x02 \x01(\tR\vserviceName\"Q\n" +
+	"\n" +
+	"CommandAck\x12\x1d\n" +
+	"\n" +
+	"command_id\x18\x01 \x01(\tR\tcommandId\x12\x0e\n" +
+	"\x02ok\x18\x02 \x01(\bR\x02ok\x12\x14\n" +
+	"\x05error\x18\x03 \x01(\tR\x05error\"\xb2\x02\n" +
+	"\aCommand\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id\x129\n" +
+	"\fset_interval\x18\x02 \x01(\v2\x14.metrics.SetIntervalH\x00R\vsetInterval\x12<\n" +
+	"\rset_collector\x18\x03 \x01(\v2\x15.metrics.SetCollectorH\x00R\fsetCollector\x123\n" +
+	"\n" +
+	"sample_now\x18\x04 \x01(\v2\x12.metrics.SampleNowH\x00R\tsampleNow\x12/\n" +
+	"\bthrottle\x18\x05 \x01(\v2\x11.metrics.ThrottleH\x00R\bthrottle\x12.\n" +
+	"\x06config\x18\x06 \x01(\v2\x14.metrics.AgentConfigH\x00R\x06configB\b\n" +
+	"\x06action\".\n" +
+	"\vSetInterval\x12\x1f\n" +
+	"\vinterval_ms\x18\x01 \x01(\x03R\n" +
+	"intervalMs\"F\n" +
+	"\fSetCollector\x12\x1c\n" +
+	"\tcollector\x18\x01 \x01(\tR\tcollector\x12\x18\n" +
+	"\aenabled\x18\x02 \x01(\bR\aenabled\"\v\n" +
+	"\tSampleNow\"C\n" +
+	"\bThrottle\x12\x16\n" +
+	"\x06factor\x18\x01 \x01(\x01R\x06factor\x12\x1f\n" +
+	"\vduration_ms\x18\x02 \x01(\x03R\n" +
+	"durationMs\"M\n" +
+	"\rConfigRequest\x12\x19\n" +
+	"\bagent_id\x18\x01 \x01(\tR\aagentId\x12!\n" +
+	"\fservice_name\x18\x02 \x01(\tR\vserviceName\"\x82\x01\n" +
+	"\vAgentConfig\x12\x18\n" +
+	"\aprofile\x18\x01 \x01(\tR\aprofile\x12\x18\n" +
+	"\aversion\x18\x02 \x01(\x03R\aversion\x12\x1f\n" +
+	"\vinterval_ms\x18\x03 \x01(\x03R\n" +
+	"intervalMs\x12\x1e\n" +
+	"\n" +
+	"collectors\x18\x04 \x03(\tR\n" +
+	"collectors\"\xd2\x02\n" +
+	"\x0fRegisterRequest\x12\x19\n" +
+	"\bagent_id\x18\x01 \x01(\tR\aagentId\x12!\n" +
+	"\fservice_name\x18\x02 \x01(\tR\vserviceName\x12\x1a\n" +
+	"\bhostname\x18\x03 \x01(\tR\bhostname\x12\x0e\n" +
+	"\x02os\x18\x04 \x01(\tR\x02os\x12#\n" +
+	"\ragent_version\x18\x05 \x01(\tR\fagentVersion\x12<\n" +
+	"\x06labels\x18\x06 \x03(\v2$.metrics.RegisterRequest.LabelsEntryR\x06labels\x12\x18\n" +
+	"\ametrics\x18\a \x03(\tR\ametrics\x12\x1d\n" +
+	"\n" +
+	"session_id\x18\b \x01(\tR\tsessionId\x1a9\n" +
+	"\vLabelsEntry\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\tR\x03key\x12\x14\n" +
+	"\x05value\x18\x02 \x01(\tR\x05value:\x028\x01\"f\n" +
+	"\x10RegisterResponse\x12\x1d\n" +
+	"\n" +
+	"session_id\x18\x01 \x01(\tR\tsessionId\x123\n" +
+	"\bsettings\x18\x02 \x01(\v2\x17.metrics.ServerSettingsR\bsettings\"\x8b\x01\n" +
+	"\x0eServerSettings\x12%\n" +
+	"\x0eserver_version\x18\x01 \x01(\tR\rserverVersion\x12$\n" +
+	"\x0esession_ttl_ms\x18\x02 \x01(\x03R\fsessionTtlMs\x12,\n" +
+	"\x06config\x18\x03 \x01(\v2\x14.metrics.AgentConfigR\x06config2\xfe\x01\n" +
+	"\x0eMetricsService\x128\n" +
+	"\vSendMetrics\x12\x15.metrics.MetricReport\x1a\x10.metrics.Summary(\x01\x126\n" +
+	"\aControl\x12\x15.metrics.AgentMessage\x1a\x10.metrics.Command(\x010\x01\x129\n" +
+	"\tGetConfig\x12\x16.metrics.ConfigRequest\x1a\x14.metrics.AgentConfig\x12?\n" +
+	"\bRegister\x12\x18.metrics.RegisterRequest\x1a\x19.metrics.RegisterResponseB-Z+gowatch/gopherwatch/pkg/generated;generatedb\x06proto3"
+
+var (
+	file_proto_metrics_proto_rawDescOnce sync.Once
+	file_proto_metrics_proto_rawDescData []byte
+)
+
+func file_proto_metrics_proto_rawDescGZIP() []byte {
+	file_proto_metrics_proto_rawDescOnce.Do(func() {
+		file_proto_metrics_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_proto_metrics_proto_rawDesc), len(file_proto_metrics_proto_rawDesc)))
+	})
+	return file_proto_metrics_proto_rawDescData
+}
+
+var file_proto_metrics_proto_msgTypes = make([]protoimpl.MessageInfo, 16)
+var file_proto_metrics_proto_goTypes = []any{
+	(*MetricReport)(nil),     // 0: metrics.MetricReport
+	(*Summary)(nil),          // 1: metrics.Summary
+	(*AgentMessage)(nil),     // 2: metrics.AgentMessage
+	(*Hello)(nil),            // 3: metrics.Hello
+	(*CommandAck)(nil),       // 4: metrics.CommandAck
+	(*Command)(nil),          // 5: metrics.Command
+	(*SetInterval)(nil),      // 6: metrics.SetInterval
+	(*SetCollector)(nil),     // 7: metrics.SetCollector
+	(*SampleNow)(nil),        // 8: metrics.SampleNow
+	(*Throttle)(nil),         // 9: metrics.Throttle
+	(*ConfigRequest)(nil),    // 10: metrics.ConfigRequest
+	(*AgentConfig)(nil),      // 11: metrics.AgentConfig
+	(*RegisterRequest)(nil),  // 12: metrics.RegisterRequest
+	(*RegisterResponse)(nil), // 13: metrics.RegisterResponse
+	(*ServerSettings)(nil),   // 14: metrics.ServerSettings
+	nil,                      // 15: metrics.RegisterRequest.LabelsEntry
+}
+var file_proto_metrics_proto_depIdxs = []int32{
+	3,  // 0: metrics.AgentMessage.hello:type_name -> metrics.Hello
+	4,  // 1: metrics.AgentMessage.ack:type_name -> metrics.CommandAck
+	6,  // 2: metrics.Command.set_interval:type_name -> metrics.SetInterval
+	7,  // 3: metrics.Command.set_collector:type_name -> metrics.SetCollector
+	8,  // 4: metrics.Command.sample_now:type_name -> metrics.SampleNow
+	9,  // 5: metrics.Command.throttle:type_name -> metrics.Throttle
+	11, // 6: metrics.Command.config:type_name -> metrics.AgentConfig
+	15, // 7: metrics.RegisterRequest.labels:type_name -> metrics.RegisterRequest.LabelsEntry
+	14, // 8: metrics.RegisterResponse.settings:type_name -> metrics.ServerSettings
+	11, // 9: metrics.ServerSettings.config:type_name -> metrics.AgentConfig
+	0,  // 10: metrics.MetricsService.SendMetrics:input_type -> metrics.MetricReport
+	2,  // 11: metrics.MetricsService.Control:input_type -> metrics.AgentMessage
+	10, // 12: metrics.MetricsService.GetConfig:input_type -> metrics.ConfigRequest
+	12, // 13: metrics.MetricsService.Register:input_type -> metrics.RegisterRequest
+	1,  // 14: metrics.MetricsService.SendMetrics:output_type -> metrics.Summary
+	5,  // 15: metrics.MetricsService.Control:output_type -> metrics.Command
+	11, // 16: metrics.MetricsService.GetConfig:output_type -> metrics.AgentConfig
+	13, // 17: metrics.MetricsService.Register:output_type -> metrics.RegisterResponse
+	14, // [14:18] is the sub-list for method output_type
+	10, // [10:14] is the sub-list for method input_type
+	10, // [10:10] is the sub-list for extension type_name
+	10, // [10:10] is the sub-list for extension extendee
+	0,  // [0:10] is the sub-list for field type_name
+}
+
+func init() { file_proto_metrics_proto_init() }
+func file_proto_metrics_proto_init() {
+	if File_proto_metrics_proto != nil {
+		return
+	}
+	file_proto_metrics_proto_msgTypes[2].OneofWrappers = []any{
+		(*AgentMessage_Hello)(nil),
+		(*AgentMessage_Ack)(nil),
+	}
+	file_proto_metrics_proto_msgTypes[5].OneofWrappers = []any{
+		(*Command_SetInterval)(nil),
+		(*Command_SetCollector)(nil),
+		(*Command_SampleNow)(nil),
+		(*Command_Throttle)(nil),
+		(*Command_Config)(nil),
 	}
 	type x struct{}
 	out := protoimpl.TypeBuilder{
@@ -206,7 +1250,7 @@ func file_proto_metrics_proto_init() {
 			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
 			RawDescriptor: unsafe.Slice(unsafe.StringData(file_proto_metrics_proto_rawDesc), len(file_proto_metrics_proto_rawDesc)),
 			NumEnums:      0,
-			NumMessages:   2,
+			NumMessages:   16,
 			NumExtensions: 0,
 			NumServices:   1,
 		},
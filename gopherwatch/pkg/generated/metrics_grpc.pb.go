@@ -20,6 +20,9 @@ const _ = grpc.SupportPackageIsVersion9
 
 const (
 	MetricsService_SendMetrics_FullMethodName = "/metrics.MetricsService/SendMetrics"
+	MetricsService_Control_FullMethodName     = "/metrics.MetricsService/Control"
+	MetricsService_GetConfig_FullMethodName   = "/metrics.MetricsService/GetConfig"
+	MetricsService_Register_FullMethodName    = "/metrics.MetricsService/Register"
 )
 
 // MetricsServiceClient is the client API for MetricsService service.
@@ -27,6 +30,15 @@ const (
 // For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
 type MetricsServiceClient interface {
 	SendMetrics(ctx context.Context, opts ...grpc.CallOption) (grpc.ClientStreamingClient[MetricReport, Summary], error)
+	// Control keeps a stream open so the server can push commands to the
+	// agent. The agent opens it with a hello and acknowledges every command.
+	Control(ctx context.Context, opts ...grpc.CallOption) (grpc.BidiStreamingClient[AgentMessage, Command], error)
+	// GetConfig returns the configuration profile of the agent; agents fetch
+	// it on connect; changes are pushed over the control stream.
+	GetConfig(ctx context.Context, in *ConfigRequest, opts ...grpc.CallOption) (*AgentConfig, error)
+	// Register opens a session for an agent: it declares who it is and what
+	// it can collect, and gets the settings the server expects it to run.
+	Register(ctx context.Context, in *RegisterRequest, opts ...grpc.CallOption) (*RegisterResponse, error)
 }
 
 type metricsServiceClient struct {
@@ -50,11 +62,53 @@ func (c *metricsServiceClient) SendMetrics(ctx context.Context, opts ...grpc.Cal
 // This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
 type MetricsService_SendMetricsClient = grpc.ClientStreamingClient[MetricReport, Summary]
 
+func (c *metricsServiceClient) Control(ctx context.Context, opts ...grpc.CallOption) (grpc.BidiStreamingClient[AgentMessage, Command], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &MetricsService_ServiceDesc.Streams[1], MetricsService_Control_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[AgentMessage, Command]{ClientStream: stream}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type MetricsService_ControlClient = grpc.BidiStreamingClient[AgentMessage, Command]
+
+func (c *metricsServiceClient) GetConfig(ctx context.Context, in *ConfigRequest, opts ...grpc.CallOption) (*AgentConfig, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(AgentConfig)
+	err := c.cc.Invoke(ctx, MetricsService_GetConfig_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *metricsServiceClient) Register(ctx context.Context, in *RegisterRequest, opts ...grpc.CallOption) (*RegisterResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(RegisterResponse)
+	err := c.cc.Invoke(ctx, MetricsService_Register_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 // MetricsServiceServer is the server API for MetricsService service.
 // All implementations must embed UnimplementedMetricsServiceServer
 // for forward compatibility.
 type MetricsServiceServer interface {
 	SendMetrics(grpc.ClientStreamingServer[MetricReport, Summary]) error
+	// Control keeps a stream open so the server can push commands to the
+	// agent. The agent opens it with a hello and acknowledges every command.
+	Control(grpc.BidiStreamingServer[AgentMessage, Command]) error
+	// GetConfig returns the configuration profile of the agent; agents fetch
+	// it on connect; changes are pushed over the control stream.
+	GetConfig(context.Context, *ConfigRequest) (*AgentConfig, error)
+	// Register opens a session for an agent: it declares who it is and what
+	// it can collect, and gets the settings the server expects it to run.
+	Register(context.Context, *RegisterRequest) (*RegisterResponse, error)
 	mustEmbedUnimplementedMetricsServiceServer()
 }
 
@@ -68,6 +122,15 @@ type UnimplementedMetricsServiceServer struct{}
 func (UnimplementedMetricsServiceServer) SendMetrics(grpc.ClientStreamingServer[MetricReport, Summary]) error {
 	return status.Error(codes.Unimplemented, "method SendMetrics not implemented")
 }
+func (UnimplementedMetricsServiceServer) Control(grpc.BidiStreamingServer[AgentMessage, Command]) error {
+	return status.Error(codes.Unimplemented, "method Control not implemented")
+}
+func (UnimplementedMetricsServiceServer) GetConfig(context.Context, *ConfigRequest) (*AgentConfig, error) {
+	return nil, status.Error(codes.Unimplemented, "method GetConfig not implemented")
+}
+func (UnimplementedMetricsServiceServer) Register(context.Context, *RegisterRequest) (*RegisterResponse, error) {
+	return nil, status.Error(codes.Unimplemented, "method Register not implemented")
+}
 func (UnimplementedMetricsServiceServer) mustEmbedUnimplementedMetricsServiceServer() {}
 func (UnimplementedMetricsServiceServer) testEmbeddedByValue()                        {}
 
@@ -96,19 +159,77 @@ func _MetricsService_SendMetrics_Handler(srv interface{}, stream grpc.ServerStre
 // This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
 type MetricsService_SendMetricsServer = grpc.ClientStreamingServer[MetricReport, Summary]
 
+func _MetricsService_Control_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(MetricsServiceServer).Control(&grpc.GenericServerStream[AgentMessage, Command]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type MetricsService_ControlServer = grpc.BidiStreamingServer[AgentMessage, Command]
+
+func _MetricsService_GetConfig_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ConfigRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(MetricsServiceServer).GetConfig(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: MetricsService_GetConfig_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(MetricsServiceServer).GetConfig(ctx, req.(*ConfigRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _MetricsService_Register_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(RegisterRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(MetricsServiceServer).Register(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: MetricsService_Register_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(MetricsServiceServer).Register(ctx, req.(*RegisterRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 // MetricsService_ServiceDesc is the grpc.ServiceDesc for MetricsService service.
 // It's only intended for direct use with grpc.RegisterService,
 // and not to be introspected or modified (even as a copy)
 var MetricsService_ServiceDesc = grpc.ServiceDesc{
 	ServiceName: "metrics.MetricsService",
 	HandlerType: (*MetricsServiceServer)(nil),
-	Methods:     []grpc.MethodDesc{},
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "GetConfig",
+			Handler:    _MetricsService_GetConfig_Handler,
+		},
+		{
+			MethodName: "Register",
+			Handler:    _MetricsService_Register_Handler,
+		},
+	},
 	Streams: []grpc.StreamDesc{
 		{
 			StreamName:    "SendMetrics",
 			Handler:       _MetricsService_SendMetrics_Handler,
 			ClientStreams: true,
 		},
+		{
+			StreamName:    "Control",
+			Handler:       _MetricsService_Control_Handler,
+			ServerStreams: true,
+			ClientStreams: true,
+		},
 	},
 	Metadata: "proto/metrics.proto",
 }
@@ -0,0 +1,221 @@
+// Package cron parses standard five-field cron expressions
+// ("minute hour day-of-month month day-of-week") used to schedule
+// recurring windows.
+package cron
+
+import (
+	"fmt"
+	"math/bits"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Schedule is a parsed cron expression. Each field is a bit set of the
+// allowed values.
+type Schedule struct {
+	minute uint64 // 0-59
+	hour   uint64 // 0-23
+	dom    uint64 // 1-31
+	month  uint64 // 1-12
+	dow    uint64 // 0-6 (Sunday = 0)
+
+	// Standard cron: when both day fields are restricted, a day matches
+	// if either does.
+	domStar bool
+	dowStar bool
+}
+
+type field struct {
+	name     string
+	min, max int
+	names    map[string]int
+}
+
+var (
+	minuteField = field{name: "minute", min: 0, max: 59}
+	hourField   = field{name: "hour", min: 0, max: 23}
+	domField    = field{name: "day of month", min: 1, max: 31}
+	monthField  = field{name: "month", min: 1, max: 12, names: map[string]int{
+		"JAN": 1, "FEB": 2, "MAR": 3, "APR": 4, "MAY": 5, "JUN": 6,
+		"JUL": 7, "AUG": 8, "SEP": 9, "OCT": 10, "NOV": 11, "DEC": 12,
+	}}
+	// 7 is accepted as Sunday and folded onto 0.
+	dowField = field{name: "day of week", min: 0, max: 7, names: map[string]int{
+		"SUN": 0, "MON": 1, "TUE": 2, "WED": 3, "THU": 4, "FRI": 5, "SAT": 6,
+	}}
+)
+
+// Parse parses a five-field cron expression. Fields accept "*", numbers,
+// names (JAN-DEC, SUN-SAT), ranges "a-b", lists "a,b" and steps "*/n", "a-b/n".
+func Parse(spec string) (Schedule, error) {
+	fields := strings.Fields(spec)
+	if len(fields) != 5 {
+		return Schedule{}, fmt.Errorf("cron: expected 5 fields, got %d in %q", len(fields), spec)
+	}
+
+	var (
+		s   Schedule
+		err error
+	)
+	if s.minute, err = minuteField.parse(fields[0]); err != nil {
+		return Schedule{}, err
+	}
+	if s.hour, err = hourField.parse(fields[1]); err != nil {
+		return Schedule{}, err
+	}
+	if s.dom, err = domField.parse(fields[2]); err != nil {
+		return Schedule{}, err
+	}
+	if s.month, err = monthField.parse(fields[3]); err != nil {
+		return Schedule{}, err
+	}
+	if s.dow, err = dowField.parse(fields[4]); err != nil {
+		return Schedule{}, err
+	}
+
+	// Fold Sunday=7 onto 0.
+	if s.dow&(1<<7) != 0 {
+		s.dow = s.dow&^(1<<7) | 1
+	}
+
+	s.domStar = fields[2] == "*"
+	s.dowStar = fields[4] == "*"
+	return s, nil
+}
+
+func (f field) parse(expr string) (uint64, error) {
+	var bits uint64
+	for _, part := range strings.Split(expr, ",") {
+		b, err := f.parsePart(part)
+		if err != nil {
+			return 0, err
+		}
+		bits |= b
+	}
+	return bits, nil
+}
+
+func (f field) parsePart(part string) (uint64, error) {
+	rng, stepStr, hasStep := strings.Cut(part, "/")
+
+	step := 1
+	if hasStep {
+		n, err := strconv.Atoi(stepStr)
+		if err != nil || n <= 0 {
+			return 0, fmt.Errorf("cron: invalid step %q in %s field", stepStr, f.name)
+		}
+		step = n
+	}
+
+	lo, hi := f.min, f.max
+	switch {
+	case rng == "*":
+	case strings.Contains(rng, "-"):
+		a, b, _ := strings.Cut(rng, "-")
+		var err error
+		if lo, err = f.value(a); err != nil {
+			return 0, err
+		}
+		if hi, err = f.value(b); err != nil {
+			return 0, err
+		}
+		if lo > hi {
+			return 0, fmt.Errorf("cron: invalid range %q in %s field", rng, f.name)
+		}
+	default:
+		v, err := f.value(rng)
+		if err != nil {
+			return 0, err
+		}
+		lo = v
+		if !hasStep {
+			hi = v
+		}
+	}
+
+	var bits uint64
+	for v := lo; v <= hi; v += step {
+		bits |= 1 << uint(v)
+	}
+	return bits, nil
+}
+
+func (f field) value(s string) (int, error) {
+	if v, ok := f.names[strings.ToUpper(s)]; ok {
+		return v, nil
+	}
+
+	v, err := strconv.Atoi(s)
+	if err != nil || v < f.min || v > f.max {
+		return 0, fmt.Errorf("cron: invalid value %q in %s field (%d-%d)", s, f.name, f.min, f.max)
+	}
+	return v, nil
+}
+
+// Matches reports whether the minute containing t is scheduled. t is
+// evaluated in its own location.
+func (s Schedule) Matches(t time.Time) bool {
+	return s.minute&(1<<uint(t.Minute())) != 0 &&
+		s.hour&(1<<uint(t.Hour())) != 0 &&
+		s.dayMatches(t)
+}
+
+// dayMatches reports whether the day containing t is scheduled.
+func (s Schedule) dayMatches(t time.Time) bool {
+	if s.month&(1<<uint(t.Month())) == 0 {
+		return false
+	}
+
+	domOK := s.dom&(1<<uint(t.Day())) != 0
+	dowOK := s.dow&(1<<uint(t.Weekday())) != 0
+
+	if s.domStar || s.dowStar {
+		return domOK && dowOK
+	}
+	return domOK || dowOK
+}
+
+// LastStart returns the most recent scheduled minute in (t-d, t], i.e. the
+// start of a window of length d that contains t, if there is one. It skips
+// unscheduled days and hours whole, so a long d costs a step per day
+// rather than per minute.
+func (s Schedule) LastStart(t time.Time, d time.Duration) (time.Time, bool) {
+	loc := t.Location()
+	c := t.Truncate(time.Minute)
+	for t.Sub(c) < d {
+		y, mon, day := c.Date()
+		if !s.dayMatches(c) {
+			// The last minute of the day before.
+			c = time.Date(y, mon, day, 0, 0, 0, 0, loc).Add(-time.Minute)
+			continue
+		}
+		if h := latest(s.hour, c.Hour()); h != c.Hour() {
+			next := time.Date(y, mon, day, 0, 0, 0, 0, loc).Add(-time.Minute)
+			if h >= 0 {
+				next = time.Date(y, mon, day, h, 59, 0, 0, loc)
+			}
+			// An hour skipped by a DST change normalizes forward.
+			if !next.Before(c) {
+				next = time.Date(y, mon, day, c.Hour(), 0, 0, 0, loc).Add(-time.Minute)
+			}
+			c = next
+			continue
+		}
+		if m := latest(s.minute, c.Minute()); m >= 0 {
+			c = time.Date(y, mon, day, c.Hour(), m, 0, 0, loc)
+			if t.Sub(c) < d {
+				return c, true
+			}
+			break
+		}
+		// The last minute of the hour before.
+		c = time.Date(y, mon, day, c.Hour(), 0, 0, 0, loc).Add(-time.Minute)
+	}
+	return time.Time{}, false
+}
+
+// latest returns the highest value in set not above v, or -1.
+func latest(set uint64, v int) int {
+	return bits.Len64(set&(1<<uint(v+1)-1)) - 1
+}
@@ -0,0 +1,107 @@
+package cron
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseErrors(t *testing.T) {
+	for _, spec := range []string{"", "* * * *", "60 * * * *", "* 24 * * *", "* * 0 * *", "* * * 13 *", "5-1 * * * *", "*/0 * * * *", "* * * * FUNDAY"} {
+		if _, err := Parse(spec); err == nil {
+			t.Errorf("expected %q to fail", spec)
+		}
+	}
+}
+
+func TestMatches(t *testing.T) {
+
+	// Sunday 2024-03-03 02:30 UTC
+	sunday := time.Date(2024, 3, 3, 2, 30, 0, 0, time.UTC)
+
+	cases := []struct {
+		spec string
+		want bool
+	}{
+		{"* * * * *", true},
+		{"30 2 * * SUN", true},
+		{"30 2 * * 7", true}, // 7 is Sunday too
+		{"30 2 * * MON-FRI", false},
+		{"*/15 2 * * *", true},
+		{"*/20 2 * * *", false},
+		{"0-45/10 1-3 * MAR *", true},
+		{"30 2 3 * MON", true}, // dom OR dow when both restricted
+		{"30 2 4 * MON", false},
+		{"30 2 4 * *", false},
+	}
+
+	for _, c := range cases {
+		s, err := Parse(c.spec)
+		if err != nil {
+			t.Fatalf("parse %q: %v", c.spec, err)
+		}
+		if got := s.Matches(sunday); got != c.want {
+			t.Errorf("%q: expected %v; got %v", c.spec, c.want, got)
+		}
+	}
+}
+
+func TestLastStart(t *testing.T) {
+	s, _ := Parse("0 2 * * SUN")
+
+	start := time.Date(2024, 3, 3, 2, 0, 0, 0, time.UTC)
+
+	if got, ok := s.LastStart(start.Add(90*time.Minute), 2*time.Hour); !ok || !got.Equal(start) {
+		t.Errorf("expected window start %v; got %v (%v)", start, got, ok)
+	}
+	if _, ok := s.LastStart(start.Add(2*time.Hour), 2*time.Hour); ok {
+		t.Errorf("expected window to be over after its duration")
+	}
+	if _, ok := s.LastStart(start.Add(-time.Minute), 2*time.Hour); ok {
+		t.Errorf("expected no window before its start")
+	}
+}
+
+func TestLastStartMatchesMinuteScan(t *testing.T) {
+	// scan is the minute-by-minute definition of LastStart.
+	scan := func(s Schedule, t time.Time, d time.Duration) (time.Time, bool) {
+		for c := t.Truncate(time.Minute); t.Sub(c) < d; c = c.Add(-time.Minute) {
+			if s.Matches(c) {
+				return c, true
+			}
+		}
+		return time.Time{}, false
+	}
+
+	ny, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skip("no time zone data")
+	}
+	specs := []string{"0 2 * * SUN", "*/15 9-17 * * MON-FRI", "30 2 * * *", "0 0 1 * *", "0 3 29 2 *", "5,55 */6 13 * FRI"}
+	times := []time.Time{
+		time.Date(2024, 3, 3, 2, 30, 0, 0, time.UTC),
+		time.Date(2024, 3, 10, 3, 45, 0, 0, ny), // after the spring-forward gap
+		time.Date(2024, 11, 3, 1, 30, 0, 0, ny), // in the fall-back hour
+		time.Date(2024, 7, 19, 23, 59, 30, 0, time.UTC),
+	}
+	for _, spec := range specs {
+		s, err := Parse(spec)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, at := range times {
+			for _, d := range []time.Duration{time.Hour, 26 * time.Hour, 7 * 24 * time.Hour, 40 * 24 * time.Hour} {
+				want, wantOK := scan(s, at, d)
+				got, ok := s.LastStart(at, d)
+				if ok != wantOK || !got.Equal(want) {
+					t.Errorf("%q at %v for %v: expected %v (%v); got %v (%v)", spec, at, d, want, wantOK, got, ok)
+				}
+			}
+		}
+	}
+
+	// A yearly schedule is found without scanning the year minute by minute.
+	s, _ := Parse("0 3 29 2 *")
+	if got, ok := s.LastStart(time.Date(2027, 2, 1, 0, 0, 0, 0, time.UTC), 4*366*24*time.Hour); !ok || !got.Equal(time.Date(2024, 2, 29, 3, 0, 0, 0, time.UTC)) {
+		t.Errorf("expected the last leap day; got %v (%v)", got, ok)
+	}
+}
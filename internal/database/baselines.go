@@ -0,0 +1,128 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+)
+
+//
+// -------------------- DATA MODEL --------------------
+//
+
+// Baseline is the learned EWMA mean and variance of one metric of one
+// agent, optionally per seasonal bucket (hour of day, hour of week), with
+// the weight of the samples behind it.
+type Baseline struct {
+	AgentID   string  `json:"agent_id"`
+	Metric    string  `json:"metric"`
+	Season    string  `json:"season"` // "" | hour | week
+	Bucket    int     `json:"bucket"` // hour of day / hour of week; 0 without season
+	Mean      float64 `json:"mean"`
+	Variance  float64 `json:"variance"`
+	Weight    float64 `json:"weight"` // of the samples learned, decayed by their age
+	Count     int64   `json:"count"`  // samples learned
+	UpdatedAt int64   `json:"updated_at"`
+}
+
+//
+// -------------------- SAVE BASELINES --------------------
+//
+
+// baselineBatch bounds the rows of one upsert statement.
+const baselineBatch = 500
+
+// SaveBaselines upserts baselines so anomaly detection keeps its learning
+// across restarts.
+func (s *MySQLService) SaveBaselines(ctx context.Context, baselines []Baseline) error {
+	for len(baselines) > 0 {
+		n := min(len(baselines), baselineBatch)
+		if err := s.saveBaselines(ctx, baselines[:n]); err != nil {
+			return err
+		}
+		baselines = baselines[n:]
+	}
+	return nil
+}
+
+func (s *MySQLService) saveBaselines(ctx context.Context, baselines []Baseline) error {
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	var (
+		sb   strings.Builder
+		args = make([]any, 0, len(baselines)*9)
+	)
+
+	sb.WriteString(`
+        INSERT INTO anomaly_baselines
+            (agent_id, metric, season, bucket, mean, variance, weight, count, updated_at)
+        VALUES `)
+
+	for i, b := range baselines {
+		if i > 0 {
+			sb.WriteString(", ")
+		}
+		sb.WriteString("(?, ?, ?, ?, ?, ?, ?, ?, ?)")
+		args = append(args, b.AgentID, b.Metric, b.Season, b.Bucket, b.Mean, b.Variance, b.Weight, b.Count, b.UpdatedAt)
+	}
+
+	sb.WriteString(`
+        ON DUPLICATE KEY UPDATE
+            mean = VALUES(mean),
+            variance = VALUES(variance),
+            weight = VALUES(weight),
+            count = VALUES(count),
+            updated_at = VALUES(updated_at)`)
+
+	if _, err := s.DB.ExecContext(ctx, sb.String(), args...); err != nil {
+		return fmt.Errorf("save baselines error: %w", err)
+	}
+
+	return nil
+}
+
+//
+// -------------------- LOAD BASELINES --------------------
+//
+
+func (s *MySQLService) LoadBaselines(ctx context.Context) ([]Baseline, error) {
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	query := `
+        SELECT agent_id, metric, season, bucket, mean, variance, weight, count, updated_at
+        FROM anomaly_baselines
+    `
+
+	rows, err := s.DB.QueryContext(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("select baselines error: %w", err)
+	}
+	defer rows.Close()
+
+	var baselines []Baseline
+
+	for rows.Next() {
+		var b Baseline
+		if err := rows.Scan(
+			&b.AgentID,
+			&b.Metric,
+			&b.Season,
+			&b.Bucket,
+			&b.Mean,
+			&b.Variance,
+			&b.Weight,
+			&b.Count,
+			&b.UpdatedAt,
+		); err != nil {
+			return nil, fmt.Errorf("scan baseline error: %w", err)
+		}
+		baselines = append(baselines, b)
+	}
+
+	return baselines, rows.Err()
+}
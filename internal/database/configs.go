@@ -0,0 +1,186 @@
+package database
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+//
+// -------------------- DATA MODEL --------------------
+//
+
+// ConfigProfile is agent configuration distributed by the server. It
+// applies to the agents of ServiceName or to those whose ID matches
+// AgentPattern; Version starts at 1 and grows with every update.
+type ConfigProfile struct {
+	ID           int64    `json:"id"`
+	Name         string   `json:"name"`
+	ServiceName  string   `json:"service_name,omitempty"`
+	AgentPattern string   `json:"agent_pattern,omitempty"` // glob, e.g. "db-*"
+	Interval     string   `json:"interval"`                // Go duration, e.g. "10s"
+	Collectors   []string `json:"collectors"`              // enabled collectors; empty: all
+	Version      int64    `json:"version"`
+	UpdatedBy    string   `json:"updated_by"`
+	UpdatedAt    int64    `json:"updated_at"`
+}
+
+//
+// -------------------- CREATE PROFILE --------------------
+//
+
+func (s *MySQLService) CreateConfigProfile(ctx context.Context, p ConfigProfile) (int64, error) {
+
+	ctx, cancel := context.WithTimeout(ctx, 2*time.Second)
+	defer cancel()
+
+	collectors, err := json.Marshal(p.Collectors)
+	if err != nil {
+		return 0, fmt.Errorf("encode collectors error: %w", err)
+	}
+
+	query := `
+        INSERT INTO agent_configs
+            (name, service_name, agent_pattern, report_interval, collectors, version, updated_by, updated_at)
+        VALUES
+            (?, ?, ?, ?, ?, 1, ?, ?)
+    `
+
+	res, err := s.DB.ExecContext(ctx, query,
+		p.Name,
+		p.ServiceName,
+		p.AgentPattern,
+		p.Interval,
+		string(collectors),
+		p.UpdatedBy,
+		p.UpdatedAt,
+	)
+	if err != nil {
+		return 0, fmt.Errorf("insert config profile error: %w", err)
+	}
+
+	id, err := res.LastInsertId()
+	if err != nil {
+		return 0, fmt.Errorf("insert config profile error: %w", err)
+	}
+
+	return id, nil
+}
+
+//
+// -------------------- UPDATE PROFILE --------------------
+//
+
+// UpdateConfigProfile replaces a profile and bumps its version. Returns
+// false if no profile has that ID.
+func (s *MySQLService) UpdateConfigProfile(ctx context.Context, p ConfigProfile) (bool, error) {
+
+	ctx, cancel := context.WithTimeout(ctx, 2*time.Second)
+	defer cancel()
+
+	collectors, err := json.Marshal(p.Collectors)
+	if err != nil {
+		return false, fmt.Errorf("encode collectors error: %w", err)
+	}
+
+	query := `
+        UPDATE agent_configs
+        SET name = ?, service_name = ?, agent_pattern = ?, report_interval = ?, collectors = ?,
+            version = version + 1, updated_by = ?, updated_at = ?
+        WHERE id = ?
+    `
+
+	res, err := s.DB.ExecContext(ctx, query,
+		p.Name,
+		p.ServiceName,
+		p.AgentPattern,
+		p.Interval,
+		string(collectors),
+		p.UpdatedBy,
+		p.UpdatedAt,
+		p.ID,
+	)
+	if err != nil {
+		return false, fmt.Errorf("update config profile error: %w", err)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("update config profile error: %w", err)
+	}
+
+	return n > 0, nil
+}
+
+//
+// -------------------- LIST PROFILES --------------------
+//
+
+func (s *MySQLService) ListConfigProfiles(ctx context.Context) ([]ConfigProfile, error) {
+
+	ctx, cancel := context.WithTimeout(ctx, 2*time.Second)
+	defer cancel()
+
+	query := `
+        SELECT id, name, service_name, agent_pattern, report_interval, collectors, version, updated_by, updated_at
+        FROM agent_configs
+        ORDER BY id
+    `
+
+	rows, err := s.DB.QueryContext(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("select config profiles error: %w", err)
+	}
+	defer rows.Close()
+
+	var profiles []ConfigProfile
+
+	for rows.Next() {
+		var p ConfigProfile
+		var collectors string
+		if err := rows.Scan(
+			&p.ID,
+			&p.Name,
+			&p.ServiceName,
+			&p.AgentPattern,
+			&p.Interval,
+			&collectors,
+			&p.Version,
+			&p.UpdatedBy,
+			&p.UpdatedAt,
+		); err != nil {
+			return nil, fmt.Errorf("scan config profile error: %w", err)
+		}
+		if err := json.Unmarshal([]byte(collectors), &p.Collectors); err != nil {
+			return nil, fmt.Errorf("decode collectors error: %w", err)
+		}
+		profiles = append(profiles, p)
+	}
+
+	return profiles, rows.Err()
+}
+
+//
+// -------------------- DELETE PROFILE --------------------
+//
+
+// DeleteConfigProfile removes a profile. Returns false if no profile has
+// that ID.
+func (s *MySQLService) DeleteConfigProfile(ctx context.Context, id int64) (bool, error) {
+
+	ctx, cancel := context.WithTimeout(ctx, 2*time.Second)
+	defer cancel()
+
+	res, err := s.DB.ExecContext(ctx, `DELETE FROM agent_configs WHERE id = ?`, id)
+	if err != nil {
+		return false, fmt.Errorf("delete config profile error: %w", err)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("delete config profile error: %w", err)
+	}
+
+	return n > 0, nil
+}
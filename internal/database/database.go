@@ -22,16 +22,83 @@ type Alert struct {
 	Metric      string  `json:"metric"`
 	Value       float64 `json:"value"`
 	Threshold   float64 `json:"threshold"`
-	Timestamp   int64   `json:"timestamp"` // Unix timestamp
+	Severity    string  `json:"severity"`    // info | warning | critical | page
+	Status      string  `json:"status"`      // firing | resolved
+	Flapping    bool    `json:"flapping"`    // notifications muted while oscillating
+	Silenced    bool    `json:"silenced"`    // notifications muted by a silence
+	Maintenance bool    `json:"maintenance"` // notifications muted by a maintenance window
+	Inhibited   bool    `json:"inhibited"`   // notifications muted by another firing alert
+
+	// Incident workflow (see ApplyAlertAction)
+	AcknowledgedBy string `json:"acknowledged_by,omitempty"`
+	AcknowledgedAt int64  `json:"acknowledged_at,omitempty"`
+	Assignee       string `json:"assignee,omitempty"`
+
+	// Escalation tiers already notified (see SetEscalationLevel)
+	EscalationLevel int `json:"escalation_level,omitempty"`
+
+	// Answer of an external detection model when it fired or escalated
+	Score       float64 `json:"score,omitempty"`
+	Explanation string  `json:"explanation,omitempty"`
+
+	Timestamp  int64 `json:"timestamp"`          // Unix timestamp of the report
+	FiredAt    int64 `json:"fired_at,omitempty"` // server time it fired
+	ResolvedAt int64 `json:"resolved_at,omitempty"`
+}
+
+// AlertFilter narrows GetAlertHistory. Zero values match everything.
+type AlertFilter struct {
+	Severity string
+	Status   string
+}
+
+// Sample is a single raw metric value reported by an agent.
+// One MetricReport fans out into one Sample per metric (cpu, memory, disk).
+type Sample struct {
+	AgentID     string  `json:"agent_id"`
+	ServiceName string  `json:"service_name"`
+	Metric      string  `json:"metric"`
+	Value       float64 `json:"value"`
+	Timestamp   int64   `json:"timestamp"`          // Unix timestamp
+	Sequence    uint64  `json:"sequence,omitempty"` // sequence number of the report (0: unknown)
 }
 
 //
 // -------------------- SERVICE INTERFACE --------------------
 //
 
+// SampleStore stores raw metric samples and answers range queries.
+// MySQLService implements it with SQL tables; TSDBStore with the
+// embedded engine in internal/tsdb.
+type SampleStore interface {
+	InsertSamples(ctx context.Context, samples []Sample) error
+	QueryRange(ctx context.Context, q RangeQuery) (RangeResult, error)
+	ListSamples(ctx context.Context, q SampleQuery) ([]Sample, error)
+}
+
 type Service interface {
-	InsertAlert(ctx context.Context, alert Alert) error
-	GetAlertHistory(ctx context.Context) ([]Alert, error)
+	SampleStore
+	InsertAlert(ctx context.Context, alert Alert) (int64, error)
+	UpdateAlert(ctx context.Context, alert Alert) error
+	GetAlertHistory(ctx context.Context, filter AlertFilter) ([]Alert, error)
+	RollupSamples(ctx context.Context, res Resolution, until int64) error
+	CreateSilence(ctx context.Context, silence Silence) (int64, error)
+	ListSilences(ctx context.Context) ([]Silence, error)
+	ExpireSilence(ctx context.Context, id int64, at int64) (bool, error)
+	CreateMaintenanceWindow(ctx context.Context, mw MaintenanceWindow) (int64, error)
+	ListMaintenanceWindows(ctx context.Context) ([]MaintenanceWindow, error)
+	DeleteMaintenanceWindow(ctx context.Context, id int64) (bool, error)
+	GetAlert(ctx context.Context, id int64) (Alert, error)
+	ApplyAlertAction(ctx context.Context, ev AlertEvent) (Alert, error)
+	ListAlertEvents(ctx context.Context, alertID int64) ([]AlertEvent, error)
+	SetEscalationLevel(ctx context.Context, id int64, level int) error
+	SaveBaselines(ctx context.Context, baselines []Baseline) error
+	LoadBaselines(ctx context.Context) ([]Baseline, error)
+	LastSequences(ctx context.Context, since int64) (map[string]uint64, error)
+	CreateConfigProfile(ctx context.Context, p ConfigProfile) (int64, error)
+	UpdateConfigProfile(ctx context.Context, p ConfigProfile) (bool, error)
+	ListConfigProfiles(ctx context.Context) ([]ConfigProfile, error)
+	DeleteConfigProfile(ctx context.Context, id int64) (bool, error)
 	Health() map[string]string
 	Close() error
 }
@@ -76,7 +143,7 @@ func NewMySQLService() (*MySQLService, error) {
 // -------------------- INSERT ALERT --------------------
 //
 
-func (s *MySQLService) InsertAlert(ctx context.Context, alert Alert) error {
+func (s *MySQLService) InsertAlert(ctx context.Context, alert Alert) (int64, error) {
 
 	// Prevent DB hanging forever
 	ctx, cancel := context.WithTimeout(ctx, 2*time.Second)
@@ -86,41 +153,87 @@ func (s *MySQLService) InsertAlert(ctx context.Context, alert Alert) error {
 	// Removed FROM_UNIXTIME()
 	query := `
         INSERT INTO alerts 
-            (agent_id, service_name, rule_name, metric, value, threshold, timestamp)
+            (agent_id, service_name, rule_name, metric, value, threshold, severity, status, flapping, silenced, maintenance, inhibited, score, explanation, timestamp, fired_at, resolved_at)
         VALUES 
-            (?, ?, ?, ?, ?, ?, ?)
+            (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
     `
 
-	_, err := s.DB.ExecContext(ctx, query,
+	res, err := s.DB.ExecContext(ctx, query,
 		alert.AgentID,
 		alert.ServiceName,
 		alert.RuleName,
 		alert.Metric,
 		alert.Value,
 		alert.Threshold,
+		alert.Severity,
+		alert.Status,
+		alert.Flapping,
+		alert.Silenced,
+		alert.Maintenance,
+		alert.Inhibited,
+		alert.Score,
+		alert.Explanation,
 		alert.Timestamp, // Raw Unix time → converted in SQL
+		alert.FiredAt,
+		alert.ResolvedAt,
 	)
 
 	if err != nil {
-		return fmt.Errorf("insert alert error: %w", err)
+		return 0, fmt.Errorf("insert alert error: %w", err)
 	}
 
-	return nil
+	id, err := res.LastInsertId()
+	if err != nil {
+		return 0, fmt.Errorf("insert alert error: %w", err)
+	}
+
+	return id, nil
 }
 
 //
-// -------------------- GET ALERT HISTORY --------------------
+// -------------------- UPDATE ALERT --------------------
 //
 
-func (s *MySQLService) GetAlertHistory(ctx context.Context) ([]Alert, error) {
+// UpdateAlert stores the mutable lifecycle fields of an existing alert.
+func (s *MySQLService) UpdateAlert(ctx context.Context, alert Alert) error {
 
 	ctx, cancel := context.WithTimeout(ctx, 2*time.Second)
 	defer cancel()
 
-	// Return Unix timestamp using UNIX_TIMESTAMP()
-	// Removed UNIX_TIMESTAMP()
 	query := `
-        SELECT 
+        UPDATE alerts
+        SET value = ?, threshold = ?, severity = ?, status = ?, flapping = ?, silenced = ?, maintenance = ?, inhibited = ?, score = ?, explanation = ?, resolved_at = ?
+        WHERE id = ?
+    `
+
+	_, err := s.DB.ExecContext(ctx, query,
+		alert.Value,
+		alert.Threshold,
+		alert.Severity,
+		alert.Status,
+		alert.Flapping,
+		alert.Silenced,
+		alert.Maintenance,
+		alert.Inhibited,
+		alert.Score,
+		alert.Explanation,
+		alert.ResolvedAt,
+		alert.ID,
+	)
+
+	if err != nil {
+		return fmt.Errorf("update alert error: %w", err)
+	}
+
+	return nil
+}
+
+//
+// -------------------- GET ALERT HISTORY --------------------
+//
+
+// alertColumns is the column list scanned by scanAlert.
+const alertColumns = `
             id, 
             agent_id, 
             service_name, 
@@ -128,12 +241,81 @@ func (s *MySQLService) GetAlertHistory(ctx context.Context) ([]Alert, error) {
             metric, 
             value, 
             threshold, 
-            timestamp
+            severity, 
+            status, 
+            flapping, 
+            silenced, 
+            maintenance, 
+            inhibited, 
+            acknowledged_by, 
+            acknowledged_at, 
+            assignee, 
+            escalation_level, 
+            score, 
+            explanation, 
+            timestamp, 
+            fired_at, 
+            resolved_at`
+
+// rowScanner is implemented by *sql.Row and *sql.Rows.
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanAlert(row rowScanner) (Alert, error) {
+	var a Alert
+	err := row.Scan(
+		&a.ID,
+		&a.AgentID,
+		&a.ServiceName,
+		&a.RuleName,
+		&a.Metric,
+		&a.Value,
+		&a.Threshold,
+		&a.Severity,
+		&a.Status,
+		&a.Flapping,
+		&a.Silenced,
+		&a.Maintenance,
+		&a.Inhibited,
+		&a.AcknowledgedBy,
+		&a.AcknowledgedAt,
+		&a.Assignee,
+		&a.EscalationLevel,
+		&a.Score,
+		&a.Explanation,
+		&a.Timestamp,
+		&a.FiredAt,
+		&a.ResolvedAt,
+	)
+	return a, err
+}
+
+func (s *MySQLService) GetAlertHistory(ctx context.Context, filter AlertFilter) ([]Alert, error) {
+
+	ctx, cancel := context.WithTimeout(ctx, 2*time.Second)
+	defer cancel()
+
+	// Return Unix timestamp using UNIX_TIMESTAMP()
+	// Removed UNIX_TIMESTAMP()
+	query := `
+        SELECT ` + alertColumns + `
         FROM alerts
-        ORDER BY id DESC
+        WHERE 1 = 1
     `
 
-	rows, err := s.DB.QueryContext(ctx, query)
+	var args []any
+	if filter.Severity != "" {
+		query += " AND severity = ?"
+		args = append(args, filter.Severity)
+	}
+	if filter.Status != "" {
+		query += " AND status = ?"
+		args = append(args, filter.Status)
+	}
+	query += " ORDER BY id DESC"
+
+	rows, err := s.DB.QueryContext(ctx, query, args...)
 	if err != nil {
 		return nil, fmt.Errorf("select alerts error: %w", err)
 	}
@@ -142,17 +324,8 @@ func (s *MySQLService) GetAlertHistory(ctx context.Context) ([]Alert, error) {
 	var alerts []Alert
 
 	for rows.Next() {
-		var a Alert
-		if err := rows.Scan(
-			&a.ID,
-			&a.AgentID,
-			&a.ServiceName,
-			&a.RuleName,
-			&a.Metric,
-			&a.Value,
-			&a.Threshold,
-			&a.Timestamp,
-		); err != nil {
+		a, err := scanAlert(rows)
+		if err != nil {
 			return nil, fmt.Errorf("scan alert error: %w", err)
 		}
 		alerts = append(alerts, a)
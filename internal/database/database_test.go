@@ -21,19 +21,31 @@ func TestDatabase(t *testing.T) {
 		Metric:      "cpu_usage",
 		Value:       92.5,
 		Threshold:   80.0,
+		Severity:    "critical",
+		Status:      "firing",
 		Timestamp:   time.Now().Unix(),
 	}
 
 	ctx := context.Background()
 
 	t.Run("InsertAlert", func(t *testing.T) {
-		if err := db.InsertAlert(ctx, alert); err != nil {
+		id, err := db.InsertAlert(ctx, alert)
+		if err != nil {
 			t.Fatalf("insert alert failed: %v", err)
 		}
+		alert.ID = id
+	})
+
+	t.Run("UpdateAlert", func(t *testing.T) {
+		alert.Status = "resolved"
+		alert.ResolvedAt = alert.Timestamp + 60
+		if err := db.UpdateAlert(ctx, alert); err != nil {
+			t.Fatalf("update alert failed: %v", err)
+		}
 	})
 
 	t.Run("GetAlertHistory", func(t *testing.T) {
-		alerts, err := db.GetAlertHistory(ctx)
+		alerts, err := db.GetAlertHistory(ctx, AlertFilter{})
 		if err != nil {
 			t.Fatalf("get alert history failed: %v", err)
 		}
@@ -41,4 +53,42 @@ func TestDatabase(t *testing.T) {
 			t.Fatalf("expected alerts but got 0")
 		}
 	})
+
+	t.Run("GetAlertHistoryBySeverity", func(t *testing.T) {
+		alerts, err := db.GetAlertHistory(ctx, AlertFilter{Severity: "critical"})
+		if err != nil {
+			t.Fatalf("get alert history failed: %v", err)
+		}
+		for _, a := range alerts {
+			if a.Severity != "critical" {
+				t.Fatalf("expected only critical alerts but got %q", a.Severity)
+			}
+		}
+	})
+
+	t.Run("InsertSamples", func(t *testing.T) {
+		samples := []Sample{
+			{AgentID: "agent-123", ServiceName: "service-A", Metric: "cpu", Value: 40, Timestamp: alert.Timestamp},
+			{AgentID: "agent-123", ServiceName: "service-A", Metric: "cpu", Value: 60, Timestamp: alert.Timestamp},
+		}
+		if err := db.InsertSamples(ctx, samples); err != nil {
+			t.Fatalf("insert samples failed: %v", err)
+		}
+	})
+
+	t.Run("QueryRange", func(t *testing.T) {
+		res, err := db.QueryRange(ctx, RangeQuery{
+			AgentID: "agent-123",
+			Metric:  "cpu",
+			Start:   alert.Timestamp - 10,
+			End:     alert.Timestamp + 10,
+			Step:    1,
+		})
+		if err != nil {
+			t.Fatalf("range query failed: %v", err)
+		}
+		if res.Resolution != ResolutionRaw.Name || len(res.Points) == 0 {
+			t.Fatalf("expected raw points but got %+v", res)
+		}
+	})
 }
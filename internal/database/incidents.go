@@ -0,0 +1,207 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+//
+// -------------------- DATA MODEL --------------------
+//
+
+// Alert actions recorded in the audit trail.
+const (
+	ActionAcknowledge = "ack"
+	ActionAssign      = "assign"
+	ActionResolve     = "resolve"
+)
+
+// AlertEvent is one entry of an alert's audit trail.
+type AlertEvent struct {
+	ID        int64  `json:"id"`
+	AlertID   int64  `json:"alert_id"`
+	Action    string `json:"action"` // ack | assign | resolve
+	Actor     string `json:"actor"`
+	Assignee  string `json:"assignee,omitempty"` // assign only
+	Comment   string `json:"comment"`
+	CreatedAt int64  `json:"created_at"`
+}
+
+var (
+	// ErrNotFound is returned when a row with the requested ID does not exist.
+	ErrNotFound = errors.New("not found")
+
+	// ErrAlertResolved is returned for actions on an already resolved alert.
+	ErrAlertResolved = errors.New("alert already resolved")
+)
+
+//
+// -------------------- GET ALERT --------------------
+//
+
+func (s *MySQLService) GetAlert(ctx context.Context, id int64) (Alert, error) {
+
+	ctx, cancel := context.WithTimeout(ctx, 2*time.Second)
+	defer cancel()
+
+	row := s.DB.QueryRowContext(ctx, `SELECT `+alertColumns+` FROM alerts WHERE id = ?`, id)
+
+	a, err := scanAlert(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Alert{}, ErrNotFound
+	}
+	if err != nil {
+		return Alert{}, fmt.Errorf("select alert error: %w", err)
+	}
+
+	return a, nil
+}
+
+//
+// -------------------- APPLY ACTION --------------------
+//
+
+// ApplyAlertAction acknowledges, assigns or resolves an alert and records
+// the action in alert_events, atomically. It returns the updated alert.
+func (s *MySQLService) ApplyAlertAction(ctx context.Context, ev AlertEvent) (Alert, error) {
+
+	ctx, cancel := context.WithTimeout(ctx, 2*time.Second)
+	defer cancel()
+
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return Alert{}, fmt.Errorf("alert action error: %w", err)
+	}
+	defer tx.Rollback()
+
+	row := tx.QueryRowContext(ctx, `SELECT `+alertColumns+` FROM alerts WHERE id = ? FOR UPDATE`, ev.AlertID)
+
+	a, err := scanAlert(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Alert{}, ErrNotFound
+	}
+	if err != nil {
+		return Alert{}, fmt.Errorf("alert action error: %w", err)
+	}
+
+	if a.Status == "resolved" {
+		return Alert{}, ErrAlertResolved
+	}
+
+	switch ev.Action {
+	case ActionAcknowledge:
+		a.AcknowledgedBy = ev.Actor
+		a.AcknowledgedAt = ev.CreatedAt
+	case ActionAssign:
+		a.Assignee = ev.Assignee
+	case ActionResolve:
+		a.Status = "resolved"
+		a.ResolvedAt = ev.CreatedAt
+	default:
+		return Alert{}, fmt.Errorf("alert action error: unknown action %q", ev.Action)
+	}
+
+	update := `
+        UPDATE alerts
+        SET acknowledged_by = ?, acknowledged_at = ?, assignee = ?, status = ?, resolved_at = ?
+        WHERE id = ?
+    `
+	if _, err := tx.ExecContext(ctx, update,
+		a.AcknowledgedBy,
+		a.AcknowledgedAt,
+		a.Assignee,
+		a.Status,
+		a.ResolvedAt,
+		a.ID,
+	); err != nil {
+		return Alert{}, fmt.Errorf("alert action error: %w", err)
+	}
+
+	insert := `
+        INSERT INTO alert_events
+            (alert_id, action, actor, assignee, comment, created_at)
+        VALUES
+            (?, ?, ?, ?, ?, ?)
+    `
+	if _, err := tx.ExecContext(ctx, insert,
+		ev.AlertID,
+		ev.Action,
+		ev.Actor,
+		ev.Assignee,
+		ev.Comment,
+		ev.CreatedAt,
+	); err != nil {
+		return Alert{}, fmt.Errorf("alert event error: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return Alert{}, fmt.Errorf("alert action error: %w", err)
+	}
+
+	return a, nil
+}
+
+//
+// -------------------- AUDIT TRAIL --------------------
+//
+
+func (s *MySQLService) ListAlertEvents(ctx context.Context, alertID int64) ([]AlertEvent, error) {
+
+	ctx, cancel := context.WithTimeout(ctx, 2*time.Second)
+	defer cancel()
+
+	query := `
+        SELECT id, alert_id, action, actor, assignee, comment, created_at
+        FROM alert_events
+        WHERE alert_id = ?
+        ORDER BY id
+    `
+
+	rows, err := s.DB.QueryContext(ctx, query, alertID)
+	if err != nil {
+		return nil, fmt.Errorf("select alert events error: %w", err)
+	}
+	defer rows.Close()
+
+	events := []AlertEvent{}
+
+	for rows.Next() {
+		var ev AlertEvent
+		if err := rows.Scan(
+			&ev.ID,
+			&ev.AlertID,
+			&ev.Action,
+			&ev.Actor,
+			&ev.Assignee,
+			&ev.Comment,
+			&ev.CreatedAt,
+		); err != nil {
+			return nil, fmt.Errorf("scan alert event error: %w", err)
+		}
+		events = append(events, ev)
+	}
+
+	return events, rows.Err()
+}
+
+//
+// -------------------- ESCALATION --------------------
+//
+
+// SetEscalationLevel records how many escalation tiers of an alert have
+// been notified, so a restarted server does not notify them again.
+func (s *MySQLService) SetEscalationLevel(ctx context.Context, id int64, level int) error {
+
+	ctx, cancel := context.WithTimeout(ctx, 2*time.Second)
+	defer cancel()
+
+	_, err := s.DB.ExecContext(ctx, `UPDATE alerts SET escalation_level = ? WHERE id = ?`, level, id)
+	if err != nil {
+		return fmt.Errorf("update escalation level error: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,142 @@
+package database
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+//
+// -------------------- DATA MODEL --------------------
+//
+
+// MaintenanceWindow is a recurring window during which notifications of
+// matching alerts are suppressed. A window opens at every minute matched by
+// Schedule (five-field cron, evaluated in Timezone) and lasts Duration.
+type MaintenanceWindow struct {
+	ID        int64     `json:"id"`
+	Name      string    `json:"name"`
+	Schedule  string    `json:"schedule"` // e.g. "0 2 * * SUN"
+	Duration  string    `json:"duration"` // Go duration, e.g. "2h"
+	Timezone  string    `json:"timezone"` // IANA name, default UTC
+	Matchers  []Matcher `json:"matchers"` // usually service_name and/or agent_id
+	CreatedBy string    `json:"created_by"`
+	Comment   string    `json:"comment"`
+	CreatedAt int64     `json:"created_at"`
+}
+
+//
+// -------------------- CREATE WINDOW --------------------
+//
+
+func (s *MySQLService) CreateMaintenanceWindow(ctx context.Context, mw MaintenanceWindow) (int64, error) {
+
+	ctx, cancel := context.WithTimeout(ctx, 2*time.Second)
+	defer cancel()
+
+	matchers, err := json.Marshal(mw.Matchers)
+	if err != nil {
+		return 0, fmt.Errorf("encode matchers error: %w", err)
+	}
+
+	query := `
+        INSERT INTO maintenance_windows
+            (name, schedule, duration, timezone, matchers, created_by, comment, created_at)
+        VALUES
+            (?, ?, ?, ?, ?, ?, ?, ?)
+    `
+
+	res, err := s.DB.ExecContext(ctx, query,
+		mw.Name,
+		mw.Schedule,
+		mw.Duration,
+		mw.Timezone,
+		string(matchers),
+		mw.CreatedBy,
+		mw.Comment,
+		mw.CreatedAt,
+	)
+	if err != nil {
+		return 0, fmt.Errorf("insert maintenance window error: %w", err)
+	}
+
+	id, err := res.LastInsertId()
+	if err != nil {
+		return 0, fmt.Errorf("insert maintenance window error: %w", err)
+	}
+
+	return id, nil
+}
+
+//
+// -------------------- LIST WINDOWS --------------------
+//
+
+func (s *MySQLService) ListMaintenanceWindows(ctx context.Context) ([]MaintenanceWindow, error) {
+
+	ctx, cancel := context.WithTimeout(ctx, 2*time.Second)
+	defer cancel()
+
+	query := `
+        SELECT id, name, schedule, duration, timezone, matchers, created_by, comment, created_at
+        FROM maintenance_windows
+        ORDER BY id
+    `
+
+	rows, err := s.DB.QueryContext(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("select maintenance windows error: %w", err)
+	}
+	defer rows.Close()
+
+	var windows []MaintenanceWindow
+
+	for rows.Next() {
+		var mw MaintenanceWindow
+		var matchers string
+		if err := rows.Scan(
+			&mw.ID,
+			&mw.Name,
+			&mw.Schedule,
+			&mw.Duration,
+			&mw.Timezone,
+			&matchers,
+			&mw.CreatedBy,
+			&mw.Comment,
+			&mw.CreatedAt,
+		); err != nil {
+			return nil, fmt.Errorf("scan maintenance window error: %w", err)
+		}
+		if err := json.Unmarshal([]byte(matchers), &mw.Matchers); err != nil {
+			return nil, fmt.Errorf("decode matchers error: %w", err)
+		}
+		windows = append(windows, mw)
+	}
+
+	return windows, rows.Err()
+}
+
+//
+// -------------------- DELETE WINDOW --------------------
+//
+
+// DeleteMaintenanceWindow removes a window definition. Returns false if no
+// window has that ID.
+func (s *MySQLService) DeleteMaintenanceWindow(ctx context.Context, id int64) (bool, error) {
+
+	ctx, cancel := context.WithTimeout(ctx, 2*time.Second)
+	defer cancel()
+
+	res, err := s.DB.ExecContext(ctx, `DELETE FROM maintenance_windows WHERE id = ?`, id)
+	if err != nil {
+		return false, fmt.Errorf("delete maintenance window error: %w", err)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("delete maintenance window error: %w", err)
+	}
+
+	return n > 0, nil
+}
@@ -0,0 +1,126 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+)
+
+//
+// -------------------- ROLLUP --------------------
+//
+
+// RollupSamples aggregates every complete bucket of res that ends at or before
+// until. It restarts res.Lateness before the newest bucket already stored in
+// the target table, so samples that arrive late (a slow agent, a replayed
+// spool) are still counted; re-running it is idempotent and it catches up
+// after downtime.
+func (s *MySQLService) RollupSamples(ctx context.Context, res Resolution, until int64) error {
+	if res.Seconds <= 0 {
+		return fmt.Errorf("rollup error: %q is not a rollup resolution", res.Name)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	// Watermark: newest bucket already aggregated. The buckets within
+	// res.Lateness of it are aggregated again, as samples may have been
+	// added to them since.
+	var from int64
+	watermark := fmt.Sprintf(`SELECT COALESCE(MAX(bucket), 0) FROM %s`, res.Table)
+	if err := s.DB.QueryRowContext(ctx, watermark).Scan(&from); err != nil {
+		return fmt.Errorf("rollup watermark error: %w", err)
+	}
+	from = max(from-res.Lateness, 0) / res.Seconds * res.Seconds
+
+	// Only complete buckets are rolled up.
+	until = until / res.Seconds * res.Seconds
+	if from >= until {
+		return nil
+	}
+
+	src := res.source()
+
+	var query string
+	if src == ResolutionRaw {
+		query = fmt.Sprintf(`
+        INSERT INTO %s
+            (agent_id, service_name, metric, bucket, min_value, max_value, sum_value, sample_count)
+        SELECT
+            agent_id,
+            MAX(service_name),
+            metric,
+            (timestamp DIV %d) * %d AS b,
+            MIN(value),
+            MAX(value),
+            SUM(value),
+            COUNT(*)
+        FROM metric_samples
+        WHERE timestamp >= ? AND timestamp < ?
+        GROUP BY agent_id, metric, b
+        ON DUPLICATE KEY UPDATE
+            min_value = VALUES(min_value),
+            max_value = VALUES(max_value),
+            sum_value = VALUES(sum_value),
+            sample_count = VALUES(sample_count)
+    `, res.Table, res.Seconds, res.Seconds)
+	} else {
+		query = fmt.Sprintf(`
+        INSERT INTO %s
+            (agent_id, service_name, metric, bucket, min_value, max_value, sum_value, sample_count)
+        SELECT
+            agent_id,
+            MAX(service_name),
+            metric,
+            (bucket DIV %d) * %d AS b,
+            MIN(min_value),
+            MAX(max_value),
+            SUM(sum_value),
+            SUM(sample_count)
+        FROM %s
+        WHERE bucket >= ? AND bucket < ?
+        GROUP BY agent_id, metric, b
+        ON DUPLICATE KEY UPDATE
+            min_value = VALUES(min_value),
+            max_value = VALUES(max_value),
+            sum_value = VALUES(sum_value),
+            sample_count = VALUES(sample_count)
+    `, res.Table, res.Seconds, res.Seconds, src.Table)
+	}
+
+	if _, err := s.DB.ExecContext(ctx, query, from, until); err != nil {
+		return fmt.Errorf("rollup %s error: %w", res.Name, err)
+	}
+
+	return nil
+}
+
+//
+// -------------------- ROLLUP JOB --------------------
+//
+
+// StartRollupJob periodically aggregates stored samples into the 1m/1h/1d
+// rollup tables until ctx is cancelled. Tiers run finest first so each one
+// sees the buckets its source tier just produced.
+func StartRollupJob(ctx context.Context, db Service, interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			now := time.Now().Unix()
+			for _, res := range RollupResolutions {
+				if err := db.RollupSamples(ctx, res, now); err != nil {
+					log.Printf("rollup job: %v", err)
+				}
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
@@ -0,0 +1,320 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+//
+// -------------------- RESOLUTIONS --------------------
+//
+
+// Resolution describes one storage tier for metric samples.
+// Raw samples live in metric_samples; rollup tiers hold pre-aggregated
+// buckets (min, max, sum, count) per agent and metric.
+type Resolution struct {
+	Name     string // "raw", "1m", "1h", "1d"
+	Seconds  int64  // Bucket width in seconds (0 for raw)
+	Table    string // Backing MySQL table
+	Lateness int64  // How far behind the newest bucket samples are still rolled up, in seconds
+}
+
+var (
+	ResolutionRaw = Resolution{Name: "raw", Seconds: 0, Table: "metric_samples"}
+	Resolution1m  = Resolution{Name: "1m", Seconds: 60, Table: "metric_rollups_1m", Lateness: 1800}
+	Resolution1h  = Resolution{Name: "1h", Seconds: 3600, Table: "metric_rollups_1h", Lateness: 2 * 3600}
+	Resolution1d  = Resolution{Name: "1d", Seconds: 86400, Table: "metric_rollups_1d", Lateness: 2 * 86400}
+)
+
+// RollupResolutions lists the rollup tiers from finest to coarsest.
+// Each tier is aggregated from the one before it (1m from raw, 1h from 1m, ...).
+var RollupResolutions = []Resolution{Resolution1m, Resolution1h, Resolution1d}
+
+// ChooseResolution returns the coarsest tier whose bucket width divides the
+// requested step, so every step bucket is made of whole rollup buckets. A
+// step smaller than one minute reads raw samples.
+func ChooseResolution(step int64) Resolution {
+	for i := len(RollupResolutions) - 1; i >= 0; i-- {
+		if res := RollupResolutions[i]; res.Seconds <= step && step%res.Seconds == 0 {
+			return res
+		}
+	}
+	return ResolutionRaw
+}
+
+// ValidateStep checks the step of a range query: it is positive, and from
+// one minute on a whole number of minutes, since 1m buckets cannot be split.
+func ValidateStep(step int64) error {
+	if step <= 0 {
+		return fmt.Errorf("step must be positive")
+	}
+	if m := Resolution1m.Seconds; step >= m && step%m != 0 {
+		return fmt.Errorf("step %ds is not a multiple of %ds; use %d or %d", step, m, step/m*m, (step/m+1)*m)
+	}
+	return nil
+}
+
+// source returns the tier a rollup resolution is aggregated from.
+func (r Resolution) source() Resolution {
+	for i, res := range RollupResolutions {
+		if res.Name == r.Name && i > 0 {
+			return RollupResolutions[i-1]
+		}
+	}
+	return ResolutionRaw
+}
+
+//
+// -------------------- QUERY MODEL --------------------
+//
+
+// RangeQuery selects one metric of one agent over [Start, End),
+// aggregated into buckets of Step seconds.
+type RangeQuery struct {
+	AgentID string
+	Metric  string
+	Start   int64 // Unix timestamp, inclusive
+	End     int64 // Unix timestamp, exclusive
+	Step    int64 // Bucket width in seconds
+}
+
+// Point is one aggregated bucket of a range query.
+type Point struct {
+	Timestamp int64   `json:"timestamp"` // Bucket start (Unix timestamp)
+	Min       float64 `json:"min"`
+	Max       float64 `json:"max"`
+	Avg       float64 `json:"avg"`
+	Sum       float64 `json:"sum"`
+	Count     int64   `json:"count"`
+}
+
+// RangeResult carries the points and the tier they were read from.
+type RangeResult struct {
+	Resolution string  `json:"resolution"`
+	Points     []Point `json:"points"`
+}
+
+// SampleQuery selects the raw samples of every metric over [Start, End),
+// of the given agents (all when empty) and service (any when empty).
+type SampleQuery struct {
+	AgentIDs    []string
+	ServiceName string
+	Start       int64 // Unix timestamp, inclusive
+	End         int64 // Unix timestamp, exclusive
+	Limit       int   // more samples than this is ErrTooManySamples
+}
+
+// ErrTooManySamples is returned when a sample query matches more than its
+// limit.
+var ErrTooManySamples = errors.New("too many samples")
+
+//
+// -------------------- INSERT SAMPLES --------------------
+//
+
+func (s *MySQLService) InsertSamples(ctx context.Context, samples []Sample) error {
+	if len(samples) == 0 {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 2*time.Second)
+	defer cancel()
+
+	placeholders := make([]string, 0, len(samples))
+	args := make([]any, 0, len(samples)*6)
+
+	for _, smp := range samples {
+		placeholders = append(placeholders, "(?, ?, ?, ?, ?, ?)")
+		args = append(args, smp.AgentID, smp.ServiceName, smp.Metric, smp.Value, smp.Timestamp, smp.Sequence)
+	}
+
+	query := `
+        INSERT INTO metric_samples
+            (agent_id, service_name, metric, value, timestamp, sequence)
+        VALUES ` + strings.Join(placeholders, ", ")
+
+	if _, err := s.DB.ExecContext(ctx, query, args...); err != nil {
+		return fmt.Errorf("insert samples error: %w", err)
+	}
+
+	return nil
+}
+
+//
+// -------------------- RANGE QUERY --------------------
+//
+
+// QueryRange reads from the coarsest tier that satisfies q.Step and
+// re-buckets the rows to exactly q.Step seconds.
+func (s *MySQLService) QueryRange(ctx context.Context, q RangeQuery) (RangeResult, error) {
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	if err := ValidateStep(q.Step); err != nil {
+		return RangeResult{}, fmt.Errorf("range query error: %w", err)
+	}
+
+	res := ChooseResolution(q.Step)
+
+	var query string
+	if res == ResolutionRaw {
+		query = `
+        SELECT
+            (timestamp DIV ?) * ? AS bucket,
+            MIN(value),
+            MAX(value),
+            SUM(value),
+            COUNT(*)
+        FROM metric_samples
+        WHERE agent_id = ? AND metric = ? AND timestamp >= ? AND timestamp < ?
+        GROUP BY bucket
+        ORDER BY bucket
+    `
+	} else {
+		query = fmt.Sprintf(`
+        SELECT
+            (bucket DIV ?) * ? AS step_bucket,
+            MIN(min_value),
+            MAX(max_value),
+            SUM(sum_value),
+            SUM(sample_count)
+        FROM %s
+        WHERE agent_id = ? AND metric = ? AND bucket >= ? AND bucket < ?
+        GROUP BY step_bucket
+        ORDER BY step_bucket
+    `, res.Table)
+	}
+
+	// A rollup bucket is stored under its start, so an unaligned Start
+	// would leave out the bucket it falls into.
+	start := q.Start
+	if res.Seconds > 0 {
+		start = start / res.Seconds * res.Seconds
+	}
+
+	rows, err := s.DB.QueryContext(ctx, query, q.Step, q.Step, q.AgentID, q.Metric, start, q.End)
+	if err != nil {
+		return RangeResult{}, fmt.Errorf("range query error: %w", err)
+	}
+	defer rows.Close()
+
+	result := RangeResult{Resolution: res.Name, Points: []Point{}}
+
+	for rows.Next() {
+		var p Point
+		if err := rows.Scan(&p.Timestamp, &p.Min, &p.Max, &p.Sum, &p.Count); err != nil {
+			return RangeResult{}, fmt.Errorf("scan point error: %w", err)
+		}
+		if p.Count > 0 {
+			p.Avg = p.Sum / float64(p.Count)
+		}
+		result.Points = append(result.Points, p)
+	}
+
+	return result, rows.Err()
+}
+
+//
+// -------------------- LIST SAMPLES --------------------
+//
+
+// ListSamples reads raw samples, oldest first.
+func (s *MySQLService) ListSamples(ctx context.Context, q SampleQuery) ([]Sample, error) {
+
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	query := `
+        SELECT agent_id, service_name, metric, value, timestamp, sequence
+        FROM metric_samples
+        WHERE timestamp >= ? AND timestamp < ?`
+	args := []any{q.Start, q.End}
+
+	if len(q.AgentIDs) > 0 {
+		query += " AND agent_id IN (?" + strings.Repeat(", ?", len(q.AgentIDs)-1) + ")"
+		for _, id := range q.AgentIDs {
+			args = append(args, id)
+		}
+	}
+	if q.ServiceName != "" {
+		query += " AND service_name = ?"
+		args = append(args, q.ServiceName)
+	}
+
+	query += " ORDER BY timestamp, id"
+	if q.Limit > 0 {
+		// One more row than the limit tells that it was exceeded.
+		query += " LIMIT ?"
+		args = append(args, q.Limit+1)
+	}
+
+	rows, err := s.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("list samples error: %w", err)
+	}
+	defer rows.Close()
+
+	var samples []Sample
+	for rows.Next() {
+		var smp Sample
+		if err := rows.Scan(&smp.AgentID, &smp.ServiceName, &smp.Metric, &smp.Value, &smp.Timestamp, &smp.Sequence); err != nil {
+			return nil, fmt.Errorf("scan sample error: %w", err)
+		}
+		samples = append(samples, smp)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("list samples error: %w", err)
+	}
+
+	if q.Limit > 0 && len(samples) > q.Limit {
+		return nil, fmt.Errorf("list samples error: %w (limit %d)", ErrTooManySamples, q.Limit)
+	}
+	return samples, nil
+}
+
+//
+// -------------------- LAST SEQUENCES --------------------
+//
+
+// LastSequences returns the sequence of the last sequenced report stored
+// for each agent since the given Unix time, the marks the server resumes
+// deduplicating from after a restart.
+func (s *MySQLService) LastSequences(ctx context.Context, since int64) (map[string]uint64, error) {
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	query := `
+        SELECT s.agent_id, s.sequence
+        FROM metric_samples s
+        JOIN (
+            SELECT agent_id, MAX(id) AS id
+            FROM metric_samples
+            WHERE timestamp >= ? AND sequence > 0
+            GROUP BY agent_id
+        ) last ON s.id = last.id`
+
+	rows, err := s.DB.QueryContext(ctx, query, since)
+	if err != nil {
+		return nil, fmt.Errorf("last sequences error: %w", err)
+	}
+	defer rows.Close()
+
+	marks := map[string]uint64{}
+	for rows.Next() {
+		var agentID string
+		var seq uint64
+		if err := rows.Scan(&agentID, &seq); err != nil {
+			return nil, fmt.Errorf("scan sequence error: %w", err)
+		}
+		marks[agentID] = seq
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("last sequences error: %w", err)
+	}
+	return marks, nil
+}
@@ -0,0 +1,39 @@
+package database
+
+import "testing"
+
+func TestChooseResolution(t *testing.T) {
+
+	cases := []struct {
+		step int64
+		want Resolution
+	}{
+		{1, ResolutionRaw},
+		{30, ResolutionRaw},
+		{60, Resolution1m},
+		{300, Resolution1m},
+		{3600, Resolution1h},
+		{6 * 3600, Resolution1h},
+		{86400, Resolution1d},
+		{7 * 86400, Resolution1d},
+		{90 * 60, Resolution1m}, // 1.5h is not made of whole hours
+		{36 * 3600, Resolution1h},
+	}
+
+	for _, c := range cases {
+		if got := ChooseResolution(c.step); got != c.want {
+			t.Errorf("step %d: expected %s; got %s", c.step, c.want.Name, got.Name)
+		}
+	}
+}
+
+func TestValidateStep(t *testing.T) {
+
+	for step, ok := range map[int64]bool{
+		0: false, -60: false, 1: true, 59: true, 60: true, 90: false, 3600: true, 3630: false,
+	} {
+		if err := ValidateStep(step); (err == nil) != ok {
+			t.Errorf("step %d: expected ok=%v; got %v", step, ok, err)
+		}
+	}
+}
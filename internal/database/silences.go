@@ -0,0 +1,153 @@
+package database
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+//
+// -------------------- DATA MODEL --------------------
+//
+
+// Matcher selects alerts by one label (agent_id, service_name, rule_name,
+// severity, ...). Value is an exact match unless IsRegex is set, in which
+// case it must match the whole label value.
+type Matcher struct {
+	Label   string `json:"label"`
+	Value   string `json:"value"`
+	IsRegex bool   `json:"is_regex"`
+}
+
+// Silence mutes notifications of matching alerts between StartsAt and EndsAt.
+// Matching alerts are still stored, flagged as silenced.
+type Silence struct {
+	ID        int64     `json:"id"`
+	Matchers  []Matcher `json:"matchers"`
+	StartsAt  int64     `json:"starts_at"` // Unix timestamp
+	EndsAt    int64     `json:"ends_at"`   // Unix timestamp
+	CreatedBy string    `json:"created_by"`
+	Comment   string    `json:"comment"`
+	CreatedAt int64     `json:"created_at"`
+}
+
+//
+// -------------------- CREATE SILENCE --------------------
+//
+
+func (s *MySQLService) CreateSilence(ctx context.Context, silence Silence) (int64, error) {
+
+	ctx, cancel := context.WithTimeout(ctx, 2*time.Second)
+	defer cancel()
+
+	matchers, err := json.Marshal(silence.Matchers)
+	if err != nil {
+		return 0, fmt.Errorf("encode matchers error: %w", err)
+	}
+
+	query := `
+        INSERT INTO silences
+            (matchers, starts_at, ends_at, created_by, comment, created_at)
+        VALUES
+            (?, ?, ?, ?, ?, ?)
+    `
+
+	res, err := s.DB.ExecContext(ctx, query,
+		string(matchers),
+		silence.StartsAt,
+		silence.EndsAt,
+		silence.CreatedBy,
+		silence.Comment,
+		silence.CreatedAt,
+	)
+	if err != nil {
+		return 0, fmt.Errorf("insert silence error: %w", err)
+	}
+
+	id, err := res.LastInsertId()
+	if err != nil {
+		return 0, fmt.Errorf("insert silence error: %w", err)
+	}
+
+	return id, nil
+}
+
+//
+// -------------------- LIST SILENCES --------------------
+//
+
+func (s *MySQLService) ListSilences(ctx context.Context) ([]Silence, error) {
+
+	ctx, cancel := context.WithTimeout(ctx, 2*time.Second)
+	defer cancel()
+
+	query := `
+        SELECT id, matchers, starts_at, ends_at, created_by, comment, created_at
+        FROM silences
+        ORDER BY id DESC
+    `
+
+	rows, err := s.DB.QueryContext(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("select silences error: %w", err)
+	}
+	defer rows.Close()
+
+	var silences []Silence
+
+	for rows.Next() {
+		var sl Silence
+		var matchers string
+		if err := rows.Scan(
+			&sl.ID,
+			&matchers,
+			&sl.StartsAt,
+			&sl.EndsAt,
+			&sl.CreatedBy,
+			&sl.Comment,
+			&sl.CreatedAt,
+		); err != nil {
+			return nil, fmt.Errorf("scan silence error: %w", err)
+		}
+		if err := json.Unmarshal([]byte(matchers), &sl.Matchers); err != nil {
+			return nil, fmt.Errorf("decode matchers error: %w", err)
+		}
+		silences = append(silences, sl)
+	}
+
+	return silences, rows.Err()
+}
+
+//
+// -------------------- EXPIRE SILENCE --------------------
+//
+
+// ExpireSilence ends a silence at the given time. Expired silences are kept
+// so the maintenance history stays visible. Returns false if no silence has
+// that ID.
+func (s *MySQLService) ExpireSilence(ctx context.Context, id int64, at int64) (bool, error) {
+
+	ctx, cancel := context.WithTimeout(ctx, 2*time.Second)
+	defer cancel()
+
+	var exists bool
+	if err := s.DB.QueryRowContext(ctx, `SELECT EXISTS(SELECT 1 FROM silences WHERE id = ?)`, id).Scan(&exists); err != nil {
+		return false, fmt.Errorf("expire silence error: %w", err)
+	}
+	if !exists {
+		return false, nil
+	}
+
+	query := `
+        UPDATE silences
+        SET ends_at = LEAST(ends_at, ?), starts_at = LEAST(starts_at, ?)
+        WHERE id = ?
+    `
+
+	if _, err := s.DB.ExecContext(ctx, query, at, at, id); err != nil {
+		return false, fmt.Errorf("expire silence error: %w", err)
+	}
+
+	return true, nil
+}
@@ -0,0 +1,170 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sort"
+
+	"gowatch/internal/tsdb"
+)
+
+//
+// -------------------- TSDB SAMPLE STORE --------------------
+//
+
+// TSDBStore keeps metric samples in the embedded time-series engine instead
+// of MySQL. Range queries are always answered from compressed raw samples,
+// so no rollup tables are needed.
+type TSDBStore struct {
+	DB *tsdb.DB
+}
+
+func NewTSDBStore(dir string, opts tsdb.Options) (*TSDBStore, error) {
+	db, err := tsdb.Open(dir, opts)
+	if err != nil {
+		return nil, fmt.Errorf("tsdb open error: %w", err)
+	}
+	return &TSDBStore{DB: db}, nil
+}
+
+func (s *TSDBStore) InsertSamples(ctx context.Context, samples []Sample) error {
+	batch := make([]tsdb.Sample, 0, len(samples))
+	for _, smp := range samples {
+		batch = append(batch, tsdb.Sample{
+			Agent:   smp.AgentID,
+			Metric:  smp.Metric,
+			Service: smp.ServiceName,
+			T:       smp.Timestamp,
+			V:       smp.Value,
+		})
+	}
+
+	if err := s.DB.Append(batch); err != nil {
+		return fmt.Errorf("insert samples error: %w", err)
+	}
+	return nil
+}
+
+func (s *TSDBStore) QueryRange(ctx context.Context, q RangeQuery) (RangeResult, error) {
+	if q.Step <= 0 {
+		return RangeResult{}, fmt.Errorf("range query error: step must be positive")
+	}
+
+	points, err := s.DB.Select(q.AgentID, q.Metric, q.Start, q.End)
+	if err != nil {
+		return RangeResult{}, fmt.Errorf("range query error: %w", err)
+	}
+
+	result := RangeResult{Resolution: ResolutionRaw.Name, Points: []Point{}}
+
+	// Points are sorted, so buckets are filled one after another.
+	for _, p := range points {
+		bucket := p.T / q.Step * q.Step
+
+		n := len(result.Points)
+		if n == 0 || result.Points[n-1].Timestamp != bucket {
+			result.Points = append(result.Points, Point{Timestamp: bucket, Min: p.V, Max: p.V})
+			n++
+		}
+
+		b := &result.Points[n-1]
+		b.Min = min(b.Min, p.V)
+		b.Max = max(b.Max, p.V)
+		b.Sum += p.V
+		b.Count++
+		b.Avg = b.Sum / float64(b.Count)
+	}
+
+	return result, nil
+}
+
+// ListSamples reads raw samples, oldest first. The engine keeps no report
+// sequence numbers; samples of one timestamp stay in the order they were
+// appended.
+func (s *TSDBStore) ListSamples(ctx context.Context, q SampleQuery) ([]Sample, error) {
+	refs, err := s.DB.Series(q.Start, q.End)
+	if err != nil {
+		return nil, fmt.Errorf("list samples error: %w", err)
+	}
+
+	var samples []Sample
+	for _, ref := range refs {
+		if len(q.AgentIDs) > 0 && !slices.Contains(q.AgentIDs, ref.Agent) {
+			continue
+		}
+		if q.ServiceName != "" && ref.Service != q.ServiceName {
+			continue
+		}
+
+		points, err := s.DB.Select(ref.Agent, ref.Metric, q.Start, q.End)
+		if err != nil {
+			return nil, fmt.Errorf("list samples error: %w", err)
+		}
+		for _, p := range points {
+			samples = append(samples, Sample{AgentID: ref.Agent, ServiceName: ref.Service, Metric: ref.Metric, Value: p.V, Timestamp: p.T})
+		}
+		if q.Limit > 0 && len(samples) > q.Limit {
+			return nil, fmt.Errorf("list samples error: %w (limit %d)", ErrTooManySamples, q.Limit)
+		}
+	}
+
+	sort.SliceStable(samples, func(i, j int) bool { return samples[i].Timestamp < samples[j].Timestamp })
+	return samples, nil
+}
+
+func (s *TSDBStore) Close() error {
+	return s.DB.Close()
+}
+
+//
+// -------------------- SAMPLE STORE OVERRIDE --------------------
+//
+
+// WithSampleStore returns a Service that keeps alerts in svc but reads and
+// writes metric samples through store. Rollups become a no-op because the
+// store answers every step from raw samples.
+func WithSampleStore(svc Service, store *TSDBStore) Service {
+	return &sampleStoreService{Service: svc, store: store}
+}
+
+type sampleStoreService struct {
+	Service
+	store *TSDBStore
+}
+
+func (s *sampleStoreService) InsertSamples(ctx context.Context, samples []Sample) error {
+	return s.store.InsertSamples(ctx, samples)
+}
+
+func (s *sampleStoreService) QueryRange(ctx context.Context, q RangeQuery) (RangeResult, error) {
+	return s.store.QueryRange(ctx, q)
+}
+
+func (s *sampleStoreService) ListSamples(ctx context.Context, q SampleQuery) ([]Sample, error) {
+	return s.store.ListSamples(ctx, q)
+}
+
+// LastSequences returns no marks: the embedded engine does not keep the
+// sequence of the samples it stores.
+func (s *sampleStoreService) LastSequences(ctx context.Context, since int64) (map[string]uint64, error) {
+	return map[string]uint64{}, nil
+}
+
+func (s *sampleStoreService) RollupSamples(ctx context.Context, res Resolution, until int64) error {
+	return nil
+}
+
+func (s *sampleStoreService) Health() map[string]string {
+	health := s.Service.Health()
+	health["samples"] = "tsdb"
+	return health
+}
+
+func (s *sampleStoreService) Close() error {
+	storeErr := s.store.Close()
+	if err := s.Service.Close(); err != nil {
+		return err
+	}
+	return storeErr
+}
@@ -0,0 +1,67 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"gowatch/internal/tsdb"
+)
+
+func TestTSDBStore(t *testing.T) {
+
+	store, err := NewTSDBStore(t.TempDir(), tsdb.Options{})
+	if err != nil {
+		t.Fatalf("failed to open tsdb store: %v", err)
+	}
+	defer store.Close()
+
+	ctx := context.Background()
+
+	var samples []Sample
+	for i := int64(0); i < 120; i++ {
+		samples = append(samples, Sample{AgentID: "agent-123", ServiceName: "service-A", Metric: "cpu", Value: float64(i), Timestamp: 1000 + i})
+	}
+	if err := store.InsertSamples(ctx, samples); err != nil {
+		t.Fatalf("insert samples failed: %v", err)
+	}
+
+	res, err := store.QueryRange(ctx, RangeQuery{AgentID: "agent-123", Metric: "cpu", Start: 1020, End: 1140, Step: 60})
+	if err != nil {
+		t.Fatalf("range query failed: %v", err)
+	}
+
+	// Buckets [1020,1080) and [1080,1140) aligned to the step.
+	if len(res.Points) != 2 {
+		t.Fatalf("expected 2 points; got %+v", res.Points)
+	}
+
+	p := res.Points[0]
+	if p.Timestamp != 1020 || p.Count != 60 || p.Min != 20 || p.Max != 79 || p.Avg != 49.5 {
+		t.Errorf("unexpected first bucket: %+v", p)
+	}
+
+	// Raw samples of every metric, oldest first.
+	if err := store.InsertSamples(ctx, []Sample{
+		{AgentID: "agent-456", ServiceName: "service-B", Metric: "memory", Value: 50, Timestamp: 1030},
+	}); err != nil {
+		t.Fatalf("insert samples failed: %v", err)
+	}
+
+	list, err := store.ListSamples(ctx, SampleQuery{Start: 1025, End: 1035})
+	if err != nil {
+		t.Fatalf("list samples failed: %v", err)
+	}
+	if len(list) != 11 || list[5].Timestamp != 1030 {
+		t.Errorf("expected 11 samples in time order; got %+v", list)
+	}
+
+	list, err = store.ListSamples(ctx, SampleQuery{ServiceName: "service-B", Start: 0, End: 2000})
+	if err != nil || len(list) != 1 || list[0].AgentID != "agent-456" {
+		t.Errorf("expected the service-B sample; got %+v (%v)", list, err)
+	}
+
+	if _, err := store.ListSamples(ctx, SampleQuery{AgentIDs: []string{"agent-123"}, Start: 0, End: 2000, Limit: 100}); !errors.Is(err, ErrTooManySamples) {
+		t.Errorf("expected ErrTooManySamples; got %v", err)
+	}
+}
@@ -0,0 +1,140 @@
+package expr
+
+import (
+	"fmt"
+	"time"
+)
+
+// -------------------- TYPES --------------------
+
+// Type is the static type of an expression.
+type Type int
+
+const (
+	TypeNumber Type = iota
+	TypeBool
+	TypeRange // a metric over a time range; only valid as a function argument
+)
+
+func (t Type) String() string {
+	switch t {
+	case TypeNumber:
+		return "number"
+	case TypeBool:
+		return "bool"
+	case TypeRange:
+		return "range"
+	}
+	return "unknown"
+}
+
+// function describes a built-in function.
+type function struct {
+	args    []Type
+	result  Type
+	counter bool // range arguments must be counters
+	eval    func(args []value) float64
+}
+
+// -------------------- CHECKER --------------------
+
+type checker struct {
+	metrics    map[string]bool
+	counters   map[string]bool
+	used       map[string]bool // metrics the expression reads
+	maxRange   time.Duration
+	maxSamples int
+}
+
+// check type-checks n and returns its type.
+func (c *checker) check(n node) (Type, error) {
+	switch n := n.(type) {
+	case *numberLit:
+		return TypeNumber, nil
+
+	case *metricRef:
+		if !c.metrics[n.name] {
+			if _, ok := functions[n.name]; ok {
+				return 0, &Error{Pos: n.at, Msg: fmt.Sprintf("function %s must be called", n.name)}
+			}
+			return 0, &Error{Pos: n.at, Msg: fmt.Sprintf("unknown metric %q", n.name)}
+		}
+		c.used[n.name] = true
+		return TypeNumber, nil
+
+	case *rangeRef:
+		if !c.metrics[n.name] {
+			return 0, &Error{Pos: n.at, Msg: fmt.Sprintf("unknown metric %q", n.name)}
+		}
+		c.used[n.name] = true
+		c.maxRange = max(c.maxRange, n.d)
+		c.maxSamples = max(c.maxSamples, n.n)
+		return TypeRange, nil
+
+	case *call:
+		fn, ok := functions[n.fn]
+		if !ok {
+			return 0, &Error{Pos: n.at, Msg: fmt.Sprintf("unknown function %q", n.fn)}
+		}
+		if len(n.args) != len(fn.args) {
+			return 0, &Error{Pos: n.at, Msg: fmt.Sprintf("%s expects %d argument(s), got %d", n.fn, len(fn.args), len(n.args))}
+		}
+		for i, arg := range n.args {
+			t, err := c.check(arg)
+			if err != nil {
+				return 0, err
+			}
+			if t != fn.args[i] {
+				return 0, &Error{Pos: arg.pos(), Msg: fmt.Sprintf("argument %d of %s must be a %s, got %s", i+1, n.fn, fn.args[i], t)}
+			}
+			if r, ok := arg.(*rangeRef); ok && fn.counter && !c.counters[r.name] {
+				return 0, &Error{Pos: arg.pos(), Msg: fmt.Sprintf("%s needs a counter; %s is a gauge, use delta or deriv", n.fn, r.name)}
+			}
+		}
+		if n.fn == "quantile_over_time" {
+			if q, ok := n.args[0].(*numberLit); ok && (q.value < 0 || q.value > 1) {
+				return 0, &Error{Pos: q.at, Msg: "quantile must be between 0 and 1"}
+			}
+		}
+		return fn.result, nil
+
+	case *unary:
+		t, err := c.check(n.x)
+		if err != nil {
+			return 0, err
+		}
+		want := TypeNumber
+		if n.op == "!" {
+			want = TypeBool
+		}
+		if t != want {
+			return 0, &Error{Pos: n.at, Msg: fmt.Sprintf("operator %s needs a %s, got %s", n.op, want, t)}
+		}
+		return want, nil
+
+	case *binary:
+		tx, err := c.check(n.x)
+		if err != nil {
+			return 0, err
+		}
+		ty, err := c.check(n.y)
+		if err != nil {
+			return 0, err
+		}
+
+		operand, result := TypeNumber, TypeNumber
+		switch n.op {
+		case "&&", "||":
+			operand, result = TypeBool, TypeBool
+		case ">", "<", ">=", "<=", "==", "!=":
+			result = TypeBool
+		}
+
+		if tx != operand || ty != operand {
+			return 0, &Error{Pos: n.at, Msg: fmt.Sprintf("operator %s needs %s operands, got %s and %s", n.op, operand, tx, ty)}
+		}
+		return result, nil
+	}
+
+	return 0, &Error{Msg: "unknown expression"}
+}
@@ -0,0 +1,364 @@
+package expr
+
+import (
+	"fmt"
+	"maps"
+	"math"
+	"slices"
+	"sort"
+	"time"
+)
+
+// -------------------- PROGRAM --------------------
+
+// Point is one sample of a metric.
+type Point struct {
+	T int64 // Unix timestamp
+	V float64
+}
+
+// Source supplies metric values to a program, as of the sample being
+// evaluated.
+type Source interface {
+	// Value returns the current value of a metric.
+	Value(metric string) float64
+	// Range returns the samples of a metric in (now-d, now], oldest first.
+	Range(metric string, d time.Duration) []Point
+	// Last returns the last n samples of a metric up to now, oldest first.
+	Last(metric string, n int) []Point
+}
+
+// Program is a compiled boolean expression.
+type Program struct {
+	src        string
+	root       node
+	subject    node     // left operand of the first comparison, nil if none
+	metrics    []string // sorted
+	maxRange   time.Duration
+	maxSamples int
+}
+
+// Env declares the metrics an expression may refer to.
+type Env struct {
+	Gauges   []string // values that go up and down, e.g. cpu
+	Counters []string // monotonic counters, e.g. net_bytes; only these take rate and increase
+}
+
+// Compile parses and type-checks src against env. The expression must be
+// a condition (bool).
+func Compile(src string, env Env) (*Program, error) {
+	root, err := parse(src)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &checker{metrics: map[string]bool{}, counters: map[string]bool{}, used: map[string]bool{}}
+	for _, m := range env.Gauges {
+		c.metrics[m] = true
+	}
+	for _, m := range env.Counters {
+		c.metrics[m] = true
+		c.counters[m] = true
+	}
+
+	t, err := c.check(root)
+	if err != nil {
+		return nil, err
+	}
+	if t != TypeBool {
+		return nil, &Error{Pos: 0, Msg: fmt.Sprintf("expression must be a condition, got %s", t)}
+	}
+
+	metrics := slices.Sorted(maps.Keys(c.used))
+	return &Program{src: src, root: root, subject: subject(root), metrics: metrics, maxRange: c.maxRange, maxSamples: c.maxSamples}, nil
+}
+
+// subject returns the left operand of the first comparison of n, in source
+// order: cpu in "cpu > 90 && memory > 80", rate(net_bytes[5m]) in
+// "rate(net_bytes[5m]) > 1e8".
+func subject(n node) node {
+	switch n := n.(type) {
+	case *unary:
+		return subject(n.x)
+	case *binary:
+		switch n.op {
+		case ">", "<", ">=", "<=", "==", "!=":
+			return n.x
+		case "&&", "||":
+			if s := subject(n.x); s != nil {
+				return s
+			}
+			return subject(n.y)
+		}
+	}
+	return nil
+}
+
+// String returns the source of the program.
+func (p *Program) String() string { return p.src }
+
+// Metrics returns the metrics the program reads, sorted.
+func (p *Program) Metrics() []string { return p.metrics }
+
+// MaxRange returns the longest range the program reads, i.e. how much
+// history a Source must keep for it.
+func (p *Program) MaxRange() time.Duration { return p.maxRange }
+
+// MaxSamples returns the largest sample-count range the program reads.
+func (p *Program) MaxSamples() int { return p.maxSamples }
+
+// Eval evaluates the program. Missing data (an empty range, a division by
+// zero) makes comparisons false rather than failing.
+func (p *Program) Eval(src Source) bool {
+	return eval(p.root, src).b
+}
+
+// Value evaluates the left operand of the program's first comparison, the
+// value an alert of the condition reports. It is NaN when the program has
+// no comparison or the data is missing.
+func (p *Program) Value(src Source) float64 {
+	if p.subject == nil {
+		return math.NaN()
+	}
+	return eval(p.subject, src).n
+}
+
+// -------------------- EVALUATION --------------------
+
+// value holds the result of a node; which field is set follows its Type.
+type value struct {
+	n float64
+	b bool
+	r []Point
+}
+
+func eval(n node, src Source) value {
+	switch n := n.(type) {
+	case *numberLit:
+		return value{n: n.value}
+
+	case *metricRef:
+		return value{n: src.Value(n.name)}
+
+	case *rangeRef:
+		if n.n > 0 {
+			return value{r: src.Last(n.name, n.n)}
+		}
+		return value{r: src.Range(n.name, n.d)}
+
+	case *call:
+		args := make([]value, len(n.args))
+		for i, a := range n.args {
+			args[i] = eval(a, src)
+		}
+		return value{n: functions[n.fn].eval(args)}
+
+	case *unary:
+		x := eval(n.x, src)
+		if n.op == "!" {
+			return value{b: !x.b}
+		}
+		return value{n: -x.n}
+
+	case *binary:
+		x := eval(n.x, src)
+
+		// Short-circuit the logical operators.
+		switch n.op {
+		case "&&":
+			if !x.b {
+				return value{b: false}
+			}
+			return value{b: eval(n.y, src).b}
+		case "||":
+			if x.b {
+				return value{b: true}
+			}
+			return value{b: eval(n.y, src).b}
+		}
+
+		y := eval(n.y, src)
+		switch n.op {
+		case "+":
+			return value{n: x.n + y.n}
+		case "-":
+			return value{n: x.n - y.n}
+		case "*":
+			return value{n: x.n * y.n}
+		case "/":
+			if y.n == 0 {
+				return value{n: math.NaN()}
+			}
+			return value{n: x.n / y.n}
+		case ">":
+			return value{b: x.n > y.n}
+		case "<":
+			return value{b: x.n < y.n}
+		case ">=":
+			return value{b: x.n >= y.n}
+		case "<=":
+			return value{b: x.n <= y.n}
+		case "==":
+			return value{b: x.n == y.n}
+		case "!=":
+			return value{b: !math.IsNaN(x.n) && !math.IsNaN(y.n) && x.n != y.n}
+		}
+	}
+	return value{}
+}
+
+// -------------------- FUNCTIONS --------------------
+
+// functions are the built-in functions by name.
+var functions = map[string]function{
+	"avg_over_time":      {args: []Type{TypeRange}, result: TypeNumber, eval: rangeFn(Avg)},
+	"min_over_time":      {args: []Type{TypeRange}, result: TypeNumber, eval: rangeFn(Min)},
+	"max_over_time":      {args: []Type{TypeRange}, result: TypeNumber, eval: rangeFn(Max)},
+	"sum_over_time":      {args: []Type{TypeRange}, result: TypeNumber, eval: rangeFn(Sum)},
+	"count_over_time":    {args: []Type{TypeRange}, result: TypeNumber, eval: rangeFn(Count)},
+	"quantile_over_time": {args: []Type{TypeNumber, TypeRange}, result: TypeNumber, eval: func(a []value) float64 { return Quantile(a[0].n, a[1].r) }},
+	"delta":              {args: []Type{TypeRange}, result: TypeNumber, eval: rangeFn(Delta)},
+	"deriv":              {args: []Type{TypeRange}, result: TypeNumber, eval: rangeFn(Deriv)},
+	"increase":           {args: []Type{TypeRange}, result: TypeNumber, counter: true, eval: rangeFn(Increase)},
+	"rate":               {args: []Type{TypeRange}, result: TypeNumber, counter: true, eval: rangeFn(Rate)},
+	"abs":                {args: []Type{TypeNumber}, result: TypeNumber, eval: func(a []value) float64 { return math.Abs(a[0].n) }},
+}
+
+// rangeFn adapts an aggregation over points to a function body.
+func rangeFn(f func([]Point) float64) func([]value) float64 {
+	return func(a []value) float64 { return f(a[0].r) }
+}
+
+// Avg returns the mean of the samples, NaN if there are none.
+func Avg(ps []Point) float64 {
+	if len(ps) == 0 {
+		return math.NaN()
+	}
+	return Sum(ps) / float64(len(ps))
+}
+
+// Sum returns the sum of the samples.
+func Sum(ps []Point) float64 {
+	var s float64
+	for _, p := range ps {
+		s += p.V
+	}
+	return s
+}
+
+// Count returns the number of samples.
+func Count(ps []Point) float64 {
+	return float64(len(ps))
+}
+
+// Min returns the smallest sample, NaN if there are none.
+func Min(ps []Point) float64 {
+	if len(ps) == 0 {
+		return math.NaN()
+	}
+	m := ps[0].V
+	for _, p := range ps[1:] {
+		m = math.Min(m, p.V)
+	}
+	return m
+}
+
+// Max returns the largest sample, NaN if there are none.
+func Max(ps []Point) float64 {
+	if len(ps) == 0 {
+		return math.NaN()
+	}
+	m := ps[0].V
+	for _, p := range ps[1:] {
+		m = math.Max(m, p.V)
+	}
+	return m
+}
+
+// Quantile returns the q-quantile (0 ≤ q ≤ 1) of the samples, linearly
+// interpolated between the closest ranks; NaN if there are none.
+func Quantile(q float64, ps []Point) float64 {
+	if len(ps) == 0 || math.IsNaN(q) {
+		return math.NaN()
+	}
+	q = math.Max(0, math.Min(1, q))
+
+	vs := make([]float64, len(ps))
+	for i, p := range ps {
+		vs[i] = p.V
+	}
+	sort.Float64s(vs)
+
+	rank := q * float64(len(vs)-1)
+	lo := int(math.Floor(rank))
+	hi := int(math.Ceil(rank))
+	return vs[lo] + (vs[hi]-vs[lo])*(rank-float64(lo))
+}
+
+// -------------------- CHANGE OVER TIME --------------------
+
+// Gauges (cpu, disk, ...) go up and down: use Delta and Deriv. Counters
+// only grow until their process restarts: use Increase and Rate, which
+// treat a drop as a reset to zero.
+
+// Delta returns the difference between the last and the first sample,
+// NaN with fewer than two.
+func Delta(ps []Point) float64 {
+	if len(ps) < 2 {
+		return math.NaN()
+	}
+	return ps[len(ps)-1].V - ps[0].V
+}
+
+// Deriv returns the per-second slope of the least-squares line through the
+// samples, NaN with fewer than two distinct timestamps.
+func Deriv(ps []Point) float64 {
+	if len(ps) < 2 {
+		return math.NaN()
+	}
+
+	// Relative to the first timestamp to keep the sums small.
+	t0 := ps[0].T
+	var sumT, sumV, sumTT, sumTV float64
+	for _, p := range ps {
+		t := float64(p.T - t0)
+		sumT += t
+		sumV += p.V
+		sumTT += t * t
+		sumTV += t * p.V
+	}
+
+	n := float64(len(ps))
+	den := n*sumTT - sumT*sumT
+	if den == 0 {
+		return math.NaN()
+	}
+	return (n*sumTV - sumT*sumV) / den
+}
+
+// Increase returns how much a counter grew over the samples. A value lower
+// than its predecessor is a counter reset: the counter restarted from zero
+// and grew to that value. NaN with fewer than two samples.
+func Increase(ps []Point) float64 {
+	if len(ps) < 2 {
+		return math.NaN()
+	}
+
+	var inc float64
+	for i := 1; i < len(ps); i++ {
+		if d := ps[i].V - ps[i-1].V; d >= 0 {
+			inc += d
+		} else {
+			inc += ps[i].V
+		}
+	}
+	return inc
+}
+
+// Rate returns the per-second increase of a counter over the samples.
+func Rate(ps []Point) float64 {
+	if len(ps) < 2 || ps[len(ps)-1].T == ps[0].T {
+		return math.NaN()
+	}
+	return Increase(ps) / float64(ps[len(ps)-1].T-ps[0].T)
+}
@@ -0,0 +1,208 @@
+package expr
+
+import (
+	"math"
+	"strings"
+	"testing"
+	"time"
+)
+
+var testMetrics = Env{Gauges: []string{"cpu", "memory", "disk"}, Counters: []string{"net_bytes"}}
+
+// fakeSource serves fixed current values and one sample per point.
+type fakeSource struct {
+	now    int64
+	values map[string]float64
+	series map[string][]Point
+}
+
+func (s fakeSource) Value(metric string) float64 { return s.values[metric] }
+
+func (s fakeSource) Range(metric string, d time.Duration) []Point {
+	var out []Point
+	for _, p := range s.series[metric] {
+		if p.T > s.now-int64(d/time.Second) && p.T <= s.now {
+			out = append(out, p)
+		}
+	}
+	return out
+}
+
+func (s fakeSource) Last(metric string, n int) []Point {
+	var ps []Point
+	for _, p := range s.series[metric] {
+		if p.T <= s.now {
+			ps = append(ps, p)
+		}
+	}
+	return ps[max(0, len(ps)-n):]
+}
+
+func TestEval(t *testing.T) {
+
+	src := fakeSource{
+		now:    3600,
+		values: map[string]float64{"cpu": 95, "memory": 85, "disk": 70},
+		series: map[string][]Point{
+			"disk":      {{0, 50}, {1800, 55}, {3600, 70}}, // avg over 1h: 62.5 (t=0 is outside)
+			"net_bytes": {{3400, 0}, {3600, 4e10}},         // 2e8 bytes/s
+		},
+	}
+
+	cases := []struct {
+		expr string
+		want bool
+	}{
+		{"cpu > 90 && memory > 80", true},
+		{"cpu > 90 && memory > 90", false},
+		{"cpu > 99 || !(memory < 80)", true},
+		{"disk - avg_over_time(disk[1h]) > 7", true},
+		{"disk - avg_over_time(disk[1h]) > 10", false},
+		{"rate(net_bytes[5m]) > 1e8", true},
+		{"rate(net_bytes[1m]) > 1e8", false}, // one sample: no rate
+		{"count_over_time(disk[1d]) == 3", true},
+		{"max_over_time(disk[2h]) - min_over_time(disk[2h]) >= 20", true},
+		{"-cpu + 2 * 50 < 10", true},
+		{"cpu / 0 > 1", false},
+		{"abs(50 - cpu) > 40", true},
+		{"avg_over_time(disk[2]) == 62.5", true}, // last two samples
+		{"count_over_time(disk[10]) == 3", true},
+		{"quantile_over_time(0.5, disk[3]) == 55", true},
+		{"quantile_over_time(0.75, disk[1d]) == 62.5", true},
+		{"delta(disk[1h]) == 15", true}, // 55 → 70
+		{"increase(net_bytes[5m]) == 4e10", true},
+	}
+
+	for _, c := range cases {
+		p, err := Compile(c.expr, testMetrics)
+		if err != nil {
+			t.Errorf("%s: unexpected compile error: %v", c.expr, err)
+			continue
+		}
+		if got := p.Eval(src); got != c.want {
+			t.Errorf("%s: got %v, want %v", c.expr, got, c.want)
+		}
+	}
+}
+
+func TestValue(t *testing.T) {
+	src := fakeSource{
+		now:    3600,
+		values: map[string]float64{"cpu": 95, "memory": 85, "disk": 70},
+		series: map[string][]Point{
+			"disk":      {{1800, 55}, {3600, 70}},
+			"net_bytes": {{3400, 0}, {3600, 4e10}},
+		},
+	}
+
+	for expr, want := range map[string]float64{
+		"cpu > 90 && memory > 80":             95,
+		"!(memory < 80) || cpu > 99":          85,
+		"disk - avg_over_time(disk[1h]) > 10": 7.5,
+		"rate(net_bytes[5m]) > 1e8":           2e8,
+	} {
+		p, err := Compile(expr, testMetrics)
+		if err != nil {
+			t.Fatalf("%s: %v", expr, err)
+		}
+		if got := p.Value(src); got != want {
+			t.Errorf("%s: got value %v, want %v", expr, got, want)
+		}
+	}
+}
+
+func TestCompileErrors(t *testing.T) {
+
+	cases := []struct {
+		expr string
+		msg  string
+	}{
+		{"cpu >", "col 6: unexpected end of expression"},
+		{"cpu > 90 &&", "unexpected end of expression"},
+		{"cpu > 90 > 80", "comparisons cannot be chained"},
+		{"gpu > 90", `col 1: unknown metric "gpu"`},
+		{"cpu + 1", "expression must be a condition, got number"},
+		{"cpu && memory > 1", "operator && needs bool operands, got number and bool"},
+		{"avg_over_time(cpu) > 1", "argument 1 of avg_over_time must be a range, got number"},
+		{"cpu[5m] > 1", "operator > needs number operands, got range and number"},
+		{"median(cpu[5m]) > 1", `unknown function "median"`},
+		{"rate(net_bytes[5x]) > 1", `invalid range "5x"`},
+		{"rate(net_bytes[5m] > 1", `expected "," or ")"`},
+		{"rate(disk[5m]) > 1", "col 6: rate needs a counter; disk is a gauge, use delta or deriv"},
+		{"cpu > 90 # comment", `unexpected character '#'`},
+		{"rate > 1", "function rate must be called"},
+		{"avg_over_time(cpu[0]) > 1", "sample count must be positive"},
+		{"quantile_over_time(95, cpu[5m]) > 1", "col 20: quantile must be between 0 and 1"},
+		{"quantile_over_time(cpu[5m]) > 1", "quantile_over_time expects 2 argument(s), got 1"},
+	}
+
+	for _, c := range cases {
+		_, err := Compile(c.expr, testMetrics)
+		if err == nil {
+			t.Errorf("%s: expected error", c.expr)
+			continue
+		}
+		if !strings.Contains(err.Error(), c.msg) {
+			t.Errorf("%s: got %q, want %q", c.expr, err, c.msg)
+		}
+	}
+}
+
+func TestMaxRange(t *testing.T) {
+	p, err := Compile("avg_over_time(cpu[5m]) > 1 && rate(net_bytes[2h]) > 0", testMetrics)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.MaxRange() != 2*time.Hour {
+		t.Errorf("got %s, want 2h", p.MaxRange())
+	}
+	if got := strings.Join(p.Metrics(), ","); got != "cpu,net_bytes" {
+		t.Errorf("got metrics %s, want cpu,net_bytes", got)
+	}
+
+	p, err = Compile("max_over_time(cpu[30]) > 1 && min_over_time(cpu[10]) > 1", testMetrics)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.MaxSamples() != 30 || p.MaxRange() != 0 {
+		t.Errorf("got %d samples / %s, want 30 samples / 0s", p.MaxSamples(), p.MaxRange())
+	}
+}
+
+func TestQuantile(t *testing.T) {
+	ps := []Point{{1, 10}, {2, 40}, {3, 20}, {4, 30}}
+
+	for q, want := range map[float64]float64{0: 10, 0.5: 25, 1: 40, 0.9: 37} {
+		if got := Quantile(q, ps); got < want-1e-9 || got > want+1e-9 {
+			t.Errorf("Quantile(%v) = %v, want %v", q, got, want)
+		}
+	}
+}
+
+func TestChangeOverTime(t *testing.T) {
+
+	// A counter that resets to zero after 300.
+	counter := []Point{{0, 100}, {10, 200}, {20, 300}, {30, 50}, {40, 150}}
+
+	if got := Increase(counter); got != 350 { // 100+100, reset to 50, +100
+		t.Errorf("Increase = %v, want 350", got)
+	}
+	if got := Rate(counter); got != 8.75 {
+		t.Errorf("Rate = %v, want 8.75", got)
+	}
+
+	// A gauge growing by 0.5%/min with noise.
+	gauge := []Point{{0, 60}, {60, 60.6}, {120, 60.9}, {180, 61.6}, {240, 62}}
+	if got := Delta(gauge); got != 2 {
+		t.Errorf("Delta = %v, want 2", got)
+	}
+	if got := Deriv(gauge) * 60; got < 0.49 || got > 0.51 {
+		t.Errorf("Deriv = %v/min, want ~0.5/min", got)
+	}
+
+	for name, f := range map[string]func([]Point) float64{"Delta": Delta, "Deriv": Deriv, "Increase": Increase, "Rate": Rate} {
+		if got := f(gauge[:1]); !math.IsNaN(got) {
+			t.Errorf("%s of one sample = %v, want NaN", name, got)
+		}
+	}
+}
@@ -0,0 +1,153 @@
+// Package expr implements the rule expression language: boolean conditions
+// over the metrics of one agent, such as
+//
+//	cpu > 90 && memory > 80
+//	disk - avg_over_time(disk[1h]) > 10
+//	rate(net_bytes[5m]) > 1e8
+//	quantile_over_time(0.95, cpu[20]) > 85
+//
+// Expressions are compiled once, when rules are loaded, and evaluated for
+// every sample against a Source holding the agent's recent history.
+package expr
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// tokenKind classifies a token.
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokNumber
+	tokIdent
+	tokDuration // inside [...]
+	tokOp
+	tokLParen
+	tokRParen
+	tokLBracket
+	tokRBracket
+	tokComma
+)
+
+type token struct {
+	kind tokenKind
+	text string
+	pos  int // byte offset in the source
+}
+
+func (t token) String() string {
+	if t.kind == tokEOF {
+		return "end of expression"
+	}
+	return fmt.Sprintf("%q", t.text)
+}
+
+// operators, longest first so "&&" wins over "&".
+var operators = []string{"&&", "||", ">=", "<=", "==", "!=", ">", "<", "+", "-", "*", "/", "!"}
+
+// lex splits src into tokens.
+func lex(src string) ([]token, error) {
+	var (
+		toks      []token
+		inBracket bool
+	)
+
+	for i := 0; i < len(src); {
+		c := rune(src[i])
+
+		switch {
+		case unicode.IsSpace(c):
+			i++
+
+		case c == '(':
+			toks = append(toks, token{tokLParen, "(", i})
+			i++
+		case c == ')':
+			toks = append(toks, token{tokRParen, ")", i})
+			i++
+		case c == '[':
+			toks = append(toks, token{tokLBracket, "[", i})
+			inBracket = true
+			i++
+		case c == ']':
+			toks = append(toks, token{tokRBracket, "]", i})
+			inBracket = false
+			i++
+		case c == ',':
+			toks = append(toks, token{tokComma, ",", i})
+			i++
+
+		case inBracket && isDigit(c):
+			// A range: digits and unit letters (5m, 1h30m, 7d) or a
+			// sample count (20).
+			j := i
+			for j < len(src) && (isDigit(rune(src[j])) || isLetter(rune(src[j]))) {
+				j++
+			}
+			toks = append(toks, token{tokDuration, src[i:j], i})
+			i = j
+
+		case isDigit(c) || (c == '.' && i+1 < len(src) && isDigit(rune(src[i+1]))):
+			j := scanNumber(src, i)
+			toks = append(toks, token{tokNumber, src[i:j], i})
+			i = j
+
+		case isLetter(c):
+			j := i
+			for j < len(src) && (isLetter(rune(src[j])) || isDigit(rune(src[j]))) {
+				j++
+			}
+			toks = append(toks, token{tokIdent, src[i:j], i})
+			i = j
+
+		default:
+			op := ""
+			for _, o := range operators {
+				if strings.HasPrefix(src[i:], o) {
+					op = o
+					break
+				}
+			}
+			if op == "" {
+				return nil, &Error{Pos: i, Msg: fmt.Sprintf("unexpected character %q", c)}
+			}
+			toks = append(toks, token{tokOp, op, i})
+			i += len(op)
+		}
+	}
+
+	return append(toks, token{tokEOF, "", len(src)}), nil
+}
+
+// scanNumber returns the end of the number starting at i: digits, an
+// optional fraction and an optional exponent (1e8, 2.5E-3).
+func scanNumber(src string, i int) int {
+	for i < len(src) && isDigit(rune(src[i])) {
+		i++
+	}
+	if i < len(src) && src[i] == '.' {
+		i++
+		for i < len(src) && isDigit(rune(src[i])) {
+			i++
+		}
+	}
+	if i < len(src) && (src[i] == 'e' || src[i] == 'E') {
+		j := i + 1
+		if j < len(src) && (src[j] == '+' || src[j] == '-') {
+			j++
+		}
+		if j < len(src) && isDigit(rune(src[j])) {
+			for j < len(src) && isDigit(rune(src[j])) {
+				j++
+			}
+			i = j
+		}
+	}
+	return i
+}
+
+func isDigit(c rune) bool  { return c >= '0' && c <= '9' }
+func isLetter(c rune) bool { return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') }
@@ -0,0 +1,281 @@
+package expr
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Error is a compile error with its position in the expression.
+type Error struct {
+	Pos int // byte offset
+	Msg string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("col %d: %s", e.Pos+1, e.Msg)
+}
+
+// -------------------- AST --------------------
+
+// node is an expression tree node.
+type node interface {
+	pos() int
+}
+
+type (
+	numberLit struct {
+		at    int
+		value float64
+	}
+
+	// metricRef is the current value of a metric.
+	metricRef struct {
+		at   int
+		name string
+	}
+
+	// rangeRef is the samples of a metric over the last d (cpu[5m]) or
+	// the last n samples (cpu[20]).
+	rangeRef struct {
+		at   int
+		name string
+		d    time.Duration
+		n    int
+	}
+
+	call struct {
+		at   int
+		fn   string
+		args []node
+	}
+
+	unary struct {
+		at int
+		op string
+		x  node
+	}
+
+	binary struct {
+		at   int
+		op   string
+		x, y node
+	}
+)
+
+func (n *numberLit) pos() int { return n.at }
+func (n *metricRef) pos() int { return n.at }
+func (n *rangeRef) pos() int  { return n.at }
+func (n *call) pos() int      { return n.at }
+func (n *unary) pos() int     { return n.at }
+func (n *binary) pos() int    { return n.at }
+
+// -------------------- PARSER --------------------
+
+// Operator precedence, loosest first:
+//
+//	||
+//	&&
+//	> < >= <= == !=   (non-associative)
+//	+ -
+//	* /
+//	unary - !
+var precedence = map[string]int{
+	"||": 1,
+	"&&": 2,
+	">":  3, "<": 3, ">=": 3, "<=": 3, "==": 3, "!=": 3,
+	"+": 4, "-": 4,
+	"*": 5, "/": 5,
+}
+
+type parser struct {
+	toks []token
+	i    int
+}
+
+// parse builds the syntax tree of src.
+func parse(src string) (node, error) {
+	toks, err := lex(src)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &parser{toks: toks}
+	n, err := p.expr(1)
+	if err != nil {
+		return nil, err
+	}
+	if t := p.peek(); t.kind != tokEOF {
+		return nil, &Error{Pos: t.pos, Msg: fmt.Sprintf("unexpected %s", t)}
+	}
+	return n, nil
+}
+
+func (p *parser) peek() token { return p.toks[p.i] }
+
+func (p *parser) next() token {
+	t := p.toks[p.i]
+	if t.kind != tokEOF {
+		p.i++
+	}
+	return t
+}
+
+func (p *parser) expect(kind tokenKind, what string) (token, error) {
+	t := p.next()
+	if t.kind != kind {
+		return t, &Error{Pos: t.pos, Msg: fmt.Sprintf("expected %s, got %s", what, t)}
+	}
+	return t, nil
+}
+
+// expr parses a binary expression whose operators bind at least minPrec.
+func (p *parser) expr(minPrec int) (node, error) {
+	x, err := p.unary()
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		t := p.peek()
+		prec, ok := precedence[t.text]
+		if t.kind != tokOp || !ok || prec < minPrec {
+			return x, nil
+		}
+		p.next()
+
+		y, err := p.expr(prec + 1)
+		if err != nil {
+			return nil, err
+		}
+
+		if prec == precedence[">"] {
+			if n := p.peek(); n.kind == tokOp && precedence[n.text] == prec {
+				return nil, &Error{Pos: n.pos, Msg: "comparisons cannot be chained; use &&"}
+			}
+		}
+
+		x = &binary{at: t.pos, op: t.text, x: x, y: y}
+	}
+}
+
+func (p *parser) unary() (node, error) {
+	if t := p.peek(); t.kind == tokOp && (t.text == "-" || t.text == "!") {
+		p.next()
+		x, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		return &unary{at: t.pos, op: t.text, x: x}, nil
+	}
+	return p.primary()
+}
+
+func (p *parser) primary() (node, error) {
+	t := p.next()
+
+	switch t.kind {
+	case tokNumber:
+		v, err := strconv.ParseFloat(t.text, 64)
+		if err != nil {
+			return nil, &Error{Pos: t.pos, Msg: fmt.Sprintf("invalid number %q", t.text)}
+		}
+		return &numberLit{at: t.pos, value: v}, nil
+
+	case tokLParen:
+		x, err := p.expr(1)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := p.expect(tokRParen, `")"`); err != nil {
+			return nil, err
+		}
+		return x, nil
+
+	case tokIdent:
+		switch p.peek().kind {
+		case tokLParen:
+			return p.call(t)
+		case tokLBracket:
+			return p.rangeRef(t)
+		}
+		return &metricRef{at: t.pos, name: t.text}, nil
+	}
+
+	return nil, &Error{Pos: t.pos, Msg: fmt.Sprintf("unexpected %s", t)}
+}
+
+func (p *parser) call(fn token) (node, error) {
+	p.next() // (
+
+	c := &call{at: fn.pos, fn: fn.text}
+	if p.peek().kind == tokRParen {
+		p.next()
+		return c, nil
+	}
+
+	for {
+		arg, err := p.expr(1)
+		if err != nil {
+			return nil, err
+		}
+		c.args = append(c.args, arg)
+
+		t := p.next()
+		if t.kind == tokRParen {
+			return c, nil
+		}
+		if t.kind != tokComma {
+			return nil, &Error{Pos: t.pos, Msg: fmt.Sprintf(`expected "," or ")", got %s`, t)}
+		}
+	}
+}
+
+func (p *parser) rangeRef(metric token) (node, error) {
+	p.next() // [
+
+	t, err := p.expect(tokDuration, "a range such as 5m or 20")
+	if err != nil {
+		return nil, err
+	}
+
+	r := &rangeRef{at: metric.pos, name: metric.text}
+	if n, err := strconv.Atoi(t.text); err == nil {
+		if n <= 0 {
+			return nil, &Error{Pos: t.pos, Msg: "sample count must be positive"}
+		}
+		r.n = n
+	} else if r.d, err = parseRange(t.text); err != nil {
+		return nil, &Error{Pos: t.pos, Msg: err.Error()}
+	}
+
+	if _, err := p.expect(tokRBracket, `"]"`); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// parseRange accepts Go durations plus days: 30s, 5m, 1h30m, 7d.
+func parseRange(s string) (time.Duration, error) {
+	var d time.Duration
+	if days, rest, ok := strings.Cut(s, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil {
+			return 0, fmt.Errorf("invalid range %q", s)
+		}
+		d = time.Duration(n) * 24 * time.Hour
+		s = rest
+	}
+	if s != "" {
+		r, err := time.ParseDuration(s)
+		if err != nil {
+			return 0, fmt.Errorf("invalid range %q", s)
+		}
+		d += r
+	}
+	if d <= 0 {
+		return 0, fmt.Errorf("range must be positive")
+	}
+	return d, nil
+}
@@ -2,9 +2,11 @@ package grpc
 
 import (
 	"context"
+	"fmt"
 	pb "gowatch/gopherwatch/pkg/generated"
 	"gowatch/internal/database"
 	"log/slog"
+	"slices"
 	"sync"
 	"time"
 )
@@ -14,33 +16,91 @@ import (
 // AlertRule defines a single alert condition.
 // Example: "CPU > 90%"
 type AlertRule struct {
-	Name       string  // Human-readable rule name
-	Metric     string  // Metric to evaluate: cpu | memory | disk
-	Threshold  float64 // Threshold value to compare against
-	Comparison string  // Operator: ">", "<", ">=", "<="
+	Name       string   // Human-readable rule name
+	Metric     string   // Metric to evaluate: cpu | memory | disk
+	Threshold  float64  // Threshold value to compare against
+	Comparison string   // Operator: ">", "<", ">=", "<="
+	Severity   Severity // Severity when Threshold is crossed (default critical)
+	Tiers      []Tier   // Optional tiers (e.g. warning 80, critical 95); override Threshold/Severity
+
+	// For is how long a tier must stay crossed before the alert fires;
+	// shorter spikes never open an alert.
+	For time.Duration
+
+	// Hysteresis: once firing, the alert resolves only when the value is
+	// past ClearThreshold (e.g. fire > 90, clear < 80) for ResolveAfter.
+	// Without ClearThreshold it clears as soon as no tier is crossed.
+	ClearThreshold *float64
+	ResolveAfter   time.Duration
+
+	// Escalation names the escalation policy of the rule's alerts.
+	Escalation string
+
+	// Scope limits the rule to some agents (nil: every agent); the first
+	// matching Override replaces its thresholds for some of them.
+	Scope     *Scope
+	Overrides []Override
+
+	// Window compares an aggregate of recent samples (e.g. the 5 minute
+	// average) instead of the latest sample.
+	Window *Window
+
+	// Anomaly compares the z-score of the sample against its learned
+	// baseline instead of the raw value (see AnomalyEvaluator).
+	Anomaly *Anomaly
+
+	// Forecast compares the projected hours until the metric reaches its
+	// limit instead of the current value (see Forecast).
+	Forecast *Forecast
+
+	// Peer compares the sample against the latest samples of the other
+	// agents of the same service (see PeerEvaluator).
+	Peer *Peer
+
+	// External asks an external evaluation service instead (see
+	// ExternalEvaluator).
+	External *External
+
+	// Evaluator names the registered evaluator judging the rule; empty
+	// picks the one of its kind (threshold, expression, anomaly, peer or
+	// external).
+	Evaluator string
+
+	// Evaluators names several evaluators judging the rule together
+	// instead; Combine is "all" (default: every one of them fires) or
+	// "any" (one of them fires).
+	Evaluators []string
+	Combine    string
+
+	// Expr is a condition in the expression language, e.g.
+	// "cpu > 90 && memory > 80"; it replaces Metric/Threshold/Comparison
+	// (see ExprEvaluator).
+	Expr string
+
+	// clearing marks the copy of the rule judged at its clear threshold.
+	clearing bool
 }
 
-// Evaluator is an interface allowing custom evaluation engines.
-// Future: AI-based evaluator, weighted scoring, anomaly detection, etc.
+// Evaluator is an interface allowing custom evaluation engines. Evaluators
+// are registered by name (see RegisterEvaluator) and rules pick theirs with
+// AlertRule.Evaluator. An error means the rule could not be judged, which
+// leaves its alert as it was rather than counting as "not crossed".
 type Evaluator interface {
-	Evaluate(metric *pb.MetricReport, rule AlertRule) bool
+	Evaluate(metric *pb.MetricReport, rule AlertRule) (bool, error)
 }
 
 // SimpleEvaluator implements basic threshold comparison.
-type SimpleEvaluator struct{}
+type SimpleEvaluator struct {
+	state *evalState // nil: the workers' state
+}
 
 // Evaluate checks whether a metric triggers a rule.
-func (e SimpleEvaluator) Evaluate(metric *pb.MetricReport, rule AlertRule) bool {
+func (e SimpleEvaluator) Evaluate(metric *pb.MetricReport, rule AlertRule) (bool, error) {
 	switch rule.Metric {
-	case "cpu":
-		return compare(metric.CpuUsage, rule.Threshold, rule.Comparison)
-	case "memory":
-		return compare(metric.MemoryUsage, rule.Threshold, rule.Comparison)
-	case "disk":
-		return compare(metric.DiskUsage, rule.Threshold, rule.Comparison)
+	case "cpu", "memory", "disk", "net_bytes":
+		return compare(e.state.orLive().ruleValue(metric, rule), rule.Threshold, rule.Comparison), nil
 	default:
-		// Unknown metric type → never trigger
-		return false
+		return false, fmt.Errorf("unknown metric %q", rule.Metric)
 	}
 }
 
@@ -76,16 +136,22 @@ type CurrentState struct {
 	CpuUsage    float64
 	MemoryUsage float64
 	DiskUsage   float64
+	NetBytes    float64
 	Timestamp   int64
 }
 
 // -------------------- PREDEFINED ALERT RULES --------------------
 
-// These are default rules the system evaluates for every incoming metric.
+// These are default rules the system evaluates for every incoming metric
+// unless RULES_FILE names a rule file (see StartGRPCServer).
 var rules = []AlertRule{
-	{"High CPU", "cpu", 90.0, ">"},
-	{"High Memory", "memory", 85.0, ">"},
-	{"High Disk", "disk", 95.0, ">"},
+	{Name: "High CPU", Metric: "cpu", Threshold: 90.0, Comparison: ">"},
+	{Name: "High Memory", Metric: "memory", Threshold: 85.0, Comparison: ">"},
+	{Name: "High Disk", Metric: "disk", Threshold: 95.0, Comparison: ">"},
+}
+
+func floatPtr(v float64) *float64 {
+	return &v
 }
 
 // -------------------- WORKER POOL --------------------
@@ -93,15 +159,20 @@ var rules = []AlertRule{
 // StartWorkers creates N worker goroutines that:
 //  1. Consume metrics from MetricChan
 //  2. Update in-memory state
-//  3. Evaluate alert rules
-//  4. Insert alerts into the database
+//  3. Evaluate alert rules through the alert lifecycle
+//  4. Store and notify alert transitions
 //
 // This design ensures concurrency, scalability, and smooth load distribution.
-func StartWorkers(n int, db database.Service) {
-	evaluator := SimpleEvaluator{}
+// The workers stop once MetricChan is closed and drained; the returned
+// WaitGroup is done when they have.
+func StartWorkers(n int, db database.Service) *sync.WaitGroup {
+	sink := storeAndNotify{db: db}
 
+	var wg sync.WaitGroup
+	wg.Add(n)
 	for i := 0; i < n; i++ {
 		go func(id int) {
+			defer wg.Done()
 
 			// Each goroutine continuously processes metrics
 			for metric := range MetricChan {
@@ -111,42 +182,71 @@ func StartWorkers(n int, db database.Service) {
 					CpuUsage:    metric.CpuUsage,
 					MemoryUsage: metric.MemoryUsage,
 					DiskUsage:   metric.DiskUsage,
+					NetBytes:    metric.NetBytes,
 					Timestamp:   metric.Timestamp,
 				})
 
-				// -------------------- EVALUATE ALERT RULES --------------------
-				for _, r := range rules {
-					if evaluator.Evaluate(metric, r) {
-
-						// Log critical alert
-						slog.Error("CRITICAL ALERT",
-							"agent", metric.AgentId,
-							"rule", r.Name,
-							"value", getValue(metric, r.Metric),
-							"threshold", r.Threshold,
-						)
-
-						// -------------------- STORE ALERT IN DB --------------------
-						if db != nil {
-							ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
-
-							db.InsertAlert(ctx, database.Alert{
-								AgentID:     metric.AgentId,
-								ServiceName: metric.ServiceName, // ← REQUIRED FIELD
-								RuleName:    r.Name,
-								Metric:      r.Metric,
-								Value:       getValue(metric, r.Metric),
-								Threshold:   r.Threshold,
-								Timestamp:   metric.Timestamp,
-							})
-
-							cancel()
-						}
+				// -------------------- STORE RAW SAMPLES --------------------
+				stored := true
+				if db != nil {
+					ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+
+					if err := db.InsertSamples(ctx, samplesFromReport(metric)); err != nil {
+						slog.Warn("failed to store samples", "agent", metric.AgentId, "err", err)
+						stored = false
 					}
+
+					cancel()
 				}
+
+				// -------------------- EVALUATE ALERT RULES --------------------
+				// Each rule runs through its lifecycle (fire → escalate →
+				// resolve); transitions are stored and notified by the sink.
+				ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+
+				live.evaluate(ctx, tracker, loadedRules(), metric, sink)
+
+				cancel()
+
+				// The report can be acknowledged to its agent now
+				sequences.processed(metric.AgentId, metric.Sequence, stored)
 			}
 		}(i)
 	}
+	return &wg
+}
+
+// metricNames lists the metrics carried by every MetricReport.
+var metricNames = []string{"cpu", "memory", "disk", "net_bytes"}
+
+// counterMetrics are the monotonic counters among metricNames; the others
+// are gauges. Only counters take rate and increase in expressions.
+var counterMetrics = map[string]bool{"net_bytes": true}
+
+// absent reports whether the report leaves out a metric because its
+// collector is disabled; its field is 0 and is not a sample.
+func absent(metric *pb.MetricReport, name string) bool {
+	return slices.Contains(metric.Absent, name)
+}
+
+// samplesFromReport flattens a MetricReport into one Sample per metric it
+// carries.
+func samplesFromReport(metric *pb.MetricReport) []database.Sample {
+	samples := make([]database.Sample, 0, len(metricNames))
+	for _, name := range metricNames {
+		if absent(metric, name) {
+			continue
+		}
+		samples = append(samples, database.Sample{
+			AgentID:     metric.AgentId,
+			ServiceName: metric.ServiceName,
+			Metric:      name,
+			Value:       getValue(metric, name),
+			Timestamp:   metric.Timestamp,
+			Sequence:    metric.Sequence,
+		})
+	}
+	return samples
 }
 
 // getValue maps a metric name string to the corresponding MetricReport value.
@@ -158,6 +258,8 @@ func getValue(metric *pb.MetricReport, metricName string) float64 {
 		return metric.MemoryUsage
 	case "disk":
 		return metric.DiskUsage
+	case "net_bytes":
+		return metric.NetBytes
 	default:
 		return 0
 	}
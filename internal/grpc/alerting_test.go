@@ -0,0 +1,82 @@
+package grpc
+
+import (
+	pb "gowatch/gopherwatch/pkg/generated"
+	"testing"
+)
+
+func TestMatchTier(t *testing.T) {
+
+	rule := AlertRule{
+		Name: "High Disk", Metric: "disk", Comparison: ">",
+		Tiers: []Tier{{SeverityWarning, 85}, {SeverityPage, 98}, {SeverityCritical, 95}},
+	}
+
+	cases := []struct {
+		disk  float64
+		fired bool
+		want  Severity
+	}{
+		{50, false, ""},
+		{90, true, SeverityWarning},
+		{96, true, SeverityCritical},
+		{99, true, SeverityPage},
+	}
+
+	for _, c := range cases {
+		tier, fired, _ := matchTier(SimpleEvaluator{}, &pb.MetricReport{DiskUsage: c.disk}, rule)
+		if fired != c.fired || tier.Severity != c.want {
+			t.Errorf("disk %.0f: expected (%v, %q); got (%v, %q)", c.disk, c.fired, c.want, fired, tier.Severity)
+		}
+	}
+}
+
+func TestMatchTierWithoutTiers(t *testing.T) {
+
+	// A plain rule keeps its threshold and defaults to critical.
+	rule := AlertRule{Name: "High CPU", Metric: "cpu", Threshold: 90, Comparison: ">"}
+
+	tier, fired, _ := matchTier(SimpleEvaluator{}, &pb.MetricReport{CpuUsage: 95}, rule)
+	if !fired || tier.Severity != SeverityCritical || tier.Threshold != 90 {
+		t.Errorf("expected critical tier at 90; got %+v (fired=%v)", tier, fired)
+	}
+}
+
+func TestParseSeverity(t *testing.T) {
+	if _, err := ParseSeverity("warning"); err != nil {
+		t.Errorf("expected warning to parse: %v", err)
+	}
+	if _, err := ParseSeverity("urgent"); err == nil {
+		t.Errorf("expected unknown severity to fail")
+	}
+}
+
+func TestAbsentMetricsSkipped(t *testing.T) {
+	low := AlertRule{Name: "CPU Idle", Metric: "cpu", Threshold: 5, Comparison: "<", Severity: SeverityWarning}
+	expr := AlertRule{Name: "Idle Box", Expr: "cpu < 5 && memory < 50", Severity: SeverityWarning}
+	mem := AlertRule{Name: "Memory Low", Metric: "memory", Threshold: 50, Comparison: "<", Severity: SeverityWarning}
+
+	// The cpu collector is disabled: its 0 is not a sample.
+	var reports []*pb.MetricReport
+	for ts := int64(100); ts < 130; ts += 10 {
+		reports = append(reports, &pb.MetricReport{AgentId: "quiet-1", Timestamp: ts, MemoryUsage: 20, Absent: []string{"cpu"}})
+	}
+
+	transitions, err := Replay([]AlertRule{low, expr, mem}, reports)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(transitions) != 1 || transitions[0].Rule != "Memory Low" {
+		t.Errorf("expected only the memory rule to fire; got %+v", transitions)
+	}
+
+	samples := samplesFromReport(reports[0])
+	if len(samples) != len(metricNames)-1 {
+		t.Errorf("expected the absent metric not to be stored; got %+v", samples)
+	}
+	for _, s := range samples {
+		if s.Metric == "cpu" {
+			t.Errorf("expected no cpu sample; got %+v", s)
+		}
+	}
+}
@@ -0,0 +1,331 @@
+package grpc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	pb "gowatch/gopherwatch/pkg/generated"
+	"gowatch/internal/database"
+	"log/slog"
+	"math"
+	"sync"
+	"time"
+)
+
+// -------------------- ANOMALY DETECTION --------------------
+
+// Anomaly makes a rule fire on values that are unusual for the agent
+// rather than above a fixed level. The rule compares the z-score of the
+// latest sample — how many standard deviations it is from the learned
+// mean — against its Threshold (the sensitivity):
+//
+//	{Name: "CPU anomaly", Metric: "cpu", Threshold: 3, Comparison: ">",
+//	 Anomaly: &Anomaly{Seasonality: "week"}}
+//
+// The mean and variance are exponentially weighted moving averages learned
+// per agent and metric, and per hour of day or hour of week with
+// seasonality so a nightly batch job is not an anomaly at night. Samples
+// lose half their weight every HalfLife of report time, however often the
+// agent reports.
+type Anomaly struct {
+	Seasonality string        // "" (none) | hour (hour of day) | week (hour of week)
+	Direction   string        // both (default) | up | down
+	WarmUp      int           // samples a baseline needs before it can fire (default 30)
+	MinStdDev   float64       // floor on the standard deviation (default 1)
+	HalfLife    time.Duration // default 1h, 7 days with hour and 28 days with week seasonality
+
+	// Sensitivity is the z-score above which a sample is unusual, judged
+	// instead of the rule's Threshold and Comparison. A rule judged by
+	// several evaluators needs it: Threshold belongs to the others.
+	Sensitivity float64
+}
+
+func (a *Anomaly) validate() error {
+	if a == nil {
+		return nil
+	}
+
+	switch a.Seasonality {
+	case "", "hour", "week":
+	default:
+		return fmt.Errorf("unknown anomaly seasonality %q", a.Seasonality)
+	}
+	switch a.Direction {
+	case "", "both", "up", "down":
+	default:
+		return fmt.Errorf("unknown anomaly direction %q", a.Direction)
+	}
+	if a.WarmUp < 0 || a.MinStdDev < 0 || a.HalfLife < 0 || a.Sensitivity < 0 {
+		return fmt.Errorf("anomaly warm-up, min stddev, half-life and sensitivity must not be negative")
+	}
+	return nil
+}
+
+func (a *Anomaly) warmUp() int {
+	if a.WarmUp == 0 {
+		return 30
+	}
+	return a.WarmUp
+}
+
+// halfLife returns the half-life of the rule's baselines. Seasonal buckets
+// only see samples an hour a day or a week, so they remember longer.
+func (a *Anomaly) halfLife() time.Duration {
+	if a.HalfLife > 0 {
+		return a.HalfLife
+	}
+	switch a.Seasonality {
+	case "hour":
+		return 7 * 24 * time.Hour
+	case "week":
+		return 28 * 24 * time.Hour
+	}
+	return time.Hour
+}
+
+func (a *Anomaly) minStdDev() float64 {
+	if a.MinStdDev == 0 {
+		return 1
+	}
+	return a.MinStdDev
+}
+
+// AnomalyEvaluator evaluates rules with an Anomaly against the learned
+// baselines. It never fires while a baseline is warming up.
+type AnomalyEvaluator struct {
+	state *evalState // nil: the workers' state
+}
+
+func (e AnomalyEvaluator) Evaluate(metric *pb.MetricReport, rule AlertRule) (bool, error) {
+	if rule.Anomaly == nil {
+		return false, errors.New("rule has no anomaly settings")
+	}
+
+	z, ok := e.state.orLive().baselines.zScore(metric, rule.Metric, rule.Anomaly)
+	if s := rule.Anomaly.Sensitivity; s > 0 {
+		// A warming baseline sees nothing unusual.
+		return (ok && z > s) != rule.clearing, nil
+	}
+	if !ok {
+		return false, nil
+	}
+	return compare(z, rule.Threshold, rule.Comparison), nil
+}
+
+// -------------------- BASELINES --------------------
+
+type baselineKey struct {
+	agent  string
+	metric string
+	season string
+	bucket int
+}
+
+type baseline struct {
+	mean     float64
+	variance float64
+	weight   float64 // of the samples learned, decayed by their age
+	count    int64
+	updated  int64
+	dirty    bool // changed since the last save
+}
+
+// baselineSet learns the baselines of every (metric, seasonality) pair
+// used by an anomaly rule from the samples seen by the workers. Rules
+// sharing a pair share its baseline, which learns with the shortest of
+// their half-lives.
+type baselineSet struct {
+	mu      sync.Mutex
+	tracked map[string]map[string]time.Duration // metric → seasonality → half-life
+	states  map[baselineKey]*baseline
+}
+
+func newBaselineSet() *baselineSet {
+	return &baselineSet{tracked: map[string]map[string]time.Duration{}, states: map[baselineKey]*baseline{}}
+}
+
+var baselines = newBaselineSet()
+
+// seasonBucket returns the seasonal bucket of a Unix timestamp (UTC).
+func seasonBucket(season string, ts int64) int {
+	t := time.Unix(ts, 0).UTC()
+	switch season {
+	case "hour":
+		return t.Hour()
+	case "week":
+		return int(t.Weekday())*24 + t.Hour()
+	}
+	return 0
+}
+
+// track makes the set learn metric with the given seasonality and
+// half-life.
+func (b *baselineSet) track(metric, season string, halfLife time.Duration) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.tracked[metric] == nil {
+		b.tracked[metric] = map[string]time.Duration{}
+	}
+	if prev, ok := b.tracked[metric][season]; !ok || halfLife < prev {
+		b.tracked[metric][season] = halfLife
+	}
+}
+
+// zScore returns the z-score of the report's value against its baseline,
+// signed by the rule's direction. ok is false while warming up.
+func (b *baselineSet) zScore(metric *pb.MetricReport, name string, a *Anomaly) (float64, bool) {
+	key := baselineKey{
+		agent:  metric.AgentId,
+		metric: name,
+		season: a.Seasonality,
+		bucket: seasonBucket(a.Seasonality, metric.Timestamp),
+	}
+
+	b.mu.Lock()
+	st, ok := b.states[key]
+	var mean, variance float64
+	var count int64
+	if ok {
+		mean, variance, count = st.mean, st.variance, st.count
+	}
+	b.mu.Unlock()
+
+	if count < int64(a.warmUp()) {
+		return 0, false
+	}
+
+	std := math.Max(math.Sqrt(variance), a.minStdDev())
+	z := (getValue(metric, name) - mean) / std
+
+	switch a.Direction {
+	case "up":
+		return z, true
+	case "down":
+		return -z, true
+	}
+	return math.Abs(z), true
+}
+
+// observe learns the report into every tracked baseline. Workers call it
+// after evaluating the rules, so a sample is judged before it is learned.
+func (b *baselineSet) observe(metric *pb.MetricReport) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for name, seasons := range b.tracked {
+		if absent(metric, name) {
+			continue
+		}
+		x := getValue(metric, name)
+		for season, halfLife := range seasons {
+			key := baselineKey{agent: metric.AgentId, metric: name, season: season, bucket: seasonBucket(season, metric.Timestamp)}
+
+			st, ok := b.states[key]
+			if !ok {
+				b.states[key] = &baseline{mean: x, weight: 1, count: 1, updated: metric.Timestamp, dirty: true}
+				continue
+			}
+
+			// The weight learned so far decays with the time since the
+			// last sample; the new sample weighs 1. Its share alpha thus
+			// follows the half-life, not the report interval.
+			elapsed := max(metric.Timestamp-st.updated, 0)
+			st.weight = st.weight*math.Exp2(-float64(elapsed)/halfLife.Seconds()) + 1
+			alpha := 1 / st.weight
+
+			// Incremental EWMA mean and variance.
+			diff := x - st.mean
+			incr := alpha * diff
+			st.mean += incr
+			st.variance = (1 - alpha) * (st.variance + diff*incr)
+			st.count++
+			st.updated = max(st.updated, metric.Timestamp)
+			st.dirty = true
+		}
+	}
+}
+
+// load restores saved baselines.
+func (b *baselineSet) load(ctx context.Context, db database.Service) error {
+	list, err := db.LoadBaselines(ctx)
+	if err != nil {
+		return err
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for _, s := range list {
+		key := baselineKey{agent: s.AgentID, metric: s.Metric, season: s.Season, bucket: s.Bucket}
+		weight := s.Weight
+		if weight == 0 {
+			weight = float64(s.Count) // saved before weights were
+		}
+		b.states[key] = &baseline{mean: s.Mean, variance: s.Variance, weight: weight, count: s.Count, updated: s.UpdatedAt}
+	}
+	return nil
+}
+
+// save stores the baselines changed since the last save.
+func (b *baselineSet) save(ctx context.Context, db database.Service) error {
+	b.mu.Lock()
+	var list []database.Baseline
+	var saved []*baseline
+	for k, st := range b.states {
+		if !st.dirty {
+			continue
+		}
+		list = append(list, database.Baseline{
+			AgentID:   k.agent,
+			Metric:    k.metric,
+			Season:    k.season,
+			Bucket:    k.bucket,
+			Mean:      st.mean,
+			Variance:  st.variance,
+			Weight:    st.weight,
+			Count:     st.count,
+			UpdatedAt: st.updated,
+		})
+		saved = append(saved, st)
+		st.dirty = false
+	}
+	b.mu.Unlock()
+
+	if err := db.SaveBaselines(ctx, list); err != nil {
+		// Retry with the next save.
+		b.mu.Lock()
+		for _, st := range saved {
+			st.dirty = true
+		}
+		b.mu.Unlock()
+		return err
+	}
+	return nil
+}
+
+// SaveBaselines stores the baselines learned since the last save. Call it
+// on shutdown, after the workers stopped, so the last minute is not lost.
+func SaveBaselines(ctx context.Context, db database.Service) error {
+	return baselines.save(ctx, db)
+}
+
+// StartBaselineSync saves learned baselines every interval until ctx is
+// cancelled.
+func StartBaselineSync(ctx context.Context, db database.Service, interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if err := baselines.save(ctx, db); err != nil {
+					slog.Warn("failed to save anomaly baselines", "err", err)
+				}
+			}
+		}
+	}()
+}
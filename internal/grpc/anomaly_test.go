@@ -0,0 +1,130 @@
+package grpc
+
+import (
+	pb "gowatch/gopherwatch/pkg/generated"
+	"math"
+	"testing"
+	"time"
+)
+
+func TestAnomalyWarmUpAndFire(t *testing.T) {
+
+	rule := AlertRule{
+		Name: "CPU anomaly", Metric: "cpu", Threshold: 3, Comparison: ">",
+		Anomaly: &Anomaly{WarmUp: 10},
+	}
+	if err := validateRule(rule); err != nil {
+		t.Fatal(err)
+	}
+	live.prepare(rule)
+
+	// Judge each sample before learning it, like the workers do.
+	feed := func(ts int64, cpu float64) bool {
+		m := &pb.MetricReport{AgentId: "anomaly-agent", CpuUsage: cpu, Timestamp: ts}
+		fired := fires(t, AnomalyEvaluator{}, m, rule)
+		baselines.observe(m)
+		return fired
+	}
+
+	// Even an outlier cannot fire while the baseline warms up.
+	if feed(0, 99) {
+		t.Error("expected no anomaly during warm-up")
+	}
+	for ts := int64(1); ts < 50; ts++ {
+		if feed(ts, 40+float64(ts%3)) && ts >= 10 {
+			t.Errorf("expected normal load not to fire at %d", ts)
+		}
+	}
+
+	if !feed(50, 95) {
+		t.Error("expected a spike to fire")
+	}
+}
+
+func TestAnomalyDirection(t *testing.T) {
+
+	up := &Anomaly{Direction: "up", WarmUp: 5}
+	down := &Anomaly{Direction: "down", WarmUp: 5}
+	baselines.track("memory", "", time.Hour)
+
+	for ts := int64(0); ts < 20; ts++ {
+		baselines.observe(&pb.MetricReport{AgentId: "direction-agent", MemoryUsage: 50, Timestamp: ts})
+	}
+
+	low := &pb.MetricReport{AgentId: "direction-agent", MemoryUsage: 10, Timestamp: 20}
+	if z, ok := baselines.zScore(low, "memory", up); !ok || z > 0 {
+		t.Errorf("expected a drop to score below zero upwards, got %.1f (ok %v)", z, ok)
+	}
+	if z, ok := baselines.zScore(low, "memory", down); !ok || z < 3 {
+		t.Errorf("expected a drop to be an anomaly downwards, got %.1f (ok %v)", z, ok)
+	}
+}
+
+func TestAnomalySeasonalBuckets(t *testing.T) {
+
+	a := &Anomaly{Seasonality: "hour", WarmUp: 5}
+	baselines.track("disk", "hour", 7*24*time.Hour)
+
+	// Every night at 02:00 the disk is busy; during the day it is quiet.
+	const day = 24 * 3600
+	for d := int64(0); d < 10; d++ {
+		baselines.observe(&pb.MetricReport{AgentId: "season-agent", DiskUsage: 90, Timestamp: d*day + 2*3600})
+		baselines.observe(&pb.MetricReport{AgentId: "season-agent", DiskUsage: 20, Timestamp: d*day + 14*3600})
+	}
+
+	night := &pb.MetricReport{AgentId: "season-agent", DiskUsage: 90, Timestamp: 10*day + 2*3600}
+	if z, _ := baselines.zScore(night, "disk", a); z > 1 {
+		t.Errorf("expected the nightly load to be normal at night, got z %.1f", z)
+	}
+	noon := &pb.MetricReport{AgentId: "season-agent", DiskUsage: 90, Timestamp: 10*day + 14*3600}
+	if z, _ := baselines.zScore(noon, "disk", a); z < 3 {
+		t.Errorf("expected the same load to be an anomaly at noon, got z %.1f", z)
+	}
+
+	// 1970-01-05 was a Monday.
+	if b := seasonBucket("week", 4*day+2*3600); b != 1*24+2 {
+		t.Errorf("unexpected hour-of-week bucket %d", b)
+	}
+}
+
+func TestAnomalyValidation(t *testing.T) {
+
+	bad := []AlertRule{
+		{Name: "a", Metric: "cpu", Threshold: 3, Comparison: ">", Anomaly: &Anomaly{Seasonality: "month"}},
+		{Name: "b", Metric: "cpu", Threshold: 3, Comparison: ">", Anomaly: &Anomaly{Direction: "sideways"}},
+		{Name: "c", Metric: "cpu", Threshold: 3, Comparison: ">", Anomaly: &Anomaly{WarmUp: -1}},
+		{Name: "d", Metric: "cpu", Threshold: 3, Comparison: ">", Anomaly: &Anomaly{}, Window: &Window{Aggregate: "avg", Samples: 3}},
+	}
+	for _, r := range bad {
+		if err := validateRule(r); err == nil {
+			t.Errorf("expected rule %q to be rejected", r.Name)
+		}
+	}
+}
+
+func TestBaselineHalfLifeIgnoresReportInterval(t *testing.T) {
+	b := newBaselineSet()
+	b.track("cpu", "", 10*time.Minute)
+
+	// Two agents at 20% for an hour, then at 80% for one half-life: one
+	// reports every 5s, the other every minute.
+	for _, agent := range []struct {
+		id    string
+		every int64
+	}{{"fast-agent", 5}, {"slow-agent", 60}} {
+		for ts := int64(0); ts <= 4200; ts += agent.every {
+			cpu := 20.0
+			if ts > 3600 {
+				cpu = 80
+			}
+			b.observe(&pb.MetricReport{AgentId: agent.id, CpuUsage: cpu, Timestamp: ts})
+		}
+	}
+
+	// After one half-life both are about halfway.
+	fast := b.states[baselineKey{agent: "fast-agent", metric: "cpu"}].mean
+	slow := b.states[baselineKey{agent: "slow-agent", metric: "cpu"}].mean
+	if math.Abs(fast-50) > 3 || math.Abs(slow-50) > 3 {
+		t.Errorf("expected both baselines near 50 after one half-life; got %.1f and %.1f", fast, slow)
+	}
+}
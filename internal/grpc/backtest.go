@@ -0,0 +1,206 @@
+package grpc
+
+import (
+	"encoding/json"
+	"errors"
+	pb "gowatch/gopherwatch/pkg/generated"
+	"gowatch/internal/database"
+	"io"
+	"net/http"
+	"sort"
+)
+
+// -------------------- BACKTEST --------------------
+
+// Backtest limits: a replay reads every raw sample of the range into memory.
+const (
+	maxBacktestRange   = 7 * 24 * 3600
+	maxBacktestSamples = 2_000_000
+)
+
+// BacktestRequest is the body of POST /rules/backtest.
+type BacktestRequest struct {
+	Rule        json.RawMessage `json:"rule"` // in the rule file format
+	Start       int64           `json:"start"`
+	End         int64           `json:"end"`
+	AgentIDs    []string        `json:"agent_ids"`    // optional
+	ServiceName string          `json:"service_name"` // optional
+}
+
+// BacktestAlert is an alert the rule would have produced.
+type BacktestAlert struct {
+	AgentID     string  `json:"agent_id"`
+	ServiceName string  `json:"service_name"`
+	Severity    string  `json:"severity"` // most severe tier reached
+	Value       float64 `json:"value"`    // value when it fired
+	FiredAt     int64   `json:"fired_at"`
+	ResolvedAt  int64   `json:"resolved_at,omitempty"` // 0 while still firing at End
+	Escalations int     `json:"escalations"`
+	Flapping    bool    `json:"flapping"` // flapped at some point
+}
+
+// BacktestResult is the response of POST /rules/backtest.
+type BacktestResult struct {
+	Rule        string          `json:"rule"`
+	Start       int64           `json:"start"`
+	End         int64           `json:"end"`
+	Agents      int             `json:"agents"`
+	Reports     int             `json:"reports"`
+	Alerts      []BacktestAlert `json:"alerts"`
+	Errors      int             `json:"errors"` // reports the evaluator failed on
+	Transitions []Transition    `json:"transitions"`
+}
+
+// backtestHandler serves POST /rules/backtest: it replays the stored
+// samples of [start, end) through a proposed rule and returns the alerts it
+// would have produced. Nothing is stored or notified.
+func (s *RestServer) backtestHandler(w http.ResponseWriter, r *http.Request) {
+	var req BacktestRequest
+	if err := json.NewDecoder(io.LimitReader(r.Body, 1<<20)).Decode(&req); err != nil {
+		http.Error(w, "invalid JSON body", http.StatusBadRequest)
+		return
+	}
+
+	if len(req.Rule) == 0 {
+		http.Error(w, "rule is required", http.StatusBadRequest)
+		return
+	}
+	rule, err := ParseRule(req.Rule)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if req.Start <= 0 || req.End <= req.Start {
+		http.Error(w, "start and end are required, with start < end", http.StatusBadRequest)
+		return
+	}
+	if req.End-req.Start > maxBacktestRange {
+		http.Error(w, "range must not exceed 7 days", http.StatusBadRequest)
+		return
+	}
+
+	samples, err := s.db.ListSamples(r.Context(), database.SampleQuery{
+		AgentIDs:    req.AgentIDs,
+		ServiceName: req.ServiceName,
+		Start:       req.Start,
+		End:         req.End,
+		Limit:       maxBacktestSamples,
+	})
+	if err != nil {
+		if errors.Is(err, database.ErrTooManySamples) {
+			http.Error(w, "too many samples; narrow the range, agents or service", http.StatusUnprocessableEntity)
+			return
+		}
+		http.Error(w, "failed to load samples", http.StatusInternalServerError)
+		return
+	}
+
+	res, err := backtest(rule, samples)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	res.Start, res.End = req.Start, req.End
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(res)
+}
+
+// backtest replays samples through rule and folds the transitions into
+// the alerts they describe.
+func backtest(rule AlertRule, samples []database.Sample) (BacktestResult, error) {
+	reports := reportsFromSamples(samples)
+
+	transitions, err := Replay([]AlertRule{rule}, reports)
+	if err != nil {
+		return BacktestResult{}, err
+	}
+
+	res := BacktestResult{Rule: rule.Name, Reports: len(reports), Alerts: []BacktestAlert{}, Transitions: transitions}
+	if res.Transitions == nil {
+		res.Transitions = []Transition{}
+	}
+
+	agents := map[string]bool{}
+	for _, m := range reports {
+		agents[m.AgentId] = true
+	}
+	res.Agents = len(agents)
+
+	open := map[string]int{} // agent → index of its firing alert
+	for _, t := range transitions {
+		i, firing := open[t.AgentID]
+		switch {
+		case t.Kind == TransitionError:
+			res.Errors++
+		case t.Kind == string(transitionFired):
+			open[t.AgentID] = len(res.Alerts)
+			res.Alerts = append(res.Alerts, BacktestAlert{
+				AgentID:     t.AgentID,
+				ServiceName: t.ServiceName,
+				Severity:    t.Severity,
+				Value:       t.Value,
+				FiredAt:     t.At,
+				Flapping:    t.Flapping,
+			})
+		case !firing:
+		case t.Kind == string(transitionEscalated):
+			res.Alerts[i].Severity = t.Severity
+			res.Alerts[i].Escalations++
+		case t.Kind == string(transitionFlapping):
+			res.Alerts[i].Flapping = res.Alerts[i].Flapping || t.Flapping
+		case t.Kind == string(transitionResolved):
+			res.Alerts[i].ResolvedAt = t.At
+			delete(open, t.AgentID)
+		}
+	}
+	return res, nil
+}
+
+// reportsFromSamples groups the samples of each report back into reports,
+// oldest first. Reports are told apart by agent, timestamp and sequence
+// number; several reports of one second without sequence numbers are told
+// apart by the order of their samples.
+func reportsFromSamples(samples []database.Sample) []*pb.MetricReport {
+	type key struct {
+		agent string
+		ts    int64
+		seq   uint64
+		nth   int // earlier samples of the same metric under agent, ts, seq
+	}
+	type metricKey struct {
+		agent, metric string
+		ts            int64
+		seq           uint64
+	}
+
+	byKey := map[key]*pb.MetricReport{}
+	seen := map[metricKey]int{}
+	var reports []*pb.MetricReport
+	for _, smp := range samples {
+		mk := metricKey{smp.AgentID, smp.Metric, smp.Timestamp, smp.Sequence}
+		k := key{smp.AgentID, smp.Timestamp, smp.Sequence, seen[mk]}
+		seen[mk]++
+
+		m, ok := byKey[k]
+		if !ok {
+			m = &pb.MetricReport{AgentId: smp.AgentID, ServiceName: smp.ServiceName, Timestamp: smp.Timestamp, Sequence: smp.Sequence}
+			byKey[k] = m
+			reports = append(reports, m)
+		}
+
+		switch smp.Metric {
+		case "cpu":
+			m.CpuUsage = smp.Value
+		case "memory":
+			m.MemoryUsage = smp.Value
+		case "disk":
+			m.DiskUsage = smp.Value
+		case "net_bytes":
+			m.NetBytes = smp.Value
+		}
+	}
+
+	sort.SliceStable(reports, func(i, j int) bool { return reports[i].Timestamp < reports[j].Timestamp })
+	return reports
+}
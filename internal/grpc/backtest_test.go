@@ -0,0 +1,126 @@
+package grpc
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"gowatch/internal/database"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// sampleDB serves stored samples to the backtest handler.
+type sampleDB struct {
+	database.Service
+	samples []database.Sample
+}
+
+func (db sampleDB) ListSamples(_ context.Context, q database.SampleQuery) ([]database.Sample, error) {
+	var out []database.Sample
+	for _, s := range db.samples {
+		if s.Timestamp >= q.Start && s.Timestamp < q.End {
+			out = append(out, s)
+		}
+	}
+	return out, nil
+}
+
+// cpuSamples stores one cpu sample per 15s from start.
+func cpuSamples(agent string, start int64, values ...float64) []database.Sample {
+	var out []database.Sample
+	for i, v := range values {
+		ts := start + int64(i)*15
+		out = append(out,
+			database.Sample{AgentID: agent, ServiceName: "web", Metric: "cpu", Value: v, Timestamp: ts},
+			database.Sample{AgentID: agent, ServiceName: "web", Metric: "memory", Value: 40, Timestamp: ts},
+		)
+	}
+	return out
+}
+
+func TestBacktestForAndHysteresis(t *testing.T) {
+
+	db := sampleDB{samples: append(
+		// A 15s spike, then 45s of load, a dip inside the hysteresis band
+		// and 30s clear.
+		cpuSamples("bt-1", 1000, 50, 95, 50, 92, 95, 97, 75, 92, 60, 60, 60),
+		// Never crosses.
+		cpuSamples("bt-2", 1000, 40, 40, 40, 40)...,
+	)}
+	s := &RestServer{db: db}
+
+	body, _ := json.Marshal(map[string]any{
+		"rule": json.RawMessage(`{"name": "Proposed CPU", "metric": "cpu", "comparison": ">",
+			"tiers": [{"severity": "warning", "threshold": 90}, {"severity": "critical", "threshold": 96}],
+			"for": "30s", "clear_threshold": 70, "resolve_after": "30s"}`),
+		"start": 1000,
+		"end":   2000,
+	})
+
+	rec := httptest.NewRecorder()
+	s.backtestHandler(rec, httptest.NewRequest(http.MethodPost, "/rules/backtest", bytes.NewReader(body)))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body)
+	}
+
+	var res BacktestResult
+	if err := json.NewDecoder(rec.Body).Decode(&res); err != nil {
+		t.Fatal(err)
+	}
+	if res.Agents != 2 || res.Reports != 15 {
+		t.Errorf("expected 2 agents and 15 reports, got %d and %d", res.Agents, res.Reports)
+	}
+
+	// The spike at 1015 is shorter than For; the load from 1045 fires at
+	// 1075 as critical, survives the dip to 75 and resolves 30s after 1120.
+	if len(res.Alerts) != 1 {
+		t.Fatalf("expected one alert, got %+v", res.Alerts)
+	}
+	a := res.Alerts[0]
+	if a.AgentID != "bt-1" || a.FiredAt != 1075 || a.Severity != "critical" || a.ResolvedAt != 1150 {
+		t.Errorf("unexpected alert %+v", a)
+	}
+}
+
+func TestBacktestValidation(t *testing.T) {
+
+	s := &RestServer{db: sampleDB{}}
+	rule := json.RawMessage(`{"name": "x", "metric": "cpu", "comparison": ">", "threshold": 90}`)
+
+	cases := []map[string]any{
+		{"start": 1000, "end": 2000},
+		{"rule": json.RawMessage(`{"name": "x", "metric": "cpu", "comparison": "~"}`), "start": 1000, "end": 2000},
+		{"rule": rule, "start": 2000, "end": 1000},
+		{"rule": rule, "start": 1000, "end": 1000 + 8*24*3600},
+	}
+	for i, c := range cases {
+		body, _ := json.Marshal(c)
+		rec := httptest.NewRecorder()
+		s.backtestHandler(rec, httptest.NewRequest(http.MethodPost, "/rules/backtest", bytes.NewReader(body)))
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("case %d: expected 400, got %d", i, rec.Code)
+		}
+	}
+}
+
+func TestReportsFromSamplesKeepsReportsOfOneSecond(t *testing.T) {
+
+	smp := func(metric string, v float64, seq uint64) database.Sample {
+		return database.Sample{AgentID: "bt-1", ServiceName: "web", Metric: metric, Value: v, Timestamp: 1000, Sequence: seq}
+	}
+
+	for name, samples := range map[string][]database.Sample{
+		"sequence": {smp("cpu", 95, 1), smp("cpu", 50, 2), smp("memory", 40, 2), smp("memory", 41, 1)},
+		// The embedded engine keeps no sequence numbers, only sample order.
+		"order": {smp("cpu", 95, 0), smp("memory", 41, 0), smp("cpu", 50, 0), smp("memory", 40, 0)},
+	} {
+		reports := reportsFromSamples(samples)
+		if len(reports) != 2 {
+			t.Fatalf("%s: expected 2 reports, got %d", name, len(reports))
+		}
+		if reports[0].CpuUsage != 95 || reports[0].MemoryUsage != 41 || reports[1].CpuUsage != 50 || reports[1].MemoryUsage != 40 {
+			t.Errorf("%s: unexpected reports %v", name, reports)
+		}
+	}
+}
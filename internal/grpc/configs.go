@@ -0,0 +1,356 @@
+package grpc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	pb "gowatch/gopherwatch/pkg/generated"
+	"gowatch/internal/database"
+	"log/slog"
+	"net/http"
+	"path"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// -------------------- AGENT CONFIGURATION --------------------
+
+// validateProfile checks a profile before it is stored.
+func validateProfile(p database.ConfigProfile) error {
+	if p.Name == "" {
+		return errors.New("name is required")
+	}
+	if (p.ServiceName == "") == (p.AgentPattern == "") {
+		return errors.New("exactly one of service_name and agent_pattern is required")
+	}
+	if _, err := path.Match(p.AgentPattern, ""); err != nil {
+		return fmt.Errorf("invalid agent_pattern: %w", err)
+	}
+	if d, err := time.ParseDuration(p.Interval); err != nil || d < time.Second {
+		return errors.New("interval must be a duration of at least 1s")
+	}
+	for _, c := range p.Collectors {
+		known := false
+		for _, m := range metricNames {
+			known = known || m == c
+		}
+		if !known {
+			return fmt.Errorf("unknown collector %q", c)
+		}
+	}
+	return nil
+}
+
+// appliedConfig is the profile version an agent runs.
+type appliedConfig struct {
+	Profile   string `json:"profile"` // empty: no profile applies
+	Version   int64  `json:"version"`
+	AppliedAt int64  `json:"applied_at"`
+}
+
+// configSet is the in-memory copy of the agent_configs table, refreshed on
+// startup and after every change through the REST API, and the versions
+// the agents acknowledged.
+type configSet struct {
+	mu       sync.RWMutex
+	profiles []database.ConfigProfile
+	applied  map[string]appliedConfig // agent → config it runs
+}
+
+var configs = &configSet{applied: map[string]appliedConfig{}}
+
+func (c *configSet) set(list []database.ConfigProfile) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.profiles = list
+}
+
+func (c *configSet) refresh(ctx context.Context, db database.Service) error {
+	list, err := db.ListConfigProfiles(ctx)
+	if err != nil {
+		return err
+	}
+	c.set(list)
+	return nil
+}
+
+// resolve returns the profile of an agent: the first one whose
+// agent_pattern matches its ID, else the first one of its service.
+func (c *configSet) resolve(agentID, service string) (database.ConfigProfile, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	for _, p := range c.profiles {
+		if p.AgentPattern != "" {
+			if ok, _ := path.Match(p.AgentPattern, agentID); ok {
+				return p, true
+			}
+		}
+	}
+	for _, p := range c.profiles {
+		if p.ServiceName != "" && p.ServiceName == service {
+			return p, true
+		}
+	}
+	return database.ConfigProfile{}, false
+}
+
+// desired returns the configuration an agent should run.
+func (c *configSet) desired(agentID, service string) *pb.AgentConfig {
+	p, ok := c.resolve(agentID, service)
+	if !ok {
+		return &pb.AgentConfig{}
+	}
+
+	// Profiles are validated before they are stored.
+	interval, _ := time.ParseDuration(p.Interval)
+	return &pb.AgentConfig{
+		Profile:    p.Name,
+		Version:    p.Version,
+		IntervalMs: interval.Milliseconds(),
+		Collectors: p.Collectors,
+	}
+}
+
+// apply records the configuration an agent runs.
+func (c *configSet) apply(agentID string, cfg *pb.AgentConfig) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.applied[agentID] = appliedConfig{Profile: cfg.Profile, Version: cfg.Version, AppliedAt: time.Now().Unix()}
+}
+
+func (c *configSet) appliedTo(agentID string) (appliedConfig, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	a, ok := c.applied[agentID]
+	return a, ok
+}
+
+// push sends the desired configuration to every connected agent running
+// another one.
+func (c *configSet) push() {
+	for _, conn := range control.connected() {
+		c.pushTo(conn.AgentID, conn.ServiceName)
+	}
+}
+
+// pushTo sends an agent its desired configuration unless it runs it already.
+func (c *configSet) pushTo(agentID, service string) {
+	cfg := c.desired(agentID, service)
+	// An agent never configured runs its defaults, as with no profile.
+	if a, _ := c.appliedTo(agentID); a.Profile == cfg.Profile && a.Version == cfg.Version {
+		return
+	}
+
+	cmd := &pb.Command{Action: &pb.Command_Config{Config: cfg}}
+	_, err := control.send(agentID, CommandApplyConfig, cmd, func() { c.apply(agentID, cfg) })
+	if err != nil && !errors.Is(err, ErrAgentNotConnected) {
+		slog.Warn("failed to push agent config", "agent", agentID, "profile", cfg.Profile, "err", err)
+	}
+}
+
+// GetConfig returns the configuration profile of an agent. Agents call it
+// on connect and apply what they get, so it counts as the version they run.
+func (s *MetricsServer) GetConfig(ctx context.Context, req *pb.ConfigRequest) (*pb.AgentConfig, error) {
+	cfg := configs.desired(req.AgentId, req.ServiceName)
+	configs.apply(req.AgentId, cfg)
+	return cfg, nil
+}
+
+// -------------------- REST HANDLERS --------------------
+
+// createConfigHandler serves POST /configs.
+func (s *RestServer) createConfigHandler(w http.ResponseWriter, r *http.Request) {
+	var p database.ConfigProfile
+	if err := json.NewDecoder(r.Body).Decode(&p); err != nil {
+		http.Error(w, "invalid config profile body", http.StatusBadRequest)
+		return
+	}
+	if err := validateProfile(p); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	p.Version = 1
+	p.UpdatedAt = time.Now().Unix()
+
+	ctx, cancel := context.WithTimeout(r.Context(), 2*time.Second)
+	defer cancel()
+
+	id, err := s.db.CreateConfigProfile(ctx, p)
+	if err != nil {
+		http.Error(w, "failed to create config profile", http.StatusInternalServerError)
+		return
+	}
+	p.ID = id
+
+	s.configsChanged(ctx)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(p)
+}
+
+// updateConfigHandler serves PUT /configs/{id}: it replaces the profile,
+// bumps its version and pushes it to the agents it applies to.
+func (s *RestServer) updateConfigHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		http.Error(w, "invalid config profile id", http.StatusBadRequest)
+		return
+	}
+
+	var p database.ConfigProfile
+	if err := json.NewDecoder(r.Body).Decode(&p); err != nil {
+		http.Error(w, "invalid config profile body", http.StatusBadRequest)
+		return
+	}
+	if err := validateProfile(p); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	p.ID = id
+	p.UpdatedAt = time.Now().Unix()
+
+	ctx, cancel := context.WithTimeout(r.Context(), 2*time.Second)
+	defer cancel()
+
+	found, err := s.db.UpdateConfigProfile(ctx, p)
+	if err != nil {
+		http.Error(w, "failed to update config profile", http.StatusInternalServerError)
+		return
+	}
+	if !found {
+		http.Error(w, "config profile not found", http.StatusNotFound)
+		return
+	}
+
+	s.configsChanged(ctx)
+
+	// Answer with the stored profile and its new version.
+	configs.mu.RLock()
+	for _, stored := range configs.profiles {
+		if stored.ID == id {
+			p = stored
+		}
+	}
+	configs.mu.RUnlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(p)
+}
+
+// listConfigsHandler serves GET /configs.
+func (s *RestServer) listConfigsHandler(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 2*time.Second)
+	defer cancel()
+
+	list, err := s.db.ListConfigProfiles(ctx)
+	if err != nil {
+		http.Error(w, "failed to load config profiles", http.StatusInternalServerError)
+		return
+	}
+	if list == nil {
+		list = []database.ConfigProfile{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(list)
+}
+
+// deleteConfigHandler serves DELETE /configs/{id}.
+func (s *RestServer) deleteConfigHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		http.Error(w, "invalid config profile id", http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 2*time.Second)
+	defer cancel()
+
+	found, err := s.db.DeleteConfigProfile(ctx, id)
+	if err != nil {
+		http.Error(w, "failed to delete config profile", http.StatusInternalServerError)
+		return
+	}
+	if !found {
+		http.Error(w, "config profile not found", http.StatusNotFound)
+		return
+	}
+
+	s.configsChanged(ctx)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// configsChanged reloads the profiles and pushes them to connected agents.
+func (s *RestServer) configsChanged(ctx context.Context) {
+	if err := configs.refresh(ctx, s.db); err != nil {
+		slog.Warn("failed to refresh config profiles", "err", err)
+		return
+	}
+	configs.push()
+}
+
+// AgentInfo is the response of GET /agents/{id}.
+type AgentInfo struct {
+	AgentID     string         `json:"agent_id"`
+	ServiceName string         `json:"service_name,omitempty"`
+	Connected   bool           `json:"connected"` // has a control stream
+	StreamID    int64          `json:"stream_id,omitempty"`
+	LastReport  int64          `json:"last_report,omitempty"` // timestamp of its latest report
+	Session     *AgentSession  `json:"session,omitempty"`     // set once it registered
+	Sequence    *SequenceState `json:"sequence,omitempty"`    // set once it sent sequenced reports
+	Config      appliedConfig  `json:"config"`                // what it runs
+	Desired     appliedConfig  `json:"desired_config"`        // what it should run
+	UpToDate    bool           `json:"config_up_to_date"`
+}
+
+// agentHandler serves GET /agents/{id}.
+func (s *RestServer) agentHandler(w http.ResponseWriter, r *http.Request) {
+	info := AgentInfo{AgentID: r.PathValue("id")}
+	known := false
+
+	for _, conn := range control.connected() {
+		if conn.AgentID == info.AgentID {
+			info.ServiceName = conn.ServiceName
+			info.Connected = true
+			info.StreamID = conn.StreamID
+			known = true
+		}
+	}
+	if sess, ok := sessions.get(info.AgentID); ok {
+		if info.ServiceName == "" {
+			info.ServiceName = sess.ServiceName
+		}
+		info.Session = &sess
+		known = true
+	}
+	if v, ok := state.Load(info.AgentID); ok {
+		info.LastReport = v.(CurrentState).Timestamp
+		known = true
+	}
+	if st, ok := sequences.get(info.AgentID); ok {
+		info.Sequence = &st
+		known = true
+	}
+	if a, ok := configs.appliedTo(info.AgentID); ok {
+		info.Config = a
+		known = true
+	}
+	if !known {
+		http.Error(w, "agent not found", http.StatusNotFound)
+		return
+	}
+
+	desired := configs.desired(info.AgentID, info.ServiceName)
+	info.Desired = appliedConfig{Profile: desired.Profile, Version: desired.Version}
+	info.UpToDate = info.Config.Profile == desired.Profile && info.Config.Version == desired.Version
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(info)
+}
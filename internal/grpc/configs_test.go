@@ -0,0 +1,98 @@
+package grpc
+
+import (
+	pb "gowatch/gopherwatch/pkg/generated"
+	"gowatch/internal/database"
+	"testing"
+)
+
+func TestResolveConfig(t *testing.T) {
+	c := &configSet{applied: map[string]appliedConfig{}}
+	c.set([]database.ConfigProfile{
+		{ID: 1, Name: "web", ServiceName: "web", Interval: "10s", Version: 3},
+		{ID: 2, Name: "canaries", AgentPattern: "web-canary-*", Interval: "1s", Collectors: []string{"cpu"}, Version: 1},
+	})
+
+	for _, tc := range []struct {
+		agent, service, profile string
+	}{
+		{"web-1", "web", "web"},
+		{"web-canary-1", "web", "canaries"}, // agent patterns win
+		{"db-1", "db", ""},
+	} {
+		if got := c.desired(tc.agent, tc.service).Profile; got != tc.profile {
+			t.Errorf("%s: expected profile %q; got %q", tc.agent, tc.profile, got)
+		}
+	}
+
+	cfg := c.desired("web-1", "web")
+	if cfg.IntervalMs != 10000 || cfg.Version != 3 {
+		t.Errorf("expected 10000ms at version 3; got %v", cfg)
+	}
+}
+
+func TestValidateProfile(t *testing.T) {
+	for _, p := range []database.ConfigProfile{
+		{ServiceName: "web", Interval: "10s"},
+		{Name: "both", ServiceName: "web", AgentPattern: "web-*", Interval: "10s"},
+		{Name: "neither", Interval: "10s"},
+		{Name: "pattern", AgentPattern: "[", Interval: "10s"},
+		{Name: "fast", ServiceName: "web", Interval: "100ms"},
+		{Name: "gpu", ServiceName: "web", Interval: "10s", Collectors: []string{"gpu"}},
+	} {
+		if err := validateProfile(p); err == nil {
+			t.Errorf("expected %+v to be rejected", p)
+		}
+	}
+	if err := validateProfile(database.ConfigProfile{Name: "ok", ServiceName: "web", Interval: "10s", Collectors: []string{"cpu"}}); err != nil {
+		t.Errorf("expected a valid profile; got %v", err)
+	}
+}
+
+func TestConfigPush(t *testing.T) {
+	configs.set([]database.ConfigProfile{{ID: 1, Name: "push", AgentPattern: "push-*", Interval: "5s", Version: 1}})
+	t.Cleanup(func() { configs.set(nil) })
+
+	client := dialTestServer(t)
+
+	// Fetching the config counts as running it.
+	cfg, err := client.GetConfig(t.Context(), &pb.ConfigRequest{AgentId: "push-1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Profile != "push" || cfg.IntervalMs != 5000 {
+		t.Fatalf("expected profile push at 5000ms; got %v", cfg)
+	}
+	ctrl := openControl(t, client, "push-1")
+
+	// An update is pushed and recorded once the agent acknowledges it.
+	configs.set([]database.ConfigProfile{{ID: 1, Name: "push", AgentPattern: "push-*", Interval: "2s", Version: 2}})
+	configs.push()
+
+	got, err := ctrl.Recv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.GetConfig().GetVersion() != 2 || got.GetConfig().GetIntervalMs() != 2000 {
+		t.Fatalf("expected version 2 at 2000ms; got %v", got)
+	}
+	if a, _ := configs.appliedTo("push-1"); a.Version != 1 {
+		t.Fatalf("expected version 1 until acknowledged; got %d", a.Version)
+	}
+
+	ack := &pb.AgentMessage{Body: &pb.AgentMessage_Ack{Ack: &pb.CommandAck{CommandId: got.Id, Ok: true}}}
+	if err := ctrl.Send(ack); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, func() bool {
+		a, _ := configs.appliedTo("push-1")
+		return a.Version == 2
+	})
+
+	// Up-to-date agents are left alone.
+	sent := len(control.commandsOf("push-1"))
+	configs.push()
+	if n := len(control.commandsOf("push-1")); n != sent {
+		t.Errorf("expected no push to an up-to-date agent; got %d more commands", n-sent)
+	}
+}
@@ -0,0 +1,394 @@
+package grpc
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	pb "gowatch/gopherwatch/pkg/generated"
+	"io"
+	"log/slog"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// -------------------- CONTROL STREAMS --------------------
+
+// Command types of POST /agents/{id}/commands.
+const (
+	CommandSetInterval  = "set_interval"
+	CommandSetCollector = "set_collector"
+	CommandSampleNow    = "sample_now"
+	CommandThrottle     = "throttle"
+	CommandApplyConfig  = "apply_config" // sent by the server when a profile changes
+)
+
+// Command states.
+const (
+	CommandPending = "pending" // sent, not acknowledged yet
+	CommandAcked   = "acked"
+	CommandFailed  = "failed" // the agent could not apply it
+	CommandLost    = "lost"   // the stream closed before the ack
+)
+
+// maxCommands is how many commands are remembered for GET /agents/{id}/commands.
+const maxCommands = 1000
+
+// ErrAgentNotConnected is returned for commands to an agent without a
+// control stream.
+var ErrAgentNotConnected = errors.New("agent is not connected")
+
+// CommandStatus tracks one command sent to an agent.
+type CommandStatus struct {
+	ID       string `json:"id"`
+	AgentID  string `json:"agent_id"`
+	StreamID int64  `json:"stream_id"`
+	Type     string `json:"type"`
+	State    string `json:"state"`
+	Error    string `json:"error,omitempty"`
+	SentAt   int64  `json:"sent_at"`
+	AckedAt  int64  `json:"acked_at,omitempty"`
+
+	onAck func() // run once the agent applied it
+}
+
+// ControlConn is an agent connected through a control stream.
+type ControlConn struct {
+	AgentID     string `json:"agent_id"`
+	ServiceName string `json:"service_name"`
+	StreamID    int64  `json:"stream_id"`
+	ConnectedAt int64  `json:"connected_at"`
+	Pending     int    `json:"pending"` // commands not acknowledged yet
+}
+
+type controlStream struct {
+	conn ControlConn
+	send chan *pb.Command
+	done chan struct{} // closed when a newer stream of the agent replaces it
+}
+
+// controlHub tracks the control stream of every connected agent and the
+// commands sent over them.
+type controlHub struct {
+	mu       sync.Mutex
+	streams  map[string]*controlStream // agent → stream
+	commands map[string]*CommandStatus // command ID → status
+	order    []string                  // command IDs, oldest first
+	lastID   int64                     // last stream and command ID
+}
+
+func newControlHub() *controlHub {
+	return &controlHub{streams: map[string]*controlStream{}, commands: map[string]*CommandStatus{}}
+}
+
+var control = newControlHub()
+
+// connect registers the stream of an agent, replacing its previous one.
+func (h *controlHub) connect(hello *pb.Hello) *controlStream {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if old, ok := h.streams[hello.AgentId]; ok {
+		close(old.done)
+		h.lose(old)
+	}
+
+	h.lastID++
+	cs := &controlStream{
+		conn: ControlConn{
+			AgentID:     hello.AgentId,
+			ServiceName: hello.ServiceName,
+			StreamID:    h.lastID,
+			ConnectedAt: time.Now().Unix(),
+		},
+		send: make(chan *pb.Command, 16),
+		done: make(chan struct{}),
+	}
+	h.streams[hello.AgentId] = cs
+	return cs
+}
+
+// disconnect forgets a stream that ended, unless it was replaced already.
+func (h *controlHub) disconnect(cs *controlStream) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.streams[cs.conn.AgentID] == cs {
+		delete(h.streams, cs.conn.AgentID)
+		h.lose(cs)
+	}
+}
+
+// lose marks the commands still pending on a stream as lost.
+func (h *controlHub) lose(cs *controlStream) {
+	for _, id := range h.order {
+		if c := h.commands[id]; c.StreamID == cs.conn.StreamID && c.State == CommandPending {
+			c.State = CommandLost
+		}
+	}
+}
+
+// send queues a command to the agent's stream and returns its status.
+// onAck, if set, runs once the agent acknowledges it successfully.
+func (h *controlHub) send(agentID, typ string, cmd *pb.Command, onAck func()) (CommandStatus, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	cs, ok := h.streams[agentID]
+	if !ok {
+		return CommandStatus{}, ErrAgentNotConnected
+	}
+
+	h.lastID++
+	cmd.Id = strconv.FormatInt(h.lastID, 10)
+
+	select {
+	case cs.send <- cmd:
+	default:
+		return CommandStatus{}, errors.New("too many commands waiting to be sent")
+	}
+
+	c := &CommandStatus{
+		ID:       cmd.Id,
+		AgentID:  agentID,
+		StreamID: cs.conn.StreamID,
+		Type:     typ,
+		State:    CommandPending,
+		SentAt:   time.Now().Unix(),
+		onAck:    onAck,
+	}
+	h.commands[c.ID] = c
+	h.order = append(h.order, c.ID)
+	if len(h.order) > maxCommands {
+		delete(h.commands, h.order[0])
+		h.order = h.order[1:]
+	}
+	return *c, nil
+}
+
+// ack records the agent's answer to a command sent on its stream.
+func (h *controlHub) ack(cs *controlStream, ack *pb.CommandAck) {
+	h.mu.Lock()
+
+	c, ok := h.commands[ack.CommandId]
+	if !ok || c.StreamID != cs.conn.StreamID || c.State != CommandPending {
+		h.mu.Unlock()
+		return
+	}
+	c.AckedAt = time.Now().Unix()
+	if !ack.Ok {
+		c.State = CommandFailed
+		c.Error = ack.Error
+		h.mu.Unlock()
+		return
+	}
+	c.State = CommandAcked
+	onAck := c.onAck
+	h.mu.Unlock()
+
+	if onAck != nil {
+		onAck()
+	}
+}
+
+// connected lists the connected agents by agent ID.
+func (h *controlHub) connected() []ControlConn {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	pending := map[int64]int{}
+	for _, c := range h.commands {
+		if c.State == CommandPending {
+			pending[c.StreamID]++
+		}
+	}
+
+	list := make([]ControlConn, 0, len(h.streams))
+	for _, cs := range h.streams {
+		conn := cs.conn
+		conn.Pending = pending[conn.StreamID]
+		list = append(list, conn)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].AgentID < list[j].AgentID })
+	return list
+}
+
+// isConnected reports whether an agent has a control stream open.
+func (h *controlHub) isConnected(agentID string) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	_, ok := h.streams[agentID]
+	return ok
+}
+
+// commandsOf returns the remembered commands of an agent, newest first.
+func (h *controlHub) commandsOf(agentID string) []CommandStatus {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	list := []CommandStatus{}
+	for i := len(h.order) - 1; i >= 0; i-- {
+		if c := h.commands[h.order[i]]; c.AgentID == agentID {
+			list = append(list, *c)
+		}
+	}
+	return list
+}
+
+// Control serves the control stream of an agent: it pushes the commands
+// queued for the agent and records its acknowledgements until either side
+// closes the stream or a newer stream of the same agent replaces it.
+func (s *MetricsServer) Control(stream pb.MetricsService_ControlServer) error {
+	first, err := stream.Recv()
+	if err != nil {
+		return err
+	}
+	hello := first.GetHello()
+	if hello == nil || hello.AgentId == "" {
+		return status.Error(codes.InvalidArgument, "the first control message must be a hello with an agent_id")
+	}
+	sessionID := streamSession(stream.Context())
+	if err := sessions.use(hello.AgentId, sessionID); err != nil {
+		return sessionError(hello.AgentId, err)
+	}
+
+	cs := control.connect(hello)
+	defer control.disconnect(cs)
+	if sessionID != "" {
+		defer sessions.touch(hello.AgentId) // its session lives sessionTTL more
+	}
+
+	slog.Info("agent connected", "agent", hello.AgentId, "stream", cs.conn.StreamID)
+
+	// Catch the agent up with profile changes it missed while away.
+	configs.pushTo(hello.AgentId, hello.ServiceName)
+
+	recvErr := make(chan error, 1)
+	go func() {
+		for {
+			msg, err := stream.Recv()
+			if err != nil {
+				recvErr <- err
+				return
+			}
+			if ack := msg.GetAck(); ack != nil {
+				control.ack(cs, ack)
+			}
+		}
+	}()
+
+	for {
+		select {
+		case cmd := <-cs.send:
+			if err := stream.Send(cmd); err != nil {
+				return err
+			}
+		case err := <-recvErr:
+			slog.Info("agent disconnected", "agent", hello.AgentId, "stream", cs.conn.StreamID)
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		case <-cs.done:
+			return status.Error(codes.Aborted, "replaced by a newer control stream")
+		}
+	}
+}
+
+// -------------------- HTTP --------------------
+
+// CommandRequest is the body of POST /agents/{id}/commands.
+type CommandRequest struct {
+	Type      string   `json:"type"`      // set_interval | set_collector | sample_now | throttle
+	Interval  duration `json:"interval"`  // set_interval
+	Collector string   `json:"collector"` // set_collector: cpu | memory | disk
+	Enabled   *bool    `json:"enabled"`   // set_collector
+	Factor    float64  `json:"factor"`    // throttle: interval multiplier, > 1
+	Duration  duration `json:"duration"`  // throttle
+}
+
+// command validates the request and builds the command it describes.
+func (req CommandRequest) command() (*pb.Command, error) {
+	switch req.Type {
+	case CommandSetInterval:
+		if time.Duration(req.Interval) < time.Second {
+			return nil, errors.New("interval must be at least 1s")
+		}
+		return &pb.Command{Action: &pb.Command_SetInterval{SetInterval: &pb.SetInterval{
+			IntervalMs: time.Duration(req.Interval).Milliseconds(),
+		}}}, nil
+
+	case CommandSetCollector:
+		known := false
+		for _, m := range metricNames {
+			known = known || m == req.Collector
+		}
+		if !known || req.Enabled == nil {
+			return nil, fmt.Errorf("set_collector needs a collector (%v) and enabled", metricNames)
+		}
+		return &pb.Command{Action: &pb.Command_SetCollector{SetCollector: &pb.SetCollector{
+			Collector: req.Collector,
+			Enabled:   *req.Enabled,
+		}}}, nil
+
+	case CommandSampleNow:
+		return &pb.Command{Action: &pb.Command_SampleNow{SampleNow: &pb.SampleNow{}}}, nil
+
+	case CommandThrottle:
+		if req.Factor <= 1 || req.Duration <= 0 {
+			return nil, errors.New("throttle needs a factor above 1 and a duration")
+		}
+		return &pb.Command{Action: &pb.Command_Throttle{Throttle: &pb.Throttle{
+			Factor:     req.Factor,
+			DurationMs: time.Duration(req.Duration).Milliseconds(),
+		}}}, nil
+	}
+	return nil, fmt.Errorf("unknown command type %q", req.Type)
+}
+
+// sendCommandHandler serves POST /agents/{id}/commands: it pushes a command
+// to the agent's control stream. The agent acknowledges it asynchronously;
+// GET /agents/{id}/commands shows whether it did.
+func (s *RestServer) sendCommandHandler(w http.ResponseWriter, r *http.Request) {
+	var req CommandRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid JSON body", http.StatusBadRequest)
+		return
+	}
+
+	cmd, err := req.command()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	c, err := control.send(r.PathValue("id"), req.Type, cmd, nil)
+	switch {
+	case errors.Is(err, ErrAgentNotConnected):
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(c)
+}
+
+func (s *RestServer) listCommandsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(control.commandsOf(r.PathValue("id")))
+}
+
+func (s *RestServer) connectedAgentsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(control.connected())
+}
@@ -0,0 +1,132 @@
+package grpc
+
+import (
+	"context"
+	pb "gowatch/gopherwatch/pkg/generated"
+	"net"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// dialTestServer serves MetricsServer in memory and returns a client.
+func dialTestServer(t *testing.T) pb.MetricsServiceClient {
+	t.Helper()
+
+	lis := bufconn.Listen(1 << 20)
+	server := grpc.NewServer()
+	pb.RegisterMetricsServiceServer(server, &MetricsServer{})
+	go server.Serve(lis)
+	t.Cleanup(server.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return lis.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return pb.NewMetricsServiceClient(conn)
+}
+
+// openControl opens a control stream for agent and waits until the server
+// has registered it.
+func openControl(t *testing.T, client pb.MetricsServiceClient, agent string) pb.MetricsService_ControlClient {
+	t.Helper()
+
+	ctrl, err := client.Control(t.Context())
+	if err != nil {
+		t.Fatal(err)
+	}
+	hello := &pb.AgentMessage{Body: &pb.AgentMessage_Hello{Hello: &pb.Hello{AgentId: agent, ServiceName: "web"}}}
+	if err := ctrl.Send(hello); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, func() bool {
+		for _, c := range control.connected() {
+			if c.AgentID == agent {
+				return true
+			}
+		}
+		return false
+	})
+	return ctrl
+}
+
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	for deadline := time.Now().Add(2 * time.Second); time.Now().Before(deadline); time.Sleep(5 * time.Millisecond) {
+		if cond() {
+			return
+		}
+	}
+	t.Fatal("condition not met within 2s")
+}
+
+func TestControlStream(t *testing.T) {
+	client := dialTestServer(t)
+	ctrl := openControl(t, client, "ctrl-agent")
+
+	req := CommandRequest{Type: CommandSetInterval, Interval: duration(30 * time.Second)}
+	cmd, err := req.command()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sent, err := control.send("ctrl-agent", req.Type, cmd, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := ctrl.Recv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Id != sent.ID || got.GetSetInterval().GetIntervalMs() != 30000 {
+		t.Fatalf("expected set_interval 30000ms as %s; got %v", sent.ID, got)
+	}
+
+	ack := &pb.AgentMessage{Body: &pb.AgentMessage_Ack{Ack: &pb.CommandAck{CommandId: got.Id, Ok: true}}}
+	if err := ctrl.Send(ack); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, func() bool { return control.commandsOf("ctrl-agent")[0].State == CommandAcked })
+
+	// A reconnecting agent replaces its stream; what was pending on the
+	// old one is lost.
+	if _, err := control.send("ctrl-agent", CommandSampleNow, &pb.Command{Action: &pb.Command_SampleNow{SampleNow: &pb.SampleNow{}}}, nil); err != nil {
+		t.Fatal(err)
+	}
+	openControl(t, client, "ctrl-agent")
+	waitFor(t, func() bool {
+		for _, c := range control.connected() {
+			if c.AgentID == "ctrl-agent" {
+				return c.StreamID != sent.StreamID
+			}
+		}
+		return false
+	})
+	if c := control.commandsOf("ctrl-agent")[0]; c.State != CommandLost {
+		t.Errorf("expected the pending command to be lost; got %s", c.State)
+	}
+
+	if _, err := control.send("nobody", CommandSampleNow, &pb.Command{}, nil); err != ErrAgentNotConnected {
+		t.Errorf("expected ErrAgentNotConnected; got %v", err)
+	}
+}
+
+func TestCommandRequestValidation(t *testing.T) {
+	for _, req := range []CommandRequest{
+		{Type: "reboot"},
+		{Type: CommandSetInterval, Interval: duration(time.Millisecond)},
+		{Type: CommandSetCollector, Collector: "gpu"},
+		{Type: CommandThrottle, Factor: 0.5, Duration: duration(time.Minute)},
+	} {
+		if _, err := req.command(); err == nil {
+			t.Errorf("expected %+v to be rejected", req)
+		}
+	}
+}
@@ -0,0 +1,373 @@
+package grpc
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	pb "gowatch/gopherwatch/pkg/generated"
+	"gowatch/internal/database"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// -------------------- ESCALATION POLICIES --------------------
+
+// EscalationTier notifies extra targets once an alert has stayed
+// unacknowledged for After since it fired.
+type EscalationTier struct {
+	After     time.Duration
+	Notifiers []string
+}
+
+// EscalationPolicy is an ordered list of tiers. Alerts below MinSeverity
+// are not escalated.
+type EscalationPolicy struct {
+	Name        string
+	MinSeverity Severity
+	Tiers       []EscalationTier // ordered by After
+}
+
+var (
+	escalationMu sync.RWMutex
+
+	// escalationPolicies holds every policy by name.
+	escalationPolicies = map[string]EscalationPolicy{
+		"oncall": {
+			Name:        "oncall",
+			MinSeverity: SeverityCritical,
+			Tiers:       []EscalationTier{{After: 10 * time.Minute, Notifiers: []string{"pager"}}},
+		},
+	}
+
+	// serviceEscalations attaches a policy to every alert of a service,
+	// overriding the policy of the rule.
+	serviceEscalations = map[string]string{}
+)
+
+// RegisterEscalationPolicy adds or replaces a policy.
+func RegisterEscalationPolicy(p EscalationPolicy) {
+	escalationMu.Lock()
+	defer escalationMu.Unlock()
+	escalationPolicies[p.Name] = p
+}
+
+// SetServiceEscalation attaches a policy to a service; an empty name
+// detaches it.
+func SetServiceEscalation(service, policy string) {
+	escalationMu.Lock()
+	defer escalationMu.Unlock()
+	if policy == "" {
+		delete(serviceEscalations, service)
+		return
+	}
+	serviceEscalations[service] = policy
+}
+
+// hasEscalationPolicy reports whether a policy is registered under name.
+func hasEscalationPolicy(name string) bool {
+	escalationMu.RLock()
+	defer escalationMu.RUnlock()
+	_, ok := escalationPolicies[name]
+	return ok
+}
+
+// EscalationConfig is the content of ESCALATION_POLICIES_FILE: policies
+// and the services they are attached to.
+type EscalationConfig struct {
+	Policies []EscalationPolicy
+	Services map[string]string // service → policy
+}
+
+type escalationFile struct {
+	Policies []policySpec      `json:"policies"`
+	Services map[string]string `json:"services"`
+}
+
+type policySpec struct {
+	Name        string               `json:"name"`
+	MinSeverity Severity             `json:"min_severity"`
+	Tiers       []escalationTierSpec `json:"tiers"`
+}
+
+type escalationTierSpec struct {
+	After     duration `json:"after"`
+	Notifiers []string `json:"notifiers"`
+}
+
+// ParseEscalationPolicies decodes and validates the format of
+// ESCALATION_POLICIES_FILE:
+//
+//	{"policies": [{"name": "payments-oncall", "min_severity": "critical",
+//	               "tiers": [{"after": "10m", "notifiers": ["pager"]},
+//	                         {"after": "30m", "notifiers": ["manager"]}]}],
+//	 "services": {"payments": "payments-oncall"}}
+//
+// Services may also name the built-in "oncall" policy.
+func ParseEscalationPolicies(data []byte) (EscalationConfig, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+
+	var f escalationFile
+	if err := dec.Decode(&f); err != nil {
+		return EscalationConfig{}, fmt.Errorf("invalid escalation policies: %w", err)
+	}
+
+	cfg := EscalationConfig{Services: f.Services}
+	for _, s := range f.Policies {
+		p := EscalationPolicy{Name: s.Name, MinSeverity: s.MinSeverity}
+		for _, t := range s.Tiers {
+			p.Tiers = append(p.Tiers, EscalationTier{After: time.Duration(t.After), Notifiers: t.Notifiers})
+		}
+		cfg.Policies = append(cfg.Policies, p)
+	}
+	if err := cfg.validate(); err != nil {
+		return EscalationConfig{}, err
+	}
+	return cfg, nil
+}
+
+func (cfg EscalationConfig) validate() error {
+	names := map[string]bool{}
+	for _, p := range cfg.Policies {
+		if p.Name == "" {
+			return errors.New("escalation policy: name is required")
+		}
+		if names[p.Name] {
+			return fmt.Errorf("escalation policy %q: duplicate name", p.Name)
+		}
+		names[p.Name] = true
+
+		if _, err := ParseSeverity(string(p.MinSeverity)); err != nil {
+			return fmt.Errorf("escalation policy %q: %w", p.Name, err)
+		}
+		if len(p.Tiers) == 0 {
+			return fmt.Errorf("escalation policy %q: tiers are required", p.Name)
+		}
+		for i, t := range p.Tiers {
+			if t.After <= 0 || (i > 0 && t.After <= p.Tiers[i-1].After) {
+				return fmt.Errorf("escalation policy %q: tier delays must be positive and increasing", p.Name)
+			}
+			if len(t.Notifiers) == 0 {
+				return fmt.Errorf("escalation policy %q: tier %d has no notifiers", p.Name, i)
+			}
+		}
+	}
+	for service, policy := range cfg.Services {
+		if !names[policy] && !hasEscalationPolicy(policy) {
+			return fmt.Errorf("service %q: unknown escalation policy %q", service, policy)
+		}
+	}
+	return nil
+}
+
+// SetEscalationConfig registers the policies of cfg and attaches them to
+// their services.
+func SetEscalationConfig(cfg EscalationConfig) error {
+	if err := cfg.validate(); err != nil {
+		return err
+	}
+	for _, p := range cfg.Policies {
+		RegisterEscalationPolicy(p)
+	}
+	for service, policy := range cfg.Services {
+		SetServiceEscalation(service, policy)
+	}
+	return nil
+}
+
+// policyFor returns the policy of the alert's service, else of its rule as
+// it applies to the alert's agent in the loaded rules.
+func policyFor(alert database.Alert) (EscalationPolicy, bool) {
+	escalationMu.RLock()
+	defer escalationMu.RUnlock()
+
+	name, ok := serviceEscalations[alert.ServiceName]
+	if !ok {
+		agent := &pb.MetricReport{AgentId: alert.AgentID, ServiceName: alert.ServiceName}
+		for _, r := range loadedRules().rulesFor(agent) {
+			if r.Name == alert.RuleName {
+				name = r.Escalation
+				break
+			}
+		}
+	}
+
+	p, ok := escalationPolicies[name]
+	return p, ok
+}
+
+// -------------------- SCHEDULER --------------------
+
+// escalator tracks open alerts and notifies escalation tiers as they
+// fall due. It is loaded from storage on startup so pending escalations
+// survive a restart; the level reached is stored with each alert.
+type escalator struct {
+	mu   sync.Mutex
+	open map[int64]database.Alert
+}
+
+func newEscalator() *escalator {
+	return &escalator{open: map[int64]database.Alert{}}
+}
+
+var escalations = newEscalator()
+
+// track records the latest state of an alert; resolved alerts are dropped.
+func (e *escalator) track(alert database.Alert) {
+	if alert.ID == 0 {
+		return
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if alert.Status == StatusResolved {
+		delete(e.open, alert.ID)
+		return
+	}
+	if prev, ok := e.open[alert.ID]; ok && prev.EscalationLevel > alert.EscalationLevel {
+		alert.EscalationLevel = prev.EscalationLevel
+	}
+	e.open[alert.ID] = alert
+}
+
+// list returns the open alerts.
+func (e *escalator) list() []database.Alert {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	out := make([]database.Alert, 0, len(e.open))
+	for _, a := range e.open {
+		out = append(out, a)
+	}
+	return out
+}
+
+// updateInhibited recomputes the inhibited flag of every open alert in one
+// pass and returns the alerts whose flag changed.
+func (e *escalator) updateInhibited(inhibited func(database.Alert) bool) []database.Alert {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	var changed []database.Alert
+	for id, a := range e.open {
+		if v := inhibited(a); v != a.Inhibited {
+			a.Inhibited = v
+			e.open[id] = a
+			changed = append(changed, a)
+		}
+	}
+	return changed
+}
+
+// load replaces the open alerts with the firing alerts in storage.
+func (e *escalator) load(ctx context.Context, db database.Service) error {
+	alerts, err := db.GetAlertHistory(ctx, database.AlertFilter{Status: StatusFiring})
+	if err != nil {
+		return err
+	}
+
+	open := make(map[int64]database.Alert, len(alerts))
+	for _, a := range alerts {
+		open[a.ID] = a
+		tracker.restore(a)
+		inhibitions.track(a)
+		groups.restore(a, time.Now())
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.open = open
+	return nil
+}
+
+// escalation is one tier that fell due for one alert.
+type escalation struct {
+	alert database.Alert
+	tier  EscalationTier
+}
+
+// due advances every alert whose next tier is due at now and returns the
+// tiers to notify. Acknowledged, muted and inhibited alerts are not escalated.
+// Tiers count from the server time the alert fired, so an agent clock that
+// is off neither delays nor hastens them.
+func (e *escalator) due(now time.Time) []escalation {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	var out []escalation
+	for id, a := range e.open {
+		// Silences, maintenance windows and inhibiting alerts may have
+		// started or ended since the alert's last transition.
+		_, silenced := silences.match(a, now.Unix())
+		_, inMaintenance := maintenance.match(a, now)
+		if a.AcknowledgedBy != "" || a.Flapping || silenced || inMaintenance || inhibitions.inhibited(a) {
+			continue
+		}
+
+		p, ok := policyFor(a)
+		if !ok || a.EscalationLevel >= len(p.Tiers) ||
+			Severity(a.Severity).Priority() < p.MinSeverity.Priority() {
+			continue
+		}
+
+		// Alerts stored before fired_at existed count from the report.
+		firedAt := a.FiredAt
+		if firedAt == 0 {
+			firedAt = a.Timestamp
+		}
+
+		tier := p.Tiers[a.EscalationLevel]
+		if now.Sub(time.Unix(firedAt, 0)) < tier.After {
+			continue
+		}
+
+		a.EscalationLevel++
+		e.open[id] = a
+		out = append(out, escalation{alert: a, tier: tier})
+	}
+	return out
+}
+
+// tick notifies every due tier and stores the level reached.
+func (e *escalator) tick(ctx context.Context, db database.Service, now time.Time) {
+	for _, esc := range e.due(now) {
+		slog.Warn("alert escalated",
+			"id", esc.alert.ID,
+			"rule", esc.alert.RuleName,
+			"agent", esc.alert.AgentID,
+			"level", esc.alert.EscalationLevel,
+			"notifiers", esc.tier.Notifiers,
+		)
+		notifyTargets(ctx, esc.tier.Notifiers, esc.alert)
+
+		if db != nil {
+			if err := db.SetEscalationLevel(ctx, esc.alert.ID, esc.alert.EscalationLevel); err != nil {
+				slog.Warn("failed to store escalation level", "id", esc.alert.ID, "err", err)
+			}
+		}
+	}
+}
+
+// StartEscalations checks open alerts for due escalation tiers every
+// interval until ctx is cancelled.
+func StartEscalations(ctx context.Context, db database.Service, interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case now := <-ticker.C:
+				tickCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+				escalations.tick(tickCtx, db, now)
+				cancel()
+			}
+		}
+	}()
+}
@@ -0,0 +1,133 @@
+package grpc
+
+import (
+	"gowatch/internal/database"
+	"testing"
+	"time"
+)
+
+func TestEscalationDue(t *testing.T) {
+
+	RegisterEscalationPolicy(EscalationPolicy{
+		Name:        "test-policy",
+		MinSeverity: SeverityCritical,
+		Tiers: []EscalationTier{
+			{After: 10 * time.Minute, Notifiers: []string{"pager"}},
+			{After: 30 * time.Minute, Notifiers: []string{"manager"}},
+		},
+	})
+	SetServiceEscalation("payments", "test-policy")
+	defer SetServiceEscalation("payments", "")
+
+	fired := time.Unix(1_000_000, 0)
+
+	e := newEscalator()
+	e.track(database.Alert{ID: 1, ServiceName: "payments", Severity: "critical", Status: StatusFiring, Timestamp: fired.Unix()})
+	e.track(database.Alert{ID: 2, ServiceName: "payments", Severity: "warning", Status: StatusFiring, Timestamp: fired.Unix()})
+	e.track(database.Alert{ID: 3, ServiceName: "payments", Severity: "critical", Status: StatusFiring, Timestamp: fired.Unix(), AcknowledgedBy: "alice"})
+
+	if got := e.due(fired.Add(9 * time.Minute)); len(got) != 0 {
+		t.Fatalf("expected nothing due before 10m; got %+v", got)
+	}
+
+	got := e.due(fired.Add(10 * time.Minute))
+	if len(got) != 1 || got[0].alert.ID != 1 || got[0].tier.Notifiers[0] != "pager" || got[0].alert.EscalationLevel != 1 {
+		t.Fatalf("expected first tier of alert 1; got %+v", got)
+	}
+
+	// A tier is notified once.
+	if got := e.due(fired.Add(11 * time.Minute)); len(got) != 0 {
+		t.Fatalf("expected first tier not to repeat; got %+v", got)
+	}
+
+	// An update from the lifecycle does not reset the level reached.
+	e.track(database.Alert{ID: 1, ServiceName: "payments", Severity: "critical", Status: StatusFiring, Timestamp: fired.Unix()})
+	got = e.due(fired.Add(30 * time.Minute))
+	if len(got) != 1 || got[0].tier.Notifiers[0] != "manager" {
+		t.Fatalf("expected second tier; got %+v", got)
+	}
+
+	// Resolved alerts are dropped.
+	e.track(database.Alert{ID: 1, Status: StatusResolved})
+	if len(e.open) != 2 {
+		t.Errorf("expected resolved alert to be dropped; open %v", e.open)
+	}
+}
+
+func TestEscalationRechecksAtDueTime(t *testing.T) {
+	RegisterEscalationPolicy(EscalationPolicy{
+		Name:        "recheck-policy",
+		MinSeverity: SeverityCritical,
+		Tiers:       []EscalationTier{{After: 10 * time.Minute, Notifiers: []string{"pager"}}},
+	})
+	SetServiceEscalation("recheck", "recheck-policy")
+	defer SetServiceEscalation("recheck", "")
+
+	// The agent clock is an hour behind: tiers count from the server time.
+	fired := time.Unix(2_000_000, 0)
+	e := newEscalator()
+	e.track(database.Alert{ID: 1, ServiceName: "recheck", Severity: "critical", Status: StatusFiring,
+		Timestamp: fired.Add(-time.Hour).Unix(), FiredAt: fired.Unix()})
+
+	if got := e.due(fired.Add(5 * time.Minute)); len(got) != 0 {
+		t.Fatalf("expected nothing due 5m after firing; got %+v", got)
+	}
+
+	// A silence created after the alert fired holds the tier back.
+	silences.set([]database.Silence{{
+		Matchers: []database.Matcher{{Label: "service_name", Value: "recheck"}},
+		StartsAt: fired.Add(8 * time.Minute).Unix(),
+		EndsAt:   fired.Add(20 * time.Minute).Unix(),
+	}})
+	defer silences.set(nil)
+
+	if got := e.due(fired.Add(15 * time.Minute)); len(got) != 0 {
+		t.Fatalf("expected silenced alert not to escalate; got %+v", got)
+	}
+	if got := e.due(fired.Add(21 * time.Minute)); len(got) != 1 {
+		t.Fatalf("expected escalation once the silence ended; got %+v", got)
+	}
+}
+
+func TestParseEscalationPolicies(t *testing.T) {
+	cfg, err := ParseEscalationPolicies([]byte(`{
+		"policies": [{"name": "file-policy", "min_severity": "warning",
+		              "tiers": [{"after": "5m", "notifiers": ["pager"]}, {"after": "20m", "notifiers": ["manager"]}]}],
+		"services": {"file-service": "file-policy", "other-service": "oncall"}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := SetEscalationConfig(cfg); err != nil {
+		t.Fatal(err)
+	}
+	defer SetServiceEscalation("file-service", "")
+	defer SetServiceEscalation("other-service", "")
+
+	p, ok := policyFor(database.Alert{ServiceName: "file-service"})
+	if !ok || p.MinSeverity != SeverityWarning || len(p.Tiers) != 2 || p.Tiers[1].After != 20*time.Minute {
+		t.Errorf("expected file-policy for file-service; got %+v", p)
+	}
+
+	for _, bad := range []string{
+		`{"services": {"payments": "missing"}}`,
+		`{"policies": [{"name": "p", "min_severity": "critical", "tiers": [{"after": "10m", "notifiers": ["pager"]}, {"after": "5m", "notifiers": ["pager"]}]}]}`,
+		`{"policies": [{"name": "p", "min_severity": "loud", "tiers": [{"after": "10m", "notifiers": ["pager"]}]}]}`,
+		`{"policies": [{"name": "p", "min_severity": "critical", "tiers": [{"after": "10m"}]}]}`,
+		`{"policies": [{"name": "p", "severity": "critical"}]}`,
+	} {
+		if _, err := ParseEscalationPolicies([]byte(bad)); err == nil {
+			t.Errorf("expected %s to be rejected", bad)
+		}
+	}
+}
+
+func TestRulesRejectUnknownEscalation(t *testing.T) {
+	r := AlertRule{Name: "Unknown Policy", Metric: "cpu", Threshold: 90, Comparison: ">", Severity: SeverityCritical, Escalation: "no-such-policy"}
+	if err := validateRule(r); err == nil {
+		t.Error("expected a rule naming an unknown escalation policy to be rejected")
+	}
+	r.Escalation = "oncall"
+	if err := validateRule(r); err != nil {
+		t.Errorf("expected the built-in policy to be accepted; got %v", err)
+	}
+}
@@ -0,0 +1,290 @@
+package grpc
+
+import (
+	"errors"
+	"fmt"
+	pb "gowatch/gopherwatch/pkg/generated"
+	"gowatch/internal/expr"
+	"math"
+	"slices"
+	"sync"
+	"time"
+)
+
+// -------------------- EXPRESSION RULES --------------------
+
+// ExprEvaluator evaluates rules written in the expression language of
+// internal/expr, e.g. "cpu > 90 && memory > 80". Rules without Expr are
+// threshold rules and are handed to SimpleEvaluator.
+type ExprEvaluator struct {
+	state *evalState // nil: the workers' state
+}
+
+// programs caches compiled expressions by source.
+var programs sync.Map // string → *expr.Program
+
+// compileExpr compiles an expression against the reported metrics.
+func compileExpr(src string) (*expr.Program, error) {
+	if p, ok := programs.Load(src); ok {
+		return p.(*expr.Program), nil
+	}
+
+	env := expr.Env{}
+	for _, m := range metricNames {
+		if counterMetrics[m] {
+			env.Counters = append(env.Counters, m)
+		} else {
+			env.Gauges = append(env.Gauges, m)
+		}
+	}
+
+	p, err := expr.Compile(src, env)
+	if err != nil {
+		return nil, err
+	}
+	programs.Store(src, p)
+	return p, nil
+}
+
+func (e ExprEvaluator) Evaluate(metric *pb.MetricReport, rule AlertRule) (bool, error) {
+	if rule.Expr == "" {
+		return SimpleEvaluator{state: e.state}.Evaluate(metric, rule)
+	}
+
+	// LoadRules rejects invalid expressions; only rules set up without it
+	// get an error here.
+	p, err := compileExpr(rule.Expr)
+	if err != nil {
+		return false, fmt.Errorf("invalid expression: %w", err)
+	}
+	// Judged with other evaluators at the clear threshold, the expression
+	// is cleared once it no longer holds.
+	fired := p.Eval(reportSource{metric: metric, history: e.state.orLive().history})
+	return fired != rule.clearing, nil
+}
+
+// exprValue returns the left operand of the rule expression's first
+// comparison, e.g. the rate in "rate(net_bytes[5m]) > 1e8", or 0 when it
+// cannot be computed.
+func (s *evalState) exprValue(metric *pb.MetricReport, rule AlertRule) float64 {
+	p, err := compileExpr(rule.Expr)
+	if err != nil {
+		return 0
+	}
+	v := p.Value(reportSource{metric: metric, history: s.orLive().history})
+	if math.IsNaN(v) || math.IsInf(v, 0) {
+		return 0
+	}
+	return v
+}
+
+// reportSource exposes a report and its agent's history to a program.
+type reportSource struct {
+	metric  *pb.MetricReport
+	history *agentHistory
+}
+
+func (s reportSource) Value(name string) float64 {
+	return getValue(s.metric, name)
+}
+
+func (s reportSource) Range(name string, d time.Duration) []expr.Point {
+	return s.history.rangeOf(s.metric.AgentId, name, s.metric.Timestamp, d)
+}
+
+func (s reportSource) Last(name string, n int) []expr.Point {
+	return s.history.last(s.metric.AgentId, name, s.metric.Timestamp, n)
+}
+
+// -------------------- LOADING RULES --------------------
+
+// LoadRules validates and compiles a rule set and makes it the set the
+// workers evaluate. Every invalid rule is reported; on error the current
+// rules are kept. It can be called while the workers run: reports already
+// being evaluated finish with the previous rules.
+func LoadRules(list []AlertRule) error {
+	if err := validateRules(list); err != nil {
+		return err
+	}
+
+	var retention time.Duration
+	var samples int
+	for _, r := range list {
+		live.prepare(r)
+		d, n := historyNeeds(r)
+		retention, samples = max(retention, d), max(samples, n)
+	}
+	// prepare only grows the history; it shrinks to what these rules need.
+	live.history.limit(retention, samples)
+
+	rulesMu.Lock()
+	ruleSet = newRuleIndex(list)
+	rulesMu.Unlock()
+	return nil
+}
+
+// validateRule checks one rule and compiles its expression.
+func validateRule(r AlertRule) error {
+	if r.Name == "" {
+		return errors.New("name is required")
+	}
+	if r.For < 0 || r.ResolveAfter < 0 {
+		return errors.New("for and resolve_after must not be negative")
+	}
+	if r.Escalation != "" && !hasEscalationPolicy(r.Escalation) {
+		return fmt.Errorf("unknown escalation policy %q", r.Escalation)
+	}
+	if err := r.Scope.validate(); err != nil {
+		return err
+	}
+	for _, o := range r.Overrides {
+		if err := o.validate(r); err != nil {
+			return fmt.Errorf("override: %w", err)
+		}
+	}
+
+	if r.Evaluator != "" && len(r.Evaluators) > 0 {
+		return errors.New("a rule names either one evaluator or several")
+	}
+	if r.Combine != "" && len(r.Evaluators) == 0 {
+		return errors.New("combine needs several evaluators")
+	}
+	if r.Combine != "" && r.Combine != CombineAll && r.Combine != CombineAny {
+		return fmt.Errorf("unknown combine %q", r.Combine)
+	}
+	for _, name := range r.evaluatorNames() {
+		ev, err := lookupEvaluator(name)
+		if err != nil {
+			return err
+		}
+		v, ok := ev.(RuleValidator)
+		if !ok {
+			continue
+		}
+		if err := v.ValidateRule(r); err != nil && len(r.Evaluators) > 0 {
+			return fmt.Errorf("evaluator %q: %w", name, err)
+		} else if err != nil {
+			return err
+		}
+	}
+
+	if err := validateKinds(r); err != nil {
+		return err
+	}
+
+	if r.Expr != "" {
+		if _, err := compileExpr(r.Expr); err != nil {
+			return err
+		}
+		if len(r.Evaluators) == 0 {
+			return validateExprRule(r)
+		}
+	}
+	if err := r.Window.validate(r.Metric); err != nil {
+		return err
+	}
+	if err := r.Anomaly.validate(); err != nil {
+		return err
+	}
+	if err := r.Forecast.validate(); err != nil {
+		return err
+	}
+	if err := r.Peer.validate(); err != nil {
+		return err
+	}
+	if err := r.External.validate(); err != nil {
+		return err
+	}
+	if r.Forecast != nil && r.Comparison != "<" && r.Comparison != "<=" {
+		return errors.New("forecast rules compare the hours left with < or <=")
+	}
+	for _, t := range r.tiers() {
+		if _, err := ParseSeverity(string(t.Severity)); err != nil {
+			return err
+		}
+	}
+	if !r.readsComparison() {
+		return nil
+	}
+	switch r.Comparison {
+	case ">", "<", ">=", "<=":
+	default:
+		return fmt.Errorf("unknown comparison %q", r.Comparison)
+	}
+	return nil
+}
+
+// validateExprRule rejects the threshold settings of an expression rule:
+// its condition carries its own thresholds, so tiers, a comparison or a
+// clear threshold would never be read.
+func validateExprRule(r AlertRule) error {
+	if len(r.Tiers) > 0 || r.Comparison != "" || r.ClearThreshold != nil {
+		return errors.New("expression rules carry their thresholds in the expression; tiers, comparison and clear_threshold are not read")
+	}
+	for _, o := range r.Overrides {
+		if o.Threshold != nil || o.Tiers != nil || o.ClearThreshold != nil {
+			return errors.New("expression rules carry their thresholds in the expression; overrides can only disable them")
+		}
+	}
+	if _, err := ParseSeverity(string(r.tiers()[0].Severity)); err != nil {
+		return err
+	}
+	return nil
+}
+
+// validateKinds checks the kinds of settings of a rule. A rule judged by
+// one evaluator has at most one kind; with several, every setting needs
+// the evaluator reading it.
+func validateKinds(r AlertRule) error {
+	if len(r.Evaluators) == 0 {
+		kinds := 0
+		for _, set := range []bool{r.Expr != "", r.Window != nil, r.Anomaly != nil, r.Forecast != nil, r.Peer != nil, r.External != nil} {
+			if set {
+				kinds++
+			}
+		}
+		if kinds > 1 {
+			return errors.New("a rule can have only one of an expression, a window, anomaly detection, a forecast, peer comparison or external evaluation")
+		}
+		return nil
+	}
+
+	if r.Window != nil && r.Forecast != nil {
+		return errors.New("a rule can have only one of a window or a forecast")
+	}
+	for _, s := range []struct {
+		set       bool
+		what      string
+		evaluator string
+	}{
+		{r.Expr != "", "an expression", EvaluatorExpression},
+		{r.Window != nil, "a window", EvaluatorThreshold},
+		{r.Forecast != nil, "a forecast", EvaluatorThreshold},
+		{r.Anomaly != nil, "anomaly settings", EvaluatorAnomaly},
+		{r.Peer != nil, "peer settings", EvaluatorPeer},
+		{r.External != nil, "external settings", EvaluatorExternal},
+	} {
+		if s.set && !slices.Contains(r.Evaluators, s.evaluator) {
+			return fmt.Errorf("%s needs the %s evaluator in evaluators", s.what, s.evaluator)
+		}
+	}
+	return nil
+}
+
+// readsComparison reports whether an evaluator of the rule compares a value
+// with its Comparison. Expression rules carry their own comparisons, and
+// anomaly and peer evaluators judged with others their own sensitivity.
+func (r AlertRule) readsComparison() bool {
+	if len(r.Evaluators) == 0 {
+		return r.Expr == ""
+	}
+	for _, name := range r.Evaluators {
+		switch {
+		case name == EvaluatorExpression && r.Expr != "":
+		case name == EvaluatorAnomaly, name == EvaluatorPeer:
+		default:
+			return true
+		}
+	}
+	return false
+}
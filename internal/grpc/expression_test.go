@@ -0,0 +1,125 @@
+package grpc
+
+import (
+	pb "gowatch/gopherwatch/pkg/generated"
+	"strings"
+	"testing"
+)
+
+func TestExprEvaluator(t *testing.T) {
+
+	rule := AlertRule{Name: "Disk jump", Expr: "disk - avg_over_time(disk[1h]) > 10"}
+	live.prepare(rule)
+
+	// An hour of flat disk usage, then a jump.
+	for ts := int64(0); ts < 3600; ts += 60 {
+		history.add(&pb.MetricReport{AgentId: "expr-agent", DiskUsage: 50, Timestamp: ts})
+	}
+
+	jump := &pb.MetricReport{AgentId: "expr-agent", DiskUsage: 70, Timestamp: 3600}
+	history.add(jump)
+
+	if !fires(t, ExprEvaluator{}, jump, rule) {
+		t.Errorf("expected jump of 20 over the hourly average to fire")
+	}
+
+	steady := &pb.MetricReport{AgentId: "expr-agent-2", DiskUsage: 70, Timestamp: 3600}
+	history.add(steady)
+	if fires(t, ExprEvaluator{}, steady, rule) {
+		t.Errorf("expected a single sample not to deviate from its own average")
+	}
+
+	// Threshold rules still go through SimpleEvaluator.
+	cpu := AlertRule{Name: "High CPU", Metric: "cpu", Threshold: 90, Comparison: ">"}
+	if !fires(t, ExprEvaluator{}, &pb.MetricReport{CpuUsage: 95}, cpu) {
+		t.Errorf("expected threshold rule to fire")
+	}
+}
+
+func TestLoadRulesReportsCompileErrors(t *testing.T) {
+
+	prev := loadedRules()
+
+	err := LoadRules([]AlertRule{
+		{Name: "ok", Expr: "cpu > 90 && memory > 80"},
+		{Name: "typo", Expr: "cpu > 90 &&& memory > 80"},
+		{Name: "gpu", Expr: "gpu > 90"},
+	})
+	if err == nil {
+		t.Fatal("expected compile errors")
+	}
+	for _, want := range []string{`rule "typo": col 12:`, `rule "gpu": col 1: unknown metric "gpu"`} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("expected %q in %q", want, err)
+		}
+	}
+	if loadedRules() != prev {
+		t.Errorf("expected rules to be kept on error")
+	}
+}
+
+func TestExprRuleOnCounter(t *testing.T) {
+
+	// The example of the expression language: more than 100 MB/s of
+	// network traffic over 5 minutes.
+	rule, err := ParseRule([]byte(`{"name": "Network saturated", "expr": "rate(net_bytes[5m]) > 1e8", "severity": "critical"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 50 MB/s for 5 minutes, then 200 MB/s.
+	var reports []*pb.MetricReport
+	var total float64
+	for ts := int64(0); ts <= 900; ts += 60 {
+		if ts > 0 && ts <= 300 {
+			total += 60 * 5e7
+		} else if ts > 300 {
+			total += 60 * 2e8
+		}
+		reports = append(reports, &pb.MetricReport{AgentId: "net-agent", NetBytes: total, Timestamp: ts})
+	}
+
+	got, err := Replay([]AlertRule{rule}, reports)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 1 || got[0].Kind != "fired" {
+		t.Fatalf("expected the rule to fire once; got %+v", got)
+	}
+
+	// At 420 the window (120, 420] holds three slow and two fast minutes:
+	// 3e10 bytes in 240s. The alert carries that rate, not 0.
+	if got[0].At != 420 || got[0].Value != 1.25e8 {
+		t.Errorf("expected to fire at 420 with a rate of 1.25e8; got %+v", got[0])
+	}
+}
+
+func TestExprRulesRejectThresholdSettings(t *testing.T) {
+
+	for name, r := range map[string]AlertRule{
+		"clear threshold": {Name: "x", Expr: "cpu > 90", ClearThreshold: floatPtr(80)},
+		"tiers":           {Name: "x", Expr: "cpu > 90", Tiers: []Tier{{Severity: SeverityWarning, Threshold: 80}}},
+		"comparison":      {Name: "x", Expr: "cpu > 90", Comparison: ">"},
+		"override":        {Name: "x", Expr: "cpu > 90", Overrides: []Override{{Threshold: floatPtr(95)}}},
+	} {
+		if err := validateRule(r); err == nil || !strings.Contains(err.Error(), "in the expression") {
+			t.Errorf("%s: expected the rule to be rejected; got %v", name, err)
+		}
+	}
+
+	// Judged with the threshold evaluator, the clear threshold is its own:
+	// the rule clears once cpu is below 80.
+	r := AlertRule{Name: "Hot and busy", Metric: "cpu", Threshold: 90, Comparison: ">", ClearThreshold: floatPtr(80),
+		Expr: "memory > 50", Evaluators: []string{EvaluatorThreshold, EvaluatorExpression}}
+	var reports []*pb.MetricReport
+	for i, cpu := range []float64{95, 85, 10} {
+		reports = append(reports, &pb.MetricReport{AgentId: "expr-clear", CpuUsage: cpu, MemoryUsage: 60, Timestamp: int64(i * 15)})
+	}
+	transitions, err := Replay([]AlertRule{r}, reports)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(transitions) != 2 || transitions[0].Kind != "fired" || transitions[1].Kind != "resolved" || transitions[1].At != 30 {
+		t.Errorf("expected to fire and resolve at 30; got %+v", transitions)
+	}
+}
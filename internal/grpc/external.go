@@ -0,0 +1,326 @@
+package grpc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	pb "gowatch/gopherwatch/pkg/generated"
+	"log/slog"
+	"slices"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+// -------------------- EXTERNAL EVALUATION --------------------
+
+// EvaluatorExternal is the name ExternalEvaluator is registered under.
+const EvaluatorExternal = "external"
+
+// External makes a rule ask an external EvaluatorService (see
+// proto/evaluator.proto) whether the agent's recent samples cross it, so
+// detection models can live outside gowatch:
+//
+//	{Name: "CPU model", Metric: "cpu", Threshold: 90, Comparison: ">",
+//	 External: &External{Model: "cpu-iforest"}}
+//
+// While the service is unavailable the rule falls back to comparing the
+// sample with its Threshold, unless NoFallback is set.
+type External struct {
+	Model      string        // passed to the service
+	Window     time.Duration // samples sent with each call (default 5m)
+	NoFallback bool          // surface failures as evaluation errors instead
+}
+
+// Circuit breaker settings of ExternalEvaluator.
+const (
+	breakerFailures = 5                // consecutive failures that open the circuit
+	breakerCooldown = 30 * time.Second // how long it stays open before a trial call
+)
+
+var errCircuitOpen = errors.New("circuit open")
+
+func (x *External) validate() error {
+	if x == nil {
+		return nil
+	}
+	if x.Window < 0 {
+		return errors.New("external window must not be negative")
+	}
+	return nil
+}
+
+func (x *External) window() time.Duration {
+	if x.Window == 0 {
+		return 5 * time.Minute
+	}
+	return x.Window
+}
+
+// ExternalEvaluator evaluates rules with External by calling an
+// EvaluatorService. Calls time out after the evaluator's timeout, and
+// after breakerFailures consecutive failures the service is not called for
+// breakerCooldown.
+//
+// Calls are made synchronously by the worker evaluating the report, so a
+// slow service holds that worker for up to the timeout on every report of
+// an external rule; keep the timeout well below the agents' report
+// interval. The score and explanation of the latest answer are kept per
+// rule and agent and put on the alert the answer fires or escalates.
+type ExternalEvaluator struct {
+	client  pb.EvaluatorServiceClient
+	timeout time.Duration
+	breaker *breaker
+	state   *evalState // nil: the workers' state
+}
+
+// NewExternalEvaluator returns an evaluator calling the EvaluatorService
+// at addr. The connection is made on the first call.
+func NewExternalEvaluator(addr string, timeout time.Duration) (*ExternalEvaluator, error) {
+	conn, err := grpc.NewClient(addr, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		return nil, fmt.Errorf("external evaluator: %w", err)
+	}
+	return newExternalEvaluator(pb.NewEvaluatorServiceClient(conn), timeout), nil
+}
+
+func newExternalEvaluator(client pb.EvaluatorServiceClient, timeout time.Duration) *ExternalEvaluator {
+	return &ExternalEvaluator{
+		client:  client,
+		timeout: timeout,
+		breaker: &breaker{failures: breakerFailures, cooldown: breakerCooldown, now: time.Now},
+	}
+}
+
+func (e *ExternalEvaluator) withState(s *evalState) Evaluator {
+	c := *e
+	c.state = s
+	return &c
+}
+
+func (e *ExternalEvaluator) ValidateRule(r AlertRule) error {
+	if r.External == nil {
+		return errors.New("the external evaluator needs external settings")
+	}
+	return nil
+}
+
+func (e *ExternalEvaluator) Evaluate(metric *pb.MetricReport, rule AlertRule) (bool, error) {
+	if rule.External == nil {
+		return false, errors.New("rule has no external settings")
+	}
+
+	if !e.breaker.allow() {
+		return e.fallback(metric, rule, errCircuitOpen)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), e.timeout)
+	defer cancel()
+
+	resp, err := e.client.Evaluate(ctx, e.request(metric, rule))
+	e.breaker.done(err)
+	if err != nil {
+		return e.fallback(metric, rule, err)
+	}
+
+	e.note(metric, rule, resp, resp.Verdict)
+	return resp.Verdict, nil
+}
+
+// EvaluateChecks asks the service about every threshold of the rule in a
+// single call.
+func (e *ExternalEvaluator) EvaluateChecks(metric *pb.MetricReport, rule AlertRule, checks []Check) ([]bool, error) {
+	if rule.External == nil {
+		return nil, errors.New("rule has no external settings")
+	}
+
+	if !e.breaker.allow() {
+		return e.fallbackChecks(metric, rule, checks, errCircuitOpen)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), e.timeout)
+	defer cancel()
+
+	req := e.request(metric, rule)
+	for _, c := range checks {
+		req.Checks = append(req.Checks, &pb.Check{Threshold: c.Threshold, Comparison: c.Comparison})
+	}
+
+	resp, err := e.client.Evaluate(ctx, req)
+	if err == nil && len(resp.Verdicts) != len(checks) {
+		err = fmt.Errorf("%d verdicts for %d checks", len(resp.Verdicts), len(checks))
+	}
+	e.breaker.done(err)
+	if err != nil {
+		return e.fallbackChecks(metric, rule, checks, err)
+	}
+
+	e.note(metric, rule, resp, slices.Contains(resp.Verdicts, true))
+	return resp.Verdicts, nil
+}
+
+// note keeps the score and explanation of an answer for the alert it may
+// fire or escalate, and logs them when a verdict fired.
+func (e *ExternalEvaluator) note(metric *pb.MetricReport, rule AlertRule, resp *pb.EvaluateResponse, fired bool) {
+	e.state.orLive().verdicts.set(alertKey{agent: metric.AgentId, rule: rule.Name},
+		externalVerdict{score: resp.Score, explanation: resp.Explanation})
+
+	if fired {
+		slog.Debug("external verdict",
+			"rule", rule.Name,
+			"agent", metric.AgentId,
+			"score", resp.Score,
+			"explanation", resp.Explanation,
+		)
+	}
+}
+
+// request builds the call for one rule tier with the agent's window.
+func (e *ExternalEvaluator) request(metric *pb.MetricReport, rule AlertRule) *pb.EvaluateRequest {
+	points := e.state.orLive().history.rangeOf(metric.AgentId, rule.Metric, metric.Timestamp, rule.External.window())
+
+	samples := make([]*pb.Sample, 0, len(points))
+	for _, p := range points {
+		samples = append(samples, &pb.Sample{Timestamp: p.T, Value: p.V})
+	}
+
+	return &pb.EvaluateRequest{
+		RuleName:    rule.Name,
+		Model:       rule.External.Model,
+		AgentId:     metric.AgentId,
+		ServiceName: metric.ServiceName,
+		Metric:      rule.Metric,
+		Threshold:   rule.Threshold,
+		Comparison:  rule.Comparison,
+		Samples:     samples,
+	}
+}
+
+// fallback judges the rule as a threshold rule when the service failed.
+// The score of an earlier answer is dropped, so it is not put on an alert
+// the threshold fired.
+func (e *ExternalEvaluator) fallback(metric *pb.MetricReport, rule AlertRule, err error) (bool, error) {
+	e.state.orLive().verdicts.forget(alertKey{agent: metric.AgentId, rule: rule.Name})
+	if rule.External.NoFallback {
+		return false, fmt.Errorf("external evaluator: %w", err)
+	}
+	return SimpleEvaluator{state: e.state}.Evaluate(metric, rule)
+}
+
+// fallbackChecks judges every threshold as a threshold rule when the
+// service failed.
+func (e *ExternalEvaluator) fallbackChecks(metric *pb.MetricReport, rule AlertRule, checks []Check, err error) ([]bool, error) {
+	out := make([]bool, len(checks))
+	for i, c := range checks {
+		r := rule
+		r.Threshold, r.Comparison = c.Threshold, c.Comparison
+		fired, err := e.fallback(metric, r, err)
+		if err != nil {
+			return nil, err
+		}
+		out[i] = fired
+	}
+	return out, nil
+}
+
+// externalVerdict is what the service said about a rule on an agent.
+type externalVerdict struct {
+	score       float64
+	explanation string
+}
+
+// verdictCache keeps the latest answer of the service per rule and agent.
+type verdictCache struct {
+	mu      sync.Mutex
+	answers map[alertKey]externalVerdict
+}
+
+func newVerdictCache() *verdictCache {
+	return &verdictCache{answers: map[alertKey]externalVerdict{}}
+}
+
+func (c *verdictCache) set(key alertKey, v externalVerdict) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.answers[key] = v
+}
+
+func (c *verdictCache) forget(key alertKey) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.answers, key)
+}
+
+func (c *verdictCache) get(key alertKey) (externalVerdict, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	v, ok := c.answers[key]
+	return v, ok
+}
+
+// drop forgets the answers about agents.
+func (c *verdictCache) drop(agents []string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for k := range c.answers {
+		if slices.Contains(agents, k.agent) {
+			delete(c.answers, k)
+		}
+	}
+}
+
+// -------------------- CIRCUIT BREAKER --------------------
+
+// breaker stops calling a failing service. It opens after failures
+// consecutive errors; once cooldown has passed a single trial call is let
+// through, which closes it on success and reopens it on failure.
+type breaker struct {
+	mu        sync.Mutex
+	failures  int
+	cooldown  time.Duration
+	now       func() time.Time
+	failed    int       // consecutive failures
+	openUntil time.Time // zero: closed
+	probing   bool      // a trial call is in flight
+}
+
+func (b *breaker) allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.openUntil.IsZero() {
+		return true
+	}
+	if b.probing || b.now().Before(b.openUntil) {
+		return false
+	}
+	b.probing = true
+	return true
+}
+
+func (b *breaker) done(err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if err == nil {
+		if !b.openUntil.IsZero() {
+			slog.Info("external evaluator recovered")
+		}
+		b.failed = 0
+		b.openUntil = time.Time{}
+		b.probing = false
+		return
+	}
+
+	b.failed++
+	if b.probing || b.failed >= b.failures {
+		if b.openUntil.IsZero() {
+			slog.Warn("external evaluator unavailable, falling back", "failures", b.failed, "err", err)
+		}
+		b.openUntil = b.now().Add(b.cooldown)
+		b.probing = false
+	}
+}
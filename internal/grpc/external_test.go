@@ -0,0 +1,151 @@
+package grpc
+
+import (
+	"context"
+	"errors"
+	pb "gowatch/gopherwatch/pkg/generated"
+	"strings"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+)
+
+// fakeModel answers with a verdict, or fails while err is set.
+type fakeModel struct {
+	calls   int
+	last    *pb.EvaluateRequest
+	verdict bool
+	err     error
+}
+
+func (m *fakeModel) Evaluate(ctx context.Context, in *pb.EvaluateRequest, opts ...grpc.CallOption) (*pb.EvaluateResponse, error) {
+	m.calls++
+	m.last = in
+	if m.err != nil {
+		return nil, m.err
+	}
+	resp := &pb.EvaluateResponse{Verdict: m.verdict, Score: 0.97, Explanation: "unusual"}
+
+	// Checks are judged on the last sample, like a threshold.
+	if n := len(in.Samples); n > 0 {
+		for _, c := range in.Checks {
+			resp.Verdicts = append(resp.Verdicts, compare(in.Samples[n-1].Value, c.Threshold, c.Comparison))
+		}
+	}
+	return resp, nil
+}
+
+func TestExternalEvaluator(t *testing.T) {
+	model := &fakeModel{verdict: true}
+	ev := newExternalEvaluator(model, time.Second).withState(newEvalState()).(*ExternalEvaluator)
+
+	rule := AlertRule{Name: "CPU model", Metric: "cpu", Threshold: 90, Comparison: ">",
+		External: &External{Model: "iforest", Window: time.Minute}}
+	if err := ev.ValidateRule(rule); err != nil {
+		t.Fatal(err)
+	}
+	if err := validateRule(rule); err == nil {
+		t.Error("expected external rules to need a registered external evaluator")
+	}
+	ev.state.prepare(rule)
+
+	var m *pb.MetricReport
+	for ts := int64(0); ts <= 120; ts += 30 {
+		m = &pb.MetricReport{AgentId: "model-agent", CpuUsage: 40, Timestamp: ts}
+		ev.state.history.add(m)
+	}
+
+	// The service decides, even below the threshold, from the window.
+	if !fires(t, ev, m, rule) {
+		t.Error("expected the model's verdict")
+	}
+	if got := len(model.last.Samples); got != 2 || model.last.Model != "iforest" {
+		t.Errorf("expected the last minute (2 samples) for iforest; got %d for %q", got, model.last.Model)
+	}
+
+	// Failures fall back to the threshold.
+	model.err = errors.New("unavailable")
+	if fires(t, ev, m, rule) {
+		t.Error("expected the threshold fallback at 40%")
+	}
+
+	noFallback := rule
+	noFallback.External = &External{NoFallback: true}
+	if _, err := ev.Evaluate(m, noFallback); err == nil {
+		t.Error("expected the failure to surface without fallback")
+	}
+}
+
+func TestExternalCircuitBreaker(t *testing.T) {
+	model := &fakeModel{err: errors.New("unavailable")}
+	ev := newExternalEvaluator(model, time.Second)
+	now := time.Unix(0, 0)
+	ev.breaker.now = func() time.Time { return now }
+
+	rule := AlertRule{Name: "CPU model", Metric: "cpu", Threshold: 90, Comparison: ">", External: &External{}}
+	m := &pb.MetricReport{AgentId: "breaker-agent", CpuUsage: 95}
+
+	for i := 0; i < breakerFailures+3; i++ {
+		if !fires(t, ev, m, rule) {
+			t.Fatal("expected the threshold fallback at 95%")
+		}
+	}
+	if model.calls != breakerFailures {
+		t.Errorf("expected the circuit to open after %d calls; got %d", breakerFailures, model.calls)
+	}
+
+	// After the cooldown one trial call goes through; it succeeds.
+	now = now.Add(breakerCooldown)
+	model.err = nil
+	fires(t, ev, m, rule)
+	fires(t, ev, m, rule)
+	if model.calls != breakerFailures+2 {
+		t.Errorf("expected the circuit to close after a good trial; got %d calls", model.calls)
+	}
+}
+
+func TestExternalOneCallPerReport(t *testing.T) {
+	model := &fakeModel{}
+	RegisterEvaluator("test-external", newExternalEvaluator(model, time.Second))
+
+	rule := AlertRule{Name: "CPU model", Evaluator: "test-external", Metric: "cpu", Comparison: ">",
+		Tiers:          []Tier{{Severity: SeverityWarning, Threshold: 80}, {Severity: SeverityCritical, Threshold: 95}},
+		ClearThreshold: floatPtr(70), External: &External{}}
+	if err := validateRule(rule); err != nil {
+		t.Fatal(err)
+	}
+
+	s := newEvalState()
+	s.prepare(rule)
+	tr := &alertTracker{state: s}
+	idx := newRuleIndex([]AlertRule{rule})
+	rec := &recorder{}
+
+	// Every report asks about both tiers and the clear threshold at once:
+	// 85 crosses the warning tier, 75 is between, 60 clears.
+	for i, cpu := range []float64{85, 75, 60} {
+		rec.at = int64(i * 30)
+		s.evaluate(t.Context(), tr, idx, &pb.MetricReport{AgentId: "batch-agent", CpuUsage: cpu, Timestamp: rec.at}, rec)
+
+		if model.calls != i+1 {
+			t.Fatalf("report %d: expected one call per report; got %d calls", i, model.calls)
+		}
+		if got := len(model.last.Checks); got != 3 {
+			t.Errorf("report %d: expected 3 checks; got %d", i, got)
+		}
+	}
+
+	var kinds []string
+	for _, tr := range rec.transitions {
+		kinds = append(kinds, tr.Kind+" "+string(tr.Severity))
+	}
+	if got, want := strings.Join(kinds, ", "), "fired warning, resolved warning"; got != want {
+		t.Fatalf("expected %q; got %q", want, got)
+	}
+
+	// The alert carries the model's answer.
+	if fired := rec.transitions[0]; fired.Score != 0.97 || fired.Explanation != "unusual" {
+		t.Errorf("expected the model's score and explanation on the alert; got %+v", fired)
+	}
+}
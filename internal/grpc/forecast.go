@@ -0,0 +1,317 @@
+package grpc
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	pb "gowatch/gopherwatch/pkg/generated"
+	"gowatch/internal/database"
+	"gowatch/internal/expr"
+	"math"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+)
+
+// -------------------- FORECASTING --------------------
+
+// Forecast makes a rule fire before a metric reaches its limit rather than
+// when it does. A trend is fitted to the agent's recent samples and the rule
+// compares the projected hours until the limit against its Threshold:
+//
+//	{Name: "Disk full soon", Metric: "disk", Threshold: 24, Comparison: "<",
+//	 Forecast: &Forecast{Lookback: 12 * time.Hour}}
+//
+// A metric that is flat or shrinking is never projected to fill up.
+type Forecast struct {
+	Method     string        // linear (default, least squares) | holt (double exponential smoothing)
+	Lookback   time.Duration // history the trend is fitted to (default 6h)
+	Limit      float64       // level considered full (default 100)
+	MinSamples int           // samples needed for a forecast (default 10)
+}
+
+// Smoothing factors of the Holt method for the level and the trend.
+const (
+	holtAlpha = 0.3
+	holtBeta  = 0.1
+)
+
+func (f *Forecast) validate() error {
+	if f == nil {
+		return nil
+	}
+
+	switch f.Method {
+	case "", "linear", "holt":
+	default:
+		return fmt.Errorf("unknown forecast method %q", f.Method)
+	}
+	if f.Lookback < 0 || f.Limit < 0 || f.MinSamples < 0 {
+		return fmt.Errorf("forecast lookback, limit and min samples must not be negative")
+	}
+	return nil
+}
+
+func (f *Forecast) method() string {
+	if f.Method == "" {
+		return "linear"
+	}
+	return f.Method
+}
+
+func (f *Forecast) lookback() time.Duration {
+	if f.Lookback == 0 {
+		return 6 * time.Hour
+	}
+	return f.Lookback
+}
+
+func (f *Forecast) limit() float64 {
+	if f.Limit == 0 {
+		return 100
+	}
+	return f.Limit
+}
+
+func (f *Forecast) minSamples() int {
+	if f.MinSamples == 0 {
+		return 10
+	}
+	return f.MinSamples
+}
+
+// forecastRefit is how often, in report time, a rule refits its trend to
+// the history. In between, the cached trend is extended to each report: a
+// trend over hours barely moves in a few minutes.
+const forecastRefit = 5 * time.Minute
+
+// forecastKey identifies the trend of one forecast setting on one metric
+// of one agent.
+type forecastKey struct {
+	agent    string
+	metric   string
+	forecast Forecast
+}
+
+// forecastFit is a fitted trend: the level at t and the slope per second.
+type forecastFit struct {
+	fittedAt int64 // report timestamp of the fit
+	t        int64
+	level    float64
+	slope    float64
+	ok       bool // false: too few samples
+}
+
+// forecastCache keeps the latest trend of every forecast rule and agent.
+type forecastCache struct {
+	mu   sync.Mutex
+	fits map[forecastKey]forecastFit
+}
+
+func newForecastCache() *forecastCache {
+	return &forecastCache{fits: map[forecastKey]forecastFit{}}
+}
+
+// drop forgets the trends of agents.
+func (c *forecastCache) drop(agents []string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for k := range c.fits {
+		if slices.Contains(agents, k.agent) {
+			delete(c.fits, k)
+		}
+	}
+}
+
+// hoursLeft projects the agent's history up to the report: NaN without
+// enough samples, +Inf when the metric is not growing. The trend is refit
+// every forecastRefit, or every report while there are too few samples.
+func (f *Forecast) hoursLeft(history *agentHistory, cache *forecastCache, metric *pb.MetricReport, name string) float64 {
+	key := forecastKey{agent: metric.AgentId, metric: name, forecast: *f}
+
+	cache.mu.Lock()
+	fit, cached := cache.fits[key]
+	cache.mu.Unlock()
+
+	age := metric.Timestamp - fit.fittedAt
+	if !cached || !fit.ok || age < 0 || age >= int64(forecastRefit/time.Second) {
+		ps := history.rangeOf(metric.AgentId, name, metric.Timestamp, f.lookback())
+		fit = forecastFit{fittedAt: metric.Timestamp}
+		if fit.level, fit.slope, fit.ok = f.fit(ps); fit.ok {
+			fit.t = ps[len(ps)-1].T
+		}
+
+		cache.mu.Lock()
+		cache.fits[key] = fit
+		cache.mu.Unlock()
+	}
+
+	if !fit.ok {
+		return math.NaN()
+	}
+	level := fit.level + fit.slope*float64(metric.Timestamp-fit.t)
+	return hoursUntil(level, fit.slope, f.limit())
+}
+
+// fit returns the level at the last sample and the per-second trend.
+func (f *Forecast) fit(ps []expr.Point) (level, slope float64, ok bool) {
+	if len(ps) < max(2, f.minSamples()) {
+		return 0, 0, false
+	}
+
+	if f.method() == "holt" {
+		return holt(ps)
+	}
+
+	slope = expr.Deriv(ps)
+	if math.IsNaN(slope) {
+		return 0, 0, false
+	}
+
+	// The least-squares line goes through the mean of the samples.
+	var sumT, sumV float64
+	for _, p := range ps {
+		sumT += float64(p.T - ps[0].T)
+		sumV += p.V
+	}
+	n := float64(len(ps))
+	last := float64(ps[len(ps)-1].T - ps[0].T)
+	return sumV/n + slope*(last-sumT/n), slope, true
+}
+
+// holt runs double exponential smoothing over irregularly spaced samples,
+// keeping the trend per second.
+func holt(ps []expr.Point) (level, slope float64, ok bool) {
+	level = ps[0].V
+	for i := 1; i < len(ps); i++ {
+		dt := float64(ps[i].T - ps[i-1].T)
+		if dt <= 0 {
+			continue
+		}
+		if i == 1 {
+			slope = (ps[1].V - ps[0].V) / dt
+		}
+
+		prev := level
+		level = holtAlpha*ps[i].V + (1-holtAlpha)*(level+slope*dt)
+		slope = holtBeta*(level-prev)/dt + (1-holtBeta)*slope
+	}
+	return level, slope, true
+}
+
+// hoursUntil returns the hours until level reaches limit at slope per
+// second: 0 when already there, +Inf when not growing.
+func hoursUntil(level, slope, limit float64) float64 {
+	if level >= limit {
+		return 0
+	}
+	if slope <= 0 {
+		return math.Inf(1)
+	}
+	return (limit - level) / slope / 3600
+}
+
+// -------------------- FORECAST ENDPOINT --------------------
+
+// ForecastResult is the projection served by GET /agents/{id}/forecast.
+type ForecastResult struct {
+	AgentID      string   `json:"agent_id"`
+	Metric       string   `json:"metric"`
+	Method       string   `json:"method"`
+	Lookback     string   `json:"lookback"`
+	Samples      int      `json:"samples"`
+	Current      float64  `json:"current"`        // fitted level at the last sample
+	SlopePerHour float64  `json:"slope_per_hour"` // trend of the fitted level
+	Limit        float64  `json:"limit"`
+	HoursToFull  *float64 `json:"hours_to_full"` // null when not growing or too few samples
+	FullAt       *int64   `json:"full_at"`       // Unix timestamp of the projected limit
+}
+
+// forecastHandler serves GET /agents/{id}/forecast?metric=&method=&lookback=
+// metric defaults to disk, method to linear and lookback (a Go duration) to
+// 6h. The trend is fitted to the stored samples, averaged per step.
+func (s *RestServer) forecastHandler(w http.ResponseWriter, r *http.Request) {
+	params := r.URL.Query()
+
+	f := Forecast{Method: params.Get("method")}
+	if v := params.Get("lookback"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			http.Error(w, "invalid lookback", http.StatusBadRequest)
+			return
+		}
+		f.Lookback = d
+	}
+	metric := params.Get("metric")
+	if metric == "" {
+		metric = "disk"
+	}
+	if !slices.Contains(metricNames, metric) {
+		http.Error(w, fmt.Sprintf("unknown metric %q", metric), http.StatusBadRequest)
+		return
+	}
+	if f.Method != "" && f.Method != "linear" && f.Method != "holt" {
+		http.Error(w, fmt.Sprintf("unknown forecast method %q", f.Method), http.StatusBadRequest)
+		return
+	}
+
+	now := time.Now().Unix()
+	q := database.RangeQuery{
+		AgentID: r.PathValue("id"),
+		Metric:  metric,
+		Start:   now - int64(f.lookback()/time.Second),
+		End:     now,
+		// About 360 points over the lookback, at least one per minute.
+		Step: max(60, int64(f.lookback()/time.Second)/360),
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 2*time.Second)
+	defer cancel()
+
+	res, err := s.db.QueryRange(ctx, q)
+	if err != nil {
+		http.Error(w, "failed to query samples", http.StatusInternalServerError)
+		return
+	}
+
+	ps := make([]expr.Point, 0, len(res.Points))
+	for _, p := range res.Points {
+		if p.Count > 0 {
+			ps = append(ps, expr.Point{T: p.Timestamp, V: p.Avg})
+		}
+	}
+	if len(ps) == 0 {
+		http.Error(w, "no samples for agent", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(f.project(q.AgentID, metric, ps))
+}
+
+// project builds the forecast result of the samples.
+func (f *Forecast) project(agent, metric string, ps []expr.Point) ForecastResult {
+	res := ForecastResult{
+		AgentID:  agent,
+		Metric:   metric,
+		Method:   f.method(),
+		Lookback: f.lookback().String(),
+		Samples:  len(ps),
+		Current:  ps[len(ps)-1].V,
+		Limit:    f.limit(),
+	}
+
+	level, slope, ok := f.fit(ps)
+	if !ok {
+		return res
+	}
+	res.Current, res.SlopePerHour = level, slope*3600
+
+	if hours := hoursUntil(level, slope, f.limit()); !math.IsInf(hours, 1) {
+		at := ps[len(ps)-1].T + int64(hours*3600)
+		res.HoursToFull, res.FullAt = &hours, &at
+	}
+	return res
+}
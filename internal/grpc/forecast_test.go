@@ -0,0 +1,131 @@
+package grpc
+
+import (
+	pb "gowatch/gopherwatch/pkg/generated"
+	"gowatch/internal/expr"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// growing returns disk samples every 5 minutes growing 1% per hour from 50%.
+func growing(n int) []expr.Point {
+	ps := make([]expr.Point, n)
+	for i := range ps {
+		ts := int64(i * 300)
+		ps[i] = expr.Point{T: ts, V: 50 + float64(ts)/3600}
+	}
+	return ps
+}
+
+func TestForecastProjection(t *testing.T) {
+
+	ps := growing(37) // 3h: 50% → 53%
+
+	for _, method := range []string{"linear", "holt"} {
+		f := &Forecast{Method: method}
+		res := f.project("forecast-agent", "disk", ps)
+		if res.HoursToFull == nil {
+			t.Fatalf("%s: expected a projection", method)
+		}
+		if math.Abs(*res.HoursToFull-47) > 1 || math.Abs(res.SlopePerHour-1) > 0.05 {
+			t.Errorf("%s: expected ~47h left at ~1%%/h, got %.1fh at %.2f%%/h", method, *res.HoursToFull, res.SlopePerHour)
+		}
+		if *res.FullAt != 3*3600+int64(*res.HoursToFull*3600) {
+			t.Errorf("%s: unexpected full_at %d", method, *res.FullAt)
+		}
+	}
+
+	flat := []expr.Point{}
+	for i := range 20 {
+		flat = append(flat, expr.Point{T: int64(i * 60), V: 70})
+	}
+	if res := (&Forecast{}).project("forecast-agent", "disk", flat); res.HoursToFull != nil {
+		t.Errorf("expected a flat disk never to fill up, got %.1fh", *res.HoursToFull)
+	}
+	if res := (&Forecast{}).project("forecast-agent", "disk", growing(3)); res.HoursToFull != nil {
+		t.Error("expected no projection from too few samples")
+	}
+}
+
+func TestForecastRuleFires(t *testing.T) {
+
+	rule := AlertRule{
+		Name: "Disk full soon", Metric: "disk", Threshold: 24, Comparison: "<",
+		Forecast: &Forecast{Lookback: time.Hour},
+	}
+	if err := validateRule(rule); err != nil {
+		t.Fatal(err)
+	}
+	live.prepare(rule)
+
+	// 5% per hour from 60%: full in about 8h, long before "High Disk".
+	var m *pb.MetricReport
+	for ts := int64(0); ts <= 3600; ts += 60 {
+		m = &pb.MetricReport{AgentId: "forecast-rule-agent", DiskUsage: 60 + 5*float64(ts)/3600, Timestamp: ts}
+		history.add(m)
+	}
+	if !fires(t, SimpleEvaluator{}, m, rule) {
+		t.Errorf("expected the rule to fire (%.1fh left)", ruleValue(m, rule))
+	}
+
+	if err := validateRule(AlertRule{Name: "x", Metric: "disk", Threshold: 24, Comparison: ">", Forecast: &Forecast{}}); err == nil {
+		t.Error("expected a forecast rule comparing with > to be rejected")
+	}
+}
+
+func TestForecastHandlerValidation(t *testing.T) {
+
+	s := &RestServer{}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /agents/{id}/forecast", s.forecastHandler)
+
+	for _, q := range []string{"?lookback=soon", "?metric=temperature", "?method=arima"} {
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/agents/a1/forecast"+q, nil))
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected 400, got %d", q, rec.Code)
+		}
+	}
+}
+
+func TestForecastRefitsOnTimer(t *testing.T) {
+	s := newEvalState()
+	f := &Forecast{Lookback: time.Hour}
+	s.history.limit(f.lookback(), 0)
+
+	// 1% per hour from 50%, one sample a minute.
+	report := func(ts int64) *pb.MetricReport {
+		m := &pb.MetricReport{AgentId: "refit-agent", DiskUsage: 50 + float64(ts)/3600, Timestamp: ts}
+		s.history.add(m)
+		return m
+	}
+	fittedAt := func() int64 {
+		return s.forecasts.fits[forecastKey{agent: "refit-agent", metric: "disk", forecast: *f}].fittedAt
+	}
+
+	var m *pb.MetricReport
+	for ts := int64(0); ts <= 3600; ts += 60 {
+		m = report(ts)
+	}
+	first := f.hoursLeft(s.history, s.forecasts, m, "disk")
+	if math.Abs(first-49) > 0.1 || fittedAt() != 3600 {
+		t.Fatalf("expected ~49h left fitted at 3600; got %.2fh at %d", first, fittedAt())
+	}
+
+	// Within the refit interval the cached trend is extended.
+	m = report(3660)
+	if got := f.hoursLeft(s.history, s.forecasts, m, "disk"); fittedAt() != 3600 || math.Abs(got-(first-1.0/60)) > 0.01 {
+		t.Errorf("expected the cached trend a minute on; got %.3fh fitted at %d", got, fittedAt())
+	}
+
+	for ts := int64(3720); ts <= 3900; ts += 60 {
+		m = report(ts)
+	}
+	f.hoursLeft(s.history, s.forecasts, m, "disk")
+	if fittedAt() != 3900 {
+		t.Errorf("expected a refit after %v; fitted at %d", forecastRefit, fittedAt())
+	}
+}
@@ -0,0 +1,365 @@
+package grpc
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"gowatch/internal/database"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// -------------------- ALERT GROUPING --------------------
+
+// Alerts sharing the values of the GroupBy labels form a group, and a group
+// is notified as one summary:
+//   - GroupWait after its first alert, so alerts firing together are batched
+//   - then at most every GroupInterval while alerts join, change or resolve
+//   - and every RepeatInterval while alerts keep firing without changes
+
+// GroupingConfig configures how alerts are grouped and batched.
+type GroupingConfig struct {
+	GroupBy        []string // alert labels, e.g. service_name, rule_name
+	GroupWait      time.Duration
+	GroupInterval  time.Duration
+	RepeatInterval time.Duration
+}
+
+var (
+	groupingMu sync.RWMutex
+
+	grouping = GroupingConfig{
+		GroupBy:        []string{"service_name", "rule_name"},
+		GroupWait:      30 * time.Second,
+		GroupInterval:  5 * time.Minute,
+		RepeatInterval: 4 * time.Hour,
+	}
+)
+
+// SetGrouping replaces the grouping configuration. It applies to groups
+// formed afterwards.
+func SetGrouping(cfg GroupingConfig) error {
+	for _, l := range cfg.GroupBy {
+		if !matcherLabels[l] {
+			return fmt.Errorf("unknown group_by label %q", l)
+		}
+	}
+	if cfg.GroupWait < 0 || cfg.GroupInterval < 0 || cfg.RepeatInterval < 0 {
+		return errors.New("group_wait, group_interval and repeat_interval must not be negative")
+	}
+
+	groupingMu.Lock()
+	defer groupingMu.Unlock()
+	grouping = cfg
+	return nil
+}
+
+type groupingFile struct {
+	GroupBy        []string  `json:"group_by"`
+	GroupWait      *duration `json:"group_wait"`
+	GroupInterval  *duration `json:"group_interval"`
+	RepeatInterval *duration `json:"repeat_interval"`
+}
+
+// ParseGrouping decodes the format of GROUPING_FILE; settings left out keep
+// their defaults:
+//
+//	{"group_by": ["service_name"], "group_wait": "1m",
+//	 "group_interval": "10m", "repeat_interval": "12h"}
+func ParseGrouping(data []byte) (GroupingConfig, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+
+	var f groupingFile
+	if err := dec.Decode(&f); err != nil {
+		return GroupingConfig{}, fmt.Errorf("invalid grouping: %w", err)
+	}
+
+	groupingMu.RLock()
+	cfg := grouping
+	groupingMu.RUnlock()
+
+	if f.GroupBy != nil {
+		cfg.GroupBy = f.GroupBy
+	}
+	for _, d := range []struct {
+		from *duration
+		to   *time.Duration
+	}{
+		{f.GroupWait, &cfg.GroupWait},
+		{f.GroupInterval, &cfg.GroupInterval},
+		{f.RepeatInterval, &cfg.RepeatInterval},
+	} {
+		if d.from != nil {
+			*d.to = time.Duration(*d.from)
+		}
+	}
+	return cfg, nil
+}
+
+// AlertGroup is the summary sent to notifiers and returned by
+// GET /alerts/groups.
+type AlertGroup struct {
+	Key      string            `json:"key"`
+	Labels   map[string]string `json:"labels"`
+	Severity string            `json:"severity"` // most severe alert
+	Firing   int               `json:"firing"`
+	Resolved int               `json:"resolved"`
+	Alerts   []database.Alert  `json:"alerts"`
+}
+
+// groupedAlert is one member of a group.
+type groupedAlert struct {
+	alert    database.Alert
+	pending  bool // changed since the last notification
+	notified bool // sent as firing at least once
+}
+
+type alertGroup struct {
+	labels    map[string]string
+	createdAt time.Time
+	notified  bool // notified at least once
+	lastSent  time.Time
+	alerts    map[alertKey]*groupedAlert
+}
+
+// groupSet holds the open groups.
+type groupSet struct {
+	mu     sync.Mutex
+	groups map[string]*alertGroup
+}
+
+func newGroupSet() *groupSet {
+	return &groupSet{groups: map[string]*alertGroup{}}
+}
+
+var groups = newGroupSet()
+
+// groupKey returns the key and labels of the group an alert belongs to.
+func groupKey(alert database.Alert, by []string) (string, map[string]string) {
+	all := alertLabels(alert)
+	labels := make(map[string]string, len(by))
+	parts := make([]string, 0, len(by))
+	for _, l := range by {
+		labels[l] = all[l]
+		parts = append(parts, l+"="+all[l])
+	}
+	return strings.Join(parts, ","), labels
+}
+
+// add records the latest state of an alert. When notify is set the change
+// is included in the group's next notification.
+func (g *groupSet) add(alert database.Alert, notify bool, now time.Time) {
+	groupingMu.RLock()
+	by := grouping.GroupBy
+	groupingMu.RUnlock()
+
+	key, labels := groupKey(alert, by)
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	grp, ok := g.groups[key]
+	if !ok {
+		grp = &alertGroup{labels: labels, createdAt: now, alerts: map[alertKey]*groupedAlert{}}
+		g.groups[key] = grp
+	}
+
+	k := alertKey{agent: alert.AgentID, rule: alert.RuleName}
+	if prev, ok := grp.alerts[k]; ok && prev.alert.ID != 0 && alert.ID != 0 && prev.alert.ID != alert.ID &&
+		prev.alert.Timestamp > alert.Timestamp {
+		return // stale update of an earlier episode
+	}
+
+	ga := grp.alerts[k]
+	if ga == nil {
+		ga = &groupedAlert{}
+		grp.alerts[k] = ga
+	}
+	ga.alert = alert
+	ga.pending = ga.pending || notify
+}
+
+// restore adds an alert loaded from storage as already notified, so its
+// group only repeats it after RepeatInterval.
+func (g *groupSet) restore(alert database.Alert, now time.Time) {
+	g.add(alert, false, now)
+
+	groupingMu.RLock()
+	key, _ := groupKey(alert, grouping.GroupBy)
+	groupingMu.RUnlock()
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	grp := g.groups[key]
+	if grp == nil {
+		return
+	}
+	if ga := grp.alerts[alertKey{agent: alert.AgentID, rule: alert.RuleName}]; ga != nil {
+		ga.notified = true
+	}
+	if !grp.notified {
+		grp.notified = true
+		grp.lastSent = now
+	}
+}
+
+// notifiable reports whether an alert is part of a notification.
+func (ga *groupedAlert) notifiable() bool {
+	a := ga.alert
+	if a.Flapping || a.Silenced || a.Maintenance || a.Inhibited {
+		return false
+	}
+	if a.Status == StatusResolved {
+		return ga.pending
+	}
+	return a.AcknowledgedBy == ""
+}
+
+// due returns the summaries of every group whose timer has expired at now
+// and drops resolved alerts once they have been notified.
+func (g *groupSet) due(now time.Time) []AlertGroup {
+	groupingMu.RLock()
+	cfg := grouping
+	groupingMu.RUnlock()
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	var out []AlertGroup
+	for key, grp := range g.groups {
+		changed := false
+		for k, ga := range grp.alerts {
+			// Muting is re-checked at send time: silences, maintenance
+			// windows and inhibiting alerts may have started or ended
+			// since the alert's last transition.
+			_, ga.alert.Silenced = silences.match(ga.alert, now.Unix())
+			_, ga.alert.Maintenance = maintenance.match(ga.alert, now)
+			ga.alert.Inhibited = inhibitions.inhibited(ga.alert)
+			// Resolved while muted, or before its firing was sent:
+			// nothing to send.
+			if ga.alert.Status == StatusResolved && (!ga.notifiable() || !ga.notified) {
+				delete(grp.alerts, k)
+				continue
+			}
+			if ga.pending && ga.notifiable() {
+				changed = true
+			}
+		}
+
+		var send bool
+		switch {
+		case !grp.notified:
+			send = changed && now.Sub(grp.createdAt) >= cfg.GroupWait
+		case changed:
+			send = now.Sub(grp.lastSent) >= cfg.GroupInterval
+		default:
+			send = now.Sub(grp.lastSent) >= cfg.RepeatInterval
+		}
+
+		if send {
+			if summary := grp.summary(key, true); len(summary.Alerts) > 0 {
+				out = append(out, summary)
+				grp.notified = true
+				grp.lastSent = now
+			}
+			for k, ga := range grp.alerts {
+				if ga.alert.Status != StatusResolved && ga.notifiable() {
+					ga.notified = true
+				}
+				ga.pending = false
+				if ga.alert.Status == StatusResolved {
+					delete(grp.alerts, k)
+				}
+			}
+		}
+
+		if len(grp.alerts) == 0 {
+			delete(g.groups, key)
+		}
+	}
+	return out
+}
+
+// summary builds the AlertGroup of a group. With onlyNotifiable it leaves
+// out acknowledged, muted, inhibited and already notified resolved alerts.
+func (grp *alertGroup) summary(key string, onlyNotifiable bool) AlertGroup {
+	s := AlertGroup{Key: key, Labels: grp.labels, Alerts: []database.Alert{}}
+
+	for _, ga := range grp.alerts {
+		if onlyNotifiable && !ga.notifiable() {
+			continue
+		}
+		a := ga.alert
+		s.Alerts = append(s.Alerts, a)
+		if a.Status == StatusResolved {
+			s.Resolved++
+		} else {
+			s.Firing++
+		}
+		if Severity(a.Severity).Priority() > Severity(s.Severity).Priority() {
+			s.Severity = a.Severity
+		}
+	}
+
+	sort.Slice(s.Alerts, func(i, j int) bool {
+		if s.Alerts[i].AgentID != s.Alerts[j].AgentID {
+			return s.Alerts[i].AgentID < s.Alerts[j].AgentID
+		}
+		return s.Alerts[i].RuleName < s.Alerts[j].RuleName
+	})
+	return s
+}
+
+// list returns every open group with all its alerts.
+func (g *groupSet) list() []AlertGroup {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	out := make([]AlertGroup, 0, len(g.groups))
+	for key, grp := range g.groups {
+		out = append(out, grp.summary(key, false))
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Key < out[j].Key })
+	return out
+}
+
+// flush notifies every due group.
+func (g *groupSet) flush(ctx context.Context, now time.Time) {
+	for _, grp := range g.due(now) {
+		notifyGroup(ctx, grp)
+	}
+}
+
+// StartGrouping sends due group notifications every interval until ctx
+// is cancelled.
+func StartGrouping(ctx context.Context, interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case now := <-ticker.C:
+				flushCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+				groups.flush(flushCtx, now)
+				cancel()
+			}
+		}
+	}()
+}
+
+// -------------------- REST HANDLERS --------------------
+
+// alertGroupsHandler serves GET /alerts/groups: the open alerts, grouped.
+func (s *RestServer) alertGroupsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(groups.list())
+}
@@ -0,0 +1,155 @@
+package grpc
+
+import (
+	"fmt"
+	"gowatch/internal/database"
+	"testing"
+	"time"
+)
+
+func TestGroupingBatchesAlerts(t *testing.T) {
+
+	cfg := GroupingConfig{
+		GroupBy:        []string{"service_name", "rule_name"},
+		GroupWait:      30 * time.Second,
+		GroupInterval:  5 * time.Minute,
+		RepeatInterval: time.Hour,
+	}
+	prev := grouping
+	if err := SetGrouping(cfg); err != nil {
+		t.Fatal(err)
+	}
+	defer func() { grouping = prev }()
+
+	g := newGroupSet()
+	start := time.Unix(1_000_000, 0)
+
+	alert := func(i int) database.Alert {
+		return database.Alert{
+			ID: int64(i + 1), AgentID: fmt.Sprintf("agent-%02d", i), ServiceName: "checkout",
+			RuleName: "High CPU", Severity: "critical", Status: StatusFiring, Timestamp: start.Unix(),
+		}
+	}
+
+	// A deploy pushes 40 agents over the threshold.
+	for i := 0; i < 40; i++ {
+		g.add(alert(i), true, start.Add(time.Duration(i)*100*time.Millisecond))
+	}
+
+	if got := g.due(start.Add(10 * time.Second)); len(got) != 0 {
+		t.Fatalf("expected nothing before group_wait; got %d groups", len(got))
+	}
+
+	got := g.due(start.Add(30 * time.Second))
+	if len(got) != 1 || got[0].Firing != 40 || got[0].Labels["service_name"] != "checkout" {
+		t.Fatalf("expected one summary of 40 alerts; got %+v", got)
+	}
+
+	// A late joiner waits for group_interval.
+	late := alert(40)
+	g.add(late, true, start.Add(time.Minute))
+	if got := g.due(start.Add(2 * time.Minute)); len(got) != 0 {
+		t.Fatalf("expected nothing before group_interval; got %+v", got)
+	}
+	if got := g.due(start.Add(30*time.Second + 5*time.Minute)); len(got) != 1 || got[0].Firing != 41 {
+		t.Fatalf("expected update after group_interval; got %+v", got)
+	}
+
+	// Acknowledged alerts are left out of repeats; resolved ones are sent once.
+	for i := 0; i < 40; i++ {
+		a := alert(i)
+		a.AcknowledgedBy = "alice"
+		g.add(a, false, start.Add(10*time.Minute))
+	}
+	late.Status = StatusResolved
+	g.add(late, true, start.Add(10*time.Minute))
+
+	got = g.due(start.Add(11 * time.Minute))
+	if len(got) != 1 || got[0].Firing != 0 || got[0].Resolved != 1 {
+		t.Fatalf("expected resolve-only update; got %+v", got)
+	}
+
+	if got := g.due(start.Add(3 * time.Hour)); len(got) != 0 {
+		t.Fatalf("expected no repeat for acknowledged alerts; got %+v", got)
+	}
+	if n := len(g.list()[0].Alerts); n != 40 {
+		t.Errorf("expected 40 alerts in grouped view; got %d", n)
+	}
+}
+
+func TestGroupingRechecksSilencesAtSendTime(t *testing.T) {
+	prev := grouping
+	if err := SetGrouping(GroupingConfig{GroupBy: []string{"service_name"}, GroupWait: 30 * time.Second, GroupInterval: 5 * time.Minute, RepeatInterval: time.Hour}); err != nil {
+		t.Fatal(err)
+	}
+	defer func() { grouping = prev }()
+
+	g := newGroupSet()
+	start := time.Unix(1_000_000, 0)
+
+	// A silence created after the alert fired holds the notification back.
+	silences.set([]database.Silence{{
+		Matchers: []database.Matcher{{Label: "service_name", Value: "search"}},
+		StartsAt: start.Add(10 * time.Second).Unix(),
+		EndsAt:   start.Add(10 * time.Minute).Unix(),
+	}})
+	defer silences.set(nil)
+
+	g.add(database.Alert{ID: 1, AgentID: "search-1", ServiceName: "search", RuleName: "High CPU",
+		Severity: "critical", Status: StatusFiring, Timestamp: start.Unix()}, true, start)
+
+	if got := g.due(start.Add(time.Minute)); len(got) != 0 {
+		t.Fatalf("expected silenced group not to be sent; got %+v", got)
+	}
+	if got := g.due(start.Add(11 * time.Minute)); len(got) != 1 || got[0].Firing != 1 {
+		t.Fatalf("expected group to be sent once the silence ended; got %+v", got)
+	}
+}
+
+func TestSetGroupingRejectsUnknownLabel(t *testing.T) {
+	if err := SetGrouping(GroupingConfig{GroupBy: []string{"host"}}); err == nil {
+		t.Errorf("expected unknown label to be rejected")
+	}
+}
+
+func TestGroupingDropsAlertsResolvedBeforeSent(t *testing.T) {
+	prev := grouping
+	if err := SetGrouping(GroupingConfig{GroupBy: []string{"service_name"}, GroupWait: 30 * time.Second, GroupInterval: 5 * time.Minute, RepeatInterval: time.Hour}); err != nil {
+		t.Fatal(err)
+	}
+	defer func() { grouping = prev }()
+
+	g := newGroupSet()
+	start := time.Unix(1_000_000, 0)
+	blip := database.Alert{ID: 1, AgentID: "cart-1", ServiceName: "cart", RuleName: "High CPU",
+		Severity: "critical", Status: StatusFiring, Timestamp: start.Unix()}
+
+	// The alert fires and resolves within group_wait.
+	g.add(blip, true, start)
+	blip.Status = StatusResolved
+	g.add(blip, true, start.Add(10*time.Second))
+
+	if got := g.due(start.Add(time.Minute)); len(got) != 0 {
+		t.Fatalf("expected no resolved notification for an alert never sent; got %+v", got)
+	}
+	if n := len(g.list()); n != 0 {
+		t.Errorf("expected the group to be dropped; got %d groups", n)
+	}
+}
+
+func TestParseGrouping(t *testing.T) {
+	cfg, err := ParseGrouping([]byte(`{"group_by": ["service_name"], "group_wait": "1m"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cfg.GroupBy) != 1 || cfg.GroupWait != time.Minute || cfg.GroupInterval != grouping.GroupInterval {
+		t.Errorf("expected group_by and group_wait set, the rest default; got %+v", cfg)
+	}
+
+	if _, err := ParseGrouping([]byte(`{"group_wait": 30}`)); err == nil {
+		t.Error("expected a numeric duration to be rejected")
+	}
+	if _, err := ParseGrouping([]byte(`{"wait": "1m"}`)); err == nil {
+		t.Error("expected an unknown field to be rejected")
+	}
+}
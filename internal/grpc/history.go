@@ -0,0 +1,160 @@
+package grpc
+
+import (
+	"context"
+	pb "gowatch/gopherwatch/pkg/generated"
+	"gowatch/internal/expr"
+	"sort"
+	"sync"
+	"time"
+)
+
+// -------------------- PER-AGENT HISTORY --------------------
+
+// historyIdle is how long an agent may stay silent before its history is
+// dropped, unless the rules look back further.
+const historyIdle = 15 * time.Minute
+
+// agentHistory keeps the recent samples of every agent in memory so rules
+// can look back over a window without querying the database. It keeps as
+// much as the longest look-back of the rules, and only the latest sample
+// when no rule reads history.
+type agentHistory struct {
+	mu         sync.RWMutex
+	retention  time.Duration
+	minSamples int                                // kept even when older than retention
+	series     map[string]map[string][]expr.Point // agent → metric → samples, oldest first
+	seen       map[string]time.Time               // agent → server time of its latest report
+}
+
+func newAgentHistory() *agentHistory {
+	return &agentHistory{series: map[string]map[string][]expr.Point{}, seen: map[string]time.Time{}}
+}
+
+// history is the sample history shared by all workers.
+var history = newAgentHistory()
+
+// retain makes the history keep at least d of samples.
+func (h *agentHistory) retain(d time.Duration) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if d > h.retention {
+		h.retention = d
+	}
+}
+
+// retainSamples makes the history keep at least the last n samples.
+func (h *agentHistory) retainSamples(n int) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if n > h.minSamples {
+		h.minSamples = n
+	}
+}
+
+// limit sets the retention to what a rule set needs, shrinking it when the
+// rules that looked furthest back were removed.
+func (h *agentHistory) limit(d time.Duration, n int) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.retention = d
+	h.minSamples = n
+}
+
+// add appends every metric of a report and drops samples older than the
+// retention, beyond the last minSamples. Out-of-order samples are inserted
+// in place. Reports of the same second are all kept, in arrival order, so
+// windows see every sample of agents reporting more than once a second.
+func (h *agentHistory) add(metric *pb.MetricReport) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	agent := h.series[metric.AgentId]
+	if agent == nil {
+		agent = map[string][]expr.Point{}
+		h.series[metric.AgentId] = agent
+	}
+	h.seen[metric.AgentId] = time.Now()
+
+	cutoff := metric.Timestamp - int64(h.retention/time.Second)
+	for _, name := range metricNames {
+		if absent(metric, name) {
+			continue
+		}
+		ps := agent[name]
+		p := expr.Point{T: metric.Timestamp, V: getValue(metric, name)}
+
+		if n := len(ps); n == 0 || ps[n-1].T <= p.T {
+			ps = append(ps, p)
+		} else {
+			i := sort.Search(n, func(i int) bool { return ps[i].T > p.T })
+			ps = append(ps[:i], append([]expr.Point{p}, ps[i:]...)...)
+		}
+
+		drop := sort.Search(len(ps), func(i int) bool { return ps[i].T > cutoff })
+		drop = min(drop, max(0, len(ps)-max(h.minSamples, 1)))
+		agent[name] = ps[drop:]
+	}
+}
+
+// rangeOf returns a copy of the samples of one metric in (now-d, now].
+func (h *agentHistory) rangeOf(agent, metric string, now int64, d time.Duration) []expr.Point {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	ps := h.series[agent][metric]
+	from := now - int64(d/time.Second)
+	lo := sort.Search(len(ps), func(i int) bool { return ps[i].T > from })
+	hi := sort.Search(len(ps), func(i int) bool { return ps[i].T > now })
+	return append([]expr.Point(nil), ps[lo:hi]...)
+}
+
+// last returns a copy of the last n samples of one metric up to now.
+func (h *agentHistory) last(agent, metric string, now int64, n int) []expr.Point {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	ps := h.series[agent][metric]
+	hi := sort.Search(len(ps), func(i int) bool { return ps[i].T > now })
+	lo := max(0, hi-n)
+	return append([]expr.Point(nil), ps[lo:hi]...)
+}
+
+// evictIdle drops the history of agents that have not reported for
+// historyIdle or the retention, whichever is longer, and returns them.
+func (h *agentHistory) evictIdle(now time.Time) []string {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	var evicted []string
+	idle := max(h.retention, historyIdle)
+	for agent, seen := range h.seen {
+		if now.Sub(seen) > idle {
+			delete(h.series, agent)
+			delete(h.seen, agent)
+			evicted = append(evicted, agent)
+		}
+	}
+	return evicted
+}
+
+// StartHistoryEviction drops the history, forecast trends and external
+// verdicts of idle agents every interval until ctx is cancelled.
+func StartHistoryEviction(ctx context.Context, interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case now := <-ticker.C:
+				if evicted := live.history.evictIdle(now); len(evicted) > 0 {
+					live.forecasts.drop(evicted)
+					live.verdicts.drop(evicted)
+				}
+			}
+		}
+	}()
+}
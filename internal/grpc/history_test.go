@@ -0,0 +1,39 @@
+package grpc
+
+import (
+	pb "gowatch/gopherwatch/pkg/generated"
+	"testing"
+	"time"
+)
+
+func TestHistoryRetention(t *testing.T) {
+	h := newAgentHistory()
+
+	// No rule reads history: only the latest sample is kept.
+	for ts := int64(0); ts <= 600; ts += 60 {
+		h.add(&pb.MetricReport{AgentId: "hist-1", CpuUsage: float64(ts), Timestamp: ts})
+	}
+	if n := len(h.series["hist-1"]["cpu"]); n != 1 {
+		t.Errorf("expected only the latest sample without rules; got %d", n)
+	}
+
+	// A 5m window keeps 5 minutes.
+	h.limit(5*time.Minute, 0)
+	for ts := int64(660); ts <= 1200; ts += 60 {
+		h.add(&pb.MetricReport{AgentId: "hist-1", CpuUsage: float64(ts), Timestamp: ts})
+	}
+	if got := h.rangeOf("hist-1", "cpu", 1200, time.Hour); len(got) != 5 || got[0].T != 960 {
+		t.Errorf("expected the last 5 minutes; got %v", got)
+	}
+
+	// Agents that stopped reporting are dropped.
+	h.add(&pb.MetricReport{AgentId: "hist-2", Timestamp: 1200})
+	h.seen["hist-1"] = time.Now().Add(-time.Hour)
+	h.evictIdle(time.Now())
+	if _, ok := h.series["hist-1"]; ok {
+		t.Errorf("expected idle agent to be evicted")
+	}
+	if _, ok := h.series["hist-2"]; !ok {
+		t.Errorf("expected active agent to be kept")
+	}
+}
@@ -0,0 +1,111 @@
+package grpc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"gowatch/internal/database"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// -------------------- INCIDENT WORKFLOW --------------------
+
+// alertActionRequest is the body of POST /alerts/{id}/ack|assign|resolve.
+type alertActionRequest struct {
+	Actor    string `json:"actor"`
+	Assignee string `json:"assignee"` // assign only
+	Comment  string `json:"comment"`
+}
+
+// alertActionHandler returns the handler for one workflow action. Every
+// action is recorded in the alert's audit trail.
+func (s *RestServer) alertActionHandler(action string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+		if err != nil {
+			http.Error(w, "invalid alert id", http.StatusBadRequest)
+			return
+		}
+
+		var req alertActionRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "invalid alert action body", http.StatusBadRequest)
+			return
+		}
+
+		switch {
+		case req.Actor == "":
+			http.Error(w, "actor is required", http.StatusBadRequest)
+			return
+		case action == database.ActionAssign && req.Assignee == "":
+			http.Error(w, "assignee is required", http.StatusBadRequest)
+			return
+		}
+		if action != database.ActionAssign {
+			req.Assignee = ""
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), 2*time.Second)
+		defer cancel()
+
+		alert, err := s.db.ApplyAlertAction(ctx, database.AlertEvent{
+			AlertID:   id,
+			Action:    action,
+			Actor:     req.Actor,
+			Assignee:  req.Assignee,
+			Comment:   req.Comment,
+			CreatedAt: time.Now().Unix(),
+		})
+		switch {
+		case errors.Is(err, database.ErrNotFound):
+			http.Error(w, "alert not found", http.StatusNotFound)
+			return
+		case errors.Is(err, database.ErrAlertResolved):
+			http.Error(w, "alert already resolved", http.StatusConflict)
+			return
+		case err != nil:
+			http.Error(w, "failed to update alert", http.StatusInternalServerError)
+			return
+		}
+
+		tracker.applyAction(alert)
+		escalations.track(alert)
+		// Let the other responders know the incident was closed by hand.
+		groups.add(alert, action == database.ActionResolve, time.Now())
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(alert)
+	}
+}
+
+// alertEventsHandler serves GET /alerts/{id}/events.
+func (s *RestServer) alertEventsHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		http.Error(w, "invalid alert id", http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 2*time.Second)
+	defer cancel()
+
+	if _, err := s.db.GetAlert(ctx, id); err != nil {
+		if errors.Is(err, database.ErrNotFound) {
+			http.Error(w, "alert not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, "failed to load alert", http.StatusInternalServerError)
+		return
+	}
+
+	events, err := s.db.ListAlertEvents(ctx, id)
+	if err != nil {
+		http.Error(w, "failed to load alert events", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(events)
+}
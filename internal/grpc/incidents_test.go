@@ -0,0 +1,76 @@
+package grpc
+
+import (
+	"context"
+	"gowatch/internal/database"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestAlertActionValidation(t *testing.T) {
+	s := &RestServer{}
+
+	cases := []struct {
+		action string
+		id     string
+		body   string
+	}{
+		{database.ActionAcknowledge, "abc", `{"actor": "alice"}`},
+		{database.ActionAcknowledge, "1", `not json`},
+		{database.ActionAcknowledge, "1", `{"comment": "no actor"}`},
+		{database.ActionAssign, "1", `{"actor": "alice"}`}, // no assignee
+	}
+
+	for _, c := range cases {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, "/alerts/"+c.id+"/"+c.action, strings.NewReader(c.body))
+		req.SetPathValue("id", c.id)
+
+		s.alertActionHandler(c.action)(rec, req)
+
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("%s %s: expected 400; got %d", c.action, c.body, rec.Code)
+		}
+	}
+}
+
+func TestApplyActionResolvesOpenAlert(t *testing.T) {
+
+	rule := AlertRule{Name: "High CPU", Metric: "cpu", Threshold: 90, Comparison: ">"}
+
+	tr := newAlertTracker()
+	sink := &recordingSink{}
+	idSink := sinkFunc(func(ctx context.Context, kind transition, alert *database.Alert) {
+		if kind == transitionFired {
+			alert.ID = 7
+		}
+		sink.transition(ctx, kind, alert)
+	})
+
+	ts := feed(tr, idSink, rule, 1000, 95)
+
+	// Acknowledging keeps the alert open and carries the ack.
+	tr.applyAction(database.Alert{ID: 7, AgentID: "agent-1", RuleName: "High CPU", AcknowledgedBy: "alice", Status: StatusFiring})
+	ts = feed(tr, idSink, rule, ts, 95)
+	if len(sink.kinds) != 1 {
+		t.Fatalf("expected a single fired transition; got %v", sink.kinds)
+	}
+
+	// A manual resolve closes the episode: the next crossing opens a new alert.
+	tr.applyAction(database.Alert{ID: 7, AgentID: "agent-1", RuleName: "High CPU", Status: StatusResolved})
+	feed(tr, idSink, rule, ts, 95)
+	if len(sink.kinds) != 2 || sink.kinds[1] != transitionFired {
+		t.Fatalf("expected a new alert after manual resolve; got %v", sink.kinds)
+	}
+	if a := sink.alerts[1]; a.AcknowledgedBy != "" {
+		t.Errorf("expected new alert without acknowledgement; got %+v", a)
+	}
+}
+
+type sinkFunc func(ctx context.Context, kind transition, alert *database.Alert)
+
+func (f sinkFunc) transition(ctx context.Context, kind transition, alert *database.Alert) {
+	f(ctx, kind, alert)
+}
@@ -0,0 +1,200 @@
+package grpc
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"gowatch/internal/database"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// -------------------- INHIBITION RULES --------------------
+
+// InhibitRule mutes alerts matching Target while an alert matching Source
+// is firing with the same values for every Equal label. For example, a
+// firing "Service Down" alert can inhibit the per-agent alerts of its
+// service with Equal: service_name.
+type InhibitRule struct {
+	Source []database.Matcher `json:"source"`
+	Target []database.Matcher `json:"target"`
+	Equal  []string           `json:"equal"`
+}
+
+// inhibitor keeps the firing alerts that can act as inhibition sources.
+type inhibitor struct {
+	mu     sync.RWMutex
+	rules  []InhibitRule
+	firing map[alertKey]database.Alert
+}
+
+func newInhibitor() *inhibitor {
+	return &inhibitor{firing: map[alertKey]database.Alert{}}
+}
+
+var inhibitions = newInhibitor()
+
+// SetInhibitRules replaces the inhibition rules.
+func SetInhibitRules(list []InhibitRule) error {
+	return inhibitions.setRules(list)
+}
+
+// ParseInhibitRules decodes and validates a JSON list of inhibition rules,
+// the format of INHIBIT_RULES_FILE and PUT /inhibit-rules:
+//
+//	[{"source": [{"label": "rule_name", "value": "Service Down"}],
+//	  "target": [{"label": "rule_name", "value": "High (CPU|Disk)", "is_regex": true}],
+//	  "equal": ["service_name"]}]
+func ParseInhibitRules(data []byte) ([]InhibitRule, error) {
+	var list []InhibitRule
+	if err := json.Unmarshal(data, &list); err != nil {
+		return nil, fmt.Errorf("invalid inhibit rules: %w", err)
+	}
+	if err := validateInhibitRules(list); err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+func validateInhibitRules(list []InhibitRule) error {
+	for i, r := range list {
+		if len(r.Source) == 0 || len(r.Target) == 0 {
+			return fmt.Errorf("inhibit rule %d: source and target matchers are required", i)
+		}
+		if err := validateMatchers(r.Source); err != nil {
+			return fmt.Errorf("inhibit rule %d: %v", i, err)
+		}
+		if err := validateMatchers(r.Target); err != nil {
+			return fmt.Errorf("inhibit rule %d: %v", i, err)
+		}
+		for _, l := range r.Equal {
+			if !matcherLabels[l] {
+				return fmt.Errorf("inhibit rule %d: unknown equal label %q", i, l)
+			}
+		}
+	}
+	return nil
+}
+
+func (in *inhibitor) setRules(list []InhibitRule) error {
+	if err := validateInhibitRules(list); err != nil {
+		return err
+	}
+
+	in.mu.Lock()
+	defer in.mu.Unlock()
+	in.rules = list
+	return nil
+}
+
+// track records whether an alert is firing and can inhibit others.
+func (in *inhibitor) track(alert database.Alert) {
+	k := alertKey{agent: alert.AgentID, rule: alert.RuleName}
+
+	in.mu.Lock()
+	defer in.mu.Unlock()
+
+	if alert.Status == StatusResolved {
+		delete(in.firing, k)
+		return
+	}
+	in.firing[k] = alert
+}
+
+// inhibited reports whether another firing alert inhibits alert.
+func (in *inhibitor) inhibited(alert database.Alert) bool {
+	in.mu.RLock()
+	defer in.mu.RUnlock()
+
+	if len(in.rules) == 0 {
+		return false
+	}
+
+	self := alertKey{agent: alert.AgentID, rule: alert.RuleName}
+	labels := alertLabels(alert)
+
+	for _, r := range in.rules {
+		if !matchesAll(r.Target, labels) {
+			continue
+		}
+		for k, src := range in.firing {
+			if k == self {
+				continue
+			}
+			srcLabels := alertLabels(src)
+			if matchesAll(r.Source, srcLabels) && equalLabels(r.Equal, labels, srcLabels) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (in *inhibitor) list() []InhibitRule {
+	in.mu.RLock()
+	defer in.mu.RUnlock()
+	return in.rules
+}
+
+// updateTargets recomputes the inhibited flag of every open alert and
+// stores the flags that changed, so stored targets follow their source
+// firing and clearing instead of keeping the flag of their last transition.
+// The flags are updated under the lock of the open alerts; the alerts are
+// stored after it is released.
+func (in *inhibitor) updateTargets(ctx context.Context, db database.Service) {
+	changed := escalations.updateInhibited(in.inhibited)
+	if db == nil {
+		return
+	}
+	for _, a := range changed {
+		if err := db.UpdateAlert(ctx, a); err != nil {
+			slog.Warn("failed to update inhibited alert", "id", a.ID, "err", err)
+		}
+	}
+}
+
+// -------------------- REST HANDLERS --------------------
+
+// listInhibitRulesHandler serves GET /inhibit-rules.
+func (s *RestServer) listInhibitRulesHandler(w http.ResponseWriter, r *http.Request) {
+	list := inhibitions.list()
+	if list == nil {
+		list = []InhibitRule{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(list)
+}
+
+// setInhibitRulesHandler serves PUT /inhibit-rules: it replaces the rules
+// and updates the inhibited flag of open alerts.
+func (s *RestServer) setInhibitRulesHandler(w http.ResponseWriter, r *http.Request) {
+	var list []InhibitRule
+	if err := json.NewDecoder(r.Body).Decode(&list); err != nil {
+		http.Error(w, "invalid inhibit rules body", http.StatusBadRequest)
+		return
+	}
+	if err := inhibitions.setRules(list); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+	inhibitions.updateTargets(ctx, s.db)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(list)
+}
+
+// equalLabels reports whether a and b agree on every label in names.
+func equalLabels(names []string, a, b map[string]string) bool {
+	for _, n := range names {
+		if a[n] != b[n] {
+			return false
+		}
+	}
+	return true
+}
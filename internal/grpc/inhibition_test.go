@@ -0,0 +1,162 @@
+package grpc
+
+import (
+	"context"
+	"fmt"
+	"gowatch/internal/database"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestInhibition(t *testing.T) {
+
+	in := newInhibitor()
+	err := in.setRules([]InhibitRule{{
+		Source: []database.Matcher{{Label: "rule_name", Value: "Service Down"}},
+		Target: []database.Matcher{{Label: "rule_name", Value: "High (CPU|Disk)", IsRegex: true}},
+		Equal:  []string{"service_name"},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cpu := database.Alert{AgentID: "a-1", ServiceName: "payments", RuleName: "High CPU", Status: StatusFiring}
+	other := database.Alert{AgentID: "b-1", ServiceName: "search", RuleName: "High CPU", Status: StatusFiring}
+	down := database.Alert{AgentID: "a-2", ServiceName: "payments", RuleName: "Service Down", Status: StatusFiring}
+
+	in.track(cpu)
+	in.track(other)
+	if in.inhibited(cpu) {
+		t.Fatalf("expected no inhibition without a source alert")
+	}
+
+	in.track(down)
+	if !in.inhibited(cpu) {
+		t.Errorf("expected cpu alert of payments to be inhibited")
+	}
+	if in.inhibited(other) {
+		t.Errorf("expected alert of another service not to be inhibited")
+	}
+	if in.inhibited(down) {
+		t.Errorf("expected source alert not to inhibit itself")
+	}
+
+	down.Status = StatusResolved
+	in.track(down)
+	if in.inhibited(cpu) {
+		t.Errorf("expected inhibition to end with the source alert")
+	}
+}
+
+func TestInhibitRuleValidation(t *testing.T) {
+	in := newInhibitor()
+
+	bad := [][]InhibitRule{
+		{{Target: []database.Matcher{{Label: "rule_name", Value: "x"}}}},
+		{{Source: []database.Matcher{{Label: "host", Value: "x"}}, Target: []database.Matcher{{Label: "rule_name", Value: "x"}}}},
+		{{Source: []database.Matcher{{Label: "rule_name", Value: "x"}}, Target: []database.Matcher{{Label: "rule_name", Value: "y"}}, Equal: []string{"host"}}},
+	}
+	for i, rules := range bad {
+		if err := in.setRules(rules); err == nil {
+			t.Errorf("case %d: expected error", i)
+		}
+	}
+}
+
+// updatedAlerts records the alerts stored with UpdateAlert.
+type updatedAlerts struct {
+	database.Service
+	updated []database.Alert
+}
+
+func (db *updatedAlerts) InsertAlert(_ context.Context, a database.Alert) (int64, error) {
+	return a.ID, nil
+}
+
+func (db *updatedAlerts) UpdateAlert(_ context.Context, a database.Alert) error {
+	db.updated = append(db.updated, a)
+	return nil
+}
+
+func TestInhibitedTargetsUpdatedWhenSourceClears(t *testing.T) {
+	prevIn, prevEsc, prevGroups := inhibitions, escalations, groups
+	inhibitions, escalations, groups = newInhibitor(), newEscalator(), newGroupSet()
+	defer func() { inhibitions, escalations, groups = prevIn, prevEsc, prevGroups }()
+
+	s := &RestServer{db: &updatedAlerts{}}
+	body := `[{"source": [{"label": "rule_name", "value": "Service Down"}],
+		"target": [{"label": "rule_name", "value": "High CPU"}], "equal": ["service_name"]}]`
+	rec := httptest.NewRecorder()
+	s.setInhibitRulesHandler(rec, httptest.NewRequest(http.MethodPut, "/inhibit-rules", strings.NewReader(body)))
+	if rec.Code != http.StatusOK || len(inhibitions.list()) != 1 {
+		t.Fatalf("expected rules to be set; got %d %s", rec.Code, rec.Body)
+	}
+
+	db := &updatedAlerts{}
+	sink := storeAndNotify{db: db}
+	down := database.Alert{ID: 1, AgentID: "a-2", ServiceName: "payments", RuleName: "Service Down", Status: StatusFiring}
+	cpu := database.Alert{ID: 2, AgentID: "a-1", ServiceName: "payments", RuleName: "High CPU", Status: StatusFiring}
+
+	sink.transition(t.Context(), transitionFired, &down)
+	sink.transition(t.Context(), transitionEscalated, &cpu)
+	if !cpu.Inhibited {
+		t.Fatalf("expected cpu alert to be inhibited")
+	}
+
+	db.updated = nil
+	down.Status = StatusResolved
+	sink.transition(t.Context(), transitionResolved, &down)
+
+	var stored *database.Alert
+	for i, a := range db.updated {
+		if a.ID == cpu.ID {
+			stored = &db.updated[i]
+		}
+	}
+	if stored == nil || stored.Inhibited {
+		t.Errorf("expected cpu alert to be stored as no longer inhibited; got %+v", db.updated)
+	}
+}
+
+// unlockedAlerts fails the test when alerts are stored while the open
+// alerts are locked.
+type unlockedAlerts struct {
+	database.Service
+	t       *testing.T
+	updated int
+}
+
+func (db *unlockedAlerts) UpdateAlert(_ context.Context, a database.Alert) error {
+	if !escalations.mu.TryLock() {
+		db.t.Errorf("alert %d stored under the lock of the open alerts", a.ID)
+		return nil
+	}
+	escalations.mu.Unlock()
+	db.updated++
+	return nil
+}
+
+func TestInhibitedTargetsStoredWithoutLock(t *testing.T) {
+	prevIn, prevEsc := inhibitions, escalations
+	inhibitions, escalations = newInhibitor(), newEscalator()
+	defer func() { inhibitions, escalations = prevIn, prevEsc }()
+
+	if err := inhibitions.setRules([]InhibitRule{{
+		Source: []database.Matcher{{Label: "rule_name", Value: "Service Down"}},
+		Target: []database.Matcher{{Label: "rule_name", Value: "High CPU"}},
+	}}); err != nil {
+		t.Fatal(err)
+	}
+	for i := range 3 {
+		escalations.track(database.Alert{ID: int64(i + 1), AgentID: fmt.Sprintf("a-%d", i), RuleName: "High CPU", Status: StatusFiring})
+	}
+	inhibitions.track(database.Alert{ID: 10, AgentID: "a-9", RuleName: "Service Down", Status: StatusFiring})
+
+	db := &unlockedAlerts{t: t}
+	inhibitions.updateTargets(t.Context(), db)
+	if db.updated != 3 {
+		t.Errorf("expected 3 targets stored; got %d", db.updated)
+	}
+}
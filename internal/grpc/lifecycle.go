@@ -0,0 +1,365 @@
+package grpc
+
+import (
+	"context"
+	pb "gowatch/gopherwatch/pkg/generated"
+	"gowatch/internal/database"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// -------------------- ALERT LIFECYCLE --------------------
+
+// An alert is one firing episode of one rule on one agent. It opens when a
+// tier is crossed and resolves only once the value is past the rule's clear
+// threshold for ResolveAfter. Oscillating across the thresholds marks the
+// alert as flapping, which keeps it open and mutes its notifications.
+
+// Alert statuses stored with every alert.
+const (
+	StatusFiring   = "firing"
+	StatusResolved = "resolved"
+)
+
+// Flap detection: an alert whose condition switched between active and
+// clear at least flapThreshold times within flapWindow is flapping.
+var (
+	flapWindow    = 10 * time.Minute
+	flapThreshold = 6
+)
+
+// transition is a lifecycle change reported to an alertSink.
+type transition string
+
+const (
+	transitionFired     transition = "fired"     // new alert opened
+	transitionEscalated transition = "escalated" // moved to a more severe tier
+	transitionResolved  transition = "resolved"  // cleared long enough
+	transitionFlapping  transition = "flapping"  // flapping started or stopped (see alert.Flapping)
+)
+
+// alertSink applies the side effects of a transition. For transitionFired
+// the sink may set alert.ID so later updates can refer to the stored row.
+type alertSink interface {
+	transition(ctx context.Context, kind transition, alert *database.Alert)
+}
+
+// condition is the hysteresis-aware state of a rule for one sample.
+type condition int
+
+const (
+	condClear   condition = iota // past the clear threshold
+	condBetween                  // inside the hysteresis band
+	condActive                   // a tier is crossed
+)
+
+// alertKey identifies one alert stream: one rule on one agent.
+type alertKey struct {
+	agent string
+	rule  string
+}
+
+type alertState struct {
+	mu sync.Mutex
+
+	firing       bool
+	alert        database.Alert // current episode while firing
+	clearSince   int64          // first clear sample of the current clear streak (0 = none)
+	pendingSince int64          // first active sample while waiting out the rule's For (0 = none)
+
+	last        condition
+	seen        bool
+	transitions []int64 // timestamps of active <-> clear switches inside flapWindow
+	flapping    bool
+}
+
+// alertTracker holds the lifecycle state of every (agent, rule) pair.
+type alertTracker struct {
+	states sync.Map   // alertKey → *alertState
+	state  *evalState // nil: the workers' state
+}
+
+func newAlertTracker() *alertTracker {
+	return &alertTracker{}
+}
+
+// tracker is the lifecycle state shared by all workers.
+var tracker = newAlertTracker()
+
+// ruleCondition evaluates the fire and clear thresholds of a rule.
+func ruleCondition(evaluator Evaluator, metric *pb.MetricReport, rule AlertRule) (condition, Tier, error) {
+	if e, ok := evaluator.(ruleEvaluator); ok {
+		evaluator = e.forReport(rule)
+	}
+
+	tier, ok, err := matchTier(evaluator, metric, rule)
+	if err != nil {
+		return condClear, Tier{}, err
+	}
+	if ok {
+		return condActive, tier, nil
+	}
+
+	if rule.ClearThreshold == nil {
+		return condClear, Tier{}, nil
+	}
+
+	clearRule := rule.clearRule()
+
+	cleared, err := evaluator.Evaluate(metric, clearRule)
+	if err != nil {
+		return condClear, Tier{}, err
+	}
+	if cleared {
+		return condClear, Tier{}, nil
+	}
+	return condBetween, Tier{}, nil
+}
+
+// clearRule returns a copy of the rule that is crossed once its value is
+// past ClearThreshold, back to normal.
+func (r AlertRule) clearRule() AlertRule {
+	c := r.atTier(Tier{Threshold: *r.ClearThreshold})
+	c.Comparison = inverseComparison(r.Comparison)
+	c.clearing = true
+	return c
+}
+
+// checks lists the thresholds evaluated for the rule: its tiers, most
+// severe first, then its clear threshold.
+func (r AlertRule) checks() []Check {
+	var out []Check
+	for _, t := range r.tiers() {
+		out = append(out, Check{Threshold: t.Threshold, Comparison: r.Comparison})
+	}
+	if r.ClearThreshold != nil {
+		out = append(out, Check{Threshold: *r.ClearThreshold, Comparison: inverseComparison(r.Comparison)})
+	}
+	return out
+}
+
+// inverseComparison returns the operator that means "back to normal".
+func inverseComparison(cmp string) string {
+	switch cmp {
+	case ">", ">=":
+		return "<"
+	case "<", "<=":
+		return ">"
+	}
+	return cmp
+}
+
+// observe feeds one sample through the lifecycle of rule on the sample's
+// agent and reports every resulting transition to sink. When the rule
+// cannot be evaluated the alert is left as it was and the error returned.
+func (t *alertTracker) observe(ctx context.Context, evaluator Evaluator, metric *pb.MetricReport, rule AlertRule, sink alertSink) error {
+	key := alertKey{agent: metric.AgentId, rule: rule.Name}
+	v, _ := t.states.LoadOrStore(key, &alertState{})
+	st := v.(*alertState)
+
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	cond, tier, err := ruleCondition(evaluator, metric, rule)
+	if err != nil {
+		return err
+	}
+	ts := metric.Timestamp
+
+	st.trackFlapping(ctx, ts, cond, sink)
+
+	if cond != condActive {
+		st.pendingSince = 0
+	}
+
+	switch {
+	case !st.firing && cond == condActive:
+		// Pending: the condition must hold for the rule's For first.
+		if st.pendingSince == 0 {
+			st.pendingSince = ts
+		}
+		if ts-st.pendingSince < int64(rule.For/time.Second) {
+			return nil
+		}
+		st.pendingSince = 0
+		st.firing = true
+		st.clearSince = 0
+		st.alert = database.Alert{
+			AgentID:     metric.AgentId,
+			ServiceName: metric.ServiceName,
+			RuleName:    rule.Name,
+			Metric:      rule.Metric,
+			Value:       t.state.orLive().ruleValue(metric, rule),
+			Threshold:   tier.Threshold,
+			Severity:    string(tier.Severity),
+			Status:      StatusFiring,
+			Flapping:    st.flapping,
+			Timestamp:   ts,
+		}
+		t.noteVerdict(key, &st.alert)
+		sink.transition(ctx, transitionFired, &st.alert)
+
+	case st.firing && cond == condActive:
+		st.clearSince = 0
+		if tier.Severity.Priority() > Severity(st.alert.Severity).Priority() {
+			st.alert.Severity = string(tier.Severity)
+			st.alert.Threshold = tier.Threshold
+			st.alert.Value = t.state.orLive().ruleValue(metric, rule)
+			t.noteVerdict(key, &st.alert)
+			sink.transition(ctx, transitionEscalated, &st.alert)
+		}
+
+	case st.firing && cond == condClear:
+		if st.clearSince == 0 {
+			st.clearSince = ts
+		}
+		// A flapping alert stays open until it settles down.
+		if st.flapping || ts-st.clearSince < int64(rule.ResolveAfter/time.Second) {
+			return nil
+		}
+		st.firing = false
+		st.clearSince = 0
+		st.alert.Status = StatusResolved
+		st.alert.Value = t.state.orLive().ruleValue(metric, rule)
+		st.alert.ResolvedAt = ts
+		sink.transition(ctx, transitionResolved, &st.alert)
+
+	case st.firing:
+		// Inside the hysteresis band: neither escalates nor resolves.
+		st.clearSince = 0
+	}
+	return nil
+}
+
+// noteVerdict puts the score and explanation the external evaluator gave
+// for the report on the alert it fired or escalated.
+func (t *alertTracker) noteVerdict(key alertKey, alert *database.Alert) {
+	v, _ := t.state.orLive().verdicts.get(key)
+	alert.Score, alert.Explanation = v.score, v.explanation
+}
+
+// trackFlapping records active <-> clear switches and updates the flapping
+// flag. Samples inside the hysteresis band do not count as a switch.
+func (st *alertState) trackFlapping(ctx context.Context, ts int64, cond condition, sink alertSink) {
+	if cond == condBetween {
+		return
+	}
+
+	if st.seen && cond != st.last {
+		st.transitions = append(st.transitions, ts)
+	}
+	st.last, st.seen = cond, true
+
+	cutoff := ts - int64(flapWindow/time.Second)
+	for len(st.transitions) > 0 && st.transitions[0] <= cutoff {
+		st.transitions = st.transitions[1:]
+	}
+
+	flapping := len(st.transitions) >= flapThreshold
+	if flapping == st.flapping {
+		return
+	}
+
+	st.flapping = flapping
+	if st.firing {
+		st.alert.Flapping = flapping
+		sink.transition(ctx, transitionFlapping, &st.alert)
+	}
+}
+
+// restore reopens an alert loaded from storage, so a restarted server keeps
+// updating it instead of opening a new one.
+func (t *alertTracker) restore(alert database.Alert) {
+	v, _ := t.states.LoadOrStore(alertKey{agent: alert.AgentID, rule: alert.RuleName}, &alertState{})
+	st := v.(*alertState)
+
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	if !st.firing {
+		st.firing = true
+		st.alert = alert
+	}
+}
+
+// applyAction copies an acknowledgement, assignment or manual resolve made
+// through the REST API onto the open alert it refers to. A manually resolved
+// alert closes the episode, so the next active sample opens a new alert.
+func (t *alertTracker) applyAction(alert database.Alert) {
+	v, ok := t.states.Load(alertKey{agent: alert.AgentID, rule: alert.RuleName})
+	if !ok {
+		return
+	}
+	st := v.(*alertState)
+
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	if !st.firing || st.alert.ID != alert.ID {
+		return
+	}
+
+	st.alert.AcknowledgedBy = alert.AcknowledgedBy
+	st.alert.AcknowledgedAt = alert.AcknowledgedAt
+	st.alert.Assignee = alert.Assignee
+
+	if alert.Status == StatusResolved {
+		st.firing = false
+		st.clearSince = 0
+		st.alert = database.Alert{}
+	}
+}
+
+// -------------------- WORKER SINK --------------------
+
+// storeAndNotify is the sink used by the worker pool: it persists every
+// transition and hands it to the alert's notification group.
+type storeAndNotify struct {
+	db database.Service
+}
+
+func (s storeAndNotify) transition(ctx context.Context, kind transition, alert *database.Alert) {
+	// Checked on every transition so the flags follow silences,
+	// maintenance windows and inhibiting alerts that start or end while
+	// the alert is open.
+	now := time.Now()
+	_, alert.Silenced = silences.match(*alert, now.Unix())
+	_, alert.Maintenance = maintenance.match(*alert, now)
+	inhibitions.track(*alert)
+	alert.Inhibited = inhibitions.inhibited(*alert)
+	if kind == transitionFired {
+		alert.FiredAt = now.Unix()
+	}
+
+	if s.db != nil {
+		if kind == transitionFired {
+			id, err := s.db.InsertAlert(ctx, *alert)
+			if err != nil {
+				slog.Warn("failed to store alert", "rule", alert.RuleName, "agent", alert.AgentID, "err", err)
+			}
+			alert.ID = id
+		} else if alert.ID != 0 {
+			if err := s.db.UpdateAlert(ctx, *alert); err != nil {
+				slog.Warn("failed to update alert", "id", alert.ID, "err", err)
+			}
+		}
+	}
+
+	escalations.track(*alert)
+
+	// An alert firing or clearing may start or end the inhibition of others.
+	if (kind == transitionFired || kind == transitionResolved) && len(inhibitions.list()) > 0 {
+		inhibitions.updateTargets(ctx, s.db)
+	}
+
+	if kind == transitionFlapping {
+		slog.Warn("alert flapping", "rule", alert.RuleName, "agent", alert.AgentID, "flapping", alert.Flapping)
+	}
+
+	// Notifications are batched per group; the group leaves out flapping,
+	// silenced, maintenance and inhibited alerts. Once acknowledged, only the resolve
+	// is notified.
+	notifyChange := kind != transitionFlapping && (alert.AcknowledgedBy == "" || kind == transitionResolved)
+	groups.add(*alert, notifyChange, now)
+}
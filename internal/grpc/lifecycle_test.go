@@ -0,0 +1,92 @@
+package grpc
+
+import (
+	"context"
+	pb "gowatch/gopherwatch/pkg/generated"
+	"gowatch/internal/database"
+	"testing"
+	"time"
+)
+
+// recordingSink collects transitions instead of storing/notifying.
+type recordingSink struct {
+	kinds  []transition
+	alerts []database.Alert
+}
+
+func (s *recordingSink) transition(ctx context.Context, kind transition, alert *database.Alert) {
+	s.kinds = append(s.kinds, kind)
+	s.alerts = append(s.alerts, *alert)
+}
+
+// feed sends one cpu sample per second starting at ts.
+func feed(tr *alertTracker, sink alertSink, rule AlertRule, ts int64, values ...float64) int64 {
+	for _, v := range values {
+		metric := &pb.MetricReport{AgentId: "agent-1", CpuUsage: v, Timestamp: ts}
+		tr.observe(context.Background(), SimpleEvaluator{}, metric, rule, sink)
+		ts++
+	}
+	return ts
+}
+
+func TestLifecycleHysteresis(t *testing.T) {
+
+	rule := AlertRule{
+		Name: "High CPU", Metric: "cpu", Comparison: ">",
+		Tiers:          []Tier{{SeverityWarning, 80}, {SeverityCritical, 90}},
+		ClearThreshold: floatPtr(70), ResolveAfter: 3 * time.Second,
+	}
+
+	tr := newAlertTracker()
+	sink := &recordingSink{}
+
+	// Fire as warning, escalate, then hover inside the band (70–80).
+	ts := feed(tr, sink, rule, 1000, 85, 95, 75, 78, 72)
+	if len(sink.kinds) != 2 || sink.kinds[0] != transitionFired || sink.kinds[1] != transitionEscalated {
+		t.Fatalf("expected fired+escalated; got %v", sink.kinds)
+	}
+
+	// Below the clear threshold, but not yet for ResolveAfter.
+	ts = feed(tr, sink, rule, ts, 60, 60, 60)
+	if len(sink.kinds) != 2 {
+		t.Fatalf("expected no resolve before ResolveAfter; got %v", sink.kinds)
+	}
+
+	feed(tr, sink, rule, ts, 60)
+	if len(sink.kinds) != 3 || sink.kinds[2] != transitionResolved {
+		t.Fatalf("expected resolve; got %v", sink.kinds)
+	}
+	if a := sink.alerts[2]; a.Status != StatusResolved || a.Severity != string(SeverityCritical) {
+		t.Errorf("unexpected resolved alert: %+v", a)
+	}
+}
+
+func TestLifecycleFlapping(t *testing.T) {
+
+	rule := AlertRule{Name: "High CPU", Metric: "cpu", Threshold: 90, Comparison: ">"}
+
+	tr := newAlertTracker()
+	sink := &recordingSink{}
+
+	// Oscillate around 90 on every sample.
+	ts := int64(1000)
+	for i := 0; i < 10; i++ {
+		ts = feed(tr, sink, rule, ts, 95, 85)
+	}
+
+	// The alert is marked flapping (either on the fired alert or by
+	// a flapping transition) and then stays open: no more transitions.
+	var flappingAt = -1
+	for i, a := range sink.alerts {
+		if a.Flapping {
+			flappingAt = i
+			break
+		}
+	}
+	if flappingAt < 0 {
+		t.Fatalf("expected alert to be marked flapping; got %v", sink.kinds)
+	}
+	if flappingAt != len(sink.kinds)-1 {
+		t.Errorf("expected no transitions after flapping started; got %v", sink.kinds[flappingAt:])
+	}
+}
@@ -0,0 +1,234 @@
+package grpc
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"gowatch/internal/cron"
+	"gowatch/internal/database"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// -------------------- MAINTENANCE WINDOWS --------------------
+
+// maxWindowDuration bounds a window so checking whether one is open stays cheap.
+const maxWindowDuration = 7 * 24 * time.Hour
+
+// parsedWindow is a window definition with its schedule compiled.
+type parsedWindow struct {
+	database.MaintenanceWindow
+	schedule cron.Schedule
+	duration time.Duration
+	location *time.Location
+}
+
+// parseWindow validates a definition and compiles its schedule.
+func parseWindow(mw database.MaintenanceWindow) (parsedWindow, error) {
+	sched, err := cron.Parse(mw.Schedule)
+	if err != nil {
+		return parsedWindow{}, err
+	}
+
+	d, err := time.ParseDuration(mw.Duration)
+	if err != nil || d < time.Minute || d > maxWindowDuration {
+		return parsedWindow{}, fmt.Errorf("duration must be between 1m and %s", maxWindowDuration)
+	}
+
+	loc := time.UTC
+	if mw.Timezone != "" {
+		if loc, err = time.LoadLocation(mw.Timezone); err != nil {
+			return parsedWindow{}, fmt.Errorf("unknown timezone %q", mw.Timezone)
+		}
+	}
+
+	if err := validateMatchers(mw.Matchers); err != nil {
+		return parsedWindow{}, err
+	}
+
+	return parsedWindow{MaintenanceWindow: mw, schedule: sched, duration: d, location: loc}, nil
+}
+
+// openAt returns the start of the occurrence containing now, if any.
+func (w parsedWindow) openAt(now time.Time) (time.Time, bool) {
+	return w.schedule.LastStart(now.In(w.location), w.duration)
+}
+
+// maintenanceSet is the in-memory copy of the maintenance_windows table,
+// refreshed on startup and after every change through the REST API.
+type maintenanceSet struct {
+	mu      sync.RWMutex
+	windows []parsedWindow
+}
+
+var maintenance = &maintenanceSet{}
+
+func (m *maintenanceSet) set(list []database.MaintenanceWindow) {
+	parsed := make([]parsedWindow, 0, len(list))
+	for _, mw := range list {
+		pw, err := parseWindow(mw)
+		if err != nil {
+			slog.Warn("skipping invalid maintenance window", "id", mw.ID, "name", mw.Name, "err", err)
+			continue
+		}
+		parsed = append(parsed, pw)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.windows = parsed
+}
+
+func (m *maintenanceSet) refresh(ctx context.Context, db database.Service) error {
+	list, err := db.ListMaintenanceWindows(ctx)
+	if err != nil {
+		return err
+	}
+	m.set(list)
+	return nil
+}
+
+// match reports whether an open window covers the alert's labels.
+func (m *maintenanceSet) match(alert database.Alert, now time.Time) (int64, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	labels := alertLabels(alert)
+	for _, w := range m.windows {
+		if !matchesAll(w.Matchers, labels) {
+			continue
+		}
+		if _, open := w.openAt(now); open {
+			return w.ID, true
+		}
+	}
+	return 0, false
+}
+
+// activeWindow is an open occurrence of a window.
+type activeWindow struct {
+	database.MaintenanceWindow
+	StartedAt int64 `json:"started_at"`
+	EndsAt    int64 `json:"ends_at"`
+}
+
+// active lists every window open at now.
+func (m *maintenanceSet) active(now time.Time) []activeWindow {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	out := []activeWindow{}
+	for _, w := range m.windows {
+		if start, open := w.openAt(now); open {
+			out = append(out, activeWindow{
+				MaintenanceWindow: w.MaintenanceWindow,
+				StartedAt:         start.Unix(),
+				EndsAt:            start.Add(w.duration).Unix(),
+			})
+		}
+	}
+	return out
+}
+
+// -------------------- REST HANDLERS --------------------
+
+// createMaintenanceHandler serves POST /maintenance.
+func (s *RestServer) createMaintenanceHandler(w http.ResponseWriter, r *http.Request) {
+	var mw database.MaintenanceWindow
+	if err := json.NewDecoder(r.Body).Decode(&mw); err != nil {
+		http.Error(w, "invalid maintenance window body", http.StatusBadRequest)
+		return
+	}
+
+	mw.ID = 0
+	mw.CreatedAt = time.Now().Unix()
+	if mw.Timezone == "" {
+		mw.Timezone = "UTC"
+	}
+
+	switch {
+	case mw.Name == "":
+		http.Error(w, "name is required", http.StatusBadRequest)
+		return
+	case len(mw.Matchers) == 0:
+		http.Error(w, "at least one matcher is required", http.StatusBadRequest)
+		return
+	}
+	if _, err := parseWindow(mw); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 2*time.Second)
+	defer cancel()
+
+	id, err := s.db.CreateMaintenanceWindow(ctx, mw)
+	if err != nil {
+		http.Error(w, "failed to create maintenance window", http.StatusInternalServerError)
+		return
+	}
+	mw.ID = id
+
+	if err := maintenance.refresh(ctx, s.db); err != nil {
+		slog.Warn("failed to refresh maintenance windows", "err", err)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(mw)
+}
+
+// listMaintenanceHandler serves GET /maintenance.
+func (s *RestServer) listMaintenanceHandler(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 2*time.Second)
+	defer cancel()
+
+	list, err := s.db.ListMaintenanceWindows(ctx)
+	if err != nil {
+		http.Error(w, "failed to load maintenance windows", http.StatusInternalServerError)
+		return
+	}
+	if list == nil {
+		list = []database.MaintenanceWindow{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(list)
+}
+
+// activeMaintenanceHandler serves GET /maintenance/active.
+func (s *RestServer) activeMaintenanceHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(maintenance.active(time.Now()))
+}
+
+// deleteMaintenanceHandler serves DELETE /maintenance/{id}.
+func (s *RestServer) deleteMaintenanceHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		http.Error(w, "invalid maintenance window id", http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 2*time.Second)
+	defer cancel()
+
+	found, err := s.db.DeleteMaintenanceWindow(ctx, id)
+	if err != nil {
+		http.Error(w, "failed to delete maintenance window", http.StatusInternalServerError)
+		return
+	}
+	if !found {
+		http.Error(w, "maintenance window not found", http.StatusNotFound)
+		return
+	}
+
+	if err := maintenance.refresh(ctx, s.db); err != nil {
+		slog.Warn("failed to refresh maintenance windows", "err", err)
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,46 @@
+package grpc
+
+import (
+	"gowatch/internal/database"
+	"testing"
+	"time"
+)
+
+func TestMaintenanceWindows(t *testing.T) {
+
+	set := &maintenanceSet{}
+	set.set([]database.MaintenanceWindow{
+		{
+			ID: 1, Name: "weekly patch", Schedule: "0 2 * * SUN", Duration: "2h", Timezone: "UTC",
+			Matchers: []database.Matcher{{Label: "service_name", Value: "payments"}},
+		},
+		{
+			ID: 2, Name: "broken", Schedule: "every sunday", Duration: "2h",
+			Matchers: []database.Matcher{{Label: "service_name", Value: "payments"}},
+		},
+	})
+
+	// Sunday 2024-03-03 03:15 UTC — inside the 02:00–04:00 window.
+	during := time.Date(2024, 3, 3, 3, 15, 0, 0, time.UTC)
+	after := time.Date(2024, 3, 3, 4, 0, 0, 0, time.UTC)
+
+	alert := database.Alert{AgentID: "pay-1", ServiceName: "payments"}
+
+	if id, ok := set.match(alert, during); !ok || id != 1 {
+		t.Errorf("expected window 1 to cover alert during the window")
+	}
+	if _, ok := set.match(alert, after); ok {
+		t.Errorf("expected window to be closed after its duration")
+	}
+
+	alert.ServiceName = "search"
+	if _, ok := set.match(alert, during); ok {
+		t.Errorf("expected window scoped to payments not to match search")
+	}
+
+	// The invalid definition is skipped; only window 1 is active.
+	active := set.active(during)
+	if len(active) != 1 || active[0].StartedAt != time.Date(2024, 3, 3, 2, 0, 0, 0, time.UTC).Unix() {
+		t.Errorf("unexpected active windows: %+v", active)
+	}
+}
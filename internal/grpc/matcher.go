@@ -0,0 +1,83 @@
+package grpc
+
+import (
+	"fmt"
+	"gowatch/internal/database"
+	"regexp"
+	"sync"
+)
+
+// -------------------- LABEL MATCHERS --------------------
+
+// matcherLabels are the alert labels matchers may select on.
+var matcherLabels = map[string]bool{
+	"agent_id":     true,
+	"service_name": true,
+	"rule_name":    true,
+	"severity":     true,
+	"metric":       true,
+}
+
+// alertLabels exposes the labels of an alert to matchers.
+func alertLabels(a database.Alert) map[string]string {
+	return map[string]string{
+		"agent_id":     a.AgentID,
+		"service_name": a.ServiceName,
+		"rule_name":    a.RuleName,
+		"severity":     a.Severity,
+		"metric":       a.Metric,
+	}
+}
+
+// regexCache keeps compiled matcher regexes; matchers are evaluated for
+// every alert transition.
+var regexCache sync.Map // string → *regexp.Regexp
+
+func compileMatcher(expr string) (*regexp.Regexp, error) {
+	if re, ok := regexCache.Load(expr); ok {
+		return re.(*regexp.Regexp), nil
+	}
+
+	// Regex matchers must match the whole label value.
+	re, err := regexp.Compile("^(?:" + expr + ")$")
+	if err != nil {
+		return nil, err
+	}
+	regexCache.Store(expr, re)
+	return re, nil
+}
+
+// validateMatchers rejects unknown labels and invalid regexes.
+func validateMatchers(matchers []database.Matcher) error {
+	for _, m := range matchers {
+		if !matcherLabels[m.Label] {
+			return fmt.Errorf("unknown matcher label %q", m.Label)
+		}
+		if m.IsRegex {
+			if _, err := compileMatcher(m.Value); err != nil {
+				return fmt.Errorf("invalid regex for %s: %v", m.Label, err)
+			}
+		}
+	}
+	return nil
+}
+
+// matchesAll reports whether every matcher matches the labels.
+func matchesAll(matchers []database.Matcher, labels map[string]string) bool {
+	for _, m := range matchers {
+		v := labels[m.Label]
+
+		if !m.IsRegex {
+			if v != m.Value {
+				return false
+			}
+			continue
+		}
+
+		re, err := compileMatcher(m.Value)
+		if err != nil || !re.MatchString(v) {
+			return false
+		}
+	}
+	return true
+}
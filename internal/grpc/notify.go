@@ -0,0 +1,197 @@
+package grpc
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"gowatch/internal/database"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// -------------------- NOTIFIERS --------------------
+
+// Notifier delivers a fired alert somewhere (logs, webhook, pager, ...).
+type Notifier interface {
+	Notify(ctx context.Context, alert database.Alert) error
+}
+
+// GroupNotifier is implemented by notifiers that can deliver a grouped
+// summary as one message. Other notifiers receive each alert of the group.
+type GroupNotifier interface {
+	NotifyGroup(ctx context.Context, group AlertGroup) error
+}
+
+// LogNotifier writes the alert to slog at the level of its severity.
+type LogNotifier struct{}
+
+func (LogNotifier) Notify(ctx context.Context, alert database.Alert) error {
+	sev := Severity(alert.Severity)
+
+	if alert.Status == StatusResolved {
+		slog.Info("ALERT RESOLVED",
+			"agent", alert.AgentID,
+			"rule", alert.RuleName,
+			"value", alert.Value,
+		)
+		return nil
+	}
+
+	slog.Log(ctx, sev.LogLevel(), strings.ToUpper(alert.Severity)+" ALERT",
+		"agent", alert.AgentID,
+		"rule", alert.RuleName,
+		"value", alert.Value,
+		"threshold", alert.Threshold,
+	)
+	return nil
+}
+
+func (LogNotifier) NotifyGroup(ctx context.Context, group AlertGroup) error {
+	agents := make([]string, 0, len(group.Alerts))
+	for _, a := range group.Alerts {
+		agents = append(agents, a.AgentID)
+	}
+
+	if group.Firing == 0 {
+		slog.Info("ALERT GROUP RESOLVED",
+			"group", group.Key,
+			"resolved", group.Resolved,
+			"agents", agents,
+		)
+		return nil
+	}
+
+	slog.Log(ctx, Severity(group.Severity).LogLevel(), strings.ToUpper(group.Severity)+" ALERT GROUP",
+		"group", group.Key,
+		"firing", group.Firing,
+		"resolved", group.Resolved,
+		"agents", agents,
+	)
+	return nil
+}
+
+// WebhookNotifier POSTs the alert as JSON to a URL.
+type WebhookNotifier struct {
+	URL    string
+	Client *http.Client
+}
+
+func NewWebhookNotifier(url string) *WebhookNotifier {
+	return &WebhookNotifier{URL: url, Client: &http.Client{Timeout: 5 * time.Second}}
+}
+
+func (n *WebhookNotifier) Notify(ctx context.Context, alert database.Alert) error {
+	return n.post(ctx, alert)
+}
+
+// NotifyGroup POSTs the group summary as JSON.
+func (n *WebhookNotifier) NotifyGroup(ctx context.Context, group AlertGroup) error {
+	return n.post(ctx, group)
+}
+
+func (n *WebhookNotifier) post(ctx context.Context, payload any) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, n.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := n.Client.Do(req)
+	if err != nil {
+		return fmt.Errorf("webhook error: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook error: status %s", resp.Status)
+	}
+	return nil
+}
+
+// -------------------- ROUTING --------------------
+
+var (
+	notifierMu sync.RWMutex
+
+	// notifiers holds every registered notifier by name.
+	notifiers = map[string]Notifier{
+		"log": LogNotifier{},
+	}
+
+	// severityRoutes lists the notifiers used for each severity.
+	// Names without a registered notifier are skipped.
+	severityRoutes = map[Severity][]string{
+		SeverityInfo:     {"log"},
+		SeverityWarning:  {"log"},
+		SeverityCritical: {"log", "webhook"},
+		SeverityPage:     {"log", "webhook", "pager"},
+	}
+)
+
+// RegisterNotifier makes a notifier available to routing under name.
+func RegisterNotifier(name string, n Notifier) {
+	notifierMu.Lock()
+	defer notifierMu.Unlock()
+	notifiers[name] = n
+}
+
+// SetSeverityRoute replaces the notifiers used for a severity.
+func SetSeverityRoute(sev Severity, names []string) {
+	notifierMu.Lock()
+	defer notifierMu.Unlock()
+	severityRoutes[sev] = names
+}
+
+// routedNotifiers returns the registered notifiers among names.
+func routedNotifiers(names []string) map[string]Notifier {
+	notifierMu.RLock()
+	defer notifierMu.RUnlock()
+
+	targets := make(map[string]Notifier, len(names))
+	for _, name := range names {
+		if n, ok := notifiers[name]; ok {
+			targets[name] = n
+		}
+	}
+	return targets
+}
+
+// notifyTargets sends the alert to the named notifiers.
+func notifyTargets(ctx context.Context, names []string, alert database.Alert) {
+	for name, n := range routedNotifiers(names) {
+		if err := n.Notify(ctx, alert); err != nil {
+			slog.Warn("notification failed", "notifier", name, "rule", alert.RuleName, "err", err)
+		}
+	}
+}
+
+// notifyGroup sends a group summary to every notifier routed for the
+// severity of its most severe alert.
+func notifyGroup(ctx context.Context, group AlertGroup) {
+	notifierMu.RLock()
+	names := severityRoutes[Severity(group.Severity)]
+	notifierMu.RUnlock()
+
+	for name, n := range routedNotifiers(names) {
+		if gn, ok := n.(GroupNotifier); ok {
+			if err := gn.NotifyGroup(ctx, group); err != nil {
+				slog.Warn("notification failed", "notifier", name, "group", group.Key, "err", err)
+			}
+			continue
+		}
+		for _, a := range group.Alerts {
+			if err := n.Notify(ctx, a); err != nil {
+				slog.Warn("notification failed", "notifier", name, "rule", a.RuleName, "err", err)
+			}
+		}
+	}
+}
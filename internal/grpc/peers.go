@@ -0,0 +1,188 @@
+package grpc
+
+import (
+	"errors"
+	"fmt"
+	pb "gowatch/gopherwatch/pkg/generated"
+	"math"
+	"sort"
+	"sync"
+	"time"
+)
+
+// -------------------- PEER-GROUP OUTLIERS --------------------
+
+// Peer makes a rule compare an agent with the other agents of its service
+// rather than with a fixed level, catching a single bad node that stays
+// under absolute thresholds. The rule compares the robust z-score of the
+// sample — its distance from the service median in scaled median absolute
+// deviations (MAD) — against its Threshold (the sensitivity):
+//
+//	{Name: "CPU outlier", Metric: "cpu", Threshold: 4, Comparison: ">",
+//	 Peer: &Peer{Direction: "up"}}
+//
+// The median and MAD are robust: the outlier itself barely moves them.
+type Peer struct {
+	Direction    string        // both (default) | up | down
+	MinPeers     int           // agents with recent samples the service needs, including this one (default 3)
+	MaxAge       time.Duration // peer samples older than this are ignored (default 5m)
+	MinDeviation float64       // floor on the scaled MAD (default 1)
+
+	// Sensitivity is the robust z-score above which the agent is an
+	// outlier, judged instead of the rule's Threshold and Comparison. A
+	// rule judged by several evaluators needs it.
+	Sensitivity float64
+}
+
+// madScale makes the MAD a consistent estimator of the standard deviation
+// of normally distributed values.
+const madScale = 1.4826
+
+// peerRetention is how long an agent that stopped reporting is remembered.
+const peerRetention = time.Hour
+
+func (p *Peer) validate() error {
+	if p == nil {
+		return nil
+	}
+
+	switch p.Direction {
+	case "", "both", "up", "down":
+	default:
+		return fmt.Errorf("unknown peer direction %q", p.Direction)
+	}
+	if p.MinPeers < 0 || p.MaxAge < 0 || p.MinDeviation < 0 || p.Sensitivity < 0 {
+		return fmt.Errorf("peer min peers, max age, min deviation and sensitivity must not be negative")
+	}
+	return nil
+}
+
+func (p *Peer) minPeers() int {
+	if p.MinPeers == 0 {
+		return 3
+	}
+	return p.MinPeers
+}
+
+func (p *Peer) maxAge() time.Duration {
+	if p.MaxAge == 0 {
+		return 5 * time.Minute
+	}
+	return p.MaxAge
+}
+
+func (p *Peer) minDeviation() float64 {
+	if p.MinDeviation == 0 {
+		return 1
+	}
+	return p.MinDeviation
+}
+
+// PeerEvaluator evaluates rules with a Peer against the latest samples of
+// the other agents of the service. It never fires when the service has too
+// few agents reporting.
+type PeerEvaluator struct {
+	state *evalState // nil: the workers' state
+}
+
+func (e PeerEvaluator) Evaluate(metric *pb.MetricReport, rule AlertRule) (bool, error) {
+	if rule.Peer == nil {
+		return false, errors.New("rule has no peer settings")
+	}
+
+	z, ok := e.state.orLive().peers.score(metric, rule.Metric, rule.Peer)
+	if s := rule.Peer.Sensitivity; s > 0 {
+		// Too few peers make no outlier.
+		return (ok && z > s) != rule.clearing, nil
+	}
+	if !ok {
+		return false, nil
+	}
+	return compare(z, rule.Threshold, rule.Comparison), nil
+}
+
+// -------------------- PEER GROUPS --------------------
+
+// peerSet keeps the latest report of every agent, by service.
+type peerSet struct {
+	mu       sync.Mutex
+	services map[string]map[string]*pb.MetricReport // service → agent → latest report
+}
+
+func newPeerSet() *peerSet {
+	return &peerSet{services: map[string]map[string]*pb.MetricReport{}}
+}
+
+var peers = newPeerSet()
+
+// observe records the report as its agent's latest and forgets agents of
+// the service that stopped reporting.
+func (s *peerSet) observe(metric *pb.MetricReport) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	group := s.services[metric.ServiceName]
+	if group == nil {
+		group = map[string]*pb.MetricReport{}
+		s.services[metric.ServiceName] = group
+	}
+	if prev := group[metric.AgentId]; prev != nil && prev.Timestamp > metric.Timestamp {
+		return
+	}
+	group[metric.AgentId] = metric
+
+	cutoff := metric.Timestamp - int64(peerRetention/time.Second)
+	for agent, m := range group {
+		if m.Timestamp < cutoff {
+			delete(group, agent)
+		}
+	}
+}
+
+// score returns the robust z-score of the report's value among the recent
+// values of its service, signed by the rule's direction. ok is false when
+// fewer than MinPeers agents reported within MaxAge.
+func (s *peerSet) score(metric *pb.MetricReport, name string, p *Peer) (float64, bool) {
+	from := metric.Timestamp - int64(p.maxAge()/time.Second)
+
+	s.mu.Lock()
+	var values []float64
+	for _, m := range s.services[metric.ServiceName] {
+		if m.AgentId != metric.AgentId && m.Timestamp >= from && !absent(m, name) {
+			values = append(values, getValue(m, name))
+		}
+	}
+	s.mu.Unlock()
+
+	x := getValue(metric, name)
+	values = append(values, x)
+	if len(values) < p.minPeers() {
+		return 0, false
+	}
+
+	med := median(values)
+	devs := make([]float64, len(values))
+	for i, v := range values {
+		devs[i] = math.Abs(v - med)
+	}
+	scale := math.Max(madScale*median(devs), p.minDeviation())
+
+	z := (x - med) / scale
+	switch p.Direction {
+	case "up":
+		return z, true
+	case "down":
+		return -z, true
+	}
+	return math.Abs(z), true
+}
+
+// median returns the median of vs, reordering it.
+func median(vs []float64) float64 {
+	sort.Float64s(vs)
+	n := len(vs)
+	if n%2 == 1 {
+		return vs[n/2]
+	}
+	return (vs[n/2-1] + vs[n/2]) / 2
+}
@@ -0,0 +1,69 @@
+package grpc
+
+import (
+	pb "gowatch/gopherwatch/pkg/generated"
+	"testing"
+)
+
+func TestPeerOutlier(t *testing.T) {
+
+	rule := AlertRule{
+		Name: "CPU outlier", Metric: "cpu", Threshold: 4, Comparison: ">",
+		Peer: &Peer{Direction: "up"},
+	}
+	if err := validateRule(rule); err != nil {
+		t.Fatal(err)
+	}
+
+	report := func(agent string, ts int64, cpu float64) *pb.MetricReport {
+		m := &pb.MetricReport{AgentId: agent, ServiceName: "peer-svc", CpuUsage: cpu, Timestamp: ts}
+		peers.observe(m)
+		return m
+	}
+
+	// Two agents are too few to tell who is the odd one out.
+	report("peer-1", 100, 30)
+	if m := report("peer-2", 100, 70); fires(t, PeerEvaluator{}, m, rule) {
+		t.Error("expected no outlier below MinPeers")
+	}
+
+	for i, cpu := range []float64{31, 29, 32, 30} {
+		report("peer-"+string(rune('3'+i)), 100, cpu)
+	}
+
+	// peer-2 is at 70% — under any absolute threshold, yet far from its peers.
+	if m := report("peer-2", 110, 70); !fires(t, PeerEvaluator{}, m, rule) {
+		t.Error("expected the bad node to be an outlier")
+	}
+	if m := report("peer-1", 110, 31); fires(t, PeerEvaluator{}, m, rule) {
+		t.Error("expected a normal node not to be an outlier")
+	}
+
+	// Peers that stopped reporting are not compared with.
+	if m := report("peer-2", 1000, 70); fires(t, PeerEvaluator{}, m, rule) {
+		t.Error("expected stale peers to be ignored")
+	}
+}
+
+func TestPeerDirectionAndServices(t *testing.T) {
+
+	down := &Peer{Direction: "down"}
+	for i, mem := range []float64{60, 62, 61, 59} {
+		peers.observe(&pb.MetricReport{AgentId: "dir-" + string(rune('a'+i)), ServiceName: "dir-svc", MemoryUsage: mem, Timestamp: 1})
+	}
+	// Agents of other services are not peers.
+	peers.observe(&pb.MetricReport{AgentId: "other", ServiceName: "other-svc", MemoryUsage: 5, Timestamp: 1})
+
+	low := &pb.MetricReport{AgentId: "dir-e", ServiceName: "dir-svc", MemoryUsage: 5, Timestamp: 1}
+	peers.observe(low)
+	if z, ok := peers.score(low, "memory", down); !ok || z < 10 {
+		t.Errorf("expected a low agent to score high downwards, got %.1f (ok %v)", z, ok)
+	}
+	if z, _ := peers.score(low, "memory", &Peer{Direction: "up"}); z > 0 {
+		t.Errorf("expected a low agent to score below zero upwards, got %.1f", z)
+	}
+
+	if err := validateRule(AlertRule{Name: "x", Metric: "cpu", Threshold: 3, Comparison: ">", Peer: &Peer{Direction: "sideways"}}); err == nil {
+		t.Error("expected an unknown direction to be rejected")
+	}
+}
@@ -0,0 +1,220 @@
+package grpc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	pb "gowatch/gopherwatch/pkg/generated"
+	"gowatch/internal/database"
+	"sort"
+	"time"
+)
+
+// -------------------- EVALUATION STATE --------------------
+
+// evalState is what rules read besides the sample itself: the per-agent
+// history, the anomaly baselines, the peer groups, the fitted forecast
+// trends and the latest answers of the external evaluator. The workers
+// share live; replays get their own so they never disturb it.
+type evalState struct {
+	history   *agentHistory
+	baselines *baselineSet
+	peers     *peerSet
+	forecasts *forecastCache
+	verdicts  *verdictCache
+}
+
+func newEvalState() *evalState {
+	return &evalState{history: newAgentHistory(), baselines: newBaselineSet(), peers: newPeerSet(), forecasts: newForecastCache(), verdicts: newVerdictCache()}
+}
+
+// live is the state of the workers.
+var live = &evalState{history: history, baselines: baselines, peers: peers, forecasts: newForecastCache(), verdicts: newVerdictCache()}
+
+// orLive lets a nil state stand for live, so zero-value evaluators work.
+func (s *evalState) orLive() *evalState {
+	if s == nil {
+		return live
+	}
+	return s
+}
+
+// prepare makes the state keep what a validated rule reads: enough history
+// for its window, forecast, external window or expression ranges, and its
+// anomaly baselines.
+func (s *evalState) prepare(r AlertRule) {
+	d, n := historyNeeds(r)
+	s.history.retain(d)
+	s.history.retainSamples(n)
+
+	if r.Anomaly != nil {
+		s.baselines.track(r.Metric, r.Anomaly.Seasonality, r.Anomaly.halfLife())
+	}
+}
+
+// historyNeeds returns how far back, and how many samples, a rule reads
+// from the history.
+func historyNeeds(r AlertRule) (d time.Duration, n int) {
+	if r.Window != nil {
+		d, n = max(d, r.Window.Duration), max(n, r.Window.Samples)
+	}
+	if r.Forecast != nil {
+		d = max(d, r.Forecast.lookback())
+	}
+	if r.External != nil {
+		d = max(d, r.External.window())
+	}
+	if r.Expr != "" {
+		if p, err := compileExpr(r.Expr); err == nil {
+			d, n = max(d, p.MaxRange()), max(n, p.MaxSamples())
+		}
+	}
+	return d, n
+}
+
+// evaluate runs one report through the rules that apply to its agent, the
+// way the workers do: the report is added to the history and peer groups,
+// judged, and only then learned by the anomaly baselines.
+func (s *evalState) evaluate(ctx context.Context, t *alertTracker, idx *ruleIndex, metric *pb.MetricReport, sink alertSink) {
+	// Rules with ranges (avg_over_time(disk[1h]), ...) read this.
+	s.history.add(metric)
+
+	// Peer rules compare the agent with its service.
+	s.peers.observe(metric)
+
+	evaluator := ruleEvaluator{state: s}
+	for _, r := range idx.rulesFor(metric) {
+		// A rule reading a metric the report leaves out is not judged;
+		// its alert stays as it is.
+		if r.readsAbsent(metric) {
+			continue
+		}
+		if err := t.observe(ctx, evaluator, metric, r, sink); err != nil {
+			if es, ok := sink.(errorSink); ok {
+				es.evalError(metric, r, err)
+			}
+		}
+	}
+
+	s.baselines.observe(metric)
+}
+
+// readsAbsent reports whether the rule reads a metric the report leaves out.
+func (r AlertRule) readsAbsent(metric *pb.MetricReport) bool {
+	if len(metric.Absent) == 0 {
+		return false
+	}
+	if r.Metric != "" && absent(metric, r.Metric) {
+		return true
+	}
+	if r.Expr != "" {
+		if p, err := compileExpr(r.Expr); err == nil {
+			for _, name := range p.Metrics() {
+				if absent(metric, name) {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+// validateRules checks a rule set, reporting every invalid rule. Rule names
+// must be unique: alert state, escalations and evaluation errors are kept
+// by rule name.
+func validateRules(list []AlertRule) error {
+	var errs []error
+	seen := map[string]bool{}
+	for _, r := range list {
+		if err := validateRule(r); err != nil {
+			errs = append(errs, fmt.Errorf("rule %q: %w", r.Name, err))
+		}
+		if r.Name != "" && seen[r.Name] {
+			errs = append(errs, fmt.Errorf("rule %q: duplicate rule name", r.Name))
+		}
+		seen[r.Name] = true
+	}
+	return errors.Join(errs...)
+}
+
+// -------------------- REPLAY --------------------
+
+// Transition is one alert lifecycle change produced by Replay.
+type Transition struct {
+	At          int64   `json:"at"` // Unix timestamp of the report that caused it
+	AgentID     string  `json:"agent_id"`
+	ServiceName string  `json:"service_name"`
+	Rule        string  `json:"rule"`
+	Kind        string  `json:"kind"` // fired | escalated | resolved | flapping | error
+	Severity    string  `json:"severity"`
+	Value       float64 `json:"value"`
+	Threshold   float64 `json:"threshold"`
+	Flapping    bool    `json:"flapping,omitempty"`
+	Score       float64 `json:"score,omitempty"`       // of an external evaluator
+	Explanation string  `json:"explanation,omitempty"` // of an external evaluator
+	Error       string  `json:"error,omitempty"`       // for kind error
+}
+
+// TransitionError is the kind of the transitions recording a report the
+// rule's evaluator failed on; the alert is left as it was.
+const TransitionError = "error"
+
+// Replay runs reports through the rule evaluation of the workers — scopes,
+// tiers, hysteresis, ResolveAfter and flap detection included — with fresh
+// state and the report timestamps as the clock, and returns the
+// transitions in order. Nothing is stored or notified.
+func Replay(list []AlertRule, reports []*pb.MetricReport) ([]Transition, error) {
+	if err := validateRules(list); err != nil {
+		return nil, err
+	}
+
+	s := newEvalState()
+	for _, r := range list {
+		s.prepare(r)
+	}
+
+	sorted := append([]*pb.MetricReport(nil), reports...)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].Timestamp < sorted[j].Timestamp })
+
+	rec := &recorder{}
+	t := &alertTracker{state: s}
+	idx := newRuleIndex(list)
+	for _, m := range sorted {
+		rec.at = m.Timestamp
+		s.evaluate(context.Background(), t, idx, m, rec)
+	}
+	return rec.transitions, nil
+}
+
+// recorder is the sink of a replay.
+type recorder struct {
+	at          int64
+	transitions []Transition
+}
+
+func (r *recorder) transition(_ context.Context, kind transition, alert *database.Alert) {
+	r.transitions = append(r.transitions, Transition{
+		At:          r.at,
+		AgentID:     alert.AgentID,
+		ServiceName: alert.ServiceName,
+		Rule:        alert.RuleName,
+		Kind:        string(kind),
+		Severity:    alert.Severity,
+		Value:       alert.Value,
+		Threshold:   alert.Threshold,
+		Flapping:    alert.Flapping,
+		Score:       alert.Score,
+		Explanation: alert.Explanation,
+	})
+}
+
+func (r *recorder) evalError(metric *pb.MetricReport, rule AlertRule, err error) {
+	r.transitions = append(r.transitions, Transition{
+		At:          r.at,
+		AgentID:     metric.AgentId,
+		ServiceName: metric.ServiceName,
+		Rule:        rule.Name,
+		Kind:        TransitionError,
+		Error:       err.Error(),
+	})
+}
@@ -0,0 +1,307 @@
+package grpc
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	pb "gowatch/gopherwatch/pkg/generated"
+	"log/slog"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// -------------------- AGENT REGISTRATION --------------------
+
+// ServerVersion is sent to agents on registration. Agents of another major
+// version speak another protocol and are rejected.
+const ServerVersion = "1.0.0"
+
+// minAgentVersion is the oldest agent version accepted on registration.
+var minAgentVersion = "1.0.0"
+
+// SetMinAgentVersion changes the oldest agent version accepted on
+// registration.
+func SetMinAgentVersion(v string) error {
+	if _, err := parseVersion(v); err != nil {
+		return err
+	}
+	minAgentVersion = v
+	return nil
+}
+
+// requireRegistration refuses the streams of agents without a session.
+var requireRegistration bool
+
+// SetRequireRegistration makes SendMetrics and Control refuse agents that
+// did not register; by default only agent IDs with a live session are
+// protected.
+func SetRequireRegistration(required bool) {
+	requireRegistration = required
+}
+
+// sessionHeader is the metadata key carrying the session ID on the
+// SendMetrics and Control streams.
+const sessionHeader = "session-id"
+
+// sessionTTL is how long a session stays live without a report or an open
+// control stream; until then its agent ID cannot be registered again.
+const sessionTTL = 2 * time.Minute
+
+// ErrDuplicateAgent is returned when an agent ID with a live session
+// registers without that session's ID.
+var ErrDuplicateAgent = errors.New("agent ID already has a live session")
+
+// Errors of streams speaking for an agent without its session.
+var (
+	ErrNotRegistered  = errors.New("agent is not registered")
+	ErrSessionInvalid = errors.New("session is not the agent's current session")
+)
+
+// AgentSession is what an agent declared when it registered.
+type AgentSession struct {
+	SessionID    string            `json:"session_id"`
+	AgentID      string            `json:"agent_id"`
+	ServiceName  string            `json:"service_name"`
+	Hostname     string            `json:"hostname"`
+	OS           string            `json:"os"`
+	AgentVersion string            `json:"agent_version"`
+	Labels       map[string]string `json:"labels"`
+	Metrics      []string          `json:"metrics"` // what it can collect
+	RegisteredAt int64             `json:"registered_at"`
+	LastSeen     int64             `json:"last_seen"`
+	Live         bool              `json:"live"`
+}
+
+// version is a parsed semantic version; missing parts are zero.
+type version [3]int
+
+// parseVersion parses "1", "1.4" or "1.4.2", with an optional "v" prefix
+// and ignoring pre-release and build suffixes.
+func parseVersion(s string) (version, error) {
+	var v version
+	core, _, _ := strings.Cut(strings.TrimPrefix(s, "v"), "-")
+	core, _, _ = strings.Cut(core, "+")
+
+	parts := strings.Split(core, ".")
+	if core == "" || len(parts) > 3 {
+		return v, fmt.Errorf("invalid version %q", s)
+	}
+	for i, p := range parts {
+		n, err := strconv.Atoi(p)
+		if err != nil || n < 0 {
+			return v, fmt.Errorf("invalid version %q", s)
+		}
+		v[i] = n
+	}
+	return v, nil
+}
+
+func (v version) less(o version) bool {
+	for i := range v {
+		if v[i] != o[i] {
+			return v[i] < o[i]
+		}
+	}
+	return false
+}
+
+// compatible reports whether agents of version s can talk to this server.
+func compatible(s string) error {
+	v, err := parseVersion(s)
+	if err != nil {
+		return err
+	}
+	server, _ := parseVersion(ServerVersion)
+	if v[0] != server[0] {
+		return fmt.Errorf("agent version %s is not compatible with server version %s", s, ServerVersion)
+	}
+	if min, _ := parseVersion(minAgentVersion); v.less(min) {
+		return fmt.Errorf("agent version %s is older than the minimum %s", s, minAgentVersion)
+	}
+	return nil
+}
+
+// sessionSet tracks the registered agents by agent ID.
+type sessionSet struct {
+	mu      sync.Mutex
+	byAgent map[string]*AgentSession
+	now     func() time.Time
+}
+
+var sessions = &sessionSet{byAgent: map[string]*AgentSession{}, now: time.Now}
+
+// live reports whether a session is still in use: its agent has a control
+// stream open or was seen within sessionTTL. Called with s.mu held.
+func (s *sessionSet) live(sess *AgentSession) bool {
+	if s.now().Sub(time.Unix(sess.LastSeen, 0)) < sessionTTL {
+		return true
+	}
+	return control.isConnected(sess.AgentID)
+}
+
+// register opens a session for an agent. An agent ID with a live session
+// is only accepted with that session's ID, which lets a restarted agent
+// take over its own session.
+func (s *sessionSet) register(req *pb.RegisterRequest) (*AgentSession, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if old, ok := s.byAgent[req.AgentId]; ok && old.SessionID != req.SessionId && s.live(old) {
+		return nil, ErrDuplicateAgent
+	}
+
+	now := s.now().Unix()
+	sess := &AgentSession{
+		SessionID:    rand.Text(),
+		AgentID:      req.AgentId,
+		ServiceName:  req.ServiceName,
+		Hostname:     req.Hostname,
+		OS:           req.Os,
+		AgentVersion: req.AgentVersion,
+		Labels:       req.Labels,
+		Metrics:      req.Metrics,
+		RegisteredAt: now,
+		LastSeen:     now,
+	}
+	s.byAgent[req.AgentId] = sess
+
+	// A restarted agent numbers its reports from 1 again; a takeover
+	// replays its spool.
+	sequences.registered(req.AgentId)
+	return sess, nil
+}
+
+// touch records activity of a registered agent; unregistered agents are
+// ignored.
+func (s *sessionSet) touch(agentID string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if sess, ok := s.byAgent[agentID]; ok {
+		sess.LastSeen = s.now().Unix()
+	}
+}
+
+// use checks that a stream carrying sessionID may speak for an agent and
+// records the agent's activity. A stream with a session ID must carry the
+// agent's current one; a stream without one is refused for agents with a
+// live session, and for every agent once registration is required.
+func (s *sessionSet) use(agentID, sessionID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sess, ok := s.byAgent[agentID]
+	switch {
+	case sessionID != "" && (!ok || sess.SessionID != sessionID):
+		return ErrSessionInvalid
+	case sessionID == "" && ok && s.live(sess):
+		return ErrDuplicateAgent
+	case sessionID == "" && requireRegistration:
+		return ErrNotRegistered
+	case sessionID == "":
+		return nil // an unregistered agent; its expired session stays expired
+	}
+
+	sess.LastSeen = s.now().Unix()
+	return nil
+}
+
+// streamSession returns the session ID a stream carries in its metadata.
+func streamSession(ctx context.Context) string {
+	md, _ := metadata.FromIncomingContext(ctx)
+	if ids := md.Get(sessionHeader); len(ids) > 0 {
+		return ids[0]
+	}
+	return ""
+}
+
+// sessionError turns an error of use into the status of a stream.
+func sessionError(agentID string, err error) error {
+	if errors.Is(err, ErrDuplicateAgent) {
+		return status.Errorf(codes.PermissionDenied, "%s: %v", agentID, err)
+	}
+	return status.Errorf(codes.Unauthenticated, "%s: %v", agentID, err)
+}
+
+// get returns the session of an agent.
+func (s *sessionSet) get(agentID string) (AgentSession, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sess, ok := s.byAgent[agentID]
+	if !ok {
+		return AgentSession{}, false
+	}
+	c := *sess
+	c.Live = s.live(sess)
+	return c, true
+}
+
+// list returns every session by agent ID.
+func (s *sessionSet) list() []AgentSession {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	list := make([]AgentSession, 0, len(s.byAgent))
+	for _, sess := range s.byAgent {
+		c := *sess
+		c.Live = s.live(sess)
+		list = append(list, c)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].AgentID < list[j].AgentID })
+	return list
+}
+
+// Register opens a session for an agent after checking its version, and
+// answers with the settings it should run, including its configuration
+// profile, which it applies like one from GetConfig.
+func (s *MetricsServer) Register(ctx context.Context, req *pb.RegisterRequest) (*pb.RegisterResponse, error) {
+	if req.AgentId == "" {
+		return nil, status.Error(codes.InvalidArgument, "agent_id is required")
+	}
+	if err := compatible(req.AgentVersion); err != nil {
+		return nil, status.Error(codes.FailedPrecondition, err.Error())
+	}
+
+	sess, err := sessions.register(req)
+	if err != nil {
+		return nil, status.Errorf(codes.AlreadyExists, "%s: %v", req.AgentId, err)
+	}
+
+	slog.Info("agent registered",
+		"agent", sess.AgentID,
+		"session", sess.SessionID,
+		"hostname", sess.Hostname,
+		"version", sess.AgentVersion,
+	)
+
+	cfg := configs.desired(req.AgentId, req.ServiceName)
+	configs.apply(req.AgentId, cfg)
+
+	return &pb.RegisterResponse{
+		SessionId: sess.SessionID,
+		Settings: &pb.ServerSettings{
+			ServerVersion: ServerVersion,
+			SessionTtlMs:  sessionTTL.Milliseconds(),
+			Config:        cfg,
+		},
+	}, nil
+}
+
+// -------------------- HTTP --------------------
+
+// listAgentsHandler serves GET /agents: the registered agents.
+func (s *RestServer) listAgentsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(sessions.list())
+}
@@ -0,0 +1,150 @@
+package grpc
+
+import (
+	pb "gowatch/gopherwatch/pkg/generated"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+func TestRegister(t *testing.T) {
+	client := dialTestServer(t)
+
+	req := &pb.RegisterRequest{
+		AgentId:      "reg-1",
+		ServiceName:  "web",
+		Hostname:     "host-a",
+		Os:           "linux",
+		AgentVersion: "1.2.0",
+		Labels:       map[string]string{"zone": "eu-1"},
+		Metrics:      []string{"cpu", "disk"},
+	}
+	resp, err := client.Register(t.Context(), req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.SessionId == "" || resp.Settings.ServerVersion != ServerVersion || resp.Settings.SessionTtlMs != sessionTTL.Milliseconds() {
+		t.Fatalf("unexpected registration %v", resp)
+	}
+	if sess, _ := sessions.get("reg-1"); sess.Hostname != "host-a" || sess.Labels["zone"] != "eu-1" || !sess.Live {
+		t.Fatalf("expected a live session from host-a; got %+v", sess)
+	}
+
+	// A second agent with the same ID is refused while the session lives...
+	dup := &pb.RegisterRequest{AgentId: "reg-1", Hostname: "host-b", AgentVersion: "1.2.0"}
+	if _, err := client.Register(t.Context(), dup); status.Code(err) != codes.AlreadyExists {
+		t.Fatalf("expected AlreadyExists; got %v", err)
+	}
+
+	// ...but the agent itself may take it over with its session ID.
+	req.SessionId = resp.SessionId
+	again, err := client.Register(t.Context(), req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again.SessionId == resp.SessionId {
+		t.Error("expected a new session")
+	}
+
+	// Once the session expired, the ID is free again.
+	sessions.now = func() time.Time { return time.Now().Add(sessionTTL) }
+	t.Cleanup(func() { sessions.now = time.Now })
+	if _, err := client.Register(t.Context(), dup); err != nil {
+		t.Fatalf("expected the expired session to be replaced; got %v", err)
+	}
+}
+
+func TestRegisterVersions(t *testing.T) {
+	client := dialTestServer(t)
+
+	for v, code := range map[string]codes.Code{
+		"1.0.0":         codes.OK,
+		"v1.3":          codes.OK,
+		"1.4.2-rc.1":    codes.OK,
+		"0.9.0":         codes.FailedPrecondition,
+		"2.0.0":         codes.FailedPrecondition,
+		"":              codes.FailedPrecondition,
+		"one.two.three": codes.FailedPrecondition,
+	} {
+		_, err := client.Register(t.Context(), &pb.RegisterRequest{AgentId: "ver-" + v, AgentVersion: v})
+		if status.Code(err) != code {
+			t.Errorf("version %q: expected %s; got %v", v, code, err)
+		}
+	}
+
+	if err := SetMinAgentVersion("1.2"); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { SetMinAgentVersion("1.0.0") })
+	if err := compatible("1.1.9"); err == nil {
+		t.Error("expected 1.1.9 to be older than the minimum 1.2")
+	}
+	if err := SetMinAgentVersion("latest"); err == nil {
+		t.Error("expected an invalid minimum version to be rejected")
+	}
+}
+
+func TestStreamsNeedTheSession(t *testing.T) {
+	client := dialTestServer(t)
+
+	resp, err := client.Register(t.Context(), &pb.RegisterRequest{AgentId: "sess-1", AgentVersion: "1.2.0"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// send streams one report of agent with the session ID, if any.
+	send := func(agent, sessionID string) error {
+		t.Helper()
+		ctx := t.Context()
+		if sessionID != "" {
+			ctx = metadata.AppendToOutgoingContext(ctx, sessionHeader, sessionID)
+		}
+		stream, err := client.SendMetrics(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		stream.Send(&pb.MetricReport{AgentId: agent})
+		_, err = stream.CloseAndRecv()
+		return err
+	}
+	t.Cleanup(func() {
+		for len(MetricChan) > 0 {
+			<-MetricChan
+		}
+	})
+
+	cases := []struct {
+		agent, session string
+		code           codes.Code
+	}{
+		{"sess-1", resp.SessionId, codes.OK},
+		{"sess-1", "", codes.PermissionDenied},            // someone else with its ID
+		{"sess-1", "stale", codes.Unauthenticated},        // not its current session
+		{"sess-2", resp.SessionId, codes.Unauthenticated}, // another agent's session
+		{"sess-2", "", codes.OK},                          // unregistered agents may stream
+	}
+	for _, c := range cases {
+		if err := send(c.agent, c.session); status.Code(err) != c.code {
+			t.Errorf("%s with session %q: expected %s; got %v", c.agent, c.session, c.code, err)
+		}
+	}
+
+	// The control stream is checked on its hello.
+	ctrl, err := client.Control(t.Context())
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctrl.Send(&pb.AgentMessage{Body: &pb.AgentMessage_Hello{Hello: &pb.Hello{AgentId: "sess-1"}}})
+	if _, err := ctrl.Recv(); status.Code(err) != codes.PermissionDenied {
+		t.Errorf("expected the control stream without the session to be refused; got %v", err)
+	}
+
+	SetRequireRegistration(true)
+	t.Cleanup(func() { SetRequireRegistration(false) })
+	if err := send("sess-2", ""); status.Code(err) != codes.Unauthenticated {
+		t.Errorf("expected unregistered agents to be refused; got %v", err)
+	}
+}
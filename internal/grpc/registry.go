@@ -0,0 +1,362 @@
+package grpc
+
+import (
+	"cmp"
+	"encoding/json"
+	"errors"
+	"fmt"
+	pb "gowatch/gopherwatch/pkg/generated"
+	"log/slog"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// -------------------- EVALUATOR REGISTRY --------------------
+
+// Names of the built-in evaluators.
+const (
+	EvaluatorThreshold  = "threshold"
+	EvaluatorExpression = "expression"
+	EvaluatorAnomaly    = "anomaly"
+	EvaluatorPeer       = "peer"
+)
+
+var (
+	evaluatorsMu sync.RWMutex
+	evaluators   = map[string]Evaluator{}
+)
+
+func init() {
+	RegisterEvaluator(EvaluatorThreshold, SimpleEvaluator{})
+	RegisterEvaluator(EvaluatorExpression, ExprEvaluator{})
+	RegisterEvaluator(EvaluatorAnomaly, AnomalyEvaluator{})
+	RegisterEvaluator(EvaluatorPeer, PeerEvaluator{})
+}
+
+// RegisterEvaluator makes an evaluator available to rules naming it in
+// AlertRule.Evaluator. Packages register theirs from an init function, like
+// database/sql drivers; it panics if name is empty or already taken.
+func RegisterEvaluator(name string, e Evaluator) {
+	evaluatorsMu.Lock()
+	defer evaluatorsMu.Unlock()
+
+	if name == "" || e == nil {
+		panic("grpc: RegisterEvaluator needs a name and an evaluator")
+	}
+	if _, dup := evaluators[name]; dup {
+		panic("grpc: RegisterEvaluator called twice for " + name)
+	}
+	evaluators[name] = e
+}
+
+// Evaluators returns the names of the registered evaluators, sorted.
+func Evaluators() []string {
+	evaluatorsMu.RLock()
+	defer evaluatorsMu.RUnlock()
+
+	names := make([]string, 0, len(evaluators))
+	for name := range evaluators {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func lookupEvaluator(name string) (Evaluator, error) {
+	evaluatorsMu.RLock()
+	defer evaluatorsMu.RUnlock()
+
+	e, ok := evaluators[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown evaluator %q", name)
+	}
+	return e, nil
+}
+
+// Check is one threshold of a rule: a tier, or the clear threshold with
+// the inverse comparison.
+type Check struct {
+	Threshold  float64
+	Comparison string
+}
+
+// BatchEvaluator is implemented by evaluators that judge every threshold of
+// a rule in one go, e.g. with a single call to a remote service. Its
+// verdicts follow checks; the lifecycle asks it once per report instead of
+// calling Evaluate for each tier and the clear threshold.
+type BatchEvaluator interface {
+	Evaluator
+	EvaluateChecks(metric *pb.MetricReport, rule AlertRule, checks []Check) ([]bool, error)
+}
+
+// RuleValidator is implemented by evaluators that check the rules naming
+// them; LoadRules and ParseRules reject the rules they refuse.
+type RuleValidator interface {
+	ValidateRule(rule AlertRule) error
+}
+
+// stateful is implemented by the built-in evaluators, which read the
+// history, baselines or peer groups of a replay instead of the workers'.
+type stateful interface {
+	withState(s *evalState) Evaluator
+}
+
+func (e SimpleEvaluator) withState(s *evalState) Evaluator  { return SimpleEvaluator{state: s} }
+func (e ExprEvaluator) withState(s *evalState) Evaluator    { return ExprEvaluator{state: s} }
+func (e AnomalyEvaluator) withState(s *evalState) Evaluator { return AnomalyEvaluator{state: s} }
+func (e PeerEvaluator) withState(s *evalState) Evaluator    { return PeerEvaluator{state: s} }
+
+// evaluatorName returns the evaluator of the rule: the one it names, or
+// the built-in one matching its kind.
+func (r AlertRule) evaluatorName() string {
+	switch {
+	case r.Evaluator != "":
+		return r.Evaluator
+	case r.Expr != "":
+		return EvaluatorExpression
+	case r.Anomaly != nil:
+		return EvaluatorAnomaly
+	case r.Peer != nil:
+		return EvaluatorPeer
+	case r.External != nil:
+		return EvaluatorExternal
+	}
+	return EvaluatorThreshold
+}
+
+// evaluatorNames returns the evaluators judging the rule.
+func (r AlertRule) evaluatorNames() []string {
+	if len(r.Evaluators) > 0 {
+		return r.Evaluators
+	}
+	return []string{r.evaluatorName()}
+}
+
+// Ways of combining the verdicts of AlertRule.Evaluators.
+const (
+	CombineAll = "all"
+	CombineAny = "any"
+)
+
+// ruleEvaluator hands each rule to its registered evaluators.
+type ruleEvaluator struct {
+	state  *evalState     // nil: the workers' state
+	report *reportVerdict // verdicts of batch evaluators for one report
+}
+
+// forReport returns the evaluator judging the thresholds of rule for a
+// single report, asking batch evaluators once for all of them.
+func (e ruleEvaluator) forReport(rule AlertRule) ruleEvaluator {
+	e.report = &reportVerdict{rule: rule, checks: rule.checks(), verdicts: map[string]map[Check]bool{}}
+	return e
+}
+
+func (e ruleEvaluator) Evaluate(metric *pb.MetricReport, rule AlertRule) (bool, error) {
+	if len(rule.Evaluators) == 0 {
+		return e.evaluateWith(rule.evaluatorName(), metric, rule)
+	}
+
+	// A "false" settles "all" and a "true" settles "any", whatever the
+	// remaining evaluators say; an error counts only when nothing settles
+	// the rule. At the clear threshold it is the other way round: an "all"
+	// rule is cleared once one of its evaluators is.
+	settles := rule.Combine == CombineAny
+	if rule.clearing {
+		settles = !settles
+	}
+	var firstErr error
+	for _, name := range rule.Evaluators {
+		fired, err := e.evaluateWith(name, metric, rule)
+		if err != nil {
+			if firstErr == nil {
+				firstErr = fmt.Errorf("evaluator %q: %w", name, err)
+			}
+			continue
+		}
+		if fired == settles {
+			return settles, nil
+		}
+	}
+	if firstErr != nil {
+		return false, firstErr
+	}
+	return !settles, nil
+}
+
+func (e ruleEvaluator) evaluateWith(name string, metric *pb.MetricReport, rule AlertRule) (bool, error) {
+	ev, err := lookupEvaluator(name)
+	if err != nil {
+		return false, err
+	}
+	if s, ok := ev.(stateful); ok {
+		ev = s.withState(e.state)
+	}
+	if b, ok := ev.(BatchEvaluator); ok && e.report != nil {
+		return e.report.verdict(name, b, metric, rule)
+	}
+	return ev.Evaluate(metric, rule)
+}
+
+// reportVerdict keeps the verdicts of the batch evaluators of a rule on
+// one report.
+type reportVerdict struct {
+	rule     AlertRule
+	checks   []Check
+	verdicts map[string]map[Check]bool // evaluator → verdict per check
+}
+
+// verdict returns the batch evaluator's verdict on one threshold of the
+// rule, asking it for every threshold the first time.
+func (v *reportVerdict) verdict(name string, b BatchEvaluator, metric *pb.MetricReport, rule AlertRule) (bool, error) {
+	c := Check{Threshold: rule.Threshold, Comparison: rule.Comparison}
+
+	byCheck, ok := v.verdicts[name]
+	if !ok {
+		list, err := b.EvaluateChecks(metric, v.rule, v.checks)
+		if err != nil {
+			return false, err
+		}
+		if len(list) != len(v.checks) {
+			return false, fmt.Errorf("%d verdicts for %d checks", len(list), len(v.checks))
+		}
+		byCheck = make(map[Check]bool, len(list))
+		for i, ch := range v.checks {
+			byCheck[ch] = list[i]
+		}
+		v.verdicts[name] = byCheck
+	}
+
+	if fired, ok := byCheck[c]; ok {
+		return fired, nil
+	}
+	return b.Evaluate(metric, rule)
+}
+
+// -------------------- BUILT-IN RULE CHECKS --------------------
+
+var errMixedKinds = errors.New("the evaluator does not read the rule's expression, anomaly, peer or external settings")
+
+func (SimpleEvaluator) ValidateRule(r AlertRule) error {
+	// With several evaluators each one reads its own settings.
+	if len(r.Evaluators) == 0 && (r.Expr != "" || r.Anomaly != nil || r.Peer != nil || r.External != nil) {
+		return errMixedKinds
+	}
+	for _, m := range metricNames {
+		if r.Metric == m {
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown metric %q", r.Metric)
+}
+
+func (AnomalyEvaluator) ValidateRule(r AlertRule) error {
+	if r.Anomaly == nil {
+		return errors.New("the anomaly evaluator needs anomaly settings")
+	}
+	if len(r.Evaluators) > 0 && r.Anomaly.Sensitivity <= 0 {
+		return errors.New("judged with other evaluators, the anomaly evaluator needs its own sensitivity")
+	}
+	return nil
+}
+
+func (PeerEvaluator) ValidateRule(r AlertRule) error {
+	if r.Peer == nil {
+		return errors.New("the peer evaluator needs peer settings")
+	}
+	if len(r.Evaluators) > 0 && r.Peer.Sensitivity <= 0 {
+		return errors.New("judged with other evaluators, the peer evaluator needs its own sensitivity")
+	}
+	return nil
+}
+
+// -------------------- EVALUATION ERRORS --------------------
+
+// RuleStatus is a loaded rule as listed by GET /rules, with the errors its
+// evaluator returned since the server started.
+type RuleStatus struct {
+	Name           string `json:"name"`
+	Evaluator      string `json:"evaluator"`         // comma-separated with several
+	Combine        string `json:"combine,omitempty"` // how several are combined
+	Errors         int64  `json:"errors"`
+	LastError      string `json:"last_error,omitempty"`
+	LastErrorAgent string `json:"last_error_agent,omitempty"`
+	LastErrorAt    int64  `json:"last_error_at,omitempty"` // report timestamp
+}
+
+type ruleErrorStats struct {
+	count int64
+	err   string
+	agent string
+	at    int64
+}
+
+// ruleErrors counts the evaluation errors of the live rules by rule name.
+type ruleErrors struct {
+	mu    sync.Mutex
+	rules map[string]*ruleErrorStats
+}
+
+var evalErrors = &ruleErrors{rules: map[string]*ruleErrorStats{}}
+
+// record counts an error and logs it when it differs from the rule's
+// previous one, so a failing evaluator does not log every sample.
+func (e *ruleErrors) record(metric *pb.MetricReport, rule AlertRule, err error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	st, ok := e.rules[rule.Name]
+	if !ok {
+		st = &ruleErrorStats{}
+		e.rules[rule.Name] = st
+	}
+	if st.err != err.Error() {
+		slog.Warn("rule evaluation failed", "rule", rule.Name, "evaluators", rule.evaluatorNames(), "agent", metric.AgentId, "err", err)
+	}
+	st.count++
+	st.err = err.Error()
+	st.agent = metric.AgentId
+	st.at = metric.Timestamp
+}
+
+// status lists the rules with their error counts.
+func (e *ruleErrors) status(list []AlertRule) []RuleStatus {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	out := make([]RuleStatus, 0, len(list))
+	for _, r := range list {
+		rs := RuleStatus{Name: r.Name, Evaluator: strings.Join(r.evaluatorNames(), ",")}
+		if len(r.Evaluators) > 0 {
+			rs.Combine = cmp.Or(r.Combine, CombineAll)
+		}
+		if st, ok := e.rules[r.Name]; ok {
+			rs.Errors = st.count
+			rs.LastError = st.err
+			rs.LastErrorAgent = st.agent
+			rs.LastErrorAt = st.at
+		}
+		out = append(out, rs)
+	}
+	return out
+}
+
+// errorSink is implemented by the sinks that want evaluation errors; the
+// alert state of the rule is left as it was.
+type errorSink interface {
+	evalError(metric *pb.MetricReport, rule AlertRule, err error)
+}
+
+func (s storeAndNotify) evalError(metric *pb.MetricReport, rule AlertRule, err error) {
+	evalErrors.record(metric, rule, err)
+}
+
+// -------------------- HTTP --------------------
+
+// rulesHandler serves GET /rules: the loaded rules, their evaluators and
+// evaluation errors.
+func (s *RestServer) rulesHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(evalErrors.status(loadedRules().list))
+}
@@ -0,0 +1,198 @@
+package grpc
+
+import (
+	"errors"
+	"fmt"
+	pb "gowatch/gopherwatch/pkg/generated"
+	"strings"
+	"testing"
+)
+
+// fires evaluates a rule and fails the test on an evaluation error.
+func fires(t *testing.T, e Evaluator, metric *pb.MetricReport, rule AlertRule) bool {
+	t.Helper()
+	fired, err := e.Evaluate(metric, rule)
+	if err != nil {
+		t.Fatalf("evaluate %q: %v", rule.Name, err)
+	}
+	return fired
+}
+
+// flakyEvaluator fires on cpu above the threshold and fails while down.
+type flakyEvaluator struct{ down *bool }
+
+func (e flakyEvaluator) Evaluate(metric *pb.MetricReport, rule AlertRule) (bool, error) {
+	if *e.down {
+		return false, errors.New("model unavailable")
+	}
+	return metric.CpuUsage > rule.Threshold, nil
+}
+
+func TestRegisteredEvaluator(t *testing.T) {
+	down := false
+	RegisterEvaluator("test-flaky", flakyEvaluator{down: &down})
+
+	rule := AlertRule{Name: "Model", Evaluator: "test-flaky", Metric: "cpu", Threshold: 90, Comparison: ">"}
+	if err := validateRule(rule); err != nil {
+		t.Fatal(err)
+	}
+
+	// Fires on the first report; the failure of the second is reported and
+	// the alert stays firing instead of resolving on a "false".
+	s := newEvalState()
+	tr := &alertTracker{state: s}
+	idx := newRuleIndex([]AlertRule{rule})
+	rec := &recorder{}
+	for ts, cpu := range []float64{95, 95, 20} {
+		down = ts == 1
+		rec.at = int64(ts)
+		s.evaluate(t.Context(), tr, idx, &pb.MetricReport{AgentId: "model-agent", CpuUsage: cpu, Timestamp: int64(ts)}, rec)
+	}
+
+	var kinds []string
+	for _, tr := range rec.transitions {
+		kinds = append(kinds, tr.Kind)
+	}
+	if got, want := strings.Join(kinds, " "), "fired error resolved"; got != want {
+		t.Errorf("expected %q; got %q", want, got)
+	}
+	if e := rec.transitions[1].Error; e != "model unavailable" {
+		t.Errorf("expected the evaluator error to be recorded; got %q", e)
+	}
+}
+
+func TestValidateEvaluator(t *testing.T) {
+	cases := []struct {
+		rule AlertRule
+		want string
+	}{
+		{AlertRule{Name: "x", Evaluator: "nope", Metric: "cpu", Threshold: 1, Comparison: ">"}, "unknown evaluator"},
+		{AlertRule{Name: "x", Evaluator: EvaluatorAnomaly, Metric: "cpu", Threshold: 1, Comparison: ">"}, "anomaly settings"},
+		{AlertRule{Name: "x", Evaluator: EvaluatorThreshold, Metric: "cpu", Threshold: 1, Comparison: ">", Peer: &Peer{}}, "does not read"},
+		{AlertRule{Name: "x", Metric: "load", Threshold: 1, Comparison: ">"}, "unknown metric"},
+	}
+	for _, c := range cases {
+		err := validateRule(c.rule)
+		if err == nil || !strings.Contains(err.Error(), c.want) {
+			t.Errorf("%+v: expected error containing %q; got %v", c.rule, c.want, err)
+		}
+	}
+
+	if names := strings.Join(Evaluators(), ","); !strings.Contains(names, "anomaly,expression,peer") {
+		t.Errorf("expected the built-in evaluators to be registered; got %s", names)
+	}
+}
+
+// gateEvaluator fires while open, whatever the sample, and fails with err.
+type gateEvaluator struct {
+	open *bool
+	err  *error
+}
+
+func (e gateEvaluator) Evaluate(metric *pb.MetricReport, rule AlertRule) (bool, error) {
+	return *e.open, *e.err
+}
+
+func TestCombinedEvaluators(t *testing.T) {
+	var open bool
+	var gateErr error
+	RegisterEvaluator("test-gate", gateEvaluator{open: &open, err: &gateErr})
+
+	down := errors.New("gate unavailable")
+	cases := []struct {
+		combine string
+		cpu     float64
+		open    bool
+		err     error
+		want    string // true | false | error
+	}{
+		{CombineAll, 95, true, nil, "true"},
+		{CombineAll, 95, false, nil, "false"},
+		{CombineAll, 50, false, down, "false"}, // the threshold settles it
+		{CombineAll, 95, false, down, "error"},
+		{CombineAny, 50, true, nil, "true"},
+		{CombineAny, 50, false, nil, "false"},
+		{CombineAny, 95, false, down, "true"},
+		{CombineAny, 50, false, down, "error"},
+	}
+	for _, c := range cases {
+		open, gateErr = c.open, c.err
+		rule := AlertRule{Name: "Gated", Metric: "cpu", Threshold: 90, Comparison: ">",
+			Evaluators: []string{EvaluatorThreshold, "test-gate"}, Combine: c.combine}
+
+		fired, err := ruleEvaluator{state: newEvalState()}.Evaluate(&pb.MetricReport{AgentId: "gate-agent", CpuUsage: c.cpu}, rule)
+		got := fmt.Sprint(fired)
+		if err != nil {
+			got = "error"
+		}
+		if got != c.want {
+			t.Errorf("%s, cpu %v, gate %v/%v: expected %s; got %s (%v)", c.combine, c.cpu, c.open, c.err, c.want, got, err)
+		}
+	}
+
+	invalid := []struct {
+		rule AlertRule
+		want string
+	}{
+		{AlertRule{Name: "x", Evaluator: "test-gate", Evaluators: []string{EvaluatorThreshold}, Metric: "cpu", Comparison: ">"}, "either one evaluator or several"},
+		{AlertRule{Name: "x", Combine: CombineAny, Metric: "cpu", Comparison: ">"}, "several evaluators"},
+		{AlertRule{Name: "x", Evaluators: []string{EvaluatorThreshold, "test-gate"}, Combine: "most", Metric: "cpu", Comparison: ">"}, "unknown combine"},
+		{AlertRule{Name: "x", Evaluators: []string{EvaluatorThreshold, "nope"}, Metric: "cpu", Comparison: ">"}, "unknown evaluator"},
+		{AlertRule{Name: "x", Evaluators: []string{EvaluatorAnomaly, "test-gate"}, Metric: "cpu", Comparison: ">"}, `evaluator "anomaly"`},
+	}
+	for _, c := range invalid {
+		err := validateRule(c.rule)
+		if err == nil || !strings.Contains(err.Error(), c.want) {
+			t.Errorf("%+v: expected error containing %q; got %v", c.rule, c.want, err)
+		}
+	}
+}
+
+func TestCombinedBuiltInEvaluators(t *testing.T) {
+
+	// High CPU only when it is also unusual for the agent.
+	rule := AlertRule{Name: "Unusual high CPU", Metric: "cpu", Threshold: 50, Comparison: ">", ClearThreshold: floatPtr(40),
+		Anomaly:    &Anomaly{WarmUp: 5, Sensitivity: 3},
+		Evaluators: []string{EvaluatorThreshold, EvaluatorAnomaly}}
+	if err := validateRule(rule); err != nil {
+		t.Fatal(err)
+	}
+
+	var reports []*pb.MetricReport
+	for i, cpu := range []float64{60, 60, 60, 60, 60, 60, 60, 95, 60} {
+		reports = append(reports, &pb.MetricReport{AgentId: "combo-1", CpuUsage: cpu, Timestamp: int64(i * 15)})
+	}
+	transitions, err := Replay([]AlertRule{rule}, reports)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 60 is above 50 but usual; 95 is both. Back at 60 the anomaly is
+	// over, which clears the rule although 60 is above the clear threshold.
+	var got []string
+	for _, tr := range transitions {
+		got = append(got, fmt.Sprintf("%s %d", tr.Kind, tr.At))
+	}
+	if strings.Join(got, ", ") != "fired 105, resolved 120" {
+		t.Errorf("expected to fire at 105 and resolve at 120; got %v", got)
+	}
+
+	// Anomaly and peer detection together, each with its own sensitivity.
+	outlier := AlertRule{Name: "Unusual outlier", Metric: "cpu",
+		Anomaly: &Anomaly{Sensitivity: 3}, Peer: &Peer{Sensitivity: 4},
+		Evaluators: []string{EvaluatorAnomaly, EvaluatorPeer}}
+	if err := validateRule(outlier); err != nil {
+		t.Errorf("expected anomaly and peer evaluators to combine; got %v", err)
+	}
+	outlier.Peer.Sensitivity = 0
+	if err := validateRule(outlier); err == nil || !strings.Contains(err.Error(), "own sensitivity") {
+		t.Errorf("expected the peer evaluator to need its sensitivity; got %v", err)
+	}
+
+	noEvaluator := rule
+	noEvaluator.Evaluators = []string{EvaluatorThreshold, EvaluatorExpression}
+	noEvaluator.Expr = "memory > 50"
+	if err := validateRule(noEvaluator); err == nil || !strings.Contains(err.Error(), "needs the anomaly evaluator") {
+		t.Errorf("expected anomaly settings to need the anomaly evaluator; got %v", err)
+	}
+}
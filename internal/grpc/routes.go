@@ -3,8 +3,10 @@ package grpc
 import (
 	"context"
 	"encoding/json"
+	"gowatch/internal/database"
 	"log"
 	"net/http"
+	"strconv"
 	"time"
 )
 
@@ -13,6 +15,33 @@ func (s *RestServer) RegisterRoutes() http.Handler {
 
 	mux.HandleFunc("/status", s.statusHandler)
 	mux.HandleFunc("/alerts/history", s.alertHistoryHandler)
+	mux.HandleFunc("GET /alerts/groups", s.alertGroupsHandler)
+	mux.HandleFunc("POST /alerts/{id}/ack", s.alertActionHandler(database.ActionAcknowledge))
+	mux.HandleFunc("POST /alerts/{id}/assign", s.alertActionHandler(database.ActionAssign))
+	mux.HandleFunc("POST /alerts/{id}/resolve", s.alertActionHandler(database.ActionResolve))
+	mux.HandleFunc("GET /alerts/{id}/events", s.alertEventsHandler)
+	mux.HandleFunc("/metrics/query", s.metricsQueryHandler)
+	mux.HandleFunc("GET /agents", s.listAgentsHandler)
+	mux.HandleFunc("GET /agents/connected", s.connectedAgentsHandler)
+	mux.HandleFunc("GET /agents/{id}", s.agentHandler)
+	mux.HandleFunc("GET /agents/{id}/forecast", s.forecastHandler)
+	mux.HandleFunc("POST /agents/{id}/commands", s.sendCommandHandler)
+	mux.HandleFunc("GET /agents/{id}/commands", s.listCommandsHandler)
+	mux.HandleFunc("GET /rules", s.rulesHandler)
+	mux.HandleFunc("POST /rules/backtest", s.backtestHandler)
+	mux.HandleFunc("GET /inhibit-rules", s.listInhibitRulesHandler)
+	mux.HandleFunc("PUT /inhibit-rules", s.setInhibitRulesHandler)
+	mux.HandleFunc("POST /silences", s.createSilenceHandler)
+	mux.HandleFunc("GET /silences", s.listSilencesHandler)
+	mux.HandleFunc("DELETE /silences/{id}", s.deleteSilenceHandler)
+	mux.HandleFunc("POST /maintenance", s.createMaintenanceHandler)
+	mux.HandleFunc("GET /maintenance", s.listMaintenanceHandler)
+	mux.HandleFunc("GET /maintenance/active", s.activeMaintenanceHandler)
+	mux.HandleFunc("DELETE /maintenance/{id}", s.deleteMaintenanceHandler)
+	mux.HandleFunc("POST /configs", s.createConfigHandler)
+	mux.HandleFunc("GET /configs", s.listConfigsHandler)
+	mux.HandleFunc("PUT /configs/{id}", s.updateConfigHandler)
+	mux.HandleFunc("DELETE /configs/{id}", s.deleteConfigHandler)
 	mux.HandleFunc("/health", s.healthHandler)
 	mux.HandleFunc("/", s.HelloWorldHandler)
 
@@ -81,7 +110,27 @@ func (s *RestServer) alertHistoryHandler(w http.ResponseWriter, r *http.Request)
 	ctx, cancel := context.WithTimeout(r.Context(), 2*time.Second)
 	defer cancel()
 
-	alerts, err := s.db.GetAlertHistory(ctx)
+	// Optional ?severity=info|warning|critical|page
+	var filter database.AlertFilter
+	if raw := r.URL.Query().Get("severity"); raw != "" {
+		sev, err := ParseSeverity(raw)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		filter.Severity = string(sev)
+	}
+
+	// Optional ?status=firing|resolved
+	switch status := r.URL.Query().Get("status"); status {
+	case "", StatusFiring, StatusResolved:
+		filter.Status = status
+	default:
+		http.Error(w, "unknown status "+status, http.StatusBadRequest)
+		return
+	}
+
+	alerts, err := s.db.GetAlertHistory(ctx, filter)
 	if err != nil {
 		http.Error(w, "failed to load history", http.StatusInternalServerError)
 		return
@@ -89,3 +138,64 @@ func (s *RestServer) alertHistoryHandler(w http.ResponseWriter, r *http.Request)
 
 	json.NewEncoder(w).Encode(alerts)
 }
+
+// metricsQueryHandler serves GET /metrics/query?agent_id=&metric=&start=&end=&step=
+// start/end are Unix timestamps (default: last hour), step is in seconds
+// (default: 60). The storage tier is chosen from the step.
+func (s *RestServer) metricsQueryHandler(w http.ResponseWriter, r *http.Request) {
+	params := r.URL.Query()
+
+	q := database.RangeQuery{
+		AgentID: params.Get("agent_id"),
+		Metric:  params.Get("metric"),
+		End:     time.Now().Unix(),
+		Step:    60,
+	}
+
+	if q.AgentID == "" || q.Metric == "" {
+		http.Error(w, "agent_id and metric are required", http.StatusBadRequest)
+		return
+	}
+
+	for _, p := range []struct {
+		name string
+		dst  *int64
+	}{{"start", &q.Start}, {"end", &q.End}, {"step", &q.Step}} {
+		raw := params.Get(p.name)
+		if raw == "" {
+			continue
+		}
+		v, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil {
+			http.Error(w, "invalid "+p.name, http.StatusBadRequest)
+			return
+		}
+		*p.dst = v
+	}
+
+	// start defaults to the hour before end, whether end was given or not.
+	if params.Get("start") == "" {
+		q.Start = q.End - 3600
+	}
+
+	if q.End <= q.Start {
+		http.Error(w, "invalid time range", http.StatusBadRequest)
+		return
+	}
+	if err := database.ValidateStep(q.Step); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	result, err := s.db.QueryRange(ctx, q)
+	if err != nil {
+		http.Error(w, "failed to query metrics", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
@@ -1,6 +1,8 @@
 package grpc
 
 import (
+	"context"
+	"gowatch/internal/database"
 	"io"
 	"net/http"
 	"net/http/httptest"
@@ -59,3 +61,37 @@ func TestHandler(t *testing.T) {
 		t.Errorf("expected response body to be %v; got %v", expected, string(body))
 	}
 }
+
+// rangeDB records the range query it is asked.
+type rangeDB struct {
+	database.Service
+	got *database.RangeQuery
+}
+
+func (db rangeDB) QueryRange(_ context.Context, q database.RangeQuery) (database.RangeResult, error) {
+	*db.got = q
+	return database.RangeResult{Points: []database.Point{}}, nil
+}
+
+func TestMetricsQueryRange(t *testing.T) {
+	var got database.RangeQuery
+	s := &RestServer{db: rangeDB{got: &got}}
+
+	query := func(params string) int {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		s.metricsQueryHandler(rec, httptest.NewRequest(http.MethodGet, "/metrics/query?agent_id=a1&metric=cpu&"+params, nil))
+		return rec.Code
+	}
+
+	// start defaults to the hour before the given end.
+	if code := query("end=1708300000"); code != http.StatusOK || got.Start != 1708300000-3600 || got.End != 1708300000 {
+		t.Errorf("expected the hour before end; got %d %+v", code, got)
+	}
+	if code := query("start=1708200000&end=1708300000&step=90"); code != http.StatusBadRequest {
+		t.Errorf("expected a step of 90s to be rejected; got %d", code)
+	}
+	if code := query("start=1708200000&end=1708300000&step=120"); code != http.StatusOK || got.Step != 120 {
+		t.Errorf("expected a step of 2m to be accepted; got %d %+v", code, got)
+	}
+}
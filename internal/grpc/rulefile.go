@@ -0,0 +1,229 @@
+package grpc
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"gowatch/internal/database"
+	"time"
+)
+
+// -------------------- RULE FILES --------------------
+
+// A rule file is JSON with the fields of AlertRule in snake_case and
+// durations as Go duration strings:
+//
+//	{"rules": [{
+//	    "name": "High CPU", "metric": "cpu", "comparison": ">",
+//	    "tiers": [{"severity": "warning", "threshold": 80}, {"severity": "critical", "threshold": 90}],
+//	    "clear_threshold": 70, "resolve_after": "30s",
+//	    "window": {"aggregate": "avg", "duration": "5m"}
+//	}]}
+
+type ruleFile struct {
+	Rules []ruleSpec `json:"rules"`
+}
+
+type ruleSpec struct {
+	Name           string         `json:"name"`
+	Metric         string         `json:"metric"`
+	Threshold      float64        `json:"threshold"`
+	Comparison     string         `json:"comparison"`
+	Severity       Severity       `json:"severity"`
+	Tiers          []tierSpec     `json:"tiers"`
+	For            duration       `json:"for"`
+	ClearThreshold *float64       `json:"clear_threshold"`
+	ResolveAfter   duration       `json:"resolve_after"`
+	Escalation     string         `json:"escalation"`
+	Scope          *scopeSpec     `json:"scope"`
+	Overrides      []overrideSpec `json:"overrides"`
+	Window         *windowSpec    `json:"window"`
+	Anomaly        *anomalySpec   `json:"anomaly"`
+	Forecast       *forecastSpec  `json:"forecast"`
+	Peer           *peerSpec      `json:"peer"`
+	External       *externalSpec  `json:"external"`
+	Evaluator      string         `json:"evaluator"`
+	Evaluators     []string       `json:"evaluators"`
+	Combine        string         `json:"combine"`
+	Expr           string         `json:"expr"`
+}
+
+type tierSpec struct {
+	Severity  Severity `json:"severity"`
+	Threshold float64  `json:"threshold"`
+}
+
+type scopeSpec struct {
+	Service      string             `json:"service"`
+	ServiceRegex string             `json:"service_regex"`
+	Agent        string             `json:"agent"`
+	Matchers     []database.Matcher `json:"matchers"`
+}
+
+type overrideSpec struct {
+	Scope          scopeSpec  `json:"scope"`
+	Threshold      *float64   `json:"threshold"`
+	Tiers          []tierSpec `json:"tiers"`
+	ClearThreshold *float64   `json:"clear_threshold"`
+	Disabled       bool       `json:"disabled"`
+}
+
+type windowSpec struct {
+	Aggregate  string   `json:"aggregate"`
+	Duration   duration `json:"duration"`
+	Samples    int      `json:"samples"`
+	Percentile float64  `json:"percentile"`
+	Per        duration `json:"per"`
+}
+
+type anomalySpec struct {
+	Seasonality string   `json:"seasonality"`
+	Direction   string   `json:"direction"`
+	WarmUp      int      `json:"warm_up"`
+	MinStdDev   float64  `json:"min_stddev"`
+	HalfLife    duration `json:"half_life"`
+	Sensitivity float64  `json:"sensitivity"`
+}
+
+type forecastSpec struct {
+	Method     string   `json:"method"`
+	Lookback   duration `json:"lookback"`
+	Limit      float64  `json:"limit"`
+	MinSamples int      `json:"min_samples"`
+}
+
+type peerSpec struct {
+	Direction    string   `json:"direction"`
+	MinPeers     int      `json:"min_peers"`
+	MaxAge       duration `json:"max_age"`
+	MinDeviation float64  `json:"min_deviation"`
+	Sensitivity  float64  `json:"sensitivity"`
+}
+
+type externalSpec struct {
+	Model      string   `json:"model"`
+	Window     duration `json:"window"`
+	NoFallback bool     `json:"no_fallback"`
+}
+
+// duration is a time.Duration written as a Go duration string ("5m").
+type duration time.Duration
+
+func (d *duration) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return fmt.Errorf("durations are strings such as \"5m\"")
+	}
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = duration(v)
+	return nil
+}
+
+// ParseRules decodes and validates a rule file.
+func ParseRules(data []byte) ([]AlertRule, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+
+	var f ruleFile
+	if err := dec.Decode(&f); err != nil {
+		return nil, fmt.Errorf("invalid rule file: %w", err)
+	}
+
+	list := make([]AlertRule, 0, len(f.Rules))
+	for _, s := range f.Rules {
+		list = append(list, s.rule())
+	}
+	if err := validateRules(list); err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+// ParseRule decodes and validates a single rule in the rule file format.
+func ParseRule(data []byte) (AlertRule, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+
+	var s ruleSpec
+	if err := dec.Decode(&s); err != nil {
+		return AlertRule{}, fmt.Errorf("invalid rule: %w", err)
+	}
+
+	r := s.rule()
+	if err := validateRule(r); err != nil {
+		return AlertRule{}, fmt.Errorf("rule %q: %w", r.Name, err)
+	}
+	return r, nil
+}
+
+func (s ruleSpec) rule() AlertRule {
+	r := AlertRule{
+		Name:           s.Name,
+		Metric:         s.Metric,
+		Threshold:      s.Threshold,
+		Comparison:     s.Comparison,
+		Severity:       s.Severity,
+		Tiers:          tiersOf(s.Tiers),
+		For:            time.Duration(s.For),
+		ClearThreshold: s.ClearThreshold,
+		ResolveAfter:   time.Duration(s.ResolveAfter),
+		Escalation:     s.Escalation,
+		Evaluator:      s.Evaluator,
+		Evaluators:     s.Evaluators,
+		Combine:        s.Combine,
+		Expr:           s.Expr,
+	}
+	if s.Scope != nil {
+		sc := s.Scope.scope()
+		r.Scope = &sc
+	}
+	for _, o := range s.Overrides {
+		r.Overrides = append(r.Overrides, Override{
+			Scope:          o.Scope.scope(),
+			Threshold:      o.Threshold,
+			Tiers:          tiersOf(o.Tiers),
+			ClearThreshold: o.ClearThreshold,
+			Disabled:       o.Disabled,
+		})
+	}
+	if w := s.Window; w != nil {
+		r.Window = &Window{
+			Aggregate:  w.Aggregate,
+			Duration:   time.Duration(w.Duration),
+			Samples:    w.Samples,
+			Percentile: w.Percentile,
+			Per:        time.Duration(w.Per),
+		}
+	}
+	if a := s.Anomaly; a != nil {
+		r.Anomaly = &Anomaly{Seasonality: a.Seasonality, Direction: a.Direction, WarmUp: a.WarmUp, MinStdDev: a.MinStdDev, HalfLife: time.Duration(a.HalfLife), Sensitivity: a.Sensitivity}
+	}
+	if f := s.Forecast; f != nil {
+		r.Forecast = &Forecast{Method: f.Method, Lookback: time.Duration(f.Lookback), Limit: f.Limit, MinSamples: f.MinSamples}
+	}
+	if p := s.Peer; p != nil {
+		r.Peer = &Peer{Direction: p.Direction, MinPeers: p.MinPeers, MaxAge: time.Duration(p.MaxAge), MinDeviation: p.MinDeviation, Sensitivity: p.Sensitivity}
+	}
+	if x := s.External; x != nil {
+		r.External = &External{Model: x.Model, Window: time.Duration(x.Window), NoFallback: x.NoFallback}
+	}
+	return r
+}
+
+func (s scopeSpec) scope() Scope {
+	return Scope{Service: s.Service, ServiceRegex: s.ServiceRegex, Agent: s.Agent, Matchers: s.Matchers}
+}
+
+func tiersOf(specs []tierSpec) []Tier {
+	if specs == nil {
+		return nil
+	}
+	tiers := make([]Tier, len(specs))
+	for i, t := range specs {
+		tiers[i] = Tier{Severity: t.Severity, Threshold: t.Threshold}
+	}
+	return tiers
+}
@@ -0,0 +1,61 @@
+package grpc
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseRules(t *testing.T) {
+
+	list, err := ParseRules([]byte(`{"rules": [{
+		"name": "Sustained CPU", "metric": "cpu", "comparison": ">",
+		"tiers": [{"severity": "warning", "threshold": 80}],
+		"clear_threshold": 70, "resolve_after": "30s",
+		"scope": {"agent": "web-*"},
+		"window": {"aggregate": "avg", "duration": "5m"}
+	}]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := list[0]
+	if r.ResolveAfter != 30*time.Second || r.Window.Duration != 5*time.Minute || *r.ClearThreshold != 70 ||
+		r.Scope.Agent != "web-*" || r.Tiers[0] != (Tier{SeverityWarning, 80}) {
+		t.Errorf("unexpected rule %+v", r)
+	}
+
+	bad := map[string]string{
+		`{"rules": [{"name": "x", "metric": "cpu", "comparison": ">", "treshold": 5}]}`:         "unknown field",
+		`{"rules": [{"name": "x", "metric": "cpu", "comparison": ">", "resolve_after": 30}]}`:   "durations are strings",
+		`{"rules": [{"name": "x", "metric": "cpu", "comparison": "~", "threshold": 5}]}`:        `rule "x": unknown comparison`,
+		`{"rules": [{"name": "x", "expr": "cpu >", "threshold": 5, "window": {"samples": 3}}]}`: "only one of",
+	}
+	for in, want := range bad {
+		if _, err := ParseRules([]byte(in)); err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("expected an error containing %q, got %v", want, err)
+		}
+	}
+}
+
+func TestDuplicateRuleNames(t *testing.T) {
+
+	_, err := ParseRules([]byte(`{"rules": [
+		{"name": "CPU", "expr": "cpu > 90"},
+		{"name": "CPU", "expr": "cpu < 50"}
+	]}`))
+	if err == nil || !strings.Contains(err.Error(), `rule "CPU": duplicate rule name`) {
+		t.Errorf("expected the rule file to be rejected; got %v", err)
+	}
+
+	prev := loadedRules()
+	err = LoadRules([]AlertRule{
+		{Name: "CPU", Expr: "cpu > 90"},
+		{Name: "CPU", Expr: "cpu < 50"},
+	})
+	if err == nil || !strings.Contains(err.Error(), "duplicate rule name") {
+		t.Errorf("expected LoadRules to reject duplicate names; got %v", err)
+	}
+	if loadedRules() != prev {
+		t.Error("expected the loaded rules to be kept")
+	}
+}
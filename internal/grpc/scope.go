@@ -0,0 +1,203 @@
+package grpc
+
+import (
+	"errors"
+	"fmt"
+	pb "gowatch/gopherwatch/pkg/generated"
+	"gowatch/internal/database"
+	"path"
+	"sync"
+)
+
+// -------------------- RULE SCOPES --------------------
+
+// Scope selects the agents a rule applies to. Every set field must match;
+// an empty scope matches every agent.
+//
+//	Scope{Service: "payments"}
+//	Scope{ServiceRegex: "db-.*", Agent: "db-prod-*"}
+//	Scope{Matchers: []database.Matcher{{Label: "agent_id", Value: "edge-[0-9]+", IsRegex: true}}}
+type Scope struct {
+	Service      string             // service_name equals
+	ServiceRegex string             // service_name matches (whole value)
+	Agent        string             // agent_id glob: * ? [a-z]
+	Matchers     []database.Matcher // on agent_id and service_name
+}
+
+// Override replaces the thresholds of a rule for the agents in its scope,
+// e.g. database hosts that legitimately run at 90% memory.
+type Override struct {
+	Scope          Scope
+	Threshold      *float64 // for rules without tiers
+	Tiers          []Tier
+	ClearThreshold *float64
+	Disabled       bool // the rule does not apply to the scope at all
+}
+
+// scopeLabels are the labels of a report scopes may select on.
+var scopeLabels = map[string]bool{
+	"agent_id":     true,
+	"service_name": true,
+}
+
+func (s *Scope) validate() error {
+	if s == nil {
+		return nil
+	}
+
+	if s.ServiceRegex != "" {
+		if _, err := compileMatcher(s.ServiceRegex); err != nil {
+			return fmt.Errorf("invalid service regex: %v", err)
+		}
+	}
+	if _, err := path.Match(s.Agent, ""); err != nil {
+		return fmt.Errorf("invalid agent pattern %q", s.Agent)
+	}
+	for _, m := range s.Matchers {
+		if !scopeLabels[m.Label] {
+			return fmt.Errorf("scopes can only match agent_id and service_name, not %q", m.Label)
+		}
+	}
+	return validateMatchers(s.Matchers)
+}
+
+// matches reports whether the agent of the report is in the scope.
+func (s *Scope) matches(metric *pb.MetricReport) bool {
+	if s == nil {
+		return true
+	}
+
+	if s.Service != "" && s.Service != metric.ServiceName {
+		return false
+	}
+	if s.ServiceRegex != "" {
+		re, err := compileMatcher(s.ServiceRegex)
+		if err != nil || !re.MatchString(metric.ServiceName) {
+			return false
+		}
+	}
+	if s.Agent != "" {
+		if ok, _ := path.Match(s.Agent, metric.AgentId); !ok {
+			return false
+		}
+	}
+	return matchesAll(s.Matchers, map[string]string{
+		"agent_id":     metric.AgentId,
+		"service_name": metric.ServiceName,
+	})
+}
+
+func (o Override) validate(r AlertRule) error {
+	if err := o.Scope.validate(); err != nil {
+		return err
+	}
+	if o.Threshold != nil && len(r.Tiers) > 0 {
+		return errors.New("override of a tiered rule needs Tiers, not Threshold")
+	}
+	for _, t := range o.Tiers {
+		if _, err := ParseSeverity(string(t.Severity)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// forAgent returns the rule as it applies to the agent of the report: with
+// the first matching override applied, or false when out of scope.
+func (r AlertRule) forAgent(metric *pb.MetricReport) (AlertRule, bool) {
+	if !r.Scope.matches(metric) {
+		return r, false
+	}
+
+	for _, o := range r.Overrides {
+		if !o.Scope.matches(metric) {
+			continue
+		}
+		if o.Disabled {
+			return r, false
+		}
+		if o.Threshold != nil {
+			r.Threshold = *o.Threshold
+		}
+		if o.Tiers != nil {
+			r.Tiers = o.Tiers
+		}
+		if o.ClearThreshold != nil {
+			r.ClearThreshold = o.ClearThreshold
+		}
+		break
+	}
+
+	r.Overrides = nil
+	return r, true
+}
+
+// -------------------- RULE INDEX --------------------
+
+// ruleIndex finds the rules that apply to an agent without scanning every
+// rule for every report. Rules scoped to one service are indexed by it;
+// the resolved rules of each agent are cached until the rules change.
+type ruleIndex struct {
+	byService map[string][]int // service → positions of rules scoped to it
+	other     []int            // positions of the remaining rules
+	list      []AlertRule
+	agents    sync.Map // scopeKey → []AlertRule
+}
+
+type scopeKey struct {
+	agent   string
+	service string
+}
+
+func newRuleIndex(list []AlertRule) *ruleIndex {
+	idx := &ruleIndex{byService: map[string][]int{}, list: list}
+	for i, r := range list {
+		if r.Scope != nil && r.Scope.Service != "" {
+			idx.byService[r.Scope.Service] = append(idx.byService[r.Scope.Service], i)
+		} else {
+			idx.other = append(idx.other, i)
+		}
+	}
+	return idx
+}
+
+// ruleSet is the index of the rules the workers evaluate. LoadRules
+// replaces it while workers run, so it is read through loadedRules.
+var (
+	rulesMu sync.RWMutex
+	ruleSet = newRuleIndex(rules)
+)
+
+// loadedRules returns the index of the rules loaded last.
+func loadedRules() *ruleIndex {
+	rulesMu.RLock()
+	defer rulesMu.RUnlock()
+	return ruleSet
+}
+
+// rulesFor returns the rules that apply to the agent of the report, in
+// rule order, with their overrides applied.
+func (idx *ruleIndex) rulesFor(metric *pb.MetricReport) []AlertRule {
+	key := scopeKey{agent: metric.AgentId, service: metric.ServiceName}
+	if v, ok := idx.agents.Load(key); ok {
+		return v.([]AlertRule)
+	}
+
+	// Merge the two candidate lists, both sorted by position.
+	scoped, other := idx.byService[metric.ServiceName], idx.other
+	var out []AlertRule
+	for len(scoped) > 0 || len(other) > 0 {
+		var i int
+		if len(other) == 0 || (len(scoped) > 0 && scoped[0] < other[0]) {
+			i, scoped = scoped[0], scoped[1:]
+		} else {
+			i, other = other[0], other[1:]
+		}
+		if r, ok := idx.list[i].forAgent(metric); ok {
+			out = append(out, r)
+		}
+	}
+
+	idx.agents.Store(key, out)
+	return out
+}
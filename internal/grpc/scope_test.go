@@ -0,0 +1,103 @@
+package grpc
+
+import (
+	pb "gowatch/gopherwatch/pkg/generated"
+	"gowatch/internal/database"
+	"testing"
+)
+
+func TestScopeMatches(t *testing.T) {
+
+	report := &pb.MetricReport{AgentId: "db-prod-3", ServiceName: "orders-db"}
+
+	cases := []struct {
+		scope Scope
+		want  bool
+	}{
+		{Scope{}, true},
+		{Scope{Service: "orders-db"}, true},
+		{Scope{Service: "orders"}, false},
+		{Scope{ServiceRegex: ".*-db"}, true},
+		{Scope{ServiceRegex: "db"}, false}, // whole value
+		{Scope{Agent: "db-prod-*"}, true},
+		{Scope{Agent: "db-staging-*"}, false},
+		{Scope{Service: "orders-db", Agent: "web-*"}, false},
+		{Scope{Matchers: []database.Matcher{{Label: "agent_id", Value: "db-prod-[0-9]+", IsRegex: true}}}, true},
+		{Scope{Matchers: []database.Matcher{{Label: "service_name", Value: "payments"}}}, false},
+	}
+	for i, c := range cases {
+		if got := c.scope.matches(report); got != c.want {
+			t.Errorf("case %d: expected %v, got %v", i, c.want, got)
+		}
+	}
+
+	bad := []Scope{
+		{ServiceRegex: "("},
+		{Agent: "db-["},
+		{Matchers: []database.Matcher{{Label: "severity", Value: "critical"}}},
+	}
+	for i, s := range bad {
+		if err := s.validate(); err == nil {
+			t.Errorf("bad scope %d: expected an error", i)
+		}
+	}
+}
+
+func TestRuleIndexOverridesAndOrder(t *testing.T) {
+
+	list := []AlertRule{
+		{
+			Name: "High Memory", Metric: "memory", Comparison: ">",
+			Tiers: []Tier{{SeverityWarning, 75}, {SeverityCritical, 85}},
+			Overrides: []Override{
+				{Scope: Scope{ServiceRegex: ".*-db"}, Tiers: []Tier{{SeverityWarning, 95}, {SeverityCritical, 98}}},
+				{Scope: Scope{Agent: "batch-*"}, Disabled: true},
+			},
+		},
+		{Name: "Payments CPU", Metric: "cpu", Threshold: 70, Comparison: ">", Scope: &Scope{Service: "payments"}},
+		{Name: "High Disk", Metric: "disk", Threshold: 90, Comparison: ">"},
+	}
+	for _, r := range list {
+		if err := validateRule(r); err != nil {
+			t.Fatalf("rule %q: %v", r.Name, err)
+		}
+	}
+	idx := newRuleIndex(list)
+
+	names := func(rs []AlertRule) []string {
+		var out []string
+		for _, r := range rs {
+			out = append(out, r.Name)
+		}
+		return out
+	}
+
+	payments := idx.rulesFor(&pb.MetricReport{AgentId: "pay-1", ServiceName: "payments"})
+	if got := names(payments); len(got) != 3 || got[1] != "Payments CPU" {
+		t.Errorf("expected all rules in order for payments, got %v", got)
+	}
+	if got := names(idx.rulesFor(&pb.MetricReport{AgentId: "web-1", ServiceName: "web"})); len(got) != 2 {
+		t.Errorf("expected the payments rule to be out of scope for web, got %v", got)
+	}
+	if got := names(idx.rulesFor(&pb.MetricReport{AgentId: "batch-7", ServiceName: "web"})); len(got) != 1 || got[0] != "High Disk" {
+		t.Errorf("expected memory rule to be disabled for batch agents, got %v", got)
+	}
+
+	// Database hosts run at 90% memory without firing.
+	db := &pb.MetricReport{AgentId: "db-1", ServiceName: "orders-db", MemoryUsage: 90}
+	mem := idx.rulesFor(db)[0]
+	if _, ok, _ := matchTier(SimpleEvaluator{}, db, mem); ok {
+		t.Error("expected the override to keep a database host at 90% quiet")
+	}
+	web := &pb.MetricReport{AgentId: "web-1", ServiceName: "web", MemoryUsage: 90}
+	if tier, ok, _ := matchTier(SimpleEvaluator{}, web, idx.rulesFor(web)[0]); !ok || tier.Severity != SeverityCritical {
+		t.Errorf("expected 90%% memory to be critical elsewhere, got %v %v", tier, ok)
+	}
+
+	if err := validateRule(AlertRule{
+		Name: "x", Metric: "memory", Comparison: ">", Tiers: []Tier{{SeverityWarning, 75}},
+		Overrides: []Override{{Threshold: floatPtr(90)}},
+	}); err == nil {
+		t.Error("expected a Threshold override of a tiered rule to be rejected")
+	}
+}
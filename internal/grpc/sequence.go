@@ -0,0 +1,251 @@
+package grpc
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// -------------------- SEQUENCE TRACKING --------------------
+
+// SequenceState is the high-water mark of an agent's sequenced reports.
+type SequenceState struct {
+	LastAccepted uint64 `json:"last_accepted"` // highest sequence accepted
+	LastAcked    uint64 `json:"last_acked"`    // every accepted report up to it is stored and evaluated
+	Duplicates   uint64 `json:"duplicates"`    // reports dropped as already accepted
+	Missing      uint64 `json:"missing"`       // sequence numbers skipped
+}
+
+// agentSequences is the state of an agent's sequences with the reports
+// the workers have not acknowledged.
+type agentSequences struct {
+	SequenceState
+	pending    map[uint64]bool // accepted, not yet processed by a worker
+	failed     map[uint64]bool // processed, but their samples were not stored
+	registered bool            // registered since its last sequenced report
+}
+
+// sequenceSet tracks the sequence numbers of every agent, so reports
+// replayed after a reconnect are dropped instead of stored and evaluated
+// twice. Reports arrive in order on a stream, so anything at or below the
+// high-water mark has been accepted already, unless storing it failed.
+//
+// An agent that restarts numbers its reports from 1 again: the mark is
+// reset when the first report after a registration has sequence 1. Taking
+// over a session and replaying the spool keeps it. The marks are kept in
+// memory and seeded at startup from the stored samples (see seed).
+type sequenceSet struct {
+	mu      sync.Mutex
+	byAgent map[string]*agentSequences
+	changed chan struct{} // closed when an acknowledgement moves
+}
+
+var sequences = newSequenceSet()
+
+func newSequenceSet() *sequenceSet {
+	return &sequenceSet{byAgent: map[string]*agentSequences{}, changed: make(chan struct{})}
+}
+
+// ackWait is how long a closing stream waits for the workers to process
+// its reports before acknowledging.
+var ackWait = 2 * time.Second
+
+// seedWindow is how far back seed looks for stored reports.
+const seedWindow = 24 * time.Hour
+
+// seed sets the marks of agents not seen yet, e.g. from
+// database.Service.LastSequences, so replays after a server restart are
+// still dropped.
+func (s *sequenceSet) seed(marks map[string]uint64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for agentID, seq := range marks {
+		if _, ok := s.byAgent[agentID]; !ok {
+			s.byAgent[agentID] = &agentSequences{SequenceState: SequenceState{LastAccepted: seq, LastAcked: seq}}
+		}
+	}
+}
+
+// observe reports whether a report with sequence seq is new, and how many
+// sequence numbers were skipped before it. Unsequenced reports (seq 0) are
+// always new.
+func (s *sequenceSet) observe(agentID string, seq uint64) (accept bool, missing uint64) {
+	if seq == 0 {
+		return true, 0
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	st, ok := s.byAgent[agentID]
+	if !ok {
+		st = &agentSequences{}
+		s.byAgent[agentID] = st
+	}
+
+	// A restarted agent registers and numbers its reports from 1 again.
+	if st.registered {
+		st.registered = false
+		if seq == 1 && st.LastAccepted > 0 {
+			*st = agentSequences{SequenceState: SequenceState{Duplicates: st.Duplicates, Missing: st.Missing}}
+		}
+	}
+
+	if seq <= st.LastAccepted {
+		// Reports whose samples were not stored are taken again.
+		if st.failed[seq] {
+			delete(st.failed, seq)
+			st.pend(seq)
+			return true, 0
+		}
+		st.Duplicates++
+		return false, 0
+	}
+
+	// The first report seen may follow reports sent before the server
+	// started; only skips after it are gaps.
+	if ok && seq > st.LastAccepted+1 {
+		missing = seq - st.LastAccepted - 1
+		st.Missing += missing
+	}
+	st.LastAccepted = seq
+	st.pend(seq)
+	return true, missing
+}
+
+func (st *agentSequences) pend(seq uint64) {
+	if st.pending == nil {
+		st.pending = map[uint64]bool{}
+	}
+	st.pending[seq] = true
+}
+
+// registered notes that an agent registered: if its next report has
+// sequence 1, it restarted and its mark is reset.
+func (s *sequenceSet) registered(agentID string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if st, ok := s.byAgent[agentID]; ok {
+		st.registered = true
+	}
+}
+
+// processed records that a worker is done with an accepted report; stored
+// tells whether its samples were stored. The acknowledgement moves up to
+// the report before the first one still pending or not stored.
+func (s *sequenceSet) processed(agentID string, seq uint64, stored bool) {
+	if seq == 0 {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	st, ok := s.byAgent[agentID]
+	if !ok || !st.pending[seq] {
+		return
+	}
+	delete(st.pending, seq)
+	if !stored {
+		if st.failed == nil {
+			st.failed = map[uint64]bool{}
+		}
+		st.failed[seq] = true
+	}
+
+	acked := st.LastAccepted
+	for _, set := range []map[uint64]bool{st.pending, st.failed} {
+		for n := range set {
+			acked = min(acked, n-1)
+		}
+	}
+	if acked != st.LastAcked {
+		st.LastAcked = acked
+		close(s.changed)
+		s.changed = make(chan struct{})
+	}
+}
+
+// waitAcked waits until the reports of an agent up to seq are acknowledged,
+// at most ackWait, and returns its acknowledgement.
+func (s *sequenceSet) waitAcked(ctx context.Context, agentID string, seq uint64) uint64 {
+	timeout := time.NewTimer(ackWait)
+	defer timeout.Stop()
+
+	for {
+		s.mu.Lock()
+		var acked uint64
+		if st, ok := s.byAgent[agentID]; ok {
+			acked = st.LastAcked
+		}
+		changed := s.changed
+		s.mu.Unlock()
+
+		if acked >= seq {
+			return acked
+		}
+		select {
+		case <-changed:
+		case <-timeout.C:
+			return acked
+		case <-ctx.Done():
+			return acked
+		}
+	}
+}
+
+// get returns the sequence state of an agent.
+func (s *sequenceSet) get(agentID string) (SequenceState, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	st, ok := s.byAgent[agentID]
+	if !ok {
+		return SequenceState{}, false
+	}
+	return st.SequenceState, true
+}
+
+// streamSequences counts what one SendMetrics stream received, for its
+// Summary.
+type streamSequences struct {
+	agentID    string // of the latest sequenced report
+	last       uint64 // highest sequence accepted on the stream
+	duplicates uint64
+	missing    uint64
+}
+
+// accept runs a report through the sequence tracking and reports whether
+// it should be processed.
+func (ss *streamSequences) accept(agentID string, seq uint64) bool {
+	ok, missing := sequences.observe(agentID, seq)
+	if seq == 0 {
+		return true
+	}
+	if agentID != ss.agentID {
+		ss.agentID, ss.last = agentID, 0
+	}
+
+	if !ok {
+		ss.duplicates++
+		return false
+	}
+	if missing > 0 {
+		ss.missing += missing
+		slog.Warn("gap in agent reports", "agent", agentID, "sequence", seq, "missing", missing)
+	}
+	ss.last = max(ss.last, seq)
+	return true
+}
+
+// lastAcked waits for the workers to process the reports accepted on the
+// stream and returns the acknowledgement of the stream's agent.
+func (ss *streamSequences) lastAcked(ctx context.Context) uint64 {
+	if ss.agentID == "" {
+		return 0
+	}
+	return sequences.waitAcked(ctx, ss.agentID, ss.last)
+}
@@ -0,0 +1,238 @@
+package grpc
+
+import (
+	"context"
+	pb "gowatch/gopherwatch/pkg/generated"
+	"sync"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc/metadata"
+)
+
+func TestSequenceTracking(t *testing.T) {
+	s := newSequenceSet()
+
+	for _, tc := range []struct {
+		seq     uint64
+		accept  bool
+		missing uint64
+	}{
+		{5, true, 0}, // reports before the first one seen are no gap
+		{6, true, 0},
+		{6, false, 0},
+		{4, false, 0},
+		{9, true, 2},
+		{0, true, 0}, // unsequenced
+		{10, true, 0},
+	} {
+		accept, missing := s.observe("seq-agent", tc.seq)
+		if accept != tc.accept || missing != tc.missing {
+			t.Errorf("sequence %d: expected accept=%v missing=%d; got %v, %d", tc.seq, tc.accept, tc.missing, accept, missing)
+		}
+	}
+
+	// The workers finish 5, 9 and 10, but storing 6 failed.
+	for _, seq := range []uint64{9, 5, 10} {
+		s.processed("seq-agent", seq, true)
+	}
+	s.processed("seq-agent", 6, false)
+
+	st, _ := s.get("seq-agent")
+	if st != (SequenceState{LastAccepted: 10, LastAcked: 5, Duplicates: 2, Missing: 2}) {
+		t.Errorf("unexpected state %+v", st)
+	}
+
+	// The replay of 6 is taken again; once stored, everything is acked.
+	if accept, _ := s.observe("seq-agent", 6); !accept {
+		t.Fatal("expected the report that was not stored to be accepted again")
+	}
+	if accept, _ := s.observe("seq-agent", 9); accept {
+		t.Error("expected the stored report to stay a duplicate")
+	}
+	s.processed("seq-agent", 6, true)
+	if st, _ := s.get("seq-agent"); st.LastAcked != 10 {
+		t.Errorf("expected 10 acknowledged; got %+v", st)
+	}
+}
+
+func TestSequenceSeedAndRestart(t *testing.T) {
+	s := newSequenceSet()
+	s.seed(map[string]uint64{"seeded": 40})
+
+	// After a server restart the spool replay is still dropped.
+	if accept, _ := s.observe("seeded", 38); accept {
+		t.Error("expected a report below the stored mark to be dropped")
+	}
+	if accept, missing := s.observe("seeded", 42); !accept || missing != 1 {
+		t.Errorf("expected 42 accepted after a gap of 1; got %v, %d", accept, missing)
+	}
+
+	// Sequence 1 is only a restart right after a registration.
+	if accept, _ := s.observe("seeded", 1); accept {
+		t.Error("expected sequence 1 without a registration to be a duplicate")
+	}
+	s.registered("seeded")
+	if accept, _ := s.observe("seeded", 1); !accept {
+		t.Error("expected a registered agent counting from 1 to be accepted")
+	}
+	if st, _ := s.get("seeded"); st.LastAccepted != 1 || st.LastAcked != 0 {
+		t.Errorf("expected the mark reset to 1; got %+v", st)
+	}
+}
+
+// processReports stands in for the workers: it takes the reports off
+// MetricChan and marks them processed until the test ends. It returns the
+// sequences processed so far.
+func processReports(t *testing.T) func() []uint64 {
+	var mu sync.Mutex
+	var got []uint64
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for {
+			select {
+			case m := <-MetricChan:
+				mu.Lock()
+				got = append(got, m.Sequence)
+				mu.Unlock()
+				sequences.processed(m.AgentId, m.Sequence, true)
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	t.Cleanup(func() { cancel(); <-done })
+
+	return func() []uint64 {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]uint64(nil), got...)
+	}
+}
+
+func TestSendMetricsDeduplicates(t *testing.T) {
+	client := dialTestServer(t)
+	processed := processReports(t)
+
+	send := func(seqs ...uint64) *pb.Summary {
+		t.Helper()
+		stream, err := client.SendMetrics(t.Context())
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, seq := range seqs {
+			if err := stream.Send(&pb.MetricReport{AgentId: "dedup-agent", Sequence: seq}); err != nil {
+				t.Fatal(err)
+			}
+		}
+		summary, err := stream.CloseAndRecv()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return summary
+	}
+
+	// The agent reconnects and replays its spool from 2, then skips 5.
+	first := send(1, 2, 3)
+	second := send(2, 3, 4, 6)
+
+	if first.LastAckedSequence != 3 || first.Duplicates != 0 {
+		t.Errorf("expected 3 acknowledged without duplicates; got %v", first)
+	}
+	if second.LastAckedSequence != 6 || second.Duplicates != 2 || second.Missing != 1 {
+		t.Errorf("expected 6 acknowledged, 2 duplicates and 1 missing; got %v", second)
+	}
+
+	if got := processed(); len(got) != 5 {
+		t.Errorf("expected reports 1, 2, 3, 4 and 6 to be processed; got %v", got)
+	}
+}
+
+func TestRestartedAgentSequencesFromOne(t *testing.T) {
+	client := dialTestServer(t)
+	processReports(t)
+
+	req := &pb.RegisterRequest{AgentId: "restart-agent", AgentVersion: "1.2.0"}
+	send := func(sessionID string, seqs ...uint64) *pb.Summary {
+		t.Helper()
+		stream, err := client.SendMetrics(metadata.AppendToOutgoingContext(t.Context(), sessionHeader, sessionID))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, seq := range seqs {
+			if err := stream.Send(&pb.MetricReport{AgentId: req.AgentId, Sequence: seq}); err != nil {
+				t.Fatal(err)
+			}
+		}
+		summary, err := stream.CloseAndRecv()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return summary
+	}
+
+	first, err := client.Register(t.Context(), req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s := send(first.SessionId, 1, 2, 3); s.LastAckedSequence != 3 {
+		t.Fatalf("expected 3 acknowledged; got %v", s)
+	}
+
+	// The agent restarts, takes over its session and counts from 1 again.
+	req.SessionId = first.SessionId
+	second, err := client.Register(t.Context(), req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s := send(second.SessionId, 1, 2); s.LastAckedSequence != 2 || s.Duplicates != 0 || s.Missing != 0 {
+		t.Errorf("expected 2 acknowledged without duplicates or gaps; got %v", s)
+	}
+
+	// A takeover replaying the spool keeps the mark.
+	req.SessionId = second.SessionId
+	third, err := client.Register(t.Context(), req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s := send(third.SessionId, 2, 3); s.LastAckedSequence != 3 || s.Duplicates != 1 {
+		t.Errorf("expected 3 acknowledged and 1 duplicate; got %v", s)
+	}
+}
+
+func TestSummaryWaitsForWorkers(t *testing.T) {
+	client := dialTestServer(t)
+	t.Cleanup(func() {
+		for len(MetricChan) > 0 {
+			<-MetricChan
+		}
+	})
+
+	stream, err := client.SendMetrics(t.Context())
+	if err != nil {
+		t.Fatal(err)
+	}
+	stream.Send(&pb.MetricReport{AgentId: "slow-agent", Sequence: 1})
+	stream.Send(&pb.MetricReport{AgentId: "slow-agent", Sequence: 2})
+
+	defer func(d time.Duration) { ackWait = d }(ackWait)
+	ackWait = 200 * time.Millisecond
+
+	// The first report is processed while the stream closes, the second
+	// not before the summary is sent.
+	go func() {
+		for st, _ := sequences.get("slow-agent"); st.LastAccepted < 2; st, _ = sequences.get("slow-agent") {
+			time.Sleep(time.Millisecond)
+		}
+		sequences.processed("slow-agent", 1, true)
+	}()
+	summary, err := stream.CloseAndRecv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if summary.LastAckedSequence != 1 {
+		t.Errorf("expected only the processed report acknowledged; got %v", summary)
+	}
+}
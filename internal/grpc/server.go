@@ -1,12 +1,16 @@
 package grpc
 
 import (
+	"context"
 	pb "gowatch/gopherwatch/pkg/generated"
 	"gowatch/internal/database"
 	"io"
 	"log"
 	"net"
 	"net/http"
+	"os"
+	"sync"
+	"time"
 
 	"google.golang.org/grpc"
 )
@@ -18,12 +22,18 @@ type MetricsServer struct {
 }
 
 func (s *MetricsServer) SendMetrics(stream pb.MetricsService_SendMetricsServer) error {
+	var seqs streamSequences
+	sessionID := streamSession(stream.Context())
+
 	for {
 		metric, err := stream.Recv()
 
 		if err == io.EOF {
 			return stream.SendAndClose(&pb.Summary{
-				Message: "Received metrics successfully",
+				Message:           "Received metrics successfully",
+				LastAckedSequence: seqs.lastAcked(stream.Context()),
+				Duplicates:        seqs.duplicates,
+				Missing:           seqs.missing,
 			})
 		}
 
@@ -31,6 +41,16 @@ func (s *MetricsServer) SendMetrics(stream pb.MetricsService_SendMetricsServer)
 			return err
 		}
 
+		// Reports speak for an agent only with its session, if it has one
+		if err := sessions.use(metric.AgentId, sessionID); err != nil {
+			return sessionError(metric.AgentId, err)
+		}
+
+		// Drop reports replayed after a reconnect
+		if !seqs.accept(metric.AgentId, metric.Sequence) {
+			continue
+		}
+
 		// Push metric into global channel
 		MetricChan <- metric
 
@@ -44,12 +64,65 @@ func (s *MetricsServer) SendMetrics(stream pb.MetricsService_SendMetricsServer)
 // -------------------- gRPC Server Bootstrap --------------------
 
 type ServerInstance struct {
-	GRPC *grpc.Server
+	GRPC    *grpc.Server
+	workers *sync.WaitGroup
+}
+
+// StopWorkers closes MetricChan and waits for the workers to process the
+// reports still queued. Call it after GRPC has stopped, so no stream sends
+// on the closed channel.
+func (s *ServerInstance) StopWorkers() {
+	close(MetricChan)
+	s.workers.Wait()
 }
 
 func StartGRPCServer(db database.Service) *ServerInstance {
+	// Compile the rules once so a bad expression stops the server here.
+	// RULES_FILE replaces the default rules with a rule file (see
+	// ParseRules).
+	list := rules
+	if path := os.Getenv("RULES_FILE"); path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			log.Fatalf("failed to read RULES_FILE: %v", err)
+		}
+		if list, err = ParseRules(data); err != nil {
+			log.Fatalf("invalid RULES_FILE: %v", err)
+		}
+	}
+	if err := LoadRules(list); err != nil {
+		log.Fatalf("invalid alert rules: %v", err)
+	}
+
+	// Load silences, maintenance windows, open alerts and anomaly
+	// baselines before workers start evaluating
+	if db != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		if err := silences.refresh(ctx, db); err != nil {
+			log.Printf("failed to load silences: %v", err)
+		}
+		if err := maintenance.refresh(ctx, db); err != nil {
+			log.Printf("failed to load maintenance windows: %v", err)
+		}
+		if err := configs.refresh(ctx, db); err != nil {
+			log.Printf("failed to load config profiles: %v", err)
+		}
+		if err := escalations.load(ctx, db); err != nil {
+			log.Printf("failed to load open alerts: %v", err)
+		}
+		if err := baselines.load(ctx, db); err != nil {
+			log.Printf("failed to load anomaly baselines: %v", err)
+		}
+		if marks, err := db.LastSequences(ctx, time.Now().Add(-seedWindow).Unix()); err != nil {
+			log.Printf("failed to load sequence marks: %v", err)
+		} else {
+			sequences.seed(marks)
+		}
+		cancel()
+	}
+
 	// Start workers
-	StartWorkers(10, db)
+	workers := StartWorkers(10, db)
 
 	lis, err := net.Listen("tcp", ":50051")
 	if err != nil {
@@ -69,7 +142,7 @@ func StartGRPCServer(db database.Service) *ServerInstance {
 		}
 	}()
 
-	return &ServerInstance{GRPC: server}
+	return &ServerInstance{GRPC: server, workers: workers}
 }
 
 // -------------------- REST Server --------------------
@@ -0,0 +1,107 @@
+package grpc
+
+import (
+	"fmt"
+	pb "gowatch/gopherwatch/pkg/generated"
+	"log/slog"
+	"sort"
+)
+
+// -------------------- SEVERITY --------------------
+
+// Severity classifies how urgent an alert is. It decides the log level,
+// which notifiers are used, and is stored with every alert.
+type Severity string
+
+const (
+	SeverityInfo     Severity = "info"
+	SeverityWarning  Severity = "warning"
+	SeverityCritical Severity = "critical"
+	SeverityPage     Severity = "page"
+)
+
+// Priority orders severities: higher means more urgent. Unknown is 0.
+func (s Severity) Priority() int {
+	switch s {
+	case SeverityInfo:
+		return 1
+	case SeverityWarning:
+		return 2
+	case SeverityCritical:
+		return 3
+	case SeverityPage:
+		return 4
+	}
+	return 0
+}
+
+// LogLevel maps a severity to the slog level used when the alert fires.
+func (s Severity) LogLevel() slog.Level {
+	switch s {
+	case SeverityInfo:
+		return slog.LevelInfo
+	case SeverityWarning:
+		return slog.LevelWarn
+	default:
+		return slog.LevelError
+	}
+}
+
+// ParseSeverity validates a severity name.
+func ParseSeverity(s string) (Severity, error) {
+	sev := Severity(s)
+	if sev.Priority() == 0 {
+		return "", fmt.Errorf("unknown severity %q (want info, warning, critical or page)", s)
+	}
+	return sev, nil
+}
+
+// -------------------- THRESHOLD TIERS --------------------
+
+// Tier is one threshold level of a rule, e.g. warning at 80, critical at 95.
+type Tier struct {
+	Severity  Severity
+	Threshold float64
+}
+
+// tiers returns the rule's tiers, most severe first. A rule without
+// explicit tiers has a single tier built from Threshold and Severity
+// (critical when unset).
+func (r AlertRule) tiers() []Tier {
+	if len(r.Tiers) == 0 {
+		sev := r.Severity
+		if sev == "" {
+			sev = SeverityCritical
+		}
+		return []Tier{{Severity: sev, Threshold: r.Threshold}}
+	}
+
+	tiers := append([]Tier(nil), r.Tiers...)
+	sort.SliceStable(tiers, func(i, j int) bool {
+		return tiers[i].Severity.Priority() > tiers[j].Severity.Priority()
+	})
+	return tiers
+}
+
+// atTier returns a copy of the rule using the tier's threshold and severity,
+// so evaluators only ever see a single threshold.
+func (r AlertRule) atTier(t Tier) AlertRule {
+	r.Threshold = t.Threshold
+	r.Severity = t.Severity
+	r.Tiers = nil
+	return r
+}
+
+// matchTier returns the most severe tier the metric crosses.
+func matchTier(evaluator Evaluator, metric *pb.MetricReport, rule AlertRule) (Tier, bool, error) {
+	for _, t := range rule.tiers() {
+		crossed, err := evaluator.Evaluate(metric, rule.atTier(t))
+		if err != nil {
+			return Tier{}, false, err
+		}
+		if crossed {
+			return t, true, nil
+		}
+	}
+	return Tier{}, false, nil
+}
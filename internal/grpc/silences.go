@@ -0,0 +1,184 @@
+package grpc
+
+import (
+	"context"
+	"encoding/json"
+	"gowatch/internal/database"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// -------------------- SILENCE CACHE --------------------
+
+// silenceSet is an in-memory copy of the silences table. Workers consult it
+// on every alert transition, so it is refreshed on startup and after every
+// change made through the REST API instead of querying MySQL each time.
+type silenceSet struct {
+	mu       sync.RWMutex
+	silences []database.Silence
+}
+
+var silences = &silenceSet{}
+
+func (s *silenceSet) set(list []database.Silence) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.silences = list
+}
+
+// refresh reloads the silences from storage.
+func (s *silenceSet) refresh(ctx context.Context, db database.Service) error {
+	list, err := db.ListSilences(ctx)
+	if err != nil {
+		return err
+	}
+	s.set(list)
+	return nil
+}
+
+// match returns the ID of an active silence matching the alert, if any.
+func (s *silenceSet) match(alert database.Alert, now int64) (int64, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	labels := alertLabels(alert)
+	for _, sl := range s.silences {
+		if silenceActive(sl, now) && matchesAll(sl.Matchers, labels) {
+			return sl.ID, true
+		}
+	}
+	return 0, false
+}
+
+func silenceActive(sl database.Silence, now int64) bool {
+	return sl.StartsAt <= now && now < sl.EndsAt
+}
+
+// silenceStatus is the state shown by the API.
+func silenceStatus(sl database.Silence, now int64) string {
+	switch {
+	case now < sl.StartsAt:
+		return "pending"
+	case now < sl.EndsAt:
+		return "active"
+	default:
+		return "expired"
+	}
+}
+
+// -------------------- REST HANDLERS --------------------
+
+// silenceView is a silence as returned by GET /silences.
+type silenceView struct {
+	database.Silence
+	Status string `json:"status"` // pending | active | expired
+}
+
+// createSilenceHandler serves POST /silences.
+func (s *RestServer) createSilenceHandler(w http.ResponseWriter, r *http.Request) {
+	var sl database.Silence
+	if err := json.NewDecoder(r.Body).Decode(&sl); err != nil {
+		http.Error(w, "invalid silence body", http.StatusBadRequest)
+		return
+	}
+
+	now := time.Now().Unix()
+	sl.ID = 0
+	sl.CreatedAt = now
+	if sl.StartsAt == 0 {
+		sl.StartsAt = now
+	}
+
+	switch {
+	case len(sl.Matchers) == 0:
+		http.Error(w, "at least one matcher is required", http.StatusBadRequest)
+		return
+	case sl.CreatedBy == "":
+		http.Error(w, "created_by is required", http.StatusBadRequest)
+		return
+	case sl.EndsAt <= sl.StartsAt || sl.EndsAt <= now:
+		http.Error(w, "ends_at must be in the future and after starts_at", http.StatusBadRequest)
+		return
+	}
+	if err := validateMatchers(sl.Matchers); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 2*time.Second)
+	defer cancel()
+
+	id, err := s.db.CreateSilence(ctx, sl)
+	if err != nil {
+		http.Error(w, "failed to create silence", http.StatusInternalServerError)
+		return
+	}
+	sl.ID = id
+
+	if err := silences.refresh(ctx, s.db); err != nil {
+		slog.Warn("failed to refresh silences", "err", err)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(silenceView{Silence: sl, Status: silenceStatus(sl, now)})
+}
+
+// listSilencesHandler serves GET /silences (optionally ?status=active).
+func (s *RestServer) listSilencesHandler(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 2*time.Second)
+	defer cancel()
+
+	list, err := s.db.ListSilences(ctx)
+	if err != nil {
+		http.Error(w, "failed to load silences", http.StatusInternalServerError)
+		return
+	}
+
+	now := time.Now().Unix()
+	want := r.URL.Query().Get("status")
+
+	views := []silenceView{}
+	for _, sl := range list {
+		status := silenceStatus(sl, now)
+		if want != "" && want != status {
+			continue
+		}
+		views = append(views, silenceView{Silence: sl, Status: status})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(views)
+}
+
+// deleteSilenceHandler serves DELETE /silences/{id}. The silence is expired
+// rather than removed so it stays in the history.
+func (s *RestServer) deleteSilenceHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		http.Error(w, "invalid silence id", http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 2*time.Second)
+	defer cancel()
+
+	found, err := s.db.ExpireSilence(ctx, id, time.Now().Unix())
+	if err != nil {
+		http.Error(w, "failed to expire silence", http.StatusInternalServerError)
+		return
+	}
+	if !found {
+		http.Error(w, "silence not found", http.StatusNotFound)
+		return
+	}
+
+	if err := silences.refresh(ctx, s.db); err != nil {
+		slog.Warn("failed to refresh silences", "err", err)
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,60 @@
+package grpc
+
+import (
+	"gowatch/internal/database"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestSilenceMatch(t *testing.T) {
+
+	set := &silenceSet{}
+	set.set([]database.Silence{
+		{
+			ID:       1,
+			Matchers: []database.Matcher{{Label: "service_name", Value: "payments"}, {Label: "agent_id", Value: "db-.*", IsRegex: true}},
+			StartsAt: 100,
+			EndsAt:   200,
+		},
+	})
+
+	alert := database.Alert{AgentID: "db-1", ServiceName: "payments", RuleName: "High CPU", Severity: "critical"}
+
+	if id, ok := set.match(alert, 150); !ok || id != 1 {
+		t.Errorf("expected silence 1 to match during its window")
+	}
+	if _, ok := set.match(alert, 250); ok {
+		t.Errorf("expected expired silence not to match")
+	}
+
+	alert.AgentID = "web-db-1" // regex must match the whole value
+	if _, ok := set.match(alert, 150); ok {
+		t.Errorf("expected anchored regex not to match %q", alert.AgentID)
+	}
+}
+
+func TestCreateSilenceValidation(t *testing.T) {
+	s := &RestServer{}
+
+	bodies := []string{
+		`not json`,
+		`{"created_by": "ops", "ends_at": 9999999999}`,                                                // no matchers
+		`{"matchers": [{"label": "agent_id", "value": "a"}], "ends_at": 9999999999}`,                  // no creator
+		`{"matchers": [{"label": "agent_id", "value": "a"}], "created_by": "ops", "ends_at": 1}`,      // already over
+		`{"matchers": [{"label": "host", "value": "a"}], "created_by": "ops", "ends_at": 9999999999}`, // unknown label
+		`{"matchers": [{"label": "agent_id", "value": "(", "is_regex": true}], "created_by": "ops", "ends_at": 9999999999}`,
+	}
+
+	for _, body := range bodies {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, "/silences", strings.NewReader(body))
+
+		s.createSilenceHandler(rec, req)
+
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("body %s: expected 400; got %d", body, rec.Code)
+		}
+	}
+}
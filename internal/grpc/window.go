@@ -0,0 +1,118 @@
+package grpc
+
+import (
+	"fmt"
+	pb "gowatch/gopherwatch/pkg/generated"
+	"gowatch/internal/expr"
+	"time"
+)
+
+// -------------------- ROLLING WINDOWS --------------------
+
+// Window makes a threshold rule compare an aggregate of the agent's recent
+// samples instead of the latest one, so single-sample spikes don't fire:
+//
+//	{Metric: "cpu", Threshold: 85, Comparison: ">",
+//	 Window: &Window{Aggregate: "avg", Duration: 5 * time.Minute}}
+//
+// Change over the window is compared with delta (last - first) and deriv
+// (least-squares slope) for gauges, and rate and increase for counters,
+// which survive counter resets:
+//
+//	{Metric: "disk", Threshold: 5, Comparison: ">",
+//	 Window: &Window{Aggregate: "delta", Duration: 10 * time.Minute}}
+//
+// The samples come from the per-agent history kept by the workers.
+type Window struct {
+	Aggregate  string        // avg | min | max | count | percentile | delta | deriv | rate | increase
+	Duration   time.Duration // the samples of the last Duration, or
+	Samples    int           // the last Samples samples
+	Percentile float64       // 0-100, for Aggregate "percentile"
+	Per        time.Duration // unit of deriv and rate (default per second), e.g. time.Hour
+}
+
+// validate checks the window of a rule on metric and makes the history
+// keep enough samples for it.
+func (w *Window) validate(metric string) error {
+	if w == nil {
+		return nil
+	}
+
+	switch w.Aggregate {
+	case "avg", "min", "max", "count", "delta", "deriv":
+	case "rate", "increase":
+		if !counterMetrics[metric] {
+			return fmt.Errorf("%s needs a counter metric; %q is a gauge, use delta or deriv", w.Aggregate, metric)
+		}
+	case "percentile":
+		if w.Percentile < 0 || w.Percentile > 100 {
+			return fmt.Errorf("window percentile must be between 0 and 100")
+		}
+	default:
+		return fmt.Errorf("unknown window aggregate %q", w.Aggregate)
+	}
+
+	if (w.Duration > 0) == (w.Samples > 0) {
+		return fmt.Errorf("window needs exactly one of duration or samples")
+	}
+	return nil
+}
+
+// aggregate computes the window over the agent's history up to the report.
+func (w *Window) aggregate(history *agentHistory, metric *pb.MetricReport, name string) float64 {
+	var ps []expr.Point
+	if w.Samples > 0 {
+		ps = history.last(metric.AgentId, name, metric.Timestamp, w.Samples)
+	} else {
+		ps = history.rangeOf(metric.AgentId, name, metric.Timestamp, w.Duration)
+	}
+
+	switch w.Aggregate {
+	case "min":
+		return expr.Min(ps)
+	case "max":
+		return expr.Max(ps)
+	case "count":
+		return expr.Count(ps)
+	case "percentile":
+		return expr.Quantile(w.Percentile/100, ps)
+	case "delta":
+		return expr.Delta(ps)
+	case "deriv":
+		return expr.Deriv(ps) * w.perSeconds()
+	case "rate":
+		return expr.Rate(ps) * w.perSeconds()
+	case "increase":
+		return expr.Increase(ps)
+	default:
+		return expr.Avg(ps)
+	}
+}
+
+func (w *Window) perSeconds() float64 {
+	if w.Per <= 0 {
+		return 1
+	}
+	return w.Per.Seconds()
+}
+
+// ruleValue is the value a threshold rule compares: the latest sample, the
+// window aggregate, or the forecast hours left when the rule has one. For
+// an expression rule without Metric it is the value of the expression's
+// first comparison.
+func ruleValue(metric *pb.MetricReport, rule AlertRule) float64 {
+	return live.ruleValue(metric, rule)
+}
+
+func (s *evalState) ruleValue(metric *pb.MetricReport, rule AlertRule) float64 {
+	if rule.Expr != "" && rule.Metric == "" {
+		return s.exprValue(metric, rule)
+	}
+	if rule.Window != nil {
+		return rule.Window.aggregate(s.history, metric, rule.Metric)
+	}
+	if rule.Forecast != nil {
+		return rule.Forecast.hoursLeft(s.history, s.forecasts, metric, rule.Metric)
+	}
+	return getValue(metric, rule.Metric)
+}
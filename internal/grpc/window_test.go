@@ -0,0 +1,153 @@
+package grpc
+
+import (
+	pb "gowatch/gopherwatch/pkg/generated"
+	"testing"
+	"time"
+)
+
+func TestWindowAverageIgnoresSpikes(t *testing.T) {
+
+	rule := AlertRule{
+		Name: "Sustained CPU", Metric: "cpu", Threshold: 85, Comparison: ">",
+		Window: &Window{Aggregate: "avg", Duration: 5 * time.Minute},
+	}
+	if err := validateRule(rule); err != nil {
+		t.Fatal(err)
+	}
+	live.prepare(rule)
+
+	report := func(ts int64, cpu float64) *pb.MetricReport {
+		m := &pb.MetricReport{AgentId: "window-agent", CpuUsage: cpu, Timestamp: ts}
+		history.add(m)
+		return m
+	}
+
+	// A single spike among normal samples.
+	var m *pb.MetricReport
+	for ts := int64(0); ts < 300; ts += 30 {
+		m = report(ts, 60)
+	}
+	m = report(300, 99)
+	if fires(t, SimpleEvaluator{}, m, rule) {
+		t.Errorf("expected a single spike not to fire (avg %.1f)", ruleValue(m, rule))
+	}
+
+	// Five minutes of high load.
+	for ts := int64(330); ts <= 600; ts += 30 {
+		m = report(ts, 95)
+	}
+	if !fires(t, SimpleEvaluator{}, m, rule) {
+		t.Errorf("expected sustained load to fire (avg %.1f)", ruleValue(m, rule))
+	}
+}
+
+func TestWindowSamplesAndPercentile(t *testing.T) {
+
+	cases := []struct {
+		w    Window
+		want float64
+	}{
+		{Window{Aggregate: "max", Samples: 3}, 100},
+		{Window{Aggregate: "min", Samples: 3}, 80},
+		{Window{Aggregate: "count", Duration: 5 * time.Second}, 5},
+		{Window{Aggregate: "percentile", Percentile: 50, Samples: 4}, 85},
+	}
+	for _, c := range cases {
+		live.prepare(AlertRule{Metric: "cpu", Window: &c.w})
+	}
+
+	for ts := int64(1); ts <= 10; ts++ {
+		history.add(&pb.MetricReport{AgentId: "window-agent-2", CpuUsage: float64(ts * 10), Timestamp: ts})
+	}
+	m := &pb.MetricReport{AgentId: "window-agent-2", CpuUsage: 100, Timestamp: 10}
+
+	for _, c := range cases {
+		w := c.w
+		if err := w.validate("cpu"); err != nil {
+			t.Fatalf("%+v: %v", w, err)
+		}
+		if got := w.aggregate(history, m, "cpu"); got != c.want {
+			t.Errorf("%+v: got %v, want %v", w, got, c.want)
+		}
+	}
+}
+
+func TestWindowValidation(t *testing.T) {
+	bad := []Window{
+		{Aggregate: "median", Samples: 3},
+		{Aggregate: "avg"},
+		{Aggregate: "avg", Samples: 3, Duration: time.Minute},
+		{Aggregate: "percentile", Percentile: 150, Samples: 3},
+	}
+	for _, w := range bad {
+		if err := w.validate("cpu"); err == nil {
+			t.Errorf("%+v: expected error", w)
+		}
+	}
+}
+
+func TestWindowDeltaAndDeriv(t *testing.T) {
+
+	growth := AlertRule{
+		Name: "Disk growth", Metric: "disk", Threshold: 5, Comparison: ">",
+		Window: &Window{Aggregate: "delta", Duration: 11 * time.Minute},
+	}
+	if err := validateRule(growth); err != nil {
+		t.Fatal(err)
+	}
+	perHour := &Window{Aggregate: "deriv", Samples: 11, Per: time.Hour}
+	live.prepare(growth)
+	live.prepare(AlertRule{Metric: "disk", Window: perHour})
+
+	// Disk grows from 60% to 66% over 10 minutes.
+	var m *pb.MetricReport
+	for i := int64(0); i <= 10; i++ {
+		m = &pb.MetricReport{AgentId: "window-agent-3", DiskUsage: 60 + 0.6*float64(i), Timestamp: i * 60}
+		history.add(m)
+	}
+
+	if !fires(t, SimpleEvaluator{}, m, growth) {
+		t.Errorf("expected 6%% growth in 10 minutes to fire (delta %.2f)", ruleValue(m, growth))
+	}
+
+	if got := perHour.aggregate(history, m, "disk"); got < 35.99 || got > 36.01 {
+		t.Errorf("expected deriv of 36%%/h; got %v", got)
+	}
+
+	rate := AlertRule{
+		Name: "Disk rate", Metric: "disk", Threshold: 1, Comparison: ">",
+		Window: &Window{Aggregate: "rate", Duration: time.Minute},
+	}
+	if err := validateRule(rate); err == nil {
+		t.Errorf("expected rate on a gauge to be rejected")
+	}
+}
+
+func TestWindowKeepsReportsOfOneSecond(t *testing.T) {
+
+	// Agents reporting every 300ms send several reports per second.
+	maxRule := AlertRule{Name: "Spike", Metric: "cpu", Threshold: 90, Comparison: ">",
+		Window: &Window{Aggregate: "max", Duration: 10 * time.Second}}
+	countRule := AlertRule{Name: "Busy", Metric: "cpu", Threshold: 2, Comparison: ">",
+		Window: &Window{Aggregate: "count", Duration: 10 * time.Second}}
+
+	var reports []*pb.MetricReport
+	for _, cpu := range []float64{99, 10, 10} {
+		reports = append(reports, &pb.MetricReport{AgentId: "subsec-1", CpuUsage: cpu, Timestamp: 100})
+	}
+
+	transitions, err := Replay([]AlertRule{maxRule, countRule}, reports)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The spike stays in the window and three reports count as three.
+	var got []string
+	for _, tr := range transitions {
+		got = append(got, tr.Rule+" "+tr.Kind)
+	}
+	if len(got) != 2 || got[0] != "Spike fired" || got[1] != "Busy fired" {
+		t.Errorf("expected both rules to fire and stay firing; got %v", got)
+	}
+}
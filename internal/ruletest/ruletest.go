@@ -0,0 +1,275 @@
+// Package ruletest runs alert rules against fixture series and checks the
+// alert transitions they produce, so rule changes can be reviewed like code.
+//
+// A fixture file holds named tests. Each test has series of reports, one
+// value per interval, and the transitions expected at offsets from start:
+//
+//	{"tests": [{
+//	    "name": "sustained CPU fires and resolves",
+//	    "series": [{"agent_id": "web-1", "service_name": "web", "interval": "15s",
+//	                "cpu": "50 95x4 60x4"}],
+//	    "expect": [
+//	        {"at": "15s", "agent_id": "web-1", "rule": "High CPU", "kind": "fired", "severity": "critical"},
+//	        {"at": "1m45s", "agent_id": "web-1", "rule": "High CPU", "kind": "resolved"}
+//	    ]
+//	}]}
+package ruletest
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	pb "gowatch/gopherwatch/pkg/generated"
+	"gowatch/internal/grpc"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// defaultStart is the virtual clock of a test without start: a Monday,
+// 00:00 UTC.
+const defaultStart = 1704067200 // 2024-01-01
+
+// File is a fixture file.
+type File struct {
+	Tests []Test `json:"tests"`
+}
+
+// Test is one scenario.
+type Test struct {
+	Name   string   `json:"name"`
+	Start  int64    `json:"start"` // Unix timestamp of the first report (default 2024-01-01)
+	Series []Series `json:"series"`
+	Expect []Expect `json:"expect"`
+}
+
+// Series is the reports of one agent, one per interval (whole seconds, at
+// least 1s, as report timestamps are in seconds). Metric values use
+// the series notation: space-separated values where "axN" is N samples of
+// a and "a+bxN" N samples from a in steps of b (90-5x3 is 90 85 80). A metric runs on with its last
+// value once its series ends; the series is as long as its longest metric.
+type Series struct {
+	AgentID     string   `json:"agent_id"`
+	ServiceName string   `json:"service_name"`
+	Interval    Duration `json:"interval"`
+	CPU         string   `json:"cpu"`
+	Memory      string   `json:"memory"`
+	Disk        string   `json:"disk"`
+	NetBytes    string   `json:"net_bytes"`
+}
+
+// Expect is an expected transition. Severity is only checked when set.
+type Expect struct {
+	At       Duration `json:"at"` // offset from start
+	AgentID  string   `json:"agent_id"`
+	Rule     string   `json:"rule"`
+	Kind     string   `json:"kind"` // fired | escalated | resolved | flapping | error
+	Severity string   `json:"severity"`
+}
+
+// Duration is a time.Duration written as a Go duration string ("15s").
+type Duration time.Duration
+
+func (d *Duration) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return fmt.Errorf("durations are strings such as \"15s\"")
+	}
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(v)
+	return nil
+}
+
+func (d Duration) String() string { return time.Duration(d).String() }
+
+// Parse decodes a fixture file.
+func Parse(data []byte) (*File, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+
+	var f File
+	if err := dec.Decode(&f); err != nil {
+		return nil, fmt.Errorf("invalid fixture file: %w", err)
+	}
+	for i, t := range f.Tests {
+		if t.Name == "" {
+			return nil, fmt.Errorf("test %d: name is required", i+1)
+		}
+		for _, s := range t.Series {
+			if s.AgentID == "" {
+				return nil, fmt.Errorf("test %q: every series needs an agent_id", t.Name)
+			}
+			// Report timestamps are whole seconds.
+			if iv := time.Duration(s.Interval); iv < time.Second || iv%time.Second != 0 {
+				return nil, fmt.Errorf("test %q: series %s: interval must be a whole number of seconds, at least 1s", t.Name, s.AgentID)
+			}
+		}
+	}
+	return &f, nil
+}
+
+// -------------------- RUNNING --------------------
+
+// Result is the outcome of one test.
+type Result struct {
+	Name       string
+	Missing    []Expect          // expected but not produced
+	Unexpected []grpc.Transition // produced but not expected
+	Err        error             // the test could not run
+}
+
+// Passed reports whether the test produced exactly the expected transitions.
+func (r Result) Passed() bool {
+	return r.Err == nil && len(r.Missing) == 0 && len(r.Unexpected) == 0
+}
+
+// Run runs every test of the file against rules.
+func Run(rules []grpc.AlertRule, f *File) []Result {
+	results := make([]Result, 0, len(f.Tests))
+	for _, t := range f.Tests {
+		results = append(results, runTest(rules, t))
+	}
+	return results
+}
+
+func runTest(rules []grpc.AlertRule, t Test) Result {
+	res := Result{Name: t.Name}
+
+	start := t.Start
+	if start == 0 {
+		start = defaultStart
+	}
+
+	reports, err := t.reports(start)
+	if err != nil {
+		res.Err = err
+		return res
+	}
+	got, err := grpc.Replay(rules, reports)
+	if err != nil {
+		res.Err = err
+		return res
+	}
+
+	used := make([]bool, len(got))
+	for _, e := range t.Expect {
+		at := start + int64(time.Duration(e.At)/time.Second)
+
+		found := false
+		for i, g := range got {
+			if used[i] || g.At != at || g.AgentID != e.AgentID || g.Rule != e.Rule || g.Kind != e.Kind {
+				continue
+			}
+			if e.Severity != "" && g.Severity != e.Severity {
+				continue
+			}
+			used[i], found = true, true
+			break
+		}
+		if !found {
+			res.Missing = append(res.Missing, e)
+		}
+	}
+	for i, g := range got {
+		if !used[i] {
+			g.At -= start
+			res.Unexpected = append(res.Unexpected, g)
+		}
+	}
+	return res
+}
+
+// reports expands the series of the test into reports.
+func (t Test) reports(start int64) ([]*pb.MetricReport, error) {
+	var out []*pb.MetricReport
+	for _, s := range t.Series {
+		cpu, err := expand(s.CPU)
+		if err != nil {
+			return nil, fmt.Errorf("series %s cpu: %w", s.AgentID, err)
+		}
+		memory, err := expand(s.Memory)
+		if err != nil {
+			return nil, fmt.Errorf("series %s memory: %w", s.AgentID, err)
+		}
+		disk, err := expand(s.Disk)
+		if err != nil {
+			return nil, fmt.Errorf("series %s disk: %w", s.AgentID, err)
+		}
+
+		netBytes, err := expand(s.NetBytes)
+		if err != nil {
+			return nil, fmt.Errorf("series %s net_bytes: %w", s.AgentID, err)
+		}
+
+		n := max(len(cpu), len(memory), len(disk), len(netBytes))
+		step := int64(time.Duration(s.Interval) / time.Second)
+		for i := range n {
+			out = append(out, &pb.MetricReport{
+				AgentId:     s.AgentID,
+				ServiceName: s.ServiceName,
+				Timestamp:   start + int64(i)*step,
+				CpuUsage:    at(cpu, i),
+				MemoryUsage: at(memory, i),
+				DiskUsage:   at(disk, i),
+				NetBytes:    at(netBytes, i),
+			})
+		}
+	}
+	return out, nil
+}
+
+// at returns vs[i], the last value past the end, 0 for an empty series.
+func at(vs []float64, i int) float64 {
+	if len(vs) == 0 {
+		return 0
+	}
+	return vs[min(i, len(vs)-1)]
+}
+
+// expand parses the series notation.
+func expand(s string) ([]float64, error) {
+	var out []float64
+	for _, item := range strings.Fields(s) {
+		base, times, repeated := strings.Cut(item, "x")
+		if !repeated {
+			v, err := strconv.ParseFloat(item, 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid value %q", item)
+			}
+			out = append(out, v)
+			continue
+		}
+
+		n, err := strconv.Atoi(times)
+		if err != nil || n < 1 {
+			return nil, fmt.Errorf("invalid repeat count in %q", item)
+		}
+
+		// The sign is part of the step: 90-5x3 is 90 85 80.
+		from, step := base, "0"
+		if i := strings.LastIndexAny(base, "+-"); i > 0 && base[i-1] != 'e' && base[i-1] != 'E' {
+			from, step = base[:i], base[i:]
+		}
+		a, err1 := strconv.ParseFloat(from, 64)
+		b, err2 := strconv.ParseFloat(strings.TrimPrefix(step, "+"), 64)
+		if err1 != nil || err2 != nil {
+			return nil, fmt.Errorf("invalid value %q", item)
+		}
+		for k := range n {
+			out = append(out, a+float64(k)*b)
+		}
+	}
+	return out, nil
+}
+
+// String formats an expectation the way the command reports it.
+func (e Expect) String() string {
+	s := fmt.Sprintf("+%s %s %q %s", e.At, e.AgentID, e.Rule, e.Kind)
+	if e.Severity != "" {
+		s += " (" + e.Severity + ")"
+	}
+	return s
+}
@@ -0,0 +1,108 @@
+package ruletest
+
+import (
+	"gowatch/internal/grpc"
+	"os"
+	"slices"
+	"testing"
+	"time"
+)
+
+func load(t *testing.T) ([]grpc.AlertRule, *File) {
+	t.Helper()
+
+	data, err := os.ReadFile("testdata/rules.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rules, err := grpc.ParseRules(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data, err = os.ReadFile("testdata/fixtures.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := Parse(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return rules, f
+}
+
+func TestFixtures(t *testing.T) {
+
+	rules, f := load(t)
+	for _, r := range Run(rules, f) {
+		if !r.Passed() {
+			t.Errorf("%s: err %v, missing %v, unexpected %v", r.Name, r.Err, r.Missing, r.Unexpected)
+		}
+	}
+}
+
+func TestMismatches(t *testing.T) {
+
+	rules, f := load(t)
+
+	// Expect the resolve one sample too early.
+	test := f.Tests[0]
+	test.Expect = slices.Clone(test.Expect)
+	test.Expect[2].At = Duration(90 * time.Second)
+
+	res := runTest(rules, test)
+	if res.Passed() {
+		t.Fatal("expected the test to fail")
+	}
+	if len(res.Missing) != 1 || res.Missing[0].Kind != "resolved" {
+		t.Errorf("expected the early resolve to be missing, got %v", res.Missing)
+	}
+	if len(res.Unexpected) != 1 || res.Unexpected[0].At != 105 {
+		t.Errorf("expected the actual resolve at +105s to be unexpected, got %v", res.Unexpected)
+	}
+
+	// A severity that does not match is a mismatch too.
+	test = f.Tests[1]
+	test.Expect = []Expect{{AgentID: "web-2", Rule: "High Memory", Kind: "fired", Severity: "warning"}}
+	if runTest(rules, test).Passed() {
+		t.Error("expected a wrong severity to fail")
+	}
+}
+
+func TestExpand(t *testing.T) {
+
+	cases := map[string][]float64{
+		"":             nil,
+		"1 2.5 3":      {1, 2.5, 3},
+		"7x3":          {7, 7, 7},
+		"60+1x3 99":    {60, 61, 62, 99},
+		"90-5x3":       {90, 85, 80},
+		"1e-1x2 -4":    {0.1, 0.1, -4},
+		"50 95x2 60x1": {50, 95, 95, 60},
+	}
+	for in, want := range cases {
+		got, err := expand(in)
+		if err != nil {
+			t.Errorf("%q: %v", in, err)
+			continue
+		}
+		if !slices.Equal(got, want) {
+			t.Errorf("%q: expected %v, got %v", in, want, got)
+		}
+	}
+
+	for _, bad := range []string{"x3", "5x0", "5xa", "five", "5+x2"} {
+		if _, err := expand(bad); err == nil {
+			t.Errorf("%q: expected an error", bad)
+		}
+	}
+}
+
+func TestParseInterval(t *testing.T) {
+	for interval, ok := range map[string]bool{"15s": true, "1s": true, "2m": true, "500ms": false, "1.5s": false, "0s": false} {
+		data := `{"tests": [{"name": "t", "series": [{"agent_id": "a", "interval": "` + interval + `"}]}]}`
+		if _, err := Parse([]byte(data)); (err == nil) != ok {
+			t.Errorf("interval %s: expected ok=%v; got %v", interval, ok, err)
+		}
+	}
+}
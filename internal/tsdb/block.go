@@ -0,0 +1,299 @@
+package tsdb
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// -------------------- IMMUTABLE BLOCKS --------------------
+
+// A block is a directory under <dir>/blocks holding a flushed head:
+//
+//	meta.json  BlockMeta
+//	chunks     "GWTS" | version | series... | crc32 of everything before it
+//
+// where each series is:
+//
+//	uvarint len + key | uvarint len + service | uvarint chunk count | chunks
+//
+// Blocks are written to a temporary directory and renamed into place, so a
+// crash never leaves a half-written block behind. A compacted block lists
+// the blocks it replaces, which are removed on open if a crash left them.
+const (
+	blockMagic   = "GWTS"
+	blockVersion = 1
+	blocksDir    = "blocks"
+	metaFile     = "meta.json"
+	chunksFile   = "chunks"
+)
+
+// BlockMeta describes the time range and size of a block.
+type BlockMeta struct {
+	MinT       int64    `json:"min_t"`
+	MaxT       int64    `json:"max_t"`
+	NumSeries  int      `json:"num_series"`
+	NumSamples int      `json:"num_samples"`
+	WALGen     uint64   `json:"wal_gen,omitempty"` // newest WAL generation it holds
+	Parents    []string `json:"parents,omitempty"` // blocks it was compacted from
+}
+
+type blockSeries struct {
+	service string
+	chunks  []encodedChunk
+}
+
+// block is a flushed, read-only block. Its chunks file is loaded on the
+// first query that overlaps it.
+type block struct {
+	dir  string
+	meta BlockMeta
+
+	once   sync.Once
+	series map[string]*blockSeries
+	err    error
+}
+
+func (b *block) overlaps(mint, maxt int64) bool {
+	return b.meta.MaxT >= mint && b.meta.MinT < maxt
+}
+
+// load reads the chunks file once.
+func (b *block) load() error {
+	b.once.Do(func() {
+		b.series, b.err = readChunksFile(filepath.Join(b.dir, chunksFile))
+	})
+	return b.err
+}
+
+func (b *block) selectPoints(key string, mint, maxt int64) ([]Point, error) {
+	if err := b.load(); err != nil {
+		return nil, err
+	}
+
+	bs, ok := b.series[key]
+	if !ok {
+		return nil, nil
+	}
+	return pointsInRange(bs.chunks, mint, maxt)
+}
+
+// headSeries returns the series of the head as they are written to a block.
+func headSeries(h *head) map[string]*blockSeries {
+	series := make(map[string]*blockSeries, len(h.series))
+	for k, ms := range h.series {
+		series[k] = &blockSeries{service: ms.service, chunks: ms.chunks()}
+	}
+	return series
+}
+
+// writeBlock persists series as a new block and returns it.
+func writeBlock(root string, meta BlockMeta, series map[string]*blockSeries) (*block, error) {
+	meta.NumSeries = len(series)
+
+	// The creation time keeps names unique if two heads cover the same range.
+	name := fmt.Sprintf("%020d-%020d-%d", meta.MinT, meta.MaxT, time.Now().UnixNano())
+	final := filepath.Join(root, blocksDir, name)
+	tmp := final + ".tmp"
+
+	if err := os.RemoveAll(tmp); err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(tmp, 0o755); err != nil {
+		return nil, err
+	}
+
+	// Series are written in key order so blocks are reproducible.
+	keys := make([]string, 0, len(series))
+	for k := range series {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	buf := []byte(blockMagic)
+	buf = append(buf, blockVersion)
+
+	for _, k := range keys {
+		bs := series[k]
+
+		buf = binary.AppendUvarint(buf, uint64(len(k)))
+		buf = append(buf, k...)
+		buf = binary.AppendUvarint(buf, uint64(len(bs.service)))
+		buf = append(buf, bs.service...)
+		buf = binary.AppendUvarint(buf, uint64(len(bs.chunks)))
+		for _, c := range bs.chunks {
+			buf = c.appendTo(buf)
+		}
+	}
+	buf = binary.BigEndian.AppendUint32(buf, crc32.ChecksumIEEE(buf))
+
+	if err := writeFileSync(filepath.Join(tmp, chunksFile), buf); err != nil {
+		return nil, err
+	}
+
+	metaJSON, err := json.Marshal(meta)
+	if err != nil {
+		return nil, err
+	}
+	if err := writeFileSync(filepath.Join(tmp, metaFile), metaJSON); err != nil {
+		return nil, err
+	}
+
+	if err := os.Rename(tmp, final); err != nil {
+		return nil, err
+	}
+
+	return &block{dir: final, meta: meta}, nil
+}
+
+func writeFileSync(path string, data []byte) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// openBlocks loads the metadata of every complete block under root,
+// ordered by time. Leftover temporary directories are removed.
+func openBlocks(root string) ([]*block, error) {
+	dir := filepath.Join(root, blocksDir)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var blocks []*block
+	for _, e := range entries {
+		if !e.IsDir() {
+			continue
+		}
+
+		path := filepath.Join(dir, e.Name())
+		if strings.HasSuffix(e.Name(), ".tmp") {
+			os.RemoveAll(path)
+			continue
+		}
+
+		raw, err := os.ReadFile(filepath.Join(path, metaFile))
+		if err != nil {
+			return nil, fmt.Errorf("read block meta %s: %w", e.Name(), err)
+		}
+
+		b := &block{dir: path}
+		if err := json.Unmarshal(raw, &b.meta); err != nil {
+			return nil, fmt.Errorf("parse block meta %s: %w", e.Name(), err)
+		}
+		blocks = append(blocks, b)
+	}
+
+	// A crash during compaction may have left the blocks it replaced.
+	replaced := map[string]bool{}
+	for _, b := range blocks {
+		for _, p := range b.meta.Parents {
+			replaced[p] = true
+		}
+	}
+	kept := blocks[:0]
+	for _, b := range blocks {
+		if replaced[filepath.Base(b.dir)] {
+			os.RemoveAll(b.dir)
+			continue
+		}
+		kept = append(kept, b)
+	}
+	blocks = kept
+
+	sort.Slice(blocks, func(i, j int) bool { return blocks[i].meta.MinT < blocks[j].meta.MinT })
+	return blocks, nil
+}
+
+var errCorruptBlock = errors.New("tsdb: corrupt block")
+
+func readChunksFile(path string) (map[string]*blockSeries, error) {
+	buf, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(buf) < len(blockMagic)+1+4 || string(buf[:len(blockMagic)]) != blockMagic {
+		return nil, errCorruptBlock
+	}
+
+	body, sum := buf[:len(buf)-4], binary.BigEndian.Uint32(buf[len(buf)-4:])
+	if crc32.ChecksumIEEE(body) != sum {
+		return nil, fmt.Errorf("%w: checksum mismatch in %s", errCorruptBlock, path)
+	}
+	if body[len(blockMagic)] != blockVersion {
+		return nil, fmt.Errorf("%w: unsupported version %d", errCorruptBlock, body[len(blockMagic)])
+	}
+
+	p := body[len(blockMagic)+1:]
+
+	readUvarint := func() (uint64, error) {
+		v, n := binary.Uvarint(p)
+		if n <= 0 {
+			return 0, errCorruptBlock
+		}
+		p = p[n:]
+		return v, nil
+	}
+	readString := func() (string, error) {
+		n, err := readUvarint()
+		if err != nil || uint64(len(p)) < n {
+			return "", errCorruptBlock
+		}
+		s := string(p[:n])
+		p = p[n:]
+		return s, nil
+	}
+
+	series := make(map[string]*blockSeries)
+	for len(p) > 0 {
+		key, err := readString()
+		if err != nil {
+			return nil, err
+		}
+		service, err := readString()
+		if err != nil {
+			return nil, err
+		}
+		n, err := readUvarint()
+		if err != nil {
+			return nil, err
+		}
+
+		bs := &blockSeries{service: service, chunks: make([]encodedChunk, 0, n)}
+		for i := uint64(0); i < n; i++ {
+			var c encodedChunk
+			c, p, err = readEncodedChunk(p)
+			if err != nil {
+				return nil, err
+			}
+			bs.chunks = append(bs.chunks, c)
+		}
+		series[key] = bs
+	}
+
+	return series, nil
+}
@@ -0,0 +1,82 @@
+package tsdb
+
+import (
+	"errors"
+)
+
+// -------------------- BIT STREAM --------------------
+
+// errEndOfStream is returned when a reader runs past the written bits.
+var errEndOfStream = errors.New("tsdb: end of bit stream")
+
+// bstream is an append-only bit buffer. count is the number of bits still
+// free in the last byte of stream.
+type bstream struct {
+	stream []byte
+	count  uint8
+}
+
+func (b *bstream) bytes() []byte {
+	return b.stream
+}
+
+func (b *bstream) writeBit(bit bool) {
+	if b.count == 0 {
+		b.stream = append(b.stream, 0)
+		b.count = 8
+	}
+
+	if bit {
+		b.stream[len(b.stream)-1] |= 1 << (b.count - 1)
+	}
+	b.count--
+}
+
+// writeBits writes the nbits lowest bits of u, most significant first.
+func (b *bstream) writeBits(u uint64, nbits int) {
+	for nbits > 0 {
+		nbits--
+		b.writeBit((u>>uint(nbits))&1 == 1)
+	}
+}
+
+// bstreamReader reads bits back from a byte slice produced by bstream.
+type bstreamReader struct {
+	stream []byte
+	pos    int // index of the current byte
+	bit    uint8
+}
+
+func newBReader(b []byte) *bstreamReader {
+	return &bstreamReader{stream: b}
+}
+
+func (r *bstreamReader) readBit() (bool, error) {
+	if r.pos >= len(r.stream) {
+		return false, errEndOfStream
+	}
+
+	bit := r.stream[r.pos]&(0x80>>r.bit) != 0
+
+	r.bit++
+	if r.bit == 8 {
+		r.bit = 0
+		r.pos++
+	}
+	return bit, nil
+}
+
+func (r *bstreamReader) readBits(nbits int) (uint64, error) {
+	var u uint64
+	for i := 0; i < nbits; i++ {
+		bit, err := r.readBit()
+		if err != nil {
+			return 0, err
+		}
+		u <<= 1
+		if bit {
+			u |= 1
+		}
+	}
+	return u, nil
+}
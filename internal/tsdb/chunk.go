@@ -0,0 +1,313 @@
+package tsdb
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"math/bits"
+)
+
+// -------------------- GORILLA CHUNK --------------------
+
+// maxSamplesPerChunk caps a chunk so decoding stays cheap and the head can
+// hand off full chunks as immutable byte slices.
+const maxSamplesPerChunk = 120
+
+// chunk stores samples of one series using the Gorilla encoding:
+//   - timestamps as delta-of-delta with variable-width buckets
+//   - values as the XOR with the previous value, reusing the previous
+//     leading/trailing zero window when it fits
+//
+// The first sample is stored verbatim (64-bit timestamp, 64-bit value).
+type chunk struct {
+	b    bstream
+	num  uint16
+	minT int64
+	maxT int64
+
+	// Appender state: last sample, last timestamp delta, last XOR window.
+	t        int64
+	v        float64
+	tDelta   int64
+	leading  uint8
+	trailing uint8
+}
+
+// Point is a single decoded sample.
+type Point struct {
+	T int64
+	V float64
+}
+
+func newChunk() *chunk {
+	return &chunk{leading: 0xff}
+}
+
+func (c *chunk) full() bool {
+	return c.num >= maxSamplesPerChunk
+}
+
+// append adds a sample. Timestamps must not go backwards.
+func (c *chunk) append(t int64, v float64) {
+	switch c.num {
+	case 0:
+		c.b.writeBits(uint64(t), 64)
+		c.b.writeBits(math.Float64bits(v), 64)
+		c.minT = t
+
+	default:
+		tDelta := t - c.t
+		c.writeDoD(tDelta - c.tDelta)
+		c.writeXOR(v)
+		c.tDelta = tDelta
+	}
+
+	c.t, c.v = t, v
+	c.maxT = t
+	c.num++
+}
+
+// writeDoD encodes a delta-of-delta using the Gorilla prefix buckets.
+func (c *chunk) writeDoD(dod int64) {
+	switch {
+	case dod == 0:
+		c.b.writeBit(false)
+	case bitRange(dod, 7):
+		c.b.writeBits(0b10, 2)
+		c.b.writeBits(uint64(dod), 7)
+	case bitRange(dod, 9):
+		c.b.writeBits(0b110, 3)
+		c.b.writeBits(uint64(dod), 9)
+	case bitRange(dod, 12):
+		c.b.writeBits(0b1110, 4)
+		c.b.writeBits(uint64(dod), 12)
+	default:
+		c.b.writeBits(0b1111, 4)
+		c.b.writeBits(uint64(dod), 64)
+	}
+}
+
+// writeXOR encodes v against the previous value.
+func (c *chunk) writeXOR(v float64) {
+	delta := math.Float64bits(v) ^ math.Float64bits(c.v)
+
+	if delta == 0 {
+		c.b.writeBit(false)
+		return
+	}
+	c.b.writeBit(true)
+
+	leading := uint8(bits.LeadingZeros64(delta))
+	trailing := uint8(bits.TrailingZeros64(delta))
+
+	// Leading zeros are stored in 5 bits.
+	if leading >= 32 {
+		leading = 31
+	}
+
+	if c.leading != 0xff && leading >= c.leading && trailing >= c.trailing {
+		// Meaningful bits fit in the previous window.
+		c.b.writeBit(false)
+		c.b.writeBits(delta>>c.trailing, int(64-c.leading-c.trailing))
+		return
+	}
+
+	c.leading, c.trailing = leading, trailing
+
+	sigbits := 64 - leading - trailing
+	c.b.writeBit(true)
+	c.b.writeBits(uint64(leading), 5)
+	// 64 significant bits does not fit in 6 bits; 0 stands for 64.
+	c.b.writeBits(uint64(sigbits), 6)
+	c.b.writeBits(delta>>trailing, int(sigbits))
+}
+
+// bitRange reports whether x fits in an nbits-wide signed bucket.
+func bitRange(x int64, nbits uint8) bool {
+	return -((1<<(nbits-1))-1) <= x && x <= 1<<(nbits-1)
+}
+
+// -------------------- DECODING --------------------
+
+// decodeChunk returns all samples stored in an encoded chunk.
+func decodeChunk(data []byte, num uint16) ([]Point, error) {
+	points := make([]Point, 0, num)
+	if num == 0 {
+		return points, nil
+	}
+
+	r := newBReader(data)
+
+	tBits, err := r.readBits(64)
+	if err != nil {
+		return nil, err
+	}
+	vBits, err := r.readBits(64)
+	if err != nil {
+		return nil, err
+	}
+
+	t, v := int64(tBits), math.Float64frombits(vBits)
+	points = append(points, Point{T: t, V: v})
+
+	var (
+		tDelta   int64
+		leading  uint8
+		trailing uint8
+	)
+
+	for i := uint16(1); i < num; i++ {
+		dod, err := readDoD(r)
+		if err != nil {
+			return nil, err
+		}
+		tDelta += dod
+		t += tDelta
+
+		v, leading, trailing, err = readXOR(r, v, leading, trailing)
+		if err != nil {
+			return nil, err
+		}
+
+		points = append(points, Point{T: t, V: v})
+	}
+
+	return points, nil
+}
+
+func readDoD(r *bstreamReader) (int64, error) {
+	// Count leading 1 bits of the prefix (at most 4).
+	var prefix int
+	for prefix < 4 {
+		bit, err := r.readBit()
+		if err != nil {
+			return 0, err
+		}
+		if !bit {
+			break
+		}
+		prefix++
+	}
+
+	var nbits int
+	switch prefix {
+	case 0:
+		return 0, nil
+	case 1:
+		nbits = 7
+	case 2:
+		nbits = 9
+	case 3:
+		nbits = 12
+	case 4:
+		u, err := r.readBits(64)
+		return int64(u), err
+	}
+
+	u, err := r.readBits(nbits)
+	if err != nil {
+		return 0, err
+	}
+
+	// Sign-extend the nbits-wide value.
+	if u > 1<<(nbits-1) {
+		return int64(u) - 1<<nbits, nil
+	}
+	return int64(u), nil
+}
+
+func readXOR(r *bstreamReader, prev float64, leading, trailing uint8) (float64, uint8, uint8, error) {
+	bit, err := r.readBit()
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	if !bit {
+		return prev, leading, trailing, nil
+	}
+
+	newWindow, err := r.readBit()
+	if err != nil {
+		return 0, 0, 0, err
+	}
+
+	if newWindow {
+		l, err := r.readBits(5)
+		if err != nil {
+			return 0, 0, 0, err
+		}
+		sig, err := r.readBits(6)
+		if err != nil {
+			return 0, 0, 0, err
+		}
+		if sig == 0 {
+			sig = 64
+		}
+		leading = uint8(l)
+		trailing = 64 - leading - uint8(sig)
+	}
+
+	sigbits := int(64 - leading - trailing)
+	u, err := r.readBits(sigbits)
+	if err != nil {
+		return 0, 0, 0, err
+	}
+
+	vBits := math.Float64bits(prev) ^ (u << trailing)
+	return math.Float64frombits(vBits), leading, trailing, nil
+}
+
+// -------------------- SERIALIZATION --------------------
+
+// chunkHeaderSize is num (2) + minT (8) + maxT (8) + data length (4).
+const chunkHeaderSize = 22
+
+var errCorruptChunk = errors.New("tsdb: corrupt chunk")
+
+// encodedChunk is an immutable chunk as stored in a block.
+type encodedChunk struct {
+	num  uint16
+	minT int64
+	maxT int64
+	data []byte
+}
+
+func (c *chunk) encoded() encodedChunk {
+	data := make([]byte, len(c.b.bytes()))
+	copy(data, c.b.bytes())
+	return encodedChunk{num: c.num, minT: c.minT, maxT: c.maxT, data: data}
+}
+
+func (e encodedChunk) points() ([]Point, error) {
+	return decodeChunk(e.data, e.num)
+}
+
+func (e encodedChunk) appendTo(buf []byte) []byte {
+	buf = binary.BigEndian.AppendUint16(buf, e.num)
+	buf = binary.BigEndian.AppendUint64(buf, uint64(e.minT))
+	buf = binary.BigEndian.AppendUint64(buf, uint64(e.maxT))
+	buf = binary.BigEndian.AppendUint32(buf, uint32(len(e.data)))
+	return append(buf, e.data...)
+}
+
+// readEncodedChunk parses one chunk from buf and returns the remainder.
+func readEncodedChunk(buf []byte) (encodedChunk, []byte, error) {
+	if len(buf) < chunkHeaderSize {
+		return encodedChunk{}, nil, errCorruptChunk
+	}
+
+	e := encodedChunk{
+		num:  binary.BigEndian.Uint16(buf[0:2]),
+		minT: int64(binary.BigEndian.Uint64(buf[2:10])),
+		maxT: int64(binary.BigEndian.Uint64(buf[10:18])),
+	}
+	size := int(binary.BigEndian.Uint32(buf[18:22]))
+	buf = buf[chunkHeaderSize:]
+
+	if len(buf) < size {
+		return encodedChunk{}, nil, fmt.Errorf("%w: want %d bytes, have %d", errCorruptChunk, size, len(buf))
+	}
+
+	e.data = buf[:size:size]
+	return e, buf[size:], nil
+}
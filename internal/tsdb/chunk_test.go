@@ -0,0 +1,88 @@
+package tsdb
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+)
+
+func TestChunkRoundTrip(t *testing.T) {
+
+	// --------------------------------------------------------
+	// Mix of regular intervals, jitter, large gaps, repeated
+	// values and special floats to hit every encoding bucket.
+	// --------------------------------------------------------
+	rng := rand.New(rand.NewSource(1))
+
+	var want []Point
+	ts := int64(1_700_000_000)
+	v := 50.0
+	for i := 0; i < maxSamplesPerChunk; i++ {
+		switch {
+		case i%40 == 39:
+			ts += 100_000 // 64-bit delta-of-delta
+		case i%10 == 9:
+			ts += int64(rng.Intn(2000)) // wider buckets
+		default:
+			ts++ // steady 1s interval
+		}
+
+		switch i % 7 {
+		case 0:
+			// repeat previous value (XOR == 0)
+		case 1:
+			v = math.Inf(1)
+		case 2:
+			v = -0.0
+		default:
+			v = rng.Float64() * 100
+		}
+		want = append(want, Point{T: ts, V: v})
+	}
+
+	c := newChunk()
+	for _, p := range want {
+		c.append(p.T, p.V)
+	}
+
+	got, err := c.encoded().points()
+	if err != nil {
+		t.Fatalf("decode failed: %v", err)
+	}
+	if len(got) != len(want) {
+		t.Fatalf("expected %d points; got %d", len(want), len(got))
+	}
+	for i := range want {
+		if got[i].T != want[i].T || math.Float64bits(got[i].V) != math.Float64bits(want[i].V) {
+			t.Fatalf("point %d: expected %+v; got %+v", i, want[i], got[i])
+		}
+	}
+}
+
+func TestChunkCompression(t *testing.T) {
+	c := newChunk()
+	for i := 0; i < maxSamplesPerChunk; i++ {
+		c.append(int64(1_700_000_000+i), 42.5)
+	}
+
+	// A steady series of constant values costs ~2 bits per sample
+	// after the first one, far below 16 raw bytes per sample.
+	if size := len(c.b.bytes()); size > 64 {
+		t.Errorf("expected steady series to compress below 64 bytes; got %d", size)
+	}
+}
+
+func TestDoDBuckets(t *testing.T) {
+	for _, dod := range []int64{0, 1, -1, 64, -63, 65, 256, -255, 257, 2048, -2047, 2049, math.MaxInt32, math.MinInt32} {
+		c := newChunk()
+		c.writeDoD(dod)
+
+		got, err := readDoD(newBReader(c.b.bytes()))
+		if err != nil {
+			t.Fatalf("dod %d: %v", dod, err)
+		}
+		if got != dod {
+			t.Errorf("dod: expected %d; got %d", dod, got)
+		}
+	}
+}
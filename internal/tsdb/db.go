@@ -0,0 +1,424 @@
+// Package tsdb is a small embedded time-series engine for single-node
+// GoWatch deployments.
+//
+// Writes go to a write-ahead log and an in-memory head block whose series
+// are Gorilla-compressed (delta-of-delta timestamps, XOR floats). Once the
+// head spans BlockDuration it is flushed to an immutable block on disk and
+// the WAL is reset. Blocks are compacted into one per CompactionRange and
+// deleted after Retention. Reads merge blocks and the head for a time range.
+package tsdb
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+const walFile = "wal"
+
+// Options tunes the engine. Zero values fall back to the defaults.
+type Options struct {
+	// BlockDuration is the head time span after which it is flushed to disk.
+	BlockDuration time.Duration // default 2h
+	// FlushInterval is how often the head is checked for flushing.
+	FlushInterval time.Duration // default 1m
+	// CompactionRange is the aligned time range whose blocks are merged into
+	// one once the head has moved past it.
+	CompactionRange time.Duration // default 24h
+	// Retention is how long blocks are kept after their newest sample.
+	Retention time.Duration // default 30 days
+	// OutOfOrderWindow is how far behind the newest sample of its series a
+	// sample is still accepted: batches written concurrently can arrive
+	// slightly out of order.
+	OutOfOrderWindow time.Duration // default 5m
+}
+
+func (o Options) withDefaults() Options {
+	if o.BlockDuration <= 0 {
+		o.BlockDuration = 2 * time.Hour
+	}
+	if o.FlushInterval <= 0 {
+		o.FlushInterval = time.Minute
+	}
+	if o.CompactionRange <= 0 {
+		o.CompactionRange = 24 * time.Hour
+	}
+	if o.Retention <= 0 {
+		o.Retention = 30 * 24 * time.Hour
+	}
+	if o.OutOfOrderWindow <= 0 {
+		o.OutOfOrderWindow = 5 * time.Minute
+	}
+	return o
+}
+
+// DB is an open time-series database rooted at a directory.
+type DB struct {
+	dir  string
+	opts Options
+
+	mtx    sync.RWMutex
+	head   *head
+	wal    *wal
+	blocks []*block
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// Open opens (or creates) a database in dir, replays the WAL into a fresh
+// head and starts the background flush loop.
+func Open(dir string, opts Options) (*DB, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("tsdb: create dir: %w", err)
+	}
+
+	blocks, err := openBlocks(dir)
+	if err != nil {
+		return nil, fmt.Errorf("tsdb: open blocks: %w", err)
+	}
+
+	var lastGen uint64
+	for _, b := range blocks {
+		lastGen = max(lastGen, b.meta.WALGen)
+	}
+
+	w, err := openWAL(filepath.Join(dir, walFile), lastGen+1)
+	if err != nil {
+		return nil, fmt.Errorf("tsdb: %w", err)
+	}
+
+	db := &DB{
+		dir:    dir,
+		opts:   opts.withDefaults(),
+		head:   newHead(),
+		wal:    w,
+		blocks: blocks,
+		stop:   make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+
+	if w.gen != 0 && w.gen <= lastGen {
+		// The WAL was flushed to a block but not reset before a crash.
+		err = w.reset(lastGen + 1)
+	} else {
+		err = w.replay(func(samples []Sample) {
+			for _, s := range samples {
+				// Only samples the head accepted were logged.
+				_ = db.head.append(s)
+			}
+		})
+	}
+	if err != nil {
+		w.close()
+		return nil, fmt.Errorf("tsdb: replay wal: %w", err)
+	}
+
+	go db.run()
+
+	return db, nil
+}
+
+// Append logs the samples to the WAL and adds them to the head. Samples
+// older than the newest one of their series are put in order within
+// Options.OutOfOrderWindow; older ones are skipped before they reach the WAL
+// and reported as ErrOutOfOrderSample after the rest are stored.
+func (db *DB) Append(samples []Sample) error {
+	if len(samples) == 0 {
+		return nil
+	}
+
+	db.mtx.Lock()
+	defer db.mtx.Unlock()
+
+	window := int64(db.opts.OutOfOrderWindow / time.Second)
+	accepted := make([]Sample, 0, len(samples))
+	for _, s := range samples {
+		if db.head.accepts(s, window) {
+			accepted = append(accepted, s)
+		}
+	}
+	outOfOrder := len(samples) - len(accepted)
+
+	if len(accepted) > 0 {
+		if err := db.wal.log(accepted); err != nil {
+			return err
+		}
+	}
+	for _, s := range accepted {
+		if err := db.head.append(s); err != nil {
+			outOfOrder++
+		}
+	}
+
+	if outOfOrder > 0 {
+		return fmt.Errorf("%w: %d of %d samples dropped", ErrOutOfOrderSample, outOfOrder, len(samples))
+	}
+	return nil
+}
+
+// Select returns the points of one series in [mint, maxt), oldest first.
+func (db *DB) Select(agent, metric string, mint, maxt int64) ([]Point, error) {
+	key := seriesKey(agent, metric)
+
+	db.mtx.RLock()
+	defer db.mtx.RUnlock()
+
+	var out []Point
+	for _, b := range db.blocks {
+		if !b.overlaps(mint, maxt) {
+			continue
+		}
+		points, err := b.selectPoints(key, mint, maxt)
+		if err != nil {
+			return nil, fmt.Errorf("tsdb: read block %s: %w", filepath.Base(b.dir), err)
+		}
+		out = append(out, points...)
+	}
+
+	points, err := db.head.selectPoints(key, mint, maxt)
+	if err != nil {
+		return nil, fmt.Errorf("tsdb: read head: %w", err)
+	}
+	out = append(out, points...)
+
+	// Blocks and head only overlap if agents sent samples late.
+	sort.SliceStable(out, func(i, j int) bool { return out[i].T < out[j].T })
+	return out, nil
+}
+
+// SeriesRef identifies a series and the service that reported it.
+type SeriesRef struct {
+	Agent   string
+	Metric  string
+	Service string
+}
+
+// Series lists the series of the blocks and head overlapping [mint, maxt),
+// sorted by agent and metric.
+func (db *DB) Series(mint, maxt int64) ([]SeriesRef, error) {
+	db.mtx.RLock()
+	defer db.mtx.RUnlock()
+
+	services := map[string]string{} // key → service
+	for _, b := range db.blocks {
+		if !b.overlaps(mint, maxt) {
+			continue
+		}
+		if err := b.load(); err != nil {
+			return nil, fmt.Errorf("tsdb: read block %s: %w", filepath.Base(b.dir), err)
+		}
+		for k, bs := range b.series {
+			services[k] = bs.service
+		}
+	}
+	if !db.head.empty() && db.head.maxT >= mint && db.head.minT < maxt {
+		for k, ms := range db.head.series {
+			services[k] = ms.service
+		}
+	}
+
+	out := make([]SeriesRef, 0, len(services))
+	for k, service := range services {
+		agent, metric := splitKey(k)
+		out = append(out, SeriesRef{Agent: agent, Metric: metric, Service: service})
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Agent != out[j].Agent {
+			return out[i].Agent < out[j].Agent
+		}
+		return out[i].Metric < out[j].Metric
+	})
+	return out, nil
+}
+
+// Flush writes the head to a new immutable block and resets the WAL.
+func (db *DB) Flush() error {
+	db.mtx.Lock()
+	defer db.mtx.Unlock()
+
+	return db.flushLocked()
+}
+
+func (db *DB) flushLocked() error {
+	if db.head.empty() {
+		return nil
+	}
+
+	meta := BlockMeta{MinT: db.head.minT, MaxT: db.head.maxT, NumSamples: db.head.samples, WALGen: db.wal.gen}
+	b, err := writeBlock(db.dir, meta, headSeries(db.head))
+	if err != nil {
+		return fmt.Errorf("tsdb: write block: %w", err)
+	}
+
+	// The block is durable; the WAL contents are no longer needed.
+	if err := db.wal.reset(db.wal.gen + 1); err != nil {
+		return fmt.Errorf("tsdb: %w", err)
+	}
+
+	db.blocks = append(db.blocks, b)
+	db.head = newHead()
+	return nil
+}
+
+// Blocks returns the metadata of all flushed blocks, oldest first.
+func (db *DB) Blocks() []BlockMeta {
+	db.mtx.RLock()
+	defer db.mtx.RUnlock()
+
+	metas := make([]BlockMeta, 0, len(db.blocks))
+	for _, b := range db.blocks {
+		metas = append(metas, b.meta)
+	}
+	return metas
+}
+
+// Compact merges the blocks of every CompactionRange the head has moved
+// past into one block per range, and deletes the blocks older than
+// Retention.
+func (db *DB) Compact() error {
+	db.mtx.Lock()
+	defer db.mtx.Unlock()
+
+	return db.compactLocked(time.Now())
+}
+
+func (db *DB) compactLocked(now time.Time) error {
+	// Retention
+	cutoff := now.Add(-db.opts.Retention).Unix()
+	kept := db.blocks[:0]
+	for _, b := range db.blocks {
+		if b.meta.MaxT < cutoff {
+			if err := os.RemoveAll(b.dir); err != nil {
+				return fmt.Errorf("tsdb: delete block: %w", err)
+			}
+			continue
+		}
+		kept = append(kept, b)
+	}
+	db.blocks = kept
+
+	// Compaction: group the blocks by the range they fall into; only
+	// ranges the head has moved past receive no more blocks.
+	span := int64(db.opts.CompactionRange / time.Second)
+	done := now.Unix()
+	if !db.head.empty() {
+		done = db.head.minT
+	}
+
+	groups := map[int64][]*block{}
+	for _, b := range db.blocks {
+		start := b.meta.MinT / span * span
+		if b.meta.MaxT < start+span && start+span <= done {
+			groups[start] = append(groups[start], b)
+		}
+	}
+
+	for _, group := range groups {
+		if len(group) < 2 {
+			continue
+		}
+		if err := db.merge(group); err != nil {
+			return fmt.Errorf("tsdb: compact: %w", err)
+		}
+	}
+	return nil
+}
+
+// merge replaces blocks, sorted by time, with a single block.
+func (db *DB) merge(blocks []*block) error {
+	meta := BlockMeta{MinT: blocks[0].meta.MinT, MaxT: blocks[0].meta.MaxT}
+	series := map[string]*blockSeries{}
+
+	for _, b := range blocks {
+		if err := b.load(); err != nil {
+			return err
+		}
+		for k, bs := range b.series {
+			merged, ok := series[k]
+			if !ok {
+				merged = &blockSeries{}
+				series[k] = merged
+			}
+			merged.service = bs.service
+			merged.chunks = append(merged.chunks, bs.chunks...)
+		}
+
+		meta.MinT = min(meta.MinT, b.meta.MinT)
+		meta.MaxT = max(meta.MaxT, b.meta.MaxT)
+		meta.NumSamples += b.meta.NumSamples
+		meta.WALGen = max(meta.WALGen, b.meta.WALGen)
+		meta.Parents = append(meta.Parents, filepath.Base(b.dir))
+	}
+
+	merged, err := writeBlock(db.dir, meta, series)
+	if err != nil {
+		return err
+	}
+
+	// The merged block is durable and names its parents, so a crash here
+	// removes them on the next open.
+	replaced := map[*block]bool{}
+	for _, b := range blocks {
+		replaced[b] = true
+		if err := os.RemoveAll(b.dir); err != nil {
+			return err
+		}
+	}
+
+	kept := []*block{merged}
+	for _, b := range db.blocks {
+		if !replaced[b] {
+			kept = append(kept, b)
+		}
+	}
+	sort.Slice(kept, func(i, j int) bool { return kept[i].meta.MinT < kept[j].meta.MinT })
+	db.blocks = kept
+	return nil
+}
+
+// run flushes the head whenever it spans at least BlockDuration, then
+// compacts and expires blocks.
+func (db *DB) run() {
+	defer close(db.done)
+
+	ticker := time.NewTicker(db.opts.FlushInterval)
+	defer ticker.Stop()
+
+	span := int64(db.opts.BlockDuration / time.Second)
+
+	for {
+		select {
+		case <-db.stop:
+			return
+		case <-ticker.C:
+		}
+
+		db.mtx.Lock()
+		if !db.head.empty() && db.head.maxT-db.head.minT >= span {
+			if err := db.flushLocked(); err != nil {
+				log.Printf("tsdb flush: %v", err)
+			}
+		}
+		if err := db.compactLocked(time.Now()); err != nil {
+			log.Printf("tsdb: %v", err)
+		}
+		db.mtx.Unlock()
+	}
+}
+
+// Close stops the flush loop and syncs the WAL. The head is not flushed;
+// it is rebuilt from the WAL on the next Open.
+func (db *DB) Close() error {
+	close(db.stop)
+	<-db.done
+
+	db.mtx.Lock()
+	defer db.mtx.Unlock()
+
+	return db.wal.close()
+}
@@ -0,0 +1,253 @@
+package tsdb
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func series(agent, metric string, from, n int64) []Sample {
+	var out []Sample
+	for i := int64(0); i < n; i++ {
+		out = append(out, Sample{Agent: agent, Metric: metric, Service: "svc", T: from + i, V: float64(i)})
+	}
+	return out
+}
+
+func TestDB(t *testing.T) {
+	dir := t.TempDir()
+
+	db, err := Open(dir, Options{})
+	if err != nil {
+		t.Fatalf("open failed: %v", err)
+	}
+
+	t.Run("AppendAndSelect", func(t *testing.T) {
+		if err := db.Append(series("a1", "cpu", 1000, 500)); err != nil {
+			t.Fatalf("append failed: %v", err)
+		}
+		if err := db.Append(series("a2", "cpu", 1000, 10)); err != nil {
+			t.Fatalf("append failed: %v", err)
+		}
+
+		points, err := db.Select("a1", "cpu", 1100, 1200)
+		if err != nil {
+			t.Fatalf("select failed: %v", err)
+		}
+		if len(points) != 100 || points[0].T != 1100 || points[99].V != 199 {
+			t.Fatalf("unexpected points: %d", len(points))
+		}
+	})
+
+	t.Run("OutOfOrder", func(t *testing.T) {
+		err := db.Append([]Sample{{Agent: "a1", Metric: "cpu", T: 1, V: 1}})
+		if err == nil {
+			t.Fatalf("expected out of order error")
+		}
+	})
+
+	t.Run("FlushToBlock", func(t *testing.T) {
+		if err := db.Flush(); err != nil {
+			t.Fatalf("flush failed: %v", err)
+		}
+		if len(db.Blocks()) != 1 {
+			t.Fatalf("expected 1 block; got %d", len(db.Blocks()))
+		}
+		if err := db.Append(series("a1", "cpu", 1500, 100)); err != nil {
+			t.Fatalf("append failed: %v", err)
+		}
+
+		// Range spans the block and the head.
+		points, err := db.Select("a1", "cpu", 1400, 1600)
+		if err != nil {
+			t.Fatalf("select failed: %v", err)
+		}
+		if len(points) != 200 {
+			t.Fatalf("expected 200 points; got %d", len(points))
+		}
+	})
+
+	t.Run("Series", func(t *testing.T) {
+		refs, err := db.Series(0, 10_000)
+		if err != nil {
+			t.Fatalf("series failed: %v", err)
+		}
+		if len(refs) != 2 || refs[0] != (SeriesRef{Agent: "a1", Metric: "cpu", Service: "svc"}) || refs[1].Agent != "a2" {
+			t.Fatalf("unexpected series: %v", refs)
+		}
+
+		refs, err = db.Series(5000, 6000)
+		if err != nil || len(refs) != 0 {
+			t.Fatalf("expected no series outside the data; got %v (%v)", refs, err)
+		}
+	})
+
+	t.Run("ReopenReplaysWAL", func(t *testing.T) {
+		if err := db.Close(); err != nil {
+			t.Fatalf("close failed: %v", err)
+		}
+
+		// Simulate a torn write at the end of the WAL.
+		f, err := os.OpenFile(filepath.Join(dir, walFile), os.O_APPEND|os.O_WRONLY, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		f.Write([]byte{0x20, 0x01, 0x02})
+		f.Close()
+
+		db, err = Open(dir, Options{})
+		if err != nil {
+			t.Fatalf("reopen failed: %v", err)
+		}
+		defer db.Close()
+
+		points, err := db.Select("a1", "cpu", 0, 10_000)
+		if err != nil {
+			t.Fatalf("select failed: %v", err)
+		}
+		if len(points) != 600 {
+			t.Fatalf("expected 600 points after reopen; got %d", len(points))
+		}
+	})
+}
+
+func TestFlushedWALNotReplayed(t *testing.T) {
+	dir := t.TempDir()
+
+	db, err := Open(dir, Options{})
+	if err != nil {
+		t.Fatalf("open failed: %v", err)
+	}
+	if err := db.Append(series("a1", "cpu", 1000, 100)); err != nil {
+		t.Fatalf("append failed: %v", err)
+	}
+
+	// Crash after the block is written but before the WAL is reset.
+	meta := BlockMeta{MinT: db.head.minT, MaxT: db.head.maxT, NumSamples: db.head.samples, WALGen: db.wal.gen}
+	if _, err := writeBlock(dir, meta, headSeries(db.head)); err != nil {
+		t.Fatalf("write block failed: %v", err)
+	}
+	if err := db.Close(); err != nil {
+		t.Fatalf("close failed: %v", err)
+	}
+
+	db, err = Open(dir, Options{})
+	if err != nil {
+		t.Fatalf("reopen failed: %v", err)
+	}
+	defer db.Close()
+
+	points, err := db.Select("a1", "cpu", 0, 10_000)
+	if err != nil {
+		t.Fatalf("select failed: %v", err)
+	}
+	if len(points) != 100 {
+		t.Fatalf("expected 100 points without duplicates; got %d", len(points))
+	}
+}
+
+func TestCompactAndRetention(t *testing.T) {
+	dir := t.TempDir()
+
+	db, err := Open(dir, Options{CompactionRange: time.Hour, Retention: 24 * time.Hour})
+	if err != nil {
+		t.Fatalf("open failed: %v", err)
+	}
+	defer db.Close()
+
+	now := time.Unix(100_000, 0)
+	old := now.Add(-48 * time.Hour).Unix()
+	for _, from := range []int64{old, 90_000, 90_600, 91_200, 97_200} {
+		if err := db.Append(series("a1", "cpu", from, 10)); err != nil {
+			t.Fatalf("append failed: %v", err)
+		}
+		if err := db.Flush(); err != nil {
+			t.Fatalf("flush failed: %v", err)
+		}
+	}
+
+	db.mtx.Lock()
+	err = db.compactLocked(now)
+	db.mtx.Unlock()
+	if err != nil {
+		t.Fatalf("compact failed: %v", err)
+	}
+
+	// The expired block is gone and the three blocks of [90000, 93600) are one;
+	// the range of the last block is not over yet.
+	blocks := db.Blocks()
+	if len(blocks) != 2 || blocks[0].NumSamples != 30 || blocks[1].NumSamples != 10 {
+		t.Fatalf("unexpected blocks: %+v", blocks)
+	}
+
+	points, err := db.Select("a1", "cpu", 0, 200_000)
+	if err != nil {
+		t.Fatalf("select failed: %v", err)
+	}
+	if len(points) != 40 {
+		t.Fatalf("expected 40 points; got %d", len(points))
+	}
+
+	// The replaced block directories are removed.
+	entries, _ := os.ReadDir(filepath.Join(dir, blocksDir))
+	if len(entries) != 2 {
+		t.Fatalf("expected 2 block directories; got %d", len(entries))
+	}
+}
+
+func TestOutOfOrderWindow(t *testing.T) {
+	dir := t.TempDir()
+
+	db, err := Open(dir, Options{OutOfOrderWindow: time.Minute})
+	if err != nil {
+		t.Fatalf("open failed: %v", err)
+	}
+
+	// 130 samples: the first 120 fill a chunk, the rest are in the open one.
+	if err := db.Append(series("a1", "cpu", 1000, 130)); err != nil {
+		t.Fatalf("append failed: %v", err)
+	}
+	if err := db.Append([]Sample{{Agent: "a1", Metric: "cpu", T: 1000 + 125, V: -1}}); err != nil {
+		t.Fatalf("expected a late sample within the window; got %v", err)
+	}
+	if err := db.Append([]Sample{{Agent: "a1", Metric: "cpu", T: 1000 + 115, V: -2}}); err != nil {
+		t.Fatalf("expected a late sample of the full chunk within the window; got %v", err)
+	}
+
+	// Samples beyond the window never reach the WAL.
+	info, _ := os.Stat(filepath.Join(dir, walFile))
+	if err := db.Append([]Sample{{Agent: "a1", Metric: "cpu", T: 1000, V: -3}}); err == nil {
+		t.Fatal("expected a sample beyond the window to be rejected")
+	}
+	if after, _ := os.Stat(filepath.Join(dir, walFile)); after.Size() != info.Size() {
+		t.Errorf("expected the rejected sample not to be logged")
+	}
+
+	check := func() {
+		t.Helper()
+		points, err := db.Select("a1", "cpu", 0, 10_000)
+		if err != nil {
+			t.Fatalf("select failed: %v", err)
+		}
+		if len(points) != 132 {
+			t.Fatalf("expected 132 points; got %d", len(points))
+		}
+		for i := 1; i < len(points); i++ {
+			if points[i].T < points[i-1].T {
+				t.Fatalf("points out of order at %d: %v", i, points[i-1:i+1])
+			}
+		}
+	}
+	check()
+
+	// The WAL replays the late samples into place.
+	if err := db.Close(); err != nil {
+		t.Fatalf("close failed: %v", err)
+	}
+	if db, err = Open(dir, Options{OutOfOrderWindow: time.Minute}); err != nil {
+		t.Fatalf("reopen failed: %v", err)
+	}
+	defer db.Close()
+	check()
+}
@@ -0,0 +1,203 @@
+package tsdb
+
+import (
+	"errors"
+	"math"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// -------------------- SAMPLES & SERIES --------------------
+
+// ErrOutOfOrderSample is returned for samples older than the newest sample
+// of the same series in the head by more than Options.OutOfOrderWindow.
+var ErrOutOfOrderSample = errors.New("tsdb: out of order sample")
+
+// Sample is one value of one series. A series is identified by agent and
+// metric; Service is carried along as the latest service name of the agent.
+// Timestamps are Unix seconds, as reported by agents.
+type Sample struct {
+	Agent   string
+	Metric  string
+	Service string
+	T       int64
+	V       float64
+}
+
+// keySep cannot appear in agent IDs or metric names sent by agents.
+const keySep = "\x00"
+
+func seriesKey(agent, metric string) string {
+	return agent + keySep + metric
+}
+
+func (s Sample) key() string {
+	return seriesKey(s.Agent, s.Metric)
+}
+
+func splitKey(key string) (agent, metric string) {
+	agent, metric, _ = strings.Cut(key, keySep)
+	return agent, metric
+}
+
+// memSeries is a series in the head: full chunks plus the open one.
+type memSeries struct {
+	service string
+	full    []encodedChunk
+	open    *chunk
+}
+
+// -------------------- HEAD BLOCK --------------------
+
+// head is the mutable in-memory block that receives all appends. It is
+// guarded by the DB mutex.
+type head struct {
+	series  map[string]*memSeries
+	minT    int64
+	maxT    int64
+	samples int
+}
+
+func newHead() *head {
+	return &head{
+		series: make(map[string]*memSeries),
+		minT:   math.MaxInt64,
+		maxT:   math.MinInt64,
+	}
+}
+
+func (h *head) empty() bool {
+	return h.samples == 0
+}
+
+func (h *head) append(s Sample) error {
+	ms, ok := h.series[s.key()]
+	if !ok {
+		ms = &memSeries{open: newChunk()}
+		h.series[s.key()] = ms
+	}
+
+	if ms.open.num > 0 && s.T < ms.open.t {
+		if err := ms.insert(s.T, s.V); err != nil {
+			return err
+		}
+		h.minT = min(h.minT, s.T)
+		h.samples++
+		return nil
+	}
+
+	if ms.open.full() {
+		ms.full = append(ms.full, ms.open.encoded())
+		ms.open = newChunk()
+	}
+
+	if s.Service != "" {
+		ms.service = s.Service
+	}
+	ms.open.append(s.T, s.V)
+
+	h.minT = min(h.minT, s.T)
+	h.maxT = max(h.maxT, s.T)
+	h.samples++
+	return nil
+}
+
+// accepts reports whether a sample can be appended: it is at most window
+// seconds older than the newest sample of its series, and not older than
+// the chunk before the open one.
+func (h *head) accepts(s Sample, window int64) bool {
+	ms, ok := h.series[s.key()]
+	if !ok || ms.open.num == 0 || s.T >= ms.open.t {
+		return true
+	}
+	return s.T >= ms.open.t-window && ms.insertable(s.T)
+}
+
+func (ms *memSeries) insertable(t int64) bool {
+	if t >= ms.open.minT {
+		return true
+	}
+	return len(ms.full) > 0 && t >= ms.full[len(ms.full)-1].minT
+}
+
+// insert adds a sample older than the newest one of the series by
+// re-encoding the open chunk, or the last full one, with it.
+func (ms *memSeries) insert(t int64, v float64) error {
+	if !ms.insertable(t) {
+		return ErrOutOfOrderSample
+	}
+
+	if t >= ms.open.minT {
+		c, err := withPoint(ms.open.encoded(), t, v)
+		if err != nil {
+			return err
+		}
+		ms.open = c
+		return nil
+	}
+
+	last := len(ms.full) - 1
+	c, err := withPoint(ms.full[last], t, v)
+	if err != nil {
+		return err
+	}
+	ms.full[last] = c.encoded()
+	return nil
+}
+
+// withPoint returns a chunk holding the points of e and (t, v), in order;
+// samples of equal timestamps keep their arrival order.
+func withPoint(e encodedChunk, t int64, v float64) (*chunk, error) {
+	points, err := e.points()
+	if err != nil {
+		return nil, err
+	}
+	i := sort.Search(len(points), func(i int) bool { return points[i].T > t })
+	points = slices.Insert(points, i, Point{T: t, V: v})
+
+	c := newChunk()
+	for _, p := range points {
+		c.append(p.T, p.V)
+	}
+	return c, nil
+}
+
+// chunks returns every chunk of a series, including a snapshot of the open one.
+func (ms *memSeries) chunks() []encodedChunk {
+	out := make([]encodedChunk, 0, len(ms.full)+1)
+	out = append(out, ms.full...)
+	if ms.open.num > 0 {
+		out = append(out, ms.open.encoded())
+	}
+	return out
+}
+
+// selectPoints decodes the points of one series inside [mint, maxt).
+func (h *head) selectPoints(key string, mint, maxt int64) ([]Point, error) {
+	ms, ok := h.series[key]
+	if !ok {
+		return nil, nil
+	}
+	return pointsInRange(ms.chunks(), mint, maxt)
+}
+
+// pointsInRange decodes only chunks overlapping [mint, maxt).
+func pointsInRange(chunks []encodedChunk, mint, maxt int64) ([]Point, error) {
+	var out []Point
+	for _, c := range chunks {
+		if c.maxT < mint || c.minT >= maxt {
+			continue
+		}
+		points, err := c.points()
+		if err != nil {
+			return nil, err
+		}
+		for _, p := range points {
+			if p.T >= mint && p.T < maxt {
+				out = append(out, p)
+			}
+		}
+	}
+	return out, nil
+}
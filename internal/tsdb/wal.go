@@ -0,0 +1,239 @@
+package tsdb
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"math"
+	"os"
+)
+
+// -------------------- WRITE-AHEAD LOG --------------------
+
+// The WAL is a single append-only file: a header, then records:
+//
+//	"GWWAL" | version | 8-byte generation
+//	uvarint payload length | payload | crc32 (IEEE) of payload
+//
+// Each payload is one Append batch:
+//
+//	uvarint count, then per sample:
+//	uvarint len + series key | uvarint len + service | varint t | 8-byte value
+//
+// Every batch is synced before Append returns. On open the WAL is replayed
+// into the head. A torn or corrupt tail (crash mid-write) ends the replay
+// and is truncated away.
+//
+// The generation grows with every reset. A block records the generation of
+// the WAL it was flushed from, so a WAL found next to its own block (crash
+// between the flush and the reset) is not replayed a second time.
+type wal struct {
+	f      *os.File
+	path   string
+	gen    uint64 // 0: a WAL written before generations
+	header int64  // bytes before the first record
+}
+
+const (
+	walMagic   = "GWWAL"
+	walVersion = 1
+	walHeader  = len(walMagic) + 1 + 8
+)
+
+// openWAL opens the WAL at path, starting it at generation gen if it is
+// new or empty.
+func openWAL(path string, gen uint64) (*wal, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("open wal: %w", err)
+	}
+	w := &wal{f: f, path: path}
+
+	buf := make([]byte, walHeader)
+	n, err := io.ReadFull(f, buf)
+	switch {
+	case n == 0:
+		if err := w.writeHeader(gen); err != nil {
+			f.Close()
+			return nil, err
+		}
+	case err == nil && string(buf[:len(walMagic)]) == walMagic && buf[len(walMagic)] == walVersion:
+		w.gen = binary.BigEndian.Uint64(buf[len(walMagic)+1:])
+		w.header = int64(walHeader)
+	default:
+		// Records from before the header existed: replayed from the start.
+	}
+	return w, nil
+}
+
+func (w *wal) writeHeader(gen uint64) error {
+	buf := []byte(walMagic)
+	buf = append(buf, walVersion)
+	buf = binary.BigEndian.AppendUint64(buf, gen)
+
+	if _, err := w.f.Write(buf); err != nil {
+		return fmt.Errorf("write wal: %w", err)
+	}
+	if err := w.f.Sync(); err != nil {
+		return fmt.Errorf("sync wal: %w", err)
+	}
+	w.gen = gen
+	w.header = int64(len(buf))
+	return nil
+}
+
+func (w *wal) log(samples []Sample) error {
+	var payload []byte
+	payload = binary.AppendUvarint(payload, uint64(len(samples)))
+
+	for _, s := range samples {
+		key := s.key()
+		payload = binary.AppendUvarint(payload, uint64(len(key)))
+		payload = append(payload, key...)
+		payload = binary.AppendUvarint(payload, uint64(len(s.Service)))
+		payload = append(payload, s.Service...)
+		payload = binary.AppendVarint(payload, s.T)
+		payload = binary.BigEndian.AppendUint64(payload, math.Float64bits(s.V))
+	}
+
+	rec := binary.AppendUvarint(nil, uint64(len(payload)))
+	rec = append(rec, payload...)
+	rec = binary.BigEndian.AppendUint32(rec, crc32.ChecksumIEEE(payload))
+
+	if _, err := w.f.Write(rec); err != nil {
+		return fmt.Errorf("write wal: %w", err)
+	}
+	if err := w.f.Sync(); err != nil {
+		return fmt.Errorf("sync wal: %w", err)
+	}
+	return nil
+}
+
+// replay calls fn for every intact batch and truncates a damaged tail.
+func (w *wal) replay(fn func([]Sample)) error {
+	if _, err := w.f.Seek(w.header, io.SeekStart); err != nil {
+		return fmt.Errorf("seek wal: %w", err)
+	}
+
+	r := bufio.NewReader(w.f)
+	good := w.header
+
+	for {
+		samples, n, err := readWALRecord(r)
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			// Torn write: drop everything after the last good record.
+			if terr := w.f.Truncate(good); terr != nil {
+				return fmt.Errorf("truncate wal: %w", terr)
+			}
+			return nil
+		}
+
+		fn(samples)
+		good += n
+	}
+}
+
+// readWALRecord decodes one record and returns its size in bytes.
+func readWALRecord(r *bufio.Reader) ([]Sample, int64, error) {
+	size, err := binary.ReadUvarint(r)
+	if err != nil {
+		return nil, 0, err
+	}
+	if size > 64<<20 {
+		return nil, 0, errCorruptChunk
+	}
+
+	payload := make([]byte, size)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return nil, 0, io.ErrUnexpectedEOF
+	}
+
+	var crc [4]byte
+	if _, err := io.ReadFull(r, crc[:]); err != nil {
+		return nil, 0, io.ErrUnexpectedEOF
+	}
+	if binary.BigEndian.Uint32(crc[:]) != crc32.ChecksumIEEE(payload) {
+		return nil, 0, errCorruptChunk
+	}
+
+	samples, err := decodeWALPayload(payload)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	total := int64(len(binary.AppendUvarint(nil, size))) + int64(size) + 4
+	return samples, total, nil
+}
+
+func decodeWALPayload(p []byte) ([]Sample, error) {
+	readUvarint := func() (uint64, error) {
+		v, n := binary.Uvarint(p)
+		if n <= 0 {
+			return 0, errCorruptChunk
+		}
+		p = p[n:]
+		return v, nil
+	}
+	readString := func() (string, error) {
+		n, err := readUvarint()
+		if err != nil || uint64(len(p)) < n {
+			return "", errCorruptChunk
+		}
+		s := string(p[:n])
+		p = p[n:]
+		return s, nil
+	}
+
+	count, err := readUvarint()
+	if err != nil {
+		return nil, err
+	}
+
+	samples := make([]Sample, 0, count)
+	for i := uint64(0); i < count; i++ {
+		key, err := readString()
+		if err != nil {
+			return nil, err
+		}
+		service, err := readString()
+		if err != nil {
+			return nil, err
+		}
+
+		t, n := binary.Varint(p)
+		if n <= 0 || len(p[n:]) < 8 {
+			return nil, errCorruptChunk
+		}
+		p = p[n:]
+		v := math.Float64frombits(binary.BigEndian.Uint64(p[:8]))
+		p = p[8:]
+
+		agent, metric := splitKey(key)
+		samples = append(samples, Sample{Agent: agent, Metric: metric, Service: service, T: t, V: v})
+	}
+
+	return samples, nil
+}
+
+// reset empties the WAL once its contents are persisted in a block and
+// starts generation gen.
+func (w *wal) reset(gen uint64) error {
+	if err := w.f.Truncate(0); err != nil {
+		return fmt.Errorf("truncate wal: %w", err)
+	}
+	return w.writeHeader(gen)
+}
+
+func (w *wal) close() error {
+	if err := w.f.Sync(); err != nil {
+		w.f.Close()
+		return err
+	}
+	return w.f.Close()
+}